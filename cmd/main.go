@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
+
 	"github.com/rs/zerolog"
 	"github.com/samber/do-template-worker/pkg"
 	"github.com/samber/do-template-worker/pkg/cli"
 	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/jobs"
+	"github.com/samber/do-template-worker/pkg/lifecycle"
+	"github.com/samber/do-template-worker/pkg/migrator"
 	"github.com/samber/do-template-worker/pkg/repositories"
 	"github.com/samber/do-template-worker/pkg/workers"
 	"github.com/samber/do/v2"
@@ -16,13 +22,16 @@ func main() {
 	injector := do.New(
 		pkg.BasePackage,
 		repositories.Package,
+		migrator.Package,
 		workers.WorkerPackage,
+		jobs.JobPackage,
 	)
 
 	// Get services from dependency injection container
 	appConfig := do.MustInvoke[*config.Config](injector)
-	appLogger := do.MustInvoke[zerolog.Logger](injector)
+	appLogger := do.MustInvoke[*zerolog.Logger](injector)
 	cliService := do.MustInvoke[*cli.CLI](injector)
+	shutdownManager := do.MustInvoke[*lifecycle.ShutdownManager](injector)
 
 	// Start the application
 	appLogger.Info().Str("app_name", appConfig.App.Name).
@@ -35,5 +44,12 @@ func main() {
 		appLogger.Fatal().Err(err).Msg("Failed to execute CLI")
 	}
 
-	_, _ = injector.ShutdownOnSignals()
+	// Long-running commands block until a signal is received, so the application
+	// can be shut down as soon as the command returns, see ShutdownManager.Stop.
+	// A service stuck in its shutdown can't hold the process past app.shutdown_timeout
+	if err := shutdownManager.Stop(context.Background(), injector); errors.Is(err, lifecycle.ErrShutdownTimeout) {
+		appLogger.Fatal().Err(err).Msg("Shutdown timed out, exiting with services still running")
+	} else if err != nil {
+		appLogger.Error().Err(err).Msg("Shutdown completed with errors")
+	}
 }
@@ -25,6 +25,9 @@ BEGIN
 END;
 $$ language 'plpgsql';
 
+-- Drop the trigger first, so that the migration can be applied again over the docker compose init scripts
+DROP TRIGGER IF EXISTS update_users_updated_at ON users;
+
 CREATE TRIGGER update_users_updated_at
     BEFORE UPDATE ON users
     FOR EACH ROW
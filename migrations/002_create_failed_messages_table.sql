@@ -0,0 +1,22 @@
+-- 002_create_failed_messages_table.sql
+-- Migration for creating the failed_messages table
+-- This migration creates the table used by the FailedMessageRepository to audit dead-lettered messages
+
+CREATE TABLE IF NOT EXISTS failed_messages (
+    id BIGSERIAL PRIMARY KEY,
+    message_id VARCHAR(255) NOT NULL,
+    action VARCHAR(255) NOT NULL,
+    body BYTEA NOT NULL,
+    error TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    failed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add index on message_id to look up the failures of a given message
+CREATE INDEX IF NOT EXISTS idx_failed_messages_message_id ON failed_messages(message_id);
+
+-- Add index on failed_at for time-based queries
+CREATE INDEX IF NOT EXISTS idx_failed_messages_failed_at ON failed_messages(failed_at);
+
+-- Add a comment to mark this migration as completed
+COMMENT ON TABLE failed_messages IS 'Dead-lettered messages audit log - created by migration 002';
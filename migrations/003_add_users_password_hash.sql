@@ -0,0 +1,9 @@
+-- 003_add_users_password_hash.sql
+-- Migration for adding the password_hash column to the users table
+-- This migration is only needed when password storage is enabled with user.password_hashing
+
+-- Nullable: users without a password can't log in with one
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+
+-- Add a comment to mark this migration as completed
+COMMENT ON COLUMN users.password_hash IS 'bcrypt or argon2id password hash - added by migration 003';
@@ -0,0 +1,18 @@
+-- 004_create_message_results_table.sql
+-- Migration for creating the message_results table
+-- This migration creates the table used by the MessageResultRepository when consumer.store_results is enabled
+
+CREATE TABLE IF NOT EXISTS message_results (
+    message_id VARCHAR(255) PRIMARY KEY,
+    action VARCHAR(255) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    result JSONB,
+    error TEXT,
+    processed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add index on processed_at for time-based queries and cleanup
+CREATE INDEX IF NOT EXISTS idx_message_results_processed_at ON message_results(processed_at);
+
+-- Add a comment to mark this migration as completed
+COMMENT ON TABLE message_results IS 'Outcome of processed messages, keyed by message ID - created by migration 004';
@@ -0,0 +1,17 @@
+-- 005_add_users_profile_columns.sql
+-- Migration for adding profile columns to the users table
+-- Existing rows get an empty first and last name and the active status
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS first_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(32) NOT NULL DEFAULT 'active';
+
+-- Restrict status to the values known by the UserRepository
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users ADD CONSTRAINT users_status_check CHECK (status IN ('active', 'inactive', 'suspended'));
+
+-- Add index on status to filter users by status
+CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
+
+-- Add a comment to mark this migration as completed
+COMMENT ON COLUMN users.status IS 'User status: active, inactive or suspended - added by migration 005';
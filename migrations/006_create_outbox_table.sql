@@ -0,0 +1,21 @@
+-- 006_create_outbox_table.sql
+-- Migration for creating the outbox table
+-- This migration creates the table used by the OutboxRepository when outbox.enabled is set: messages are
+-- written in the same transaction as business writes, then published to RabbitMQ by the outbox relay
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    message_id VARCHAR(255) NOT NULL,
+    body BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Add a partial index so that the relay finds unpublished messages without scanning published ones
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(id) WHERE published_at IS NULL;
+
+-- Add index on published_at for cleanup
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox(published_at);
+
+-- Add a comment to mark this migration as completed
+COMMENT ON TABLE outbox IS 'Messages waiting to be published by the outbox relay - created by migration 006';
@@ -0,0 +1,16 @@
+-- 007_create_processed_messages_table.sql
+-- Migration for creating the processed_messages table
+-- This migration creates the table used by the ProcessedMessageRepository when consumer.transactional is set: a
+-- record is committed with the database writes of each message, so that a redelivered message is not processed twice
+
+CREATE TABLE IF NOT EXISTS processed_messages (
+    message_id VARCHAR(255) PRIMARY KEY,
+    action VARCHAR(255) NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add index on processed_at for cleanup
+CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages(processed_at);
+
+-- Add a comment to mark this migration as completed
+COMMENT ON TABLE processed_messages IS 'Messages whose database writes are committed - created by migration 007';
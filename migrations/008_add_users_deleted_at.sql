@@ -0,0 +1,11 @@
+-- 008_add_users_deleted_at.sql
+-- Migration for soft-deleting users
+-- Deleted users keep their row with deleted_at set, and are hidden from the UserRepository reads
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Add a partial index on the live users, which every read filters on
+CREATE INDEX IF NOT EXISTS idx_users_live_created_at ON users(created_at) WHERE deleted_at IS NULL;
+
+-- Add a comment to mark this migration as completed
+COMMENT ON COLUMN users.deleted_at IS 'Soft deletion time, NULL for live users - added by migration 008';
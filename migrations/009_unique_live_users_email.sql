@@ -0,0 +1,10 @@
+-- 009_unique_live_users_email.sql
+-- Migration for reusing the email of soft-deleted users
+-- Emails are only unique among live users, so that a user can be created again after being soft-deleted
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_live_email ON users(email) WHERE deleted_at IS NULL;
+
+-- Add a comment to mark this migration as completed
+COMMENT ON INDEX idx_users_live_email IS 'Unique email of live users - added by migration 009';
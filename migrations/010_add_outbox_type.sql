@@ -0,0 +1,8 @@
+-- 010_add_outbox_type.sql
+-- Migration for adding the message type to the outbox table
+-- The relay publishes it as the AMQP type property; messages enqueued before get an empty type
+
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS type VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Add a comment to mark this migration as completed
+COMMENT ON COLUMN outbox.type IS 'Message type, the action of the message - added by migration 010';
@@ -0,0 +1,6 @@
+-- 001_create_users_table.sql (down)
+-- Reverts the creation of the users table
+
+DROP TRIGGER IF EXISTS update_users_updated_at ON users;
+DROP FUNCTION IF EXISTS update_updated_at_column();
+DROP TABLE IF EXISTS users;
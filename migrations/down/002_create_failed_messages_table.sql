@@ -0,0 +1,4 @@
+-- 002_create_failed_messages_table.sql (down)
+-- Reverts the creation of the failed_messages table
+
+DROP TABLE IF EXISTS failed_messages;
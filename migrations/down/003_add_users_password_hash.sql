@@ -0,0 +1,4 @@
+-- 003_add_users_password_hash.sql (down)
+-- Reverts the addition of the password_hash column
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_hash;
@@ -0,0 +1,4 @@
+-- 004_create_message_results_table.sql (down)
+-- Reverts the creation of the message_results table
+
+DROP TABLE IF EXISTS message_results;
@@ -0,0 +1,8 @@
+-- 005_add_users_profile_columns.sql (down)
+-- Reverts the addition of the profile columns
+
+DROP INDEX IF EXISTS idx_users_status;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users DROP COLUMN IF EXISTS status;
+ALTER TABLE users DROP COLUMN IF EXISTS last_name;
+ALTER TABLE users DROP COLUMN IF EXISTS first_name;
@@ -0,0 +1,4 @@
+-- 006_create_outbox_table.sql (down)
+-- Reverts the creation of the outbox table
+
+DROP TABLE IF EXISTS outbox;
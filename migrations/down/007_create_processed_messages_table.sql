@@ -0,0 +1,4 @@
+-- 007_create_processed_messages_table.sql (down)
+-- Reverts the creation of the processed_messages table
+
+DROP TABLE IF EXISTS processed_messages;
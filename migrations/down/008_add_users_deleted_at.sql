@@ -0,0 +1,6 @@
+-- 008_add_users_deleted_at.sql (down)
+-- Reverts the soft deletion of users, permanently losing the soft-deleted users
+
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_users_live_created_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
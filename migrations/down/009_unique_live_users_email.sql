@@ -0,0 +1,11 @@
+-- 009_unique_live_users_email.sql (down)
+-- Reverts to emails unique among all users, permanently losing the soft-deleted users whose email was reused
+
+DELETE FROM users d
+WHERE d.deleted_at IS NOT NULL
+  AND EXISTS (
+      SELECT 1 FROM users u
+      WHERE u.email = d.email AND u.id <> d.id AND (u.deleted_at IS NULL OR u.id > d.id)
+  );
+DROP INDEX IF EXISTS idx_users_live_email;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
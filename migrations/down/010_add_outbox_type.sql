@@ -0,0 +1,4 @@
+-- 010_add_outbox_type.sql (down)
+-- Reverts the addition of the message type to the outbox table
+
+ALTER TABLE outbox DROP COLUMN IF EXISTS type;
@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations, so that the binary can inspect them without the source tree.
+package migrations
+
+import "embed"
+
+// FS holds the SQL migrations, named <version>_<description>.sql. The down/ directory holds the
+// migrations reverting them, under the same names. The docker compose init scripts ignore it.
+//
+//go:embed *.sql down/*.sql
+var FS embed.FS
@@ -3,8 +3,11 @@ package pkg
 import (
 	"github.com/samber/do-template-worker/pkg/cli"
 	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/health"
+	"github.com/samber/do-template-worker/pkg/lifecycle"
 	"github.com/samber/do-template-worker/pkg/logger"
-	"github.com/samber/do-template-worker/pkg/repositories"
+	"github.com/samber/do-template-worker/pkg/metrics"
+	"github.com/samber/do-template-worker/pkg/tracing"
 	"github.com/samber/do/v2"
 )
 
@@ -12,6 +15,9 @@ var BasePackage = do.Package(
 	do.Lazy(config.NewConfig),
 	do.Lazy(cli.NewCLI),
 	do.Lazy(logger.NewLogger),
-	do.Lazy(repositories.NewDatabase),
-	do.Lazy(repositories.NewUserRepository),
+	do.Lazy(logger.NewLevelController),
+	do.Lazy(metrics.NewMetrics),
+	do.Lazy(lifecycle.NewShutdownManager),
+	do.Lazy(health.NewRegistry),
+	do.Lazy(tracing.NewTracing),
 )
@@ -0,0 +1,300 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+	"github.com/samber/do-template-worker/pkg/repositories"
+	"github.com/samber/do-template-worker/pkg/workers"
+	"github.com/samber/do/v2"
+	"github.com/spf13/cobra"
+)
+
+// benchUserRepository records when each benchmark user has been written to the database
+// The bench command overrides the UserRepository service with it before the consumer is
+// invoked, showing how do.Override can decorate a dependency without touching its consumers.
+type benchUserRepository struct {
+	repositories.UserRepository
+
+	mu       sync.Mutex
+	expected int
+	sentAt   map[string]time.Time
+	latency  []time.Duration
+	userIDs  []int64
+	done     chan struct{}
+}
+
+// CreateUser creates the user, then records its end-to-end latency.
+func (r *benchUserRepository) CreateUser(ctx context.Context, user *repositories.User) (*repositories.User, error) {
+	created, err := r.UserRepository.CreateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	r.record(created)
+	return created, nil
+}
+
+// CreateUsers creates the users, then records their end-to-end latency.
+func (r *benchUserRepository) CreateUsers(ctx context.Context, users []*repositories.User) ([]*repositories.User, error) {
+	created, err := r.UserRepository.CreateUsers(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range created {
+		r.record(user)
+	}
+	return created, nil
+}
+
+// record records the end-to-end latency of a created benchmark user.
+func (r *benchUserRepository) record(created *repositories.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sentAt, ok := r.sentAt[created.Email]; ok {
+		delete(r.sentAt, created.Email)
+		r.latency = append(r.latency, time.Since(sentAt))
+		r.userIDs = append(r.userIDs, created.ID)
+		if len(r.latency) == r.expected {
+			close(r.done)
+		}
+	}
+}
+
+// WithTx runs fn in a transaction, recording the users created within it once it commits.
+func (r *benchUserRepository) WithTx(ctx context.Context, fn func(repo repositories.UserRepository) error) error {
+	var created []*repositories.User
+
+	err := r.UserRepository.WithTx(ctx, func(repo repositories.UserRepository) error {
+		return fn(&benchTxUserRepository{UserRepository: repo, created: &created})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, user := range created {
+		r.record(user)
+	}
+
+	return nil
+}
+
+// benchTxUserRepository collects the users created within a transaction, to be recorded once it commits.
+type benchTxUserRepository struct {
+	repositories.UserRepository
+	created *[]*repositories.User
+}
+
+// CreateUser creates the user and collects it.
+func (r *benchTxUserRepository) CreateUser(ctx context.Context, user *repositories.User) (*repositories.User, error) {
+	created, err := r.UserRepository.CreateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	*r.created = append(*r.created, created)
+	return created, nil
+}
+
+// CreateUsers creates the users and collects them.
+func (r *benchTxUserRepository) CreateUsers(ctx context.Context, users []*repositories.User) ([]*repositories.User, error) {
+	created, err := r.UserRepository.CreateUsers(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	*r.created = append(*r.created, created...)
+	return created, nil
+}
+
+// newBenchCommand creates the bench command.
+func (cli *CLI) newBenchCommand() *cobra.Command {
+	var (
+		messages    int
+		concurrency int
+		timeout     time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Benchmark end-to-end latency",
+		Long: "Publish messages and measure the produce -> consume -> database write latency and throughput. " +
+			"The benchmark runs a consumer in-process: other consumers attached to the same queue would steal messages.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if messages <= 0 || concurrency <= 0 {
+				return errors.New("--messages and --concurrency must be positive")
+			}
+			return cli.runBench(messages, concurrency, timeout)
+		},
+	}
+
+	cmd.Flags().IntVar(&messages, "messages", 1000, "Number of messages to publish")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 10, "Number of concurrent publishers")
+	cmd.Flags().DurationVar(&timeout, "timeout", 2*time.Minute, "Maximum time to wait for all messages to be processed")
+
+	return cmd
+}
+
+// runBench publishes benchmark messages, waits for the consumer to process them and prints a summary.
+func (cli *CLI) runBench(messages, concurrency int, timeout time.Duration) error {
+	runID := time.Now().UnixNano()
+
+	repo := &benchUserRepository{
+		UserRepository: do.MustInvoke[repositories.UserRepository](cli.injector),
+		expected:       messages,
+		sentAt:         make(map[string]time.Time, messages),
+		done:           make(chan struct{}),
+	}
+	defer cli.cleanupBench(repo)
+
+	// Decorate the repository before the consumer resolves it
+	do.OverrideValue[repositories.UserRepository](cli.injector.RootScope(), repo)
+
+	rabbitMQ := do.MustInvoke[*rabbitmq.RabbitMQService](cli.injector)
+	consumerWorker := do.MustInvoke[*workers.ConsumerWorker](cli.injector)
+	if err := consumerWorker.Start(); err != nil {
+		return fmt.Errorf("failed to start consumer worker: %w", err)
+	}
+
+	start := time.Now()
+	if err := publishBenchMessages(rabbitMQ, repo, runID, messages, concurrency); err != nil {
+		return err
+	}
+	published := time.Since(start)
+
+	select {
+	case <-repo.done:
+	case <-time.After(timeout):
+		fmt.Println("Timeout reached before all messages were processed")
+	}
+	elapsed := time.Since(start)
+
+	repo.mu.Lock()
+	latency := append([]time.Duration(nil), repo.latency...)
+	repo.mu.Unlock()
+
+	printBenchSummary(messages, published, elapsed, latency)
+
+	return nil
+}
+
+// publishBenchMessages publishes the benchmark messages from concurrent publishers.
+func publishBenchMessages(rabbitMQ *rabbitmq.RabbitMQService, repo *benchUserRepository, runID int64, messages, concurrency int) error {
+	jobs := make(chan int)
+	errs := make(chan error, concurrency)
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := publishBenchMessage(rabbitMQ, repo, runID, i); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+	for i := 0; i < messages && err == nil; i++ {
+		select {
+		case jobs <- i:
+		case err = <-errs:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err == nil && len(errs) > 0 {
+		err = <-errs
+	}
+
+	return err
+}
+
+// publishBenchMessage publishes a single create_user message stamped with its send time.
+func publishBenchMessage(rabbitMQ *rabbitmq.RabbitMQService, repo *benchUserRepository, runID int64, i int) error {
+	email := fmt.Sprintf("bench_%d_%d@bench.local", runID, i)
+
+	payload, err := json.Marshal(workers.UserPayload{Name: fmt.Sprintf("Bench %d", i), Email: email})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	message := workers.WorkerMessage{
+		Action:  "create_user",
+		Payload: payload,
+		ID:      fmt.Sprintf("bench_%d_%d", runID, i),
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	repo.mu.Lock()
+	repo.sentAt[email] = time.Now()
+	repo.mu.Unlock()
+
+	if err := rabbitMQ.PublishMessageWithOptions(body, rabbitmq.PublishOptions{MessageID: message.ID, Type: message.Action}); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	return nil
+}
+
+// cleanupBench deletes the users created by the benchmark.
+func (cli *CLI) cleanupBench(repo *benchUserRepository) {
+	repo.mu.Lock()
+	ids := append([]int64(nil), repo.userIDs...)
+	pending := len(repo.sentAt)
+	repo.mu.Unlock()
+
+	ctx := context.Background()
+	for _, id := range ids {
+		if err := repo.UserRepository.HardDeleteUser(ctx, id); err != nil {
+			fmt.Printf("Failed to delete benchmark user %d: %v\n", id, err)
+		}
+	}
+
+	fmt.Printf("Cleaned up %d benchmark users\n", len(ids))
+	if pending > 0 {
+		fmt.Printf("%d benchmark messages were not processed and may remain in the queue\n", pending)
+	}
+}
+
+// printBenchSummary prints throughput and latency percentiles.
+func printBenchSummary(messages int, published, elapsed time.Duration, latency []time.Duration) {
+	sort.Slice(latency, func(a, b int) bool { return latency[a] < latency[b] })
+
+	fmt.Printf("Published:  %d messages in %s (%.2f msg/s)\n", messages, published.Round(time.Millisecond), float64(messages)/published.Seconds())
+	fmt.Printf("Processed:  %d messages in %s (%.2f msg/s)\n", len(latency), elapsed.Round(time.Millisecond), float64(len(latency))/elapsed.Seconds())
+
+	if len(latency) == 0 {
+		return
+	}
+
+	fmt.Printf("Latency:    p50=%s p95=%s p99=%s max=%s\n",
+		percentile(latency, 0.50).Round(time.Microsecond),
+		percentile(latency, 0.95).Round(time.Microsecond),
+		percentile(latency, 0.99).Round(time.Microsecond),
+		latency[len(latency)-1].Round(time.Microsecond),
+	)
+}
+
+// percentile returns the p-th percentile of sorted durations, using the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/jobs"
+	"github.com/samber/do/v2"
+	"github.com/spf13/cobra"
+)
+
+// newCleanupCommand creates the cleanup command.
+func (cli *CLI) newCleanupCommand() *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Delete old records",
+		Long: "Run the cleanup job once, deleting failed messages, message results, published outbox messages and processed-message records older than jobs.cleanup_retention. " +
+			"The serve command runs the same job periodically when jobs.cleanup_schedule is set.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cleanupJob, err := do.Invoke[*jobs.CleanupJob](cli.injector)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			result, err := cleanupJob.Run(ctx)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Deleted %d failed messages, %d message results, %d outbox messages and %d processed-message records\n",
+				result.FailedMessagesDeleted, result.MessageResultsDeleted, result.OutboxMessagesDeleted, result.ProcessedMessagesDeleted)
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Minute, "Timeout of the cleanup")
+
+	return cmd
+}
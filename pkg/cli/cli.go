@@ -1,10 +1,17 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/lifecycle"
+	"github.com/samber/do-template-worker/pkg/logger"
 	"github.com/samber/do-template-worker/pkg/workers"
 	"github.com/samber/do/v2"
 	"github.com/spf13/cobra"
@@ -14,13 +21,14 @@ import (
 // This demonstrates how to create a CLI service with dependency injection.
 type CLI struct {
 	config      *config.Config `do:""`
-	injector    do.Injector    `do:""`
+	injector    do.Injector
 	rootCommand *cobra.Command
 }
 
 // NewCLI creates a new CLI service with dependency injection support.
 func NewCLI(i do.Injector) (*CLI, error) {
 	cli := do.MustInvokeStruct[*CLI](i)
+	cli.injector = i
 
 	// Create the root command
 	cli.rootCommand = &cobra.Command{
@@ -28,6 +36,25 @@ func NewCLI(i do.Injector) (*CLI, error) {
 		Short:   "A template worker application using samber/do dependency injection",
 		Long:    "A comprehensive template project demonstrating the github.com/samber/do dependency injection library with PostgreSQL and RabbitMQ integration",
 		Version: cli.config.App.Version,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Flags are parsed at this point: load config files and refresh the config
+			files, err := cmd.Flags().GetStringArray("config")
+			if err != nil {
+				return err
+			}
+			if err := cli.config.Load(files); err != nil {
+				return err
+			}
+
+			// Fail before any connection is opened: services are created lazily by the commands
+			if err := cli.config.Validate(); err != nil {
+				return err
+			}
+
+			// The logger was created before the flags were parsed: apply the loaded logger settings
+			logger.Configure(do.MustInvoke[*zerolog.Logger](cli.injector), cli.config.Logger)
+			return nil
+		},
 	}
 
 	// Add persistent flags using dependency injection
@@ -51,6 +78,9 @@ func (cli *CLI) setupCommands() {
 	// Add producer command
 	cli.rootCommand.AddCommand(cli.newProducerCommand())
 
+	// Add publish command
+	cli.rootCommand.AddCommand(cli.newPublishCommand())
+
 	// Add consumer command
 	cli.rootCommand.AddCommand(cli.newConsumerCommand())
 
@@ -60,29 +90,71 @@ func (cli *CLI) setupCommands() {
 	// Add migrate command
 	cli.rootCommand.AddCommand(cli.newMigrateCommand())
 
+	// Add seed command
+	cli.rootCommand.AddCommand(cli.newSeedCommand())
+
 	// Add health command
 	cli.rootCommand.AddCommand(cli.newHealthCommand())
 
 	// Add version command
 	cli.rootCommand.AddCommand(cli.newVersionCommand())
+
+	// Add deps command
+	cli.rootCommand.AddCommand(cli.newDepsCommand())
+
+	// Add bench command
+	cli.rootCommand.AddCommand(cli.newBenchCommand())
+
+	// Add config command
+	cli.rootCommand.AddCommand(cli.newConfigCommand())
+
+	// Add rabbitmq command
+	cli.rootCommand.AddCommand(cli.newRabbitMQCommand())
+
+	// Add cleanup command
+	cli.rootCommand.AddCommand(cli.newCleanupCommand())
+
+	// Add message command
+	cli.rootCommand.AddCommand(cli.newMessageCommand())
+
+	// Add preflight command
+	cli.rootCommand.AddCommand(cli.newPreflightCommand())
 }
 
 // newProducerCommand creates the producer command.
 func (cli *CLI) newProducerCommand() *cobra.Command {
-	return &cobra.Command{
+	var (
+		duration  time.Duration
+		rateLimit float64
+		count     int64
+	)
+
+	cmd := &cobra.Command{
 		Use:   "producer",
 		Short: "Start the producer worker",
 		Long:  "Start the producer worker that creates messages periodically",
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Println("Starting producer worker...")
-			cli.runProducer()
+
+			opts := workers.ProducerRunOptions{Duration: duration, Count: count}
+			if rateLimit > 0 {
+				opts.Interval = time.Duration(float64(time.Second) / rateLimit)
+			}
+
+			cli.runProducer(opts)
 		},
 	}
+
+	cmd.Flags().DurationVar(&duration, "duration", 0, "Stop the producer after this duration (0 = run until signal)")
+	cmd.Flags().Float64Var(&rateLimit, "rate-limit", 0, "Maximum number of messages produced per second (0 = producer.interval)")
+	cmd.Flags().Int64Var(&count, "count", 0, "Stop the producer after publishing this many messages (0 = run until signal)")
+
+	return cmd
 }
 
 // newConsumerCommand creates the consumer command.
 func (cli *CLI) newConsumerCommand() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "consumer",
 		Short: "Start the consumer worker",
 		Long:  "Start the consumer worker that processes messages and calls UserRepository",
@@ -91,32 +163,10 @@ func (cli *CLI) newConsumerCommand() *cobra.Command {
 			cli.runConsumer()
 		},
 	}
-}
 
-// newServeCommand creates the serve command.
-func (cli *CLI) newServeCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:   "serve",
-		Short: "Start the worker service",
-		Long:  "Start the do-template-worker service with dependency injection",
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Starting worker service...")
-			// This will be implemented to use the dependency injection container
-		},
-	}
-}
+	cmd.AddCommand(cli.newConsumerProcessCommand())
 
-// newMigrateCommand creates the migrate command.
-func (cli *CLI) newMigrateCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:   "migrate",
-		Short: "Run database migrations",
-		Long:  "Run database migrations using the configured database connection",
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Running database migrations...")
-			// This will be implemented to use the dependency injection container
-		},
-	}
+	return cmd
 }
 
 // newHealthCommand creates the health command.
@@ -161,15 +211,47 @@ func (cli *CLI) AddCommand(command *cobra.Command) {
 
 // runProducer starts the producer worker with graceful shutdown
 // This method demonstrates how to run a worker with dependency injection and signal handling.
-func (cli *CLI) runProducer() {
+func (cli *CLI) runProducer(opts workers.ProducerRunOptions) {
 	// Get services from dependency injection container
 	producerWorker := do.MustInvoke[*workers.ProducerWorker](cli.injector)
-	logger := do.MustInvoke[zerolog.Logger](cli.injector)
+	logger := do.MustInvoke[*zerolog.Logger](cli.injector)
+
+	ctx, stop := signalContext()
+	defer stop()
 
 	// Start the producer worker
-	if err := producerWorker.Start(); err != nil {
+	if err := producerWorker.StartWithOptions(opts); err != nil {
 		logger.Fatal().Err(err).Msg("Failed to start producer worker")
 	}
+
+	// Stop producing before anything else is torn down
+	shutdownManager := do.MustInvoke[*lifecycle.ShutdownManager](cli.injector)
+	shutdownManager.Register("producer", lifecycle.PriorityStopIntake, func(ctx context.Context) error {
+		return producerWorker.Shutdown()
+	})
+
+	// With the outbox, the producer only writes messages: relay them, like serve does
+	if cli.config.Outbox.Enabled {
+		outboxRelay, err := do.Invoke[*workers.OutboxRelay](cli.injector)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to start outbox relay")
+		}
+
+		// Keep relaying while the producer stops, messages left being published on the next start
+		shutdownManager.Register("outbox_relay", lifecycle.PriorityDrain, func(ctx context.Context) error {
+			return outboxRelay.Shutdown()
+		})
+		go func() { _ = outboxRelay.Run() }()
+	}
+
+	// Run until a signal is received or the producer stops on its own
+	select {
+	case <-ctx.Done():
+	case <-producerWorker.Done():
+	}
+
+	stats := producerWorker.Stats()
+	fmt.Printf("Produced %d messages in %s (%.2f msg/s)\n", stats.Produced, stats.Elapsed.Round(time.Millisecond), stats.Rate())
 }
 
 // runConsumer starts the consumer worker with graceful shutdown
@@ -177,10 +259,27 @@ func (cli *CLI) runProducer() {
 func (cli *CLI) runConsumer() {
 	// Get services from dependency injection container
 	consumerWorker := do.MustInvoke[*workers.ConsumerWorker](cli.injector)
-	logger := do.MustInvoke[zerolog.Logger](cli.injector)
+	logger := do.MustInvoke[*zerolog.Logger](cli.injector)
+
+	ctx, stop := signalContext()
+	defer stop()
 
 	// Start the consumer worker
 	if err := consumerWorker.Start(); err != nil {
 		logger.Fatal().Err(err).Msg("Failed to start consumer worker")
 	}
+
+	// Stop consuming before anything else is torn down
+	shutdownManager := do.MustInvoke[*lifecycle.ShutdownManager](cli.injector)
+	shutdownManager.Register("consumer", lifecycle.PriorityStopIntake, func(ctx context.Context) error {
+		return consumerWorker.Shutdown(ctx)
+	})
+
+	// Run until a signal is received
+	<-ctx.Done()
+}
+
+// signalContext returns a context cancelled on SIGTERM or interrupt.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 }
@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// configOption is a config key derived from a persistent flag.
+type configOption struct {
+	key         string
+	description string
+	value       any
+}
+
+// configSection groups the options sharing the same top-level key.
+type configSection struct {
+	name    string
+	options []configOption
+}
+
+// newConfigCommand creates the config command.
+func (cli *CLI) newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage configuration files",
+	}
+
+	cmd.AddCommand(cli.newConfigInitCommand())
+
+	return cmd
+}
+
+// newConfigInitCommand creates the config init command.
+func (cli *CLI) newConfigInitCommand() *cobra.Command {
+	var (
+		out    string
+		format string
+		force  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Generate a sample config file",
+		Long: "Write a commented config file populated with the default value and description of every option. " +
+			"Keys and defaults come from the command line flags, so the file never drifts from them.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format == "" {
+				format = strings.TrimPrefix(filepath.Ext(out), ".")
+			}
+
+			content, err := renderConfig(configSections(cli.rootCommand.PersistentFlags()), format)
+			if err != nil {
+				return err
+			}
+
+			if !force {
+				if _, err := os.Stat(out); err == nil {
+					return fmt.Errorf("%s already exists, use --force to overwrite it", out)
+				}
+			}
+
+			if err := os.WriteFile(out, content, 0o600); err != nil {
+				return fmt.Errorf("failed to write config file: %w", err)
+			}
+
+			fmt.Printf("Config file written to %s\n", out)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&out, "out", "config.yaml", "Output file")
+	cmd.Flags().StringVar(&format, "format", "", "Output format: yaml, toml or json (defaults to the output file extension)")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite the output file if it exists")
+
+	return cmd
+}
+
+// configSections collects the config options from the dotted persistent flags, grouped by section.
+func configSections(flags *pflag.FlagSet) []configSection {
+	var sections []configSection
+
+	flags.VisitAll(func(flag *pflag.Flag) {
+		name, key, ok := strings.Cut(flag.Name, ".")
+		if !ok {
+			// Not a config key, e.g. --config
+			return
+		}
+
+		if len(sections) == 0 || sections[len(sections)-1].name != name {
+			sections = append(sections, configSection{name: name})
+		}
+
+		section := &sections[len(sections)-1]
+		section.options = append(section.options, configOption{
+			key:         key,
+			description: flag.Usage,
+			value:       flagValue(flag),
+		})
+	})
+
+	return sections
+}
+
+// flagValue returns the typed default value of a flag.
+func flagValue(flag *pflag.Flag) any {
+	switch flag.Value.Type() {
+	case "bool":
+		v, _ := strconv.ParseBool(flag.DefValue)
+		return v
+	case "int":
+		v, _ := strconv.Atoi(flag.DefValue)
+		return v
+	case "float64":
+		v, _ := strconv.ParseFloat(flag.DefValue, 64)
+		return v
+	case "stringSlice":
+		v, _ := flag.Value.(pflag.SliceValue)
+		return append([]string{}, v.GetSlice()...)
+	default:
+		return flag.DefValue
+	}
+}
+
+// renderConfig renders the config sections in the given format.
+func renderConfig(sections []configSection, format string) ([]byte, error) {
+	switch format {
+	case "yaml", "yml":
+		return renderCommented(sections, "%s:\n", "  # %s\n  %s: %s\n"), nil
+	case "toml":
+		return renderCommented(sections, "[%s]\n", "# %s\n%s = %s\n"), nil
+	case "json":
+		return renderJSON(sections)
+	default:
+		return nil, errors.New("unsupported config format, expected yaml, toml or json")
+	}
+}
+
+// renderCommented renders sections with one comment per option, for formats supporting comments
+// Scalars are written as JSON literals, which are valid in both YAML and TOML.
+func renderCommented(sections []configSection, sectionFormat, optionFormat string) []byte {
+	var b strings.Builder
+
+	b.WriteString("# Generated by `config init`. Flags and environment variables override these values.\n")
+
+	for _, section := range sections {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, sectionFormat, section.name)
+
+		for _, option := range section.options {
+			value, _ := json.Marshal(option.value)
+			fmt.Fprintf(&b, optionFormat, option.description, option.key, value)
+		}
+	}
+
+	return []byte(b.String())
+}
+
+// renderJSON renders sections as a JSON document. JSON has no comments, so descriptions are dropped.
+func renderJSON(sections []configSection) ([]byte, error) {
+	document := make(map[string]map[string]any, len(sections))
+	for _, section := range sections {
+		document[section.name] = make(map[string]any, len(section.options))
+		for _, option := range section.options {
+			document[section.name][option.key] = option.value
+		}
+	}
+
+	content, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to render config: %w", err)
+	}
+
+	return append(content, '\n'), nil
+}
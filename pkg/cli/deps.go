@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samber/do/v2"
+	"github.com/spf13/cobra"
+)
+
+// Health statuses reported by the deps command.
+const (
+	healthHealthy   = "healthy"
+	healthDegraded  = "degraded"
+	healthUnhealthy = "unhealthy"
+	healthErrored   = "errored"
+)
+
+// dependencyStatus describes a registered service and, optionally, its health.
+type dependencyStatus struct {
+	Service string `json:"service"`
+	Scope   string `json:"scope"`
+	Invoked bool   `json:"invoked"`
+	Health  string `json:"health,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// newDepsCommand creates the deps command.
+func (cli *CLI) newDepsCommand() *cobra.Command {
+	var (
+		check   bool
+		asJSON  bool
+		timeout time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "deps",
+		Short: "List registered services",
+		Long:  "List the services registered in the dependency injection container, optionally checking their health",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			statuses := cli.collectDependencies(check, timeout)
+			if asJSON {
+				return printDependenciesJSON(statuses)
+			}
+			return printDependenciesText(statuses, check)
+		},
+	}
+
+	cmd.Flags().BoolVar(&check, "check", false, "Invoke every service and report the health of those supporting health checks")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print output as JSON")
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Second, "Timeout for the health checks, run concurrently")
+
+	return cmd
+}
+
+// collectDependencies lists registered services and optionally checks their health
+// A service failing to invoke is marked as errored; it never aborts the command.
+func (cli *CLI) collectDependencies(check bool, timeout time.Duration) []dependencyStatus {
+	provided := cli.injector.ListProvidedServices()
+
+	healths := map[string]dependencyStatus{}
+	if check {
+		healths = cli.checkDependencies(provided, timeout)
+	}
+
+	invoked := map[string]bool{}
+	for _, service := range cli.injector.ListInvokedServices() {
+		invoked[service.Service] = true
+	}
+
+	statuses := make([]dependencyStatus, 0, len(provided))
+	for _, service := range provided {
+		status := healths[service.Service]
+		status.Service = service.Service
+		status.Scope = service.ScopeName
+		status.Invoked = invoked[service.Service]
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(a, b int) bool {
+		return statuses[a].Service < statuses[b].Service
+	})
+
+	return statuses
+}
+
+// checkDependencies invokes every provided service, then runs the injector's health checks
+// The injector only checks the services it has built, and reports the others as healthy: invoking
+// them first covers every registered service, and only those implementing do.HealthcheckerWithContext
+// or do.Healthchecker get a health status.
+func (cli *CLI) checkDependencies(provided []do.ServiceDescription, timeout time.Duration) map[string]dependencyStatus {
+	healths := map[string]dependencyStatus{}
+	checkable := map[string]bool{}
+
+	for _, service := range provided {
+		instance, err := do.InvokeNamed[any](cli.injector, service.Service)
+		if err != nil {
+			healths[service.Service] = dependencyStatus{Health: healthErrored, Error: err.Error()}
+			continue
+		}
+
+		switch instance.(type) {
+		case do.HealthcheckerWithContext, do.Healthchecker:
+			checkable[service.Service] = true
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for name, err := range cli.injector.HealthCheckWithContext(ctx) {
+		if !checkable[name] {
+			continue
+		}
+
+		if err != nil {
+			healths[name] = dependencyStatus{Health: healthUnhealthy, Error: err.Error()}
+		} else {
+			healths[name] = dependencyStatus{Health: healthHealthy}
+		}
+	}
+
+	return healths
+}
+
+// printDependenciesJSON prints dependency statuses as a JSON array.
+func printDependenciesJSON(statuses []dependencyStatus) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(statuses)
+}
+
+// printDependenciesText prints dependency statuses as an aligned table.
+func printDependenciesText(statuses []dependencyStatus, check bool) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	if check {
+		_, _ = fmt.Fprintln(w, "SERVICE\tSCOPE\tINVOKED\tHEALTH\tERROR")
+	} else {
+		_, _ = fmt.Fprintln(w, "SERVICE\tSCOPE\tINVOKED")
+	}
+
+	for _, status := range statuses {
+		if !check {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%t\n", status.Service, status.Scope, status.Invoked)
+			continue
+		}
+
+		health := status.Health
+		if health == "" {
+			health = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\n", status.Service, status.Scope, status.Invoked, health, status.Error)
+	}
+
+	return w.Flush()
+}
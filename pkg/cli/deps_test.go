@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samber/do/v2"
+)
+
+// checkedService is a service supporting the injector's health checks.
+type checkedService struct {
+	err error
+}
+
+func (s *checkedService) HealthCheck(ctx context.Context) error {
+	return s.err
+}
+
+// plainService is a service without health check.
+type plainService struct{}
+
+func TestCollectDependenciesChecksRegisteredServices(t *testing.T) {
+	t.Parallel()
+
+	injector := do.New()
+	do.ProvideNamed(injector, "healthy", func(do.Injector) (*checkedService, error) { return &checkedService{}, nil })
+	do.ProvideNamed(injector, "unhealthy", func(do.Injector) (*checkedService, error) {
+		return &checkedService{err: errors.New("ping failed")}, nil
+	})
+	do.ProvideNamed(injector, "errored", func(do.Injector) (*checkedService, error) { return nil, errors.New("no shards configured") })
+	do.ProvideNamed(injector, "plain", func(do.Injector) (*plainService, error) { return &plainService{}, nil })
+
+	cli := &CLI{injector: injector}
+
+	healths := map[string]string{}
+	for _, status := range cli.collectDependencies(true, time.Second) {
+		healths[status.Service] = status.Health
+		if status.Service != "errored" && !status.Invoked {
+			t.Errorf("expected %s to be invoked by the check", status.Service)
+		}
+	}
+
+	expected := map[string]string{"healthy": healthHealthy, "unhealthy": healthUnhealthy, "errored": healthErrored, "plain": ""}
+	for service, health := range expected {
+		if healths[service] != health {
+			t.Errorf("expected %s to be %q, got %q", service, health, healths[service])
+		}
+	}
+}
+
+func TestCollectDependenciesWithoutCheck(t *testing.T) {
+	t.Parallel()
+
+	injector := do.New()
+	do.ProvideNamed(injector, "lazy", func(do.Injector) (*checkedService, error) { return &checkedService{}, nil })
+
+	statuses := (&CLI{injector: injector}).collectDependencies(false, time.Second)
+	if len(statuses) != 1 || statuses[0].Invoked || statuses[0].Health != "" {
+		t.Fatalf("expected the service to be listed without being invoked, got %+v", statuses)
+	}
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/repositories"
+	"github.com/samber/do/v2"
+	"github.com/spf13/cobra"
+)
+
+// newMessageCommand creates the message command.
+func (cli *CLI) newMessageCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "message",
+		Short: "Inspect processed messages",
+	}
+
+	cmd.AddCommand(cli.newMessageResultCommand())
+
+	return cmd
+}
+
+// newMessageResultCommand creates the message result command.
+func (cli *CLI) newMessageResultCommand() *cobra.Command {
+	var (
+		id      string
+		timeout time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "result",
+		Short: "Print the outcome of a processed message",
+		Long: "Print the stored outcome of the message with the given ID as JSON. " +
+			"Results are only stored with consumer.store_results; a message without result is still pending, " +
+			"was processed without storing results, or was cleaned up.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if id == "" {
+				return errors.New("--id is required")
+			}
+
+			resultRepo, err := do.Invoke[repositories.MessageResultRepository](cli.injector)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			result, err := resultRepo.GetMessageResult(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(result)
+		},
+	}
+
+	cmd.Flags().StringVar(&id, "id", "", "ID of the message")
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Second, "Timeout of the lookup")
+
+	return cmd
+}
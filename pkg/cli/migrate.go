@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/migrator"
+	"github.com/samber/do/v2"
+	"github.com/spf13/cobra"
+)
+
+// defaultMigrateTimeout bounds a migrate command, so that a migration waiting on a lock can't hang a deploy.
+const defaultMigrateTimeout = 5 * time.Minute
+
+// newMigrateCommand creates the migrate command.
+func (cli *CLI) newMigrateCommand() *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Run database migrations",
+		Long: "Run the migrations embedded in the binary using the configured database connection. " +
+			"Applied versions are recorded in the schema_migrations table. " +
+			"A migration still running after --timeout is cancelled and rolled back.",
+	}
+
+	cmd.PersistentFlags().DurationVar(&timeout, "timeout", defaultMigrateTimeout, "Timeout of the whole command (0 = none)")
+
+	cmd.AddCommand(cli.newMigrateUpCommand(&timeout))
+	cmd.AddCommand(cli.newMigrateDownCommand(&timeout))
+	cmd.AddCommand(cli.newMigrateStatusCommand(&timeout))
+	cmd.AddCommand(cli.newMigrateCreateCommand())
+
+	return cmd
+}
+
+// migrateContext is cancelled on signals and, unless timeout is zero, once timeout elapses.
+func migrateContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signalContext()
+	if timeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// newMigrateUpCommand creates the migrate up command.
+func (cli *CLI) newMigrateUpCommand(timeout *time.Duration) *cobra.Command {
+	return &cobra.Command{
+		Use:   "up",
+		Short: "Apply the pending migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := do.Invoke[*migrator.Migrator](cli.injector)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := migrateContext(*timeout)
+			defer cancel()
+
+			applied, err := m.Up(ctx)
+			for _, migration := range applied {
+				fmt.Printf("Applied %s\n", migration.Name)
+			}
+			if err != nil {
+				return err
+			}
+
+			if len(applied) == 0 {
+				fmt.Println("No pending migrations")
+			}
+			return nil
+		},
+	}
+}
+
+// newMigrateDownCommand creates the migrate down command.
+func (cli *CLI) newMigrateDownCommand(timeout *time.Duration) *cobra.Command {
+	var steps int
+
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "Revert the last applied migrations",
+		Long:  "Revert the last --steps applied migrations, most recent first. It refuses to go past the first migration.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := do.Invoke[*migrator.Migrator](cli.injector)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := migrateContext(*timeout)
+			defer cancel()
+
+			reverted, err := m.Down(ctx, steps)
+			for _, migration := range reverted {
+				fmt.Printf("Reverted %s\n", migration.Name)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().IntVar(&steps, "steps", 1, "Number of migrations to revert")
+
+	return cmd
+}
+
+// newMigrateStatusCommand creates the migrate status command.
+func (cli *CLI) newMigrateStatusCommand(timeout *time.Duration) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "List the migrations and whether they are applied",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := do.Invoke[*migrator.Migrator](cli.injector)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := migrateContext(*timeout)
+			defer cancel()
+
+			statuses, err := m.Status(ctx)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+			for _, s := range statuses {
+				state := "pending"
+				if s.Applied {
+					state = "applied"
+				}
+				_, _ = fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, state)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// newMigrateCreateCommand creates the migrate create command.
+func (cli *CLI) newMigrateCreateCommand() *cobra.Command {
+	var dir string
+
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Scaffold a new migration",
+		Long: "Create <version>_<name>.sql in the migrations directory and in its down/ directory, " +
+			"with the version following the last migration. The name is made of lowercase letters, digits and underscores.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, err := migrator.Create(dir, args[0])
+			if err != nil {
+				return err
+			}
+
+			for _, file := range files {
+				fmt.Printf("Created %s\n", file)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dir, "dir", "migrations", "Migrations directory")
+
+	return cmd
+}
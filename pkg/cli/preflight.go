@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do/v2"
+	"github.com/spf13/cobra"
+)
+
+// defaultPreflightTimeout bounds each dependency dial of the preflight.
+const defaultPreflightTimeout = 3 * time.Second
+
+// preflightTarget is a network dependency checked by the preflight.
+type preflightTarget struct {
+	Name    string
+	Address string
+}
+
+// preflightResult tells whether a dependency accepted a TCP connection.
+type preflightResult struct {
+	preflightTarget
+	Latency time.Duration
+	Err     error
+}
+
+// newPreflightCommand creates the preflight command.
+func (cli *CLI) newPreflightCommand() *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "preflight",
+		Short: "Check that dependencies are reachable",
+		Long: "Dial the TCP address of every configured dependency, without authenticating. " +
+			"An unreachable dependency means the configuration points at the wrong host or port, " +
+			"or the network is in the way; it exits with a non-zero status.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results := runPreflight(context.Background(), preflightTargets(cli.config), timeout)
+			if err := printPreflightResults(results); err != nil {
+				return err
+			}
+			return preflightError(results)
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", defaultPreflightTimeout, "Timeout of each connection attempt")
+
+	return cmd
+}
+
+// preflight checks that every dependency is reachable, logging each result
+// It runs before the services are built, so that a wrong host is not reported as an authentication
+// or connection error further down.
+func (cli *CLI) preflight() error {
+	logger := do.MustInvoke[*zerolog.Logger](cli.injector)
+
+	results := runPreflight(context.Background(), preflightTargets(cli.config), defaultPreflightTimeout)
+	for _, result := range results {
+		if result.Err != nil {
+			logger.Error().Err(result.Err).Str("dependency", result.Name).Str("address", result.Address).Msg("Dependency unreachable")
+			continue
+		}
+		logger.Info().Str("dependency", result.Name).Str("address", result.Address).Dur("latency", result.Latency).Msg("Dependency reachable")
+	}
+
+	if err := preflightError(results); err != nil {
+		return fmt.Errorf("preflight failed: %w", err)
+	}
+
+	return nil
+}
+
+// preflightTargets lists the addresses of the database, its shards and RabbitMQ
+// Shards inherit their unset host and port from the top-level database configuration.
+func preflightTargets(cfg *config.Config) []preflightTarget {
+	targets := []preflightTarget{
+		{Name: "database", Address: net.JoinHostPort(cfg.Database.Host, strconv.Itoa(cfg.Database.Port))},
+	}
+
+	for i, shard := range cfg.Database.Shards {
+		name := shard.Name
+		if name == "" {
+			name = fmt.Sprintf("shard_%d", i)
+		}
+
+		host, port := shard.Host, shard.Port
+		if host == "" {
+			host = cfg.Database.Host
+		}
+		if port == 0 {
+			port = cfg.Database.Port
+		}
+
+		targets = append(targets, preflightTarget{
+			Name:    "database shard " + name,
+			Address: net.JoinHostPort(host, strconv.Itoa(port)),
+		})
+	}
+
+	return append(targets, preflightTarget{
+		Name:    "rabbitmq",
+		Address: net.JoinHostPort(cfg.RabbitMQ.Host, strconv.Itoa(cfg.RabbitMQ.Port)),
+	})
+}
+
+// runPreflight dials every target concurrently, each within the given timeout.
+func runPreflight(ctx context.Context, targets []preflightTarget, timeout time.Duration) []preflightResult {
+	results := make([]preflightResult, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = dial(ctx, target, timeout)
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// dial opens and immediately closes a TCP connection to a target.
+func dial(ctx context.Context, target preflightTarget, timeout time.Duration) preflightResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", target.Address)
+	if err != nil {
+		return preflightResult{preflightTarget: target, Err: err}
+	}
+	_ = conn.Close()
+
+	return preflightResult{preflightTarget: target, Latency: time.Since(start)}
+}
+
+// preflightError joins the errors of the unreachable dependencies, or returns nil when all are reachable.
+func preflightError(results []preflightResult) error {
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s unreachable at %s: %w", result.Name, result.Address, result.Err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// printPreflightResults prints preflight results as an aligned table.
+func printPreflightResults(results []preflightResult) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(w, "DEPENDENCY\tADDRESS\tSTATUS\tLATENCY")
+	for _, result := range results {
+		if result.Err != nil {
+			_, _ = fmt.Fprintf(w, "%s\t%s\tunreachable\t-\n", result.Name, result.Address)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\treachable\t%s\n", result.Name, result.Address, result.Latency.Round(time.Millisecond))
+	}
+
+	return w.Flush()
+}
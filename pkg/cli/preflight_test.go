@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/config"
+)
+
+func TestPreflightTargetsInheritShardAddress(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{
+			Host: "db", Port: 5432,
+			Shards: []config.DatabaseShardConfig{
+				{Name: "eu", DatabaseConfig: config.DatabaseConfig{Host: "db-eu"}},
+				{DatabaseConfig: config.DatabaseConfig{Port: 6432}},
+			},
+		},
+		RabbitMQ: config.RabbitMQConfig{Host: "mq", Port: 5672},
+	}
+
+	var got []string
+	for _, target := range preflightTargets(cfg) {
+		got = append(got, target.Name+"="+target.Address)
+	}
+
+	expected := "database=db:5432,database shard eu=db-eu:5432,database shard shard_1=db:6432,rabbitmq=mq:5672"
+	if strings.Join(got, ",") != expected {
+		t.Fatalf("expected targets %s, got %s", expected, strings.Join(got, ","))
+	}
+}
+
+func TestRunPreflight(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	// Grab a free port, then release it so that dialing it is refused
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	closedAddress := closed.Addr().String()
+	_ = closed.Close()
+
+	results := runPreflight(context.Background(), []preflightTarget{
+		{Name: "up", Address: listener.Addr().String()},
+		{Name: "down", Address: closedAddress},
+	}, time.Second)
+
+	if results[0].Err != nil {
+		t.Fatalf("expected the listening dependency to be reachable, got %v", results[0].Err)
+	}
+	if results[1].Err == nil {
+		t.Fatal("expected the closed dependency to be unreachable")
+	}
+
+	err = preflightError(results)
+	if err == nil || !strings.Contains(err.Error(), "down unreachable at "+closedAddress) || strings.Contains(err.Error(), "up unreachable") {
+		t.Fatalf("expected an error naming only the unreachable dependency, got %v", err)
+	}
+}
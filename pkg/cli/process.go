@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/workers"
+	"github.com/spf13/cobra"
+)
+
+// newConsumerProcessCommand creates the consumer process command.
+func (cli *CLI) newConsumerProcessCommand() *cobra.Command {
+	var (
+		file    string
+		dryRun  bool
+		timeout time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "process",
+		Short: "Process a single message read from a file",
+		Long: "Run a message body read from a file through the consumer pipeline, outside of the broker, and print its outcome as JSON. " +
+			"Handlers write to the database as usual; with --dry-run, writes are discarded and no result is stored. " +
+			"The command fails when processing fails, so that a poison message can be reproduced and debugged locally.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return errors.New("--file is required")
+			}
+
+			body, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read message: %w", err)
+			}
+
+			// The broker is never involved: the message is neither consumed nor acked
+			consumerWorker, err := workers.NewOfflineConsumerWorker(cli.injector)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			report, processErr := consumerWorker.Process(ctx, body, dryRun)
+
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(report); err != nil {
+				return err
+			}
+
+			return processErr
+		},
+	}
+
+	cmd.Flags().StringVar(&file, "file", "", "Path of the message body, as published to the queue")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Discard database writes and don't store the result")
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "Timeout of the processing")
+
+	return cmd
+}
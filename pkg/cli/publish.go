@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+	"github.com/samber/do-template-worker/pkg/workers"
+	"github.com/samber/do/v2"
+	"github.com/spf13/cobra"
+)
+
+// newPublishCommand creates the publish command.
+func (cli *CLI) newPublishCommand() *cobra.Command {
+	var (
+		action  string
+		payload string
+		id      string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "publish",
+		Short: "Publish a single message",
+		Long: "Publish a single message with the given action and JSON payload to the queue, then exit. " +
+			"The message carries app.name as its source, and a generated ID unless --id is set.",
+		Example: `  do-template-worker publish --action create_user --payload '{"name":"John","email":"john@example.com"}'`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if id == "" {
+				id = fmt.Sprintf("msg_%d", time.Now().UnixNano())
+			}
+
+			body, err := newPublishedMessage(action, payload, id, cli.config.App.Name)
+			if err != nil {
+				return err
+			}
+
+			rabbitMQ, err := do.Invoke[*rabbitmq.RabbitMQService](cli.injector)
+			if err != nil {
+				return err
+			}
+
+			if err := rabbitMQ.PublishMessageWithOptions(body, rabbitmq.PublishOptions{MessageID: id, Type: action}); err != nil {
+				return fmt.Errorf("failed to publish message: %w", err)
+			}
+
+			fmt.Printf("Published %s message %s\n", action, id)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&action, "action", "", "Action of the message")
+	cmd.Flags().StringVar(&payload, "payload", "", "JSON payload of the message")
+	cmd.Flags().StringVar(&id, "id", "", "ID of the message (default: generated)")
+
+	return cmd
+}
+
+// newPublishedMessage builds the body of a message published by the publish command
+// An empty payload is published as null, any other payload must be valid JSON.
+func newPublishedMessage(action, payload, id, source string) ([]byte, error) {
+	if action == "" {
+		return nil, errors.New("--action is required")
+	}
+
+	message := workers.WorkerMessage{Action: action, ID: id, Source: source}
+	if payload != "" {
+		if !json.Valid([]byte(payload)) {
+			return nil, fmt.Errorf("--payload is not valid JSON: %s", payload)
+		}
+		message.Payload = json.RawMessage(payload)
+	}
+
+	return json.Marshal(message)
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/samber/do-template-worker/pkg/workers"
+)
+
+func TestNewPublishedMessage(t *testing.T) {
+	t.Parallel()
+
+	body, err := newPublishedMessage("create_user", `{"name":"John","email":"john@example.com"}`, "msg_1", "cli")
+	if err != nil {
+		t.Fatalf("expected a message, got %v", err)
+	}
+
+	var message workers.WorkerMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		t.Fatalf("failed to decode message: %v", err)
+	}
+	if message.Action != "create_user" || message.ID != "msg_1" || message.Source != "cli" || string(message.Payload) != `{"name":"John","email":"john@example.com"}` {
+		t.Fatalf("unexpected message: %s", body)
+	}
+
+	if body, err := newPublishedMessage("ping", "", "msg_2", "cli"); err != nil || !strings.Contains(string(body), `"payload":null`) {
+		t.Fatalf("expected an empty payload to be published as null, got %s (%v)", body, err)
+	}
+
+	if _, err := newPublishedMessage("create_user", `{"name":`, "msg_3", "cli"); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Fatalf("expected an invalid payload to be rejected, got %v", err)
+	}
+	if _, err := newPublishedMessage("", "{}", "msg_4", "cli"); err == nil || !strings.Contains(err.Error(), "--action is required") {
+		t.Fatalf("expected a missing action to be rejected, got %v", err)
+	}
+}
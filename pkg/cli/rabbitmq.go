@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+	"github.com/samber/do/v2"
+	"github.com/spf13/cobra"
+)
+
+// peekedMessage describes a message seen by the rabbitmq peek command.
+type peekedMessage struct {
+	MessageID   string         `json:"message_id,omitempty"`
+	Type        string         `json:"type,omitempty"`
+	AppID       string         `json:"app_id,omitempty"`
+	Exchange    string         `json:"exchange"`
+	RoutingKey  string         `json:"routing_key"`
+	Redelivered bool           `json:"redelivered"`
+	Headers     map[string]any `json:"headers,omitempty"`
+	Body        string         `json:"body"`
+}
+
+// newRabbitMQCommand creates the rabbitmq command.
+func (cli *CLI) newRabbitMQCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rabbitmq",
+		Short: "Inspect RabbitMQ",
+	}
+
+	cmd.AddCommand(cli.newRabbitMQPeekCommand())
+
+	return cmd
+}
+
+// newRabbitMQPeekCommand creates the rabbitmq peek command.
+func (cli *CLI) newRabbitMQPeekCommand() *cobra.Command {
+	var (
+		count  int
+		asJSON bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "peek",
+		Short: "Print messages of the queue without consuming them",
+		Long: "Fetch up to --count messages from the queue, print them and requeue them. " +
+			"Peeking briefly removes messages from the queue: consumers cannot see them while they are printed, " +
+			"and requeued messages may be delivered in a different order.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := do.Invoke[*rabbitmq.RabbitMQService](cli.injector)
+			if err != nil {
+				return err
+			}
+
+			deliveries, err := service.Peek(count)
+			if err != nil {
+				return err
+			}
+
+			messages := make([]peekedMessage, 0, len(deliveries))
+			for _, delivery := range deliveries {
+				messages = append(messages, newPeekedMessage(delivery))
+			}
+
+			if asJSON {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(messages)
+			}
+
+			printPeekedMessages(messages)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&count, "count", 10, "Maximum number of messages to peek")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print output as JSON")
+
+	return cmd
+}
+
+// newPeekedMessage converts a delivery into a printable message.
+func newPeekedMessage(delivery amqp091.Delivery) peekedMessage {
+	return peekedMessage{
+		MessageID:   delivery.MessageId,
+		Type:        delivery.Type,
+		AppID:       delivery.AppId,
+		Exchange:    delivery.Exchange,
+		RoutingKey:  delivery.RoutingKey,
+		Redelivered: delivery.Redelivered,
+		Headers:     delivery.Headers,
+		Body:        string(delivery.Body),
+	}
+}
+
+// printPeekedMessages prints messages as text, one block per message.
+func printPeekedMessages(messages []peekedMessage) {
+	if len(messages) == 0 {
+		fmt.Println("The queue is empty")
+		return
+	}
+
+	for i, message := range messages {
+		fmt.Printf("--- message %d (exchange=%q routing_key=%q redelivered=%t)\n",
+			i+1, message.Exchange, message.RoutingKey, message.Redelivered)
+		if message.MessageID != "" || message.Type != "" || message.AppID != "" {
+			fmt.Printf("message_id=%q type=%q app_id=%q\n", message.MessageID, message.Type, message.AppID)
+		}
+
+		keys := make([]string, 0, len(message.Headers))
+		for key := range message.Headers {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Printf("%s: %v\n", key, message.Headers[key])
+		}
+
+		fmt.Println(message.Body)
+	}
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/repositories"
+	"github.com/samber/do/v2"
+	"github.com/spf13/cobra"
+)
+
+// seedBatchSize is the number of users inserted per CreateUsers call.
+const seedBatchSize = 500
+
+var (
+	seedFirstNames = []string{"Alice", "Bob", "Chloe", "David", "Emma", "Farid", "Grace", "Hugo", "Ines", "Jack", "Kenji", "Lea", "Mateo", "Nora", "Omar", "Priya", "Quentin", "Rosa", "Samuel", "Tara"}
+	seedLastNames  = []string{"Adams", "Bernard", "Chen", "Dubois", "Evans", "Fischer", "Garcia", "Haddad", "Ivanova", "Johnson", "Kim", "Lopez", "Martin", "Nguyen", "Okafor", "Petit", "Rossi", "Silva", "Tanaka", "Weber"}
+)
+
+// newSeedCommand creates the seed command.
+func (cli *CLI) newSeedCommand() *cobra.Command {
+	var (
+		count    int
+		truncate bool
+		timeout  time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Populate the database with random users",
+		Long: "Insert random but realistic users for local development, through the UserRepository. " +
+			"With --truncate, every live user is hard-deleted first.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if count < 0 {
+				return fmt.Errorf("--count must not be negative, got %d", count)
+			}
+
+			userRepo, err := do.Invoke[repositories.UserRepository](cli.injector)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			if truncate {
+				deleted, err := deleteAllUsers(ctx, userRepo)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Deleted %d users\n", deleted)
+			}
+
+			users := seedUsers(count, time.Now().Unix(), rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())))
+			for batch := range slices.Chunk(users, seedBatchSize) {
+				if _, err := userRepo.CreateUsers(ctx, batch); err != nil {
+					return fmt.Errorf("failed to seed users: %w", err)
+				}
+			}
+
+			fmt.Printf("Seeded %d users\n", len(users))
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&count, "count", 100, "Number of users to insert")
+	cmd.Flags().BoolVar(&truncate, "truncate", false, "Hard-delete every live user first")
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "Timeout of the seeding")
+
+	return cmd
+}
+
+// seedUsers generates count random users
+// Emails are made unique with the run ID, so that seeding twice doesn't collide.
+func seedUsers(count int, runID int64, rnd *rand.Rand) []*repositories.User {
+	users := make([]*repositories.User, 0, count)
+	for i := range count {
+		firstName := seedFirstNames[rnd.IntN(len(seedFirstNames))]
+		lastName := seedLastNames[rnd.IntN(len(seedLastNames))]
+
+		// Mostly active users, as in a live database
+		status := repositories.UserStatusActive
+		switch n := rnd.IntN(10); {
+		case n == 0:
+			status = repositories.UserStatusSuspended
+		case n < 3:
+			status = repositories.UserStatusInactive
+		}
+
+		users = append(users, &repositories.User{
+			Name:      firstName + " " + lastName,
+			Email:     fmt.Sprintf("%s.%s.%d.%d@example.com", strings.ToLower(firstName), strings.ToLower(lastName), runID, i),
+			FirstName: firstName,
+			LastName:  lastName,
+			Status:    status,
+		})
+	}
+
+	return users
+}
+
+// deleteAllUsers hard-deletes every live user through the repository, page by page, returning how many were deleted.
+func deleteAllUsers(ctx context.Context, userRepo repositories.UserRepository) (int, error) {
+	var deleted int
+	for {
+		users, err := userRepo.ListUsers(ctx, seedBatchSize, 0)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list users: %w", err)
+		}
+		if len(users) == 0 {
+			return deleted, nil
+		}
+
+		for _, user := range users {
+			if err := userRepo.HardDeleteUser(ctx, user.ID); err != nil {
+				return deleted, fmt.Errorf("failed to delete user %d: %w", user.ID, err)
+			}
+			deleted++
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/samber/do-template-worker/pkg/repositories"
+)
+
+func TestSeedUsers(t *testing.T) {
+	t.Parallel()
+
+	users := seedUsers(200, 1700000000, rand.New(rand.NewPCG(1, 2)))
+	if len(users) != 200 {
+		t.Fatalf("expected 200 users, got %d", len(users))
+	}
+
+	emails := map[string]bool{}
+	statuses := map[repositories.UserStatus]int{}
+	for _, user := range users {
+		if user.Name != user.FirstName+" "+user.LastName {
+			t.Fatalf("expected the name to be built from the first and last names, got %+v", user)
+		}
+		if !strings.Contains(user.Email, ".1700000000.") || !strings.HasSuffix(user.Email, "@example.com") {
+			t.Fatalf("expected the email to carry the run ID, got %s", user.Email)
+		}
+		if emails[user.Email] {
+			t.Fatalf("expected unique emails, got %s twice", user.Email)
+		}
+		emails[user.Email] = true
+		statuses[user.Status]++
+	}
+
+	if statuses[repositories.UserStatusActive] <= statuses[repositories.UserStatusInactive]+statuses[repositories.UserStatusSuspended] {
+		t.Fatalf("expected mostly active users, got %v", statuses)
+	}
+}
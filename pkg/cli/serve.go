@@ -0,0 +1,464 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/health"
+	"github.com/samber/do-template-worker/pkg/httpserver"
+	"github.com/samber/do-template-worker/pkg/jobs"
+	"github.com/samber/do-template-worker/pkg/lifecycle"
+	"github.com/samber/do-template-worker/pkg/metrics"
+	"github.com/samber/do-template-worker/pkg/migrator"
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+	"github.com/samber/do-template-worker/pkg/repositories"
+	"github.com/samber/do-template-worker/pkg/workers"
+	"github.com/samber/do/v2"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// componentRetryInitialDelay is the first delay between two start attempts of a failed component.
+	componentRetryInitialDelay = 1 * time.Second
+	// componentRetryMaxDelay caps the exponential backoff between two start attempts.
+	componentRetryMaxDelay = 30 * time.Second
+	// migrationCheckTimeout bounds the check of pending migrations at startup.
+	migrationCheckTimeout = 10 * time.Second
+	// workerStableAfter resets the restart count of a worker that ran that long before dying.
+	workerStableAfter = 5 * time.Minute
+	// shutdownComponent is the component failing /readyz once serve is shutting down.
+	shutdownComponent = "shutdown"
+)
+
+// errShuttingDown is the readiness error of shutdownComponent.
+var errShuttingDown = errors.New("shutting down")
+
+// serveComponent is a part of the service started by the serve command.
+type serveComponent struct {
+	name  string
+	start func() error
+	// run is the blocking run loop of the component, supervised once started. Nil when start
+	// runs the component in the background by itself.
+	run func() error
+}
+
+// newServeCommand creates the serve command.
+func (cli *CLI) newServeCommand() *cobra.Command {
+	var (
+		toleratePartial bool
+		preflight       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Start the worker service",
+		Long: "Start the health HTTP server, the consumer and the producer. " +
+			"With --tolerate-partial, components failing to start are reported as unhealthy in /readyz " +
+			"and retried in the background instead of aborting the process. " +
+			"With --preflight, unreachable dependencies abort the process before any service is built.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if preflight {
+				if err := cli.preflight(); err != nil {
+					return err
+				}
+			}
+			return cli.runServe(toleratePartial)
+		},
+	}
+
+	cmd.Flags().BoolVar(&toleratePartial, "tolerate-partial", false, "Keep running when some components fail to start, retrying them in the background")
+	cmd.Flags().BoolVar(&preflight, "preflight", false, "Check that dependencies are reachable before starting")
+
+	return cmd
+}
+
+// runServe starts every component and blocks until a signal is received.
+func (cli *CLI) runServe(toleratePartial bool) error {
+	logger := do.MustInvoke[*zerolog.Logger](cli.injector)
+	registry := do.MustInvoke[*health.Registry](cli.injector)
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	if err := cli.checkMigrations(ctx, logger); err != nil {
+		return err
+	}
+
+	// The health server starts first, so that probes get answers while the workers start
+	registry.AddCheck("database", cli.databaseHealthCheck())
+	registry.AddCheck("rabbitmq", cli.rabbitMQHealthCheck())
+	cli.startHealthServer(registry, logger)
+
+	return cli.serve(ctx, cli.serveComponents(), toleratePartial)
+}
+
+// serve starts the components and blocks until ctx is done
+// Started components register their own shutdown hooks, which run once the command returns,
+// including when a later component fails to start.
+func (cli *CLI) serve(ctx context.Context, components []serveComponent, toleratePartial bool) error {
+	logger := do.MustInvoke[*zerolog.Logger](cli.injector)
+	registry := do.MustInvoke[*health.Registry](cli.injector)
+
+	// Workers that die after too many restarts take the whole process down
+	failures := make(chan error, len(components))
+	supervise := func(component serveComponent) {
+		if component.run != nil {
+			go cli.supervise(ctx, component, failures)
+		}
+	}
+
+	for _, component := range components {
+		err := component.start()
+		if err == nil {
+			registry.SetHealthy(component.name)
+			logger.Info().Str("component", component.name).Msg("Component started")
+			supervise(component)
+			continue
+		}
+
+		registry.SetUnhealthy(component.name, err)
+		logger.Error().Err(err).Str("component", component.name).Msg("Component failed to start")
+
+		if !toleratePartial {
+			return fmt.Errorf("failed to start %s: %w", component.name, err)
+		}
+
+		go retryComponent(ctx, component, registry, logger, supervise)
+	}
+
+	// Run until a signal is received or a worker can't be kept alive
+	select {
+	case <-ctx.Done():
+		cli.predrain(registry, logger)
+		return nil
+	case err := <-failures:
+		return err
+	}
+}
+
+// predrain fails /readyz, then waits shutdown.predrain_delay before the workers are stopped
+// Endpoint controllers and load balancers take a while to notice an instance is no longer ready:
+// the workers keep running meanwhile, so that work routed to the instance is not dropped.
+// A second signal skips the wait.
+func (cli *CLI) predrain(registry *health.Registry, logger *zerolog.Logger) {
+	delay := cli.config.Shutdown.PredrainDelay
+
+	registry.SetUnhealthy(shutdownComponent, errShuttingDown)
+	logger.Info().Str("phase", "pre-drain").Dur("predrain_delay", delay).Msg("Shutdown phase started, readiness failed")
+
+	if delay > 0 {
+		ctx, stop := signalContext()
+		defer stop()
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			logger.Warn().Msg("Pre-drain interrupted by a second signal")
+		}
+	}
+
+	logger.Info().Str("phase", "pre-drain").Msg("Shutdown phase completed")
+}
+
+// supervise runs the loop of a started component, restarting it independently of the other
+// components when it dies, up to app.max_worker_restarts times in a row.
+func (cli *CLI) supervise(ctx context.Context, component serveComponent, failures chan<- error) {
+	logger := do.MustInvoke[*zerolog.Logger](cli.injector)
+	registry := do.MustInvoke[*health.Registry](cli.injector)
+
+	err := lifecycle.Supervise(ctx, component.name, component.run, lifecycle.SupervisorOptions{
+		MaxRestarts:    cli.config.App.MaxWorkerRestarts,
+		InitialBackoff: componentRetryInitialDelay,
+		MaxBackoff:     componentRetryMaxDelay,
+		StableAfter:    workerStableAfter,
+	}, logger)
+	if err != nil {
+		registry.SetUnhealthy(component.name, err)
+		failures <- err
+	}
+}
+
+// checkMigrations compares the database schema with the embedded migrations, without applying them
+// With app.require_migrations, pending migrations or a failed check abort the command.
+// Otherwise they are logged as a warning, so that a deploy skipping migrations is still noticed.
+func (cli *CLI) checkMigrations(ctx context.Context, logger *zerolog.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, migrationCheckTimeout)
+	defer cancel()
+
+	err := func() error {
+		m, err := do.Invoke[*migrator.Migrator](cli.injector)
+		if err != nil {
+			return err
+		}
+		return m.CheckApplied(ctx)
+	}()
+	if err == nil {
+		return nil
+	}
+
+	if cli.config.App.RequireMigrations {
+		return fmt.Errorf("refusing to serve: %w", err)
+	}
+
+	if errors.Is(err, migrator.ErrPendingMigrations) {
+		logger.Warn().Err(err).Msg("Serving with pending database migrations")
+	} else {
+		logger.Warn().Err(err).Msg("Failed to check database migrations")
+	}
+
+	return nil
+}
+
+// serveComponents returns the components started by the serve command
+// Invoking a worker constructs its dependencies, so a broker or database outage surfaces here.
+// A failed provider isn't cached by the container: the next attempt invokes it again.
+func (cli *CLI) serveComponents() []serveComponent {
+	shutdownManager := do.MustInvoke[*lifecycle.ShutdownManager](cli.injector)
+
+	// Workers run in their own supervised goroutines, so that each one is restarted independently
+	var (
+		consumerWorker *workers.ConsumerWorker
+		producerWorker *workers.ProducerWorker
+	)
+
+	components := []serveComponent{
+		{
+			name: "consumer",
+			start: func() error {
+				var err error
+				consumerWorker, err = do.Invoke[*workers.ConsumerWorker](cli.injector)
+				if err != nil {
+					return err
+				}
+				// Don't consume messages only to fail them while the database is unreachable
+				if err := consumerWorker.CheckDatabase(); err != nil {
+					return err
+				}
+
+				shutdownManager.Register("consumer", lifecycle.PriorityStopIntake, func(ctx context.Context) error {
+					return consumerWorker.Shutdown(ctx)
+				})
+				return nil
+			},
+			run: func() error {
+				return consumerWorker.Run()
+			},
+		},
+		{
+			name: "producer",
+			start: func() error {
+				var err error
+				producerWorker, err = do.Invoke[*workers.ProducerWorker](cli.injector)
+				if err != nil {
+					return err
+				}
+
+				shutdownManager.Register("producer", lifecycle.PriorityStopIntake, func(ctx context.Context) error {
+					return producerWorker.Shutdown()
+				})
+				return nil
+			},
+			run: func() error {
+				return producerWorker.Run()
+			},
+		},
+	}
+
+	// The relay publishes the messages the producer writes to the outbox
+	if cli.config.Outbox.Enabled {
+		var outboxRelay *workers.OutboxRelay
+
+		components = append(components, serveComponent{
+			name: "outbox_relay",
+			start: func() error {
+				var err error
+				outboxRelay, err = do.Invoke[*workers.OutboxRelay](cli.injector)
+				if err != nil {
+					return err
+				}
+
+				shutdownManager.Register("outbox_relay", lifecycle.PriorityStopIntake, func(ctx context.Context) error {
+					return outboxRelay.Shutdown()
+				})
+				return nil
+			},
+			run: func() error {
+				return outboxRelay.Run()
+			},
+		})
+	}
+
+	// Scheduled jobs are optional
+	if cli.config.Jobs.CleanupSchedule > 0 {
+		components = append(components, serveComponent{
+			name: "cleanup",
+			start: func() error {
+				cleanupJob, err := do.Invoke[*jobs.CleanupJob](cli.injector)
+				if err != nil {
+					return err
+				}
+				if err := cleanupJob.Start(); err != nil {
+					return err
+				}
+
+				shutdownManager.Register("cleanup", lifecycle.PriorityStopIntake, func(ctx context.Context) error {
+					return cleanupJob.Shutdown()
+				})
+				return nil
+			},
+		})
+	}
+
+	return components
+}
+
+// retryComponent keeps trying to start a component with exponential backoff, until it starts or ctx is done
+// The started component is then handed to supervise.
+func retryComponent(ctx context.Context, component serveComponent, registry *health.Registry, logger *zerolog.Logger, supervise func(serveComponent)) {
+	delay := componentRetryInitialDelay
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		err := component.start()
+		if err == nil {
+			registry.SetHealthy(component.name)
+			logger.Info().Str("component", component.name).Int("attempt", attempt).Msg("Component started after retry")
+			supervise(component)
+			return
+		}
+
+		registry.SetUnhealthy(component.name, err)
+		logger.Warn().Err(err).Str("component", component.name).Int("attempt", attempt).Msg("Component still failing to start")
+
+		delay = min(2*delay, componentRetryMaxDelay)
+	}
+}
+
+// databaseHealthCheck returns the check reporting the database health, with its pool utilization, to /readyz
+// With database.saturation_threshold, a pool saturated for that many checks in a row fails readiness, so
+// that no more work is routed to the instance, until it has had a free connection for as many checks.
+func (cli *CLI) databaseHealthCheck() health.Check {
+	saturation := health.NewHysteresis(cli.config.Database.SaturationThreshold)
+
+	return func(ctx context.Context) health.ComponentStatus {
+		state, utilization, err := checkDatabase(ctx, cli.injector)
+
+		status := health.ComponentStatus{
+			Healthy:  state == healthHealthy || state == healthDegraded,
+			Degraded: state == healthDegraded,
+			Details: map[string]any{
+				"pool_acquired": utilization.Acquired,
+				"pool_max":      utilization.Max,
+			},
+		}
+		if err != nil {
+			status.Error = err.Error()
+		}
+
+		// Only a working database has a meaningful pool utilization
+		if status.Healthy && saturation.Observe(utilization.Saturated()) {
+			status.Healthy = false
+			status.Degraded = false
+			status.Error = fmt.Sprintf("pool saturated: %d/%d connections in use", utilization.Acquired, utilization.Max)
+		}
+
+		return status
+	}
+}
+
+// checkDatabase checks the database connection and the utilization of its pool
+// A working database whose pool utilization exceeds database.pool_degraded_threshold is degraded:
+// it still serves queries, but callers are about to wait for connections.
+func checkDatabase(ctx context.Context, injector do.Injector) (string, repositories.PoolUtilization, error) {
+	db, err := do.Invoke[*repositories.Database](injector)
+	if err != nil {
+		return healthErrored, repositories.PoolUtilization{}, err
+	}
+	if err := db.HealthCheckWithContext(ctx); err != nil {
+		return healthUnhealthy, repositories.PoolUtilization{}, err
+	}
+
+	utilization := db.PoolUtilization()
+	threshold := do.MustInvoke[*config.Config](injector).Database.PoolDegradedThreshold
+	if threshold > 0 && utilization.Ratio >= threshold {
+		return healthDegraded, utilization, fmt.Errorf("pool utilization %d/%d above %.0f%%",
+			utilization.Acquired, utilization.Max, threshold*100)
+	}
+
+	return healthHealthy, utilization, nil
+}
+
+// rabbitMQHealthCheck returns the check reporting the RabbitMQ connection to /readyz
+// A reconnecting connection fails readiness, as no message is consumed until it is back.
+func (cli *CLI) rabbitMQHealthCheck() health.Check {
+	return func(ctx context.Context) health.ComponentStatus {
+		state, err := checkRabbitMQ(ctx, cli.injector)
+
+		status := health.ComponentStatus{Healthy: state == healthHealthy}
+		if err != nil {
+			status.Error = err.Error()
+		}
+
+		return status
+	}
+}
+
+// checkRabbitMQ checks the RabbitMQ connection, reporting its state rather than a binary up/down.
+func checkRabbitMQ(ctx context.Context, injector do.Injector) (string, error) {
+	service, err := do.Invoke[*rabbitmq.RabbitMQService](injector)
+	if err != nil {
+		return healthErrored, err
+	}
+
+	status := service.ConnectionState()
+	switch status.State {
+	case rabbitmq.StateConnected:
+		if err := service.HealthCheckWithContext(ctx); err != nil {
+			return healthUnhealthy, err
+		}
+		return healthHealthy, nil
+	case rabbitmq.StateReconnecting:
+		return healthDegraded, fmt.Errorf("reconnecting since %s: %s", status.Since.Format(time.RFC3339), status.LastError)
+	default:
+		return healthUnhealthy, fmt.Errorf("connection %s since %s: %s", status.State, status.Since.Format(time.RFC3339), status.LastError)
+	}
+}
+
+// startHealthServer serves the health endpoints and the Prometheus metrics on app.metrics_port until shutdown
+// The /config endpoint is only served when http.config_token is set.
+func (cli *CLI) startHealthServer(registry *health.Registry, logger *zerolog.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/", registry.Handler())
+	mux.Handle("/metrics", promhttp.HandlerFor(do.MustInvoke[*metrics.Metrics](cli.injector).Registry(), promhttp.HandlerOpts{}))
+	if cli.config.HTTP.ConfigToken != "" {
+		mux.Handle("/config", httpserver.ConfigHandler(cli.config))
+	}
+
+	addr := net.JoinHostPort("", strconv.Itoa(cli.config.App.MetricsPort))
+	server := httpserver.New(cli.config.HTTP, addr, mux)
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Str("addr", addr).Msg("Health server failed")
+		}
+	}()
+
+	// Keep answering probes until the workers are stopped
+	shutdownManager := do.MustInvoke[*lifecycle.ShutdownManager](cli.injector)
+	shutdownManager.Register("health_server", lifecycle.PriorityFlush, server.Shutdown)
+
+	logger.Info().Str("addr", addr).Msg("Health server started")
+}
@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/health"
+	"github.com/samber/do-template-worker/pkg/lifecycle"
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+	"github.com/samber/do/v2"
+)
+
+// newTestServeCLI builds a CLI whose injector only provides what serve needs.
+func newTestServeCLI(t *testing.T) (*CLI, *lifecycle.ShutdownManager) {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	injector := do.New()
+	do.ProvideValue(injector, &config.Config{App: config.AppConfig{ShutdownHookTimeout: time.Second}})
+	do.ProvideValue(injector, &logger)
+	do.Provide(injector, health.NewRegistry)
+	do.Provide(injector, lifecycle.NewShutdownManager)
+
+	return &CLI{config: do.MustInvoke[*config.Config](injector), injector: injector},
+		do.MustInvoke[*lifecycle.ShutdownManager](injector)
+}
+
+// fakeWorkers builds serve components registering a shutdown hook, like the real workers do.
+type fakeWorkers struct {
+	shutdownManager *lifecycle.ShutdownManager
+
+	mu       sync.Mutex
+	shutdown []string
+}
+
+func (f *fakeWorkers) component(name string, startErr error) serveComponent {
+	return serveComponent{
+		name: name,
+		start: func() error {
+			if startErr != nil {
+				return startErr
+			}
+
+			f.shutdownManager.Register(name, lifecycle.PriorityStopIntake, func(ctx context.Context) error {
+				f.mu.Lock()
+				defer f.mu.Unlock()
+				f.shutdown = append(f.shutdown, name)
+				return nil
+			})
+			return nil
+		},
+	}
+}
+
+func TestServeShutsDownEveryWorker(t *testing.T) {
+	t.Parallel()
+
+	cli, shutdownManager := newTestServeCLI(t)
+	workers := &fakeWorkers{shutdownManager: shutdownManager}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := cli.serve(ctx, []serveComponent{
+		workers.component("consumer", nil),
+		workers.component("producer", nil),
+	}, false)
+	if err != nil {
+		t.Fatalf("expected serve to return cleanly once cancelled, got %v", err)
+	}
+
+	if err := shutdownManager.Run(context.Background()); err != nil {
+		t.Fatalf("expected a clean shutdown, got %v", err)
+	}
+	if fmt.Sprint(workers.shutdown) != "[consumer producer]" {
+		t.Fatalf("expected both workers to be shut down, got %v", workers.shutdown)
+	}
+}
+
+func TestServeFailsReadinessBeforeStoppingWorkers(t *testing.T) {
+	t.Parallel()
+
+	cli, shutdownManager := newTestServeCLI(t)
+	cli.config.Shutdown.PredrainDelay = 50 * time.Millisecond
+	registry := do.MustInvoke[*health.Registry](cli.injector)
+	workers := &fakeWorkers{shutdownManager: shutdownManager}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := cli.serve(ctx, []serveComponent{workers.component("consumer", nil)}, false); err != nil {
+		t.Fatalf("expected serve to return cleanly once cancelled, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected serve to wait for the pre-drain delay, returned after %s", elapsed)
+	}
+	ready, components := registry.Ready()
+	if ready || components[shutdownComponent].Error != errShuttingDown.Error() {
+		t.Fatalf("expected readiness to fail while shutting down, got %+v", components)
+	}
+	// Workers are only stopped by the shutdown hooks, once serve has returned
+	if len(workers.shutdown) != 0 {
+		t.Fatalf("expected workers to keep running during the pre-drain, got %v shut down", workers.shutdown)
+	}
+}
+
+func TestServeFailsWhenAWorkerFailsToStart(t *testing.T) {
+	t.Parallel()
+
+	cli, shutdownManager := newTestServeCLI(t)
+	workers := &fakeWorkers{shutdownManager: shutdownManager}
+
+	err := cli.serve(context.Background(), []serveComponent{
+		workers.component("consumer", nil),
+		workers.component("producer", errors.New("broker unreachable")),
+	}, false)
+	if err == nil || !strings.Contains(err.Error(), "failed to start producer") {
+		t.Fatalf("expected an error naming the failed worker, got %v", err)
+	}
+
+	// The worker started before the failure must still be stopped
+	if err := shutdownManager.Run(context.Background()); err != nil {
+		t.Fatalf("expected a clean shutdown, got %v", err)
+	}
+	if fmt.Sprint(workers.shutdown) != "[consumer]" {
+		t.Fatalf("expected the started worker to be shut down, got %v", workers.shutdown)
+	}
+}
+
+func TestServeFailsWhenAWorkerKeepsDying(t *testing.T) {
+	t.Parallel()
+
+	cli, shutdownManager := newTestServeCLI(t)
+	workers := &fakeWorkers{shutdownManager: shutdownManager}
+
+	// No restart allowed: the first death takes the process down
+	dying := workers.component("consumer", nil)
+	dying.run = func() error {
+		return errors.New("message channel closed")
+	}
+
+	err := cli.serve(context.Background(), []serveComponent{dying}, false)
+	if !errors.Is(err, lifecycle.ErrTooManyRestarts) {
+		t.Fatalf("expected ErrTooManyRestarts, got %v", err)
+	}
+}
+
+func TestRabbitMQHealthCheckFailsWithoutConnection(t *testing.T) {
+	t.Parallel()
+
+	cli, _ := newTestServeCLI(t)
+	do.Provide(cli.injector, func(do.Injector) (*rabbitmq.RabbitMQService, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	status := cli.rabbitMQHealthCheck()(context.Background())
+	if status.Healthy || !strings.Contains(status.Error, "connection refused") {
+		t.Fatalf("expected an unhealthy status reporting the connection error, got %+v", status)
+	}
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/samber/do/v2"
 	"github.com/spf13/cobra"
@@ -16,19 +18,56 @@ type Config struct {
 	RabbitMQ RabbitMQConfig `mapstructure:"rabbitmq"`
 	Logger   LoggerConfig   `mapstructure:"logger"`
 	App      AppConfig      `mapstructure:"app"`
+	User     UserConfig     `mapstructure:"user"`
+	Consumer ConsumerConfig `mapstructure:"consumer"`
+	Producer ProducerConfig `mapstructure:"producer"`
+	Jobs     JobsConfig     `mapstructure:"jobs"`
+	Outbox   OutboxConfig   `mapstructure:"outbox"`
+	HTTP     HTTPConfig     `mapstructure:"http"`
+	Shutdown ShutdownConfig `mapstructure:"shutdown"`
 }
 
 // DatabaseConfig holds PostgreSQL configuration.
 type DatabaseConfig struct {
-	Host            string `mapstructure:"host"`
-	Port            int    `mapstructure:"port"`
-	User            string `mapstructure:"user"`
-	Password        string `mapstructure:"password"`
-	Database        string `mapstructure:"database"`
-	SSLMode         string `mapstructure:"ssl_mode"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	Database string `mapstructure:"database"`
+	SSLMode  string `mapstructure:"ssl_mode"`
+	// SSLRootCert is the CA certificate file verifying the server with the verify-ca and verify-full
+	// ssl modes. Empty uses the system roots.
+	SSLRootCert string `mapstructure:"ssl_root_cert"`
+	// SSLCert and SSLKey are the client certificate and key files authenticating to the server, for mutual TLS.
+	SSLCert         string `mapstructure:"ssl_cert"`
+	SSLKey          string `mapstructure:"ssl_key"`
 	MaxOpenConns    int    `mapstructure:"max_open_conns"`
 	MaxIdleConns    int    `mapstructure:"max_idle_conns"`
 	ConnMaxLifetime int    `mapstructure:"conn_max_lifetime"`
+	// QueryTimeout bounds repository calls whose context has no deadline. Zero disables it.
+	QueryTimeout time.Duration `mapstructure:"query_timeout"`
+	// AcquireTimeout bounds the wait for a free pool connection, failing fast when the pool is
+	// exhausted. Zero waits as long as the query context allows.
+	AcquireTimeout time.Duration `mapstructure:"acquire_timeout"`
+	// PoolDegradedThreshold is the pool utilization ratio, between 0 and 1, above which the
+	// database is reported as degraded by health checks. Zero disables it.
+	PoolDegradedThreshold float64 `mapstructure:"pool_degraded_threshold"`
+	// SaturationThreshold is the number of consecutive health checks finding every pool connection
+	// in use before readiness fails, and finding a free one before it recovers. Zero disables it.
+	SaturationThreshold int `mapstructure:"saturation_threshold"`
+	// ConnectTimeout bounds the time spent connecting at startup, retries included. Zero disables it.
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+	// ConnectMaxRetries is how many times a failed connection is retried at startup, with exponential backoff.
+	ConnectMaxRetries int `mapstructure:"connect_max_retries"`
+	// Shards enables sharding when set. Shards can only be configured from config files.
+	Shards []DatabaseShardConfig `mapstructure:"shards"`
+}
+
+// DatabaseShardConfig holds the configuration of a named database shard
+// Unset fields are inherited from the top-level database configuration.
+type DatabaseShardConfig struct {
+	Name           string `mapstructure:"name"`
+	DatabaseConfig `mapstructure:",squash"`
 }
 
 // RabbitMQConfig holds RabbitMQ configuration.
@@ -37,14 +76,66 @@ type RabbitMQConfig struct {
 	Port      int    `mapstructure:"port"`
 	User      string `mapstructure:"user"`
 	Password  string `mapstructure:"password"`
+	VHost     string `mapstructure:"vhost"`
+	TLS       bool   `mapstructure:"tls"`
 	QueueName string `mapstructure:"queue_name"`
 	Exchange  string `mapstructure:"exchange"`
+	// MirrorExchange receives a best-effort copy of every produced message. Empty disables mirroring.
+	MirrorExchange string `mapstructure:"mirror_exchange"`
+	// PauseOnFlowControl pauses the producer while the broker applies flow control.
+	PauseOnFlowControl bool `mapstructure:"pause_on_flow_control"`
+	// LogLifecycle logs connection and channel open/close events at info level instead of debug.
+	LogLifecycle bool `mapstructure:"log_lifecycle"`
+	// DeclareExchange and DeclareQueue control how the topology is declared at startup.
+	DeclareExchange string `mapstructure:"declare_exchange"`
+	DeclareQueue    string `mapstructure:"declare_queue"`
+	// ReconnectMaxAttempts is how many times a lost connection is re-dialed, with exponential
+	// backoff, before giving up. Zero disables automatic reconnection.
+	ReconnectMaxAttempts int `mapstructure:"reconnect_max_attempts"`
+	// ConnectTimeout bounds the time spent connecting at startup, retries included. Zero disables it.
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+	// ConnectMaxRetries is how many times a failed connection is retried at startup, with exponential backoff.
+	ConnectMaxRetries int `mapstructure:"connect_max_retries"`
+	// DLXName is the exchange routing dead-lettered messages to the dead-letter queue, set as the
+	// x-dead-letter-exchange of the main queue. Empty publishes them straight to the dead-letter queue.
+	DLXName string `mapstructure:"dlx_name"`
+	// PrefetchCount bounds the deliveries the broker pushes to a consumer before they are acked, for
+	// fair dispatch across consumers and bounded memory. Zero means unlimited.
+	PrefetchCount int `mapstructure:"prefetch_count"`
+	// ConsumerConcurrency is how many goroutines of the consumer handle deliveries concurrently.
+	ConsumerConcurrency int `mapstructure:"consumer_concurrency"`
+	// Bindings are extra queues the consumer consumes, each dispatched to a single handler. They
+	// can only be configured from config files.
+	Bindings []RabbitMQBindingConfig `mapstructure:"bindings"`
+}
+
+// RabbitMQBindingConfig binds a queue to an exchange, its messages being handled by a single handler
+// Unset exchange and routing key default to rabbitmq.exchange and to the queue name.
+type RabbitMQBindingConfig struct {
+	Queue      string `mapstructure:"queue"`
+	Exchange   string `mapstructure:"exchange"`
+	RoutingKey string `mapstructure:"routing_key"`
+	// Handler is the action the messages of the queue are dispatched as, whatever their own action.
+	Handler string `mapstructure:"handler"`
 }
 
+// RabbitMQ topology declaration modes.
+const (
+	// DeclareActive declares the exchange or queue, creating it when missing.
+	DeclareActive = "active"
+	// DeclarePassive checks that the exchange or queue exists, without creating it.
+	DeclarePassive = "passive"
+	// DeclareSkip neither declares nor checks the exchange or queue.
+	DeclareSkip = "skip"
+)
+
 // LoggerConfig holds logger configuration.
 type LoggerConfig struct {
-	Level   string `mapstructure:"level"`
-	Format  string `mapstructure:"format"`
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+	// FileFormat is the format of the file destinations of Output, defaulting to Format.
+	FileFormat string `mapstructure:"file_format"`
+	// Output is a comma-separated list of destinations: stdout or file paths.
 	Output  string `mapstructure:"output"`
 	NoColor bool   `mapstructure:"no_color"`
 }
@@ -55,6 +146,162 @@ type AppConfig struct {
 	Version     string `mapstructure:"version"`
 	Environment string `mapstructure:"environment"`
 	Debug       bool   `mapstructure:"debug"`
+	// MetricsPort is the port of the HTTP server exposing health and metrics endpoints.
+	MetricsPort int `mapstructure:"metrics_port"`
+	// ShutdownHookTimeout bounds each shutdown hook. Zero means no timeout.
+	ShutdownHookTimeout time.Duration `mapstructure:"shutdown_hook_timeout"`
+	// ShutdownTimeout bounds the whole shutdown, hooks and container services, after which the
+	// process exits anyway. Zero means no timeout.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// RequireMigrations makes serve refuse to start while migrations are pending. When false,
+	// pending migrations are only logged as a warning.
+	RequireMigrations bool `mapstructure:"require_migrations"`
+	// MaxWorkerRestarts is how many times in a row serve restarts a dead worker before exiting.
+	MaxWorkerRestarts int `mapstructure:"max_worker_restarts"`
+	// TracingEnabled records OpenTelemetry spans around message handling and propagates their W3C trace
+	// context through message headers.
+	TracingEnabled bool `mapstructure:"tracing_enabled"`
+	// OTLPEndpoint is the URL of the OTLP/HTTP collector spans are exported to, e.g. http://localhost:4318.
+	// Empty records spans without exporting them, only logging them at debug level.
+	OTLPEndpoint string `mapstructure:"otlp_endpoint"`
+}
+
+// UserConfig holds user domain configuration.
+type UserConfig struct {
+	// CreateRateLimit is the maximum number of users created per second from create_user messages, the
+	// consumer requeuing the others after a delay. Zero or negative means unlimited.
+	CreateRateLimit float64 `mapstructure:"create_rate_limit"`
+	// PasswordHashing is one of PasswordHashingNone, PasswordHashingBcrypt or PasswordHashingArgon2id.
+	// Password storage is disabled unless a hashing algorithm is configured.
+	PasswordHashing string `mapstructure:"password_hashing"`
+	// PasswordCost is the bcrypt cost, or the number of argon2id passes.
+	// Zero uses the algorithm's default.
+	PasswordCost int `mapstructure:"password_cost"`
+}
+
+// Password hashing algorithms.
+const (
+	// PasswordHashingNone disables password storage.
+	PasswordHashingNone = "none"
+	// PasswordHashingBcrypt hashes passwords with bcrypt.
+	PasswordHashingBcrypt = "bcrypt"
+	// PasswordHashingArgon2id hashes passwords with argon2id.
+	PasswordHashingArgon2id = "argon2id"
+)
+
+// Consumer ordering modes.
+const (
+	// OrderingNone lets the broker and consumer trade ordering for throughput.
+	OrderingNone = "none"
+	// OrderingStrict processes messages one at a time, in queue order.
+	OrderingStrict = "strict"
+)
+
+// Handling of malformed messages: empty bodies or invalid JSON, which can never be processed.
+const (
+	// MalformedDeadLetter routes malformed messages to the dead-letter queue.
+	MalformedDeadLetter = "dead_letter"
+	// MalformedDrop acknowledges and logs malformed messages, discarding them.
+	MalformedDrop = "drop"
+)
+
+// ConsumerConfig holds consumer worker configuration.
+type ConsumerConfig struct {
+	// MaxRequeues caps how many times a failed message is requeued before it is
+	// dead-lettered, 5 by default, so that poison messages aren't redelivered forever.
+	// Zero means messages are requeued without limit.
+	MaxRequeues int `mapstructure:"max_requeues"`
+	// ProcessTimeout bounds the processing of a single message. Messages exceeding it
+	// are dead-lettered. Zero disables the timeout.
+	ProcessTimeout time.Duration `mapstructure:"process_timeout"`
+	// Ordering is either OrderingNone or OrderingStrict.
+	Ordering string `mapstructure:"ordering"`
+	// HeartbeatInterval is the delay between two "consumer alive" logs. Zero disables them.
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	// RequeueOnShutdown requeues the messages left unfinished at shutdown. When false they are
+	// nacked without requeue, relying on the broker's dead-letter or redelivery policy.
+	RequeueOnShutdown bool `mapstructure:"requeue_on_shutdown"`
+	// ShutdownGracePeriod is how long shutdown waits for the messages being processed to finish
+	// before aborting them. Zero waits as long as the shutdown hook allows.
+	ShutdownGracePeriod time.Duration `mapstructure:"shutdown_grace_period"`
+	// Schemas maps an action to the path of the JSON Schema its payload must match. Payloads
+	// violating their schema are dead-lettered. Schemas can only be configured from config files.
+	Schemas map[string]string `mapstructure:"schemas"`
+	// AcceptSources restricts processing to messages produced by the listed services. Other
+	// messages are acknowledged and skipped. Empty accepts every source.
+	AcceptSources []string `mapstructure:"accept_sources"`
+	// MalformedMessages is either MalformedDeadLetter or MalformedDrop.
+	MalformedMessages string `mapstructure:"malformed_messages"`
+	// StoreResults persists the outcome of every message in the message_results table.
+	StoreResults bool `mapstructure:"store_results"`
+	// Transactional commits the database writes of a message together with a processed_messages
+	// record, then acks it, so that a redelivered message is skipped rather than processed twice.
+	Transactional bool `mapstructure:"transactional"`
+	// ActionConcurrency maps an action to the number of its messages processed concurrently.
+	// Unlisted actions share a single slot. Empty processes every message one at a time, in a
+	// single loop. It can only be configured from config files.
+	ActionConcurrency map[string]int `mapstructure:"action_concurrency"`
+	// LogBody logs the body of every consumed message at debug level, truncated to LogBodyMaxBytes
+	// bytes with the values of the LogBodyRedact fields redacted.
+	LogBody bool `mapstructure:"log_body"`
+	// LogBodyMaxBytes caps the logged part of a message body. Zero logs whole bodies.
+	LogBodyMaxBytes int `mapstructure:"log_body_max_bytes"`
+	// LogBodyRedact lists the body fields whose values are redacted, at any depth, ignoring case.
+	LogBodyRedact []string `mapstructure:"log_body_redact"`
+}
+
+// ProducerConfig holds producer worker configuration.
+type ProducerConfig struct {
+	// Action is the action of the produced messages. It must have a registered payload generator,
+	// unless PayloadTemplate is set.
+	Action string `mapstructure:"action"`
+	// Interval is the delay between two produced messages.
+	Interval time.Duration `mapstructure:"interval"`
+	// PayloadTemplate is a text/template rendering the JSON payload of the produced messages, replacing
+	// the payload generator of the action. It is given the .Seq, .Unix and .UnixNano of each message.
+	PayloadTemplate string `mapstructure:"payload_template"`
+	// MaxBacklog pauses production while the queue holds more ready messages. Zero disables backpressure.
+	MaxBacklog int `mapstructure:"max_backlog"`
+	// PublishTimeout bounds the publish of a message, so that a hung broker doesn't stall production. Zero disables it.
+	PublishTimeout time.Duration `mapstructure:"publish_timeout"`
+}
+
+// JobsConfig holds scheduled jobs configuration.
+type JobsConfig struct {
+	// CleanupSchedule is the interval between two cleanups run by serve. Zero disables the job.
+	CleanupSchedule time.Duration `mapstructure:"cleanup_schedule"`
+	// CleanupRetention is how long records are kept before the cleanup deletes them.
+	CleanupRetention time.Duration `mapstructure:"cleanup_retention"`
+}
+
+// OutboxConfig holds transactional outbox configuration.
+type OutboxConfig struct {
+	// Enabled makes the producer write messages to the outbox table instead of publishing them,
+	// and serve run the relay publishing them to RabbitMQ.
+	Enabled bool `mapstructure:"enabled"`
+	// RelayInterval is the delay between two polls of the outbox by the relay.
+	RelayInterval time.Duration `mapstructure:"relay_interval"`
+	// BatchSize is the maximum number of messages published by a single poll.
+	BatchSize int `mapstructure:"batch_size"`
+}
+
+// HTTPConfig holds the configuration shared by HTTP servers
+// Go's http.Server has no timeouts by default, leaving it open to slowloris-style attacks.
+type HTTPConfig struct {
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout"`
+	// ConfigToken is the bearer token protecting the /config endpoint of the health server.
+	// Empty disables the endpoint.
+	ConfigToken string `mapstructure:"config_token"`
+}
+
+// ShutdownConfig holds the configuration of the serve shutdown sequence.
+type ShutdownConfig struct {
+	// PredrainDelay is how long serve keeps running once /readyz reports it is shutting down,
+	// before stopping the workers, so that load balancers stop routing to it. Zero stops at once.
+	PredrainDelay time.Duration `mapstructure:"predrain_delay"`
 }
 
 // NewConfig creates a new configuration instance using viper
@@ -70,42 +317,270 @@ func NewConfig(i do.Injector) (*Config, error) {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
+	// Full-URL variables injected by cloud platforms override piecewise settings
+	if err := config.applyURLEnv(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
+// Load merges the given config files, in order, then refreshes the configuration
+// Files are merged with viper.MergeInConfig, so later files override earlier ones. Nested maps
+// are merged key by key: a file only overrides the keys it sets, e.g. setting `database.host` in
+// prod.yaml keeps `database.port` from base.yaml. Lists and scalar values are replaced as a whole.
+// Flags and environment variables still take precedence over every file, and DATABASE_URL,
+// AMQP_URL or CLOUDAMQP_URL over every piecewise database or RabbitMQ setting.
+//
+// Without files, a config file found in one of DefaultConfigPaths is loaded instead, if any.
+// Explicitly given files must exist, while a missing default file is silently ignored.
+//
+// The configuration is unmarshaled into the existing instance, so every service holding
+// the *Config sees the refreshed values.
+func (cs *Config) Load(files []string) error {
+	if len(files) == 0 {
+		if err := mergeDefaultConfig(DefaultConfigPaths); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		viper.SetConfigFile(file)
+		if err := viper.MergeInConfig(); err != nil {
+			return fmt.Errorf("error reading config file %s: %w", file, err)
+		}
+	}
+
+	if err := viper.Unmarshal(cs); err != nil {
+		return fmt.Errorf("error unmarshaling config: %w", err)
+	}
+
+	return cs.applyURLEnv()
+}
+
+// DefaultConfigPaths are the directories searched, in order, for a config file named
+// config.yaml, config.json or config.toml when no --config flag is given.
+var DefaultConfigPaths = []string{".", "/etc/do-template-worker"}
+
+// mergeDefaultConfig merges the first config file found in the given directories, if any.
+func mergeDefaultConfig(paths []string) error {
+	viper.SetConfigName("config")
+	for _, path := range paths {
+		viper.AddConfigPath(path)
+	}
+
+	if err := viper.MergeInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return fmt.Errorf("error reading default config file: %w", err)
+	}
+
+	return nil
+}
+
+// DefaultConfig returns the default configuration
+// It builds a configuration without viper, e.g. for tests or when embedding the worker as a library.
+// Command line flags take their default values from it, so both always agree.
+func DefaultConfig() *Config {
+	return &Config{
+		Database: DatabaseConfig{
+			Host:                  "localhost",
+			Port:                  5432,
+			User:                  "postgres",
+			Password:              "postgres",
+			Database:              "do_template_worker",
+			SSLMode:               "disable",
+			MaxOpenConns:          25,
+			MaxIdleConns:          25,
+			ConnMaxLifetime:       300,
+			QueryTimeout:          30 * time.Second,
+			AcquireTimeout:        5 * time.Second,
+			PoolDegradedThreshold: 0.9,
+			ConnectTimeout:        30 * time.Second,
+			ConnectMaxRetries:     5,
+		},
+		RabbitMQ: RabbitMQConfig{
+			Host:                 "localhost",
+			Port:                 5672,
+			User:                 "guest",
+			Password:             "guest",
+			VHost:                "/",
+			QueueName:            "worker_queue",
+			Exchange:             "worker_exchange",
+			PauseOnFlowControl:   true,
+			LogLifecycle:         true,
+			DeclareExchange:      DeclareActive,
+			DeclareQueue:         DeclareActive,
+			ReconnectMaxAttempts: 10,
+			ConnectTimeout:       30 * time.Second,
+			ConnectMaxRetries:    5,
+			PrefetchCount:        1,
+			ConsumerConcurrency:  1,
+		},
+		Logger: LoggerConfig{
+			Level:  "info",
+			Format: LogFormatConsole,
+			Output: "stdout",
+		},
+		App: AppConfig{
+			Name:                "do-template-worker",
+			Version:             "1.0.0",
+			Environment:         "development",
+			MetricsPort:         9090,
+			ShutdownHookTimeout: 10 * time.Second,
+			ShutdownTimeout:     30 * time.Second,
+			MaxWorkerRestarts:   5,
+		},
+		User: UserConfig{
+			PasswordHashing: PasswordHashingNone,
+		},
+		Consumer: ConsumerConfig{
+			MaxRequeues:         5,
+			Ordering:            OrderingNone,
+			HeartbeatInterval:   60 * time.Second,
+			RequeueOnShutdown:   true,
+			ShutdownGracePeriod: 5 * time.Second,
+			MalformedMessages:   MalformedDeadLetter,
+			LogBodyMaxBytes:     512,
+			LogBodyRedact:       []string{"email", "password"},
+		},
+		Producer: ProducerConfig{
+			Action:         "create_user",
+			Interval:       5 * time.Second,
+			PublishTimeout: 10 * time.Second,
+		},
+		Jobs: JobsConfig{
+			CleanupRetention: 30 * 24 * time.Hour,
+		},
+		Outbox: OutboxConfig{
+			RelayInterval: time.Second,
+			BatchSize:     100,
+		},
+		HTTP: HTTPConfig{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			IdleTimeout:       60 * time.Second,
+		},
+	}
+}
+
 // SetCobraFlags adds command line flags to the cobra command
 // This method demonstrates how services can provide functionality through DI.
 func (cs *Config) SetCobraFlags(cmd *cobra.Command) {
+	defaults := DefaultConfig()
+
+	// Config files, merged in order
+	_ = cmd.PersistentFlags().StringArray("config", nil, "Config file (repeatable, later files override earlier ones; defaults to config.yaml in . or /etc/do-template-worker when present)")
+
 	// Database flags
-	_ = cmd.PersistentFlags().String("database.host", "localhost", "Database host")
-	_ = cmd.PersistentFlags().Int("database.port", 5432, "Database port")
-	_ = cmd.PersistentFlags().String("database.user", "postgres", "Database user")
-	_ = cmd.PersistentFlags().String("database.password", "postgres", "Database password")
-	_ = cmd.PersistentFlags().String("database.database", "do_template_worker", "Database name")
-	_ = cmd.PersistentFlags().String("database.ssl_mode", "disable", "Database SSL mode")
-	_ = cmd.PersistentFlags().Int("database.max_open_conns", 25, "Database max open connections")
-	_ = cmd.PersistentFlags().Int("database.max_idle_conns", 25, "Database max idle connections")
-	_ = cmd.PersistentFlags().Int("database.conn_max_lifetime", 300, "Database connection max lifetime in seconds")
+	_ = cmd.PersistentFlags().String("database.host", defaults.Database.Host, "Database host")
+	_ = cmd.PersistentFlags().Int("database.port", defaults.Database.Port, "Database port")
+	_ = cmd.PersistentFlags().String("database.user", defaults.Database.User, "Database user")
+	_ = cmd.PersistentFlags().String("database.password", defaults.Database.Password, "Database password")
+	_ = cmd.PersistentFlags().String("database.database", defaults.Database.Database, "Database name")
+	_ = cmd.PersistentFlags().String("database.ssl_mode", defaults.Database.SSLMode, "Database SSL mode")
+	_ = cmd.PersistentFlags().String("database.ssl_root_cert", defaults.Database.SSLRootCert, "CA certificate file verifying the database server")
+	_ = cmd.PersistentFlags().String("database.ssl_cert", defaults.Database.SSLCert, "Client certificate file for the database")
+	_ = cmd.PersistentFlags().String("database.ssl_key", defaults.Database.SSLKey, "Client key file for the database")
+	_ = cmd.PersistentFlags().Int("database.max_open_conns", defaults.Database.MaxOpenConns, "Database max open connections")
+	_ = cmd.PersistentFlags().Int("database.max_idle_conns", defaults.Database.MaxIdleConns, "Database max idle connections")
+	_ = cmd.PersistentFlags().Int("database.conn_max_lifetime", defaults.Database.ConnMaxLifetime, "Database connection max lifetime in seconds")
+	_ = cmd.PersistentFlags().Duration("database.query_timeout", defaults.Database.QueryTimeout, "Default timeout of database queries without a deadline (0 = none)")
+	_ = cmd.PersistentFlags().Duration("database.acquire_timeout", defaults.Database.AcquireTimeout, "Maximum wait for a free connection of the pool (0 = bounded by the query timeout only)")
+	_ = cmd.PersistentFlags().Float64("database.pool_degraded_threshold", defaults.Database.PoolDegradedThreshold, "Pool utilization ratio above which the database is reported as degraded (0 = disabled)")
+	_ = cmd.PersistentFlags().Duration("database.connect_timeout", defaults.Database.ConnectTimeout, "Maximum time spent connecting to the database at startup, retries included (0 = none)")
+	_ = cmd.PersistentFlags().Int("database.connect_max_retries", defaults.Database.ConnectMaxRetries, "Retries of a failed database connection at startup")
+	_ = cmd.PersistentFlags().Int("database.saturation_threshold", defaults.Database.SaturationThreshold, "Consecutive health checks with a saturated pool before failing readiness (0 = disabled)")
 
 	// RabbitMQ flags
-	_ = cmd.PersistentFlags().String("rabbitmq.host", "localhost", "RabbitMQ host")
-	_ = cmd.PersistentFlags().Int("rabbitmq.port", 5672, "RabbitMQ port")
-	_ = cmd.PersistentFlags().String("rabbitmq.user", "guest", "RabbitMQ user")
-	_ = cmd.PersistentFlags().String("rabbitmq.password", "guest", "RabbitMQ password")
-	_ = cmd.PersistentFlags().String("rabbitmq.queue_name", "worker_queue", "RabbitMQ queue name")
-	_ = cmd.PersistentFlags().String("rabbitmq.exchange", "worker_exchange", "RabbitMQ exchange name")
+	_ = cmd.PersistentFlags().String("rabbitmq.host", defaults.RabbitMQ.Host, "RabbitMQ host")
+	_ = cmd.PersistentFlags().Int("rabbitmq.port", defaults.RabbitMQ.Port, "RabbitMQ port")
+	_ = cmd.PersistentFlags().String("rabbitmq.user", defaults.RabbitMQ.User, "RabbitMQ user")
+	_ = cmd.PersistentFlags().String("rabbitmq.password", defaults.RabbitMQ.Password, "RabbitMQ password")
+	_ = cmd.PersistentFlags().String("rabbitmq.vhost", defaults.RabbitMQ.VHost, "RabbitMQ virtual host")
+	_ = cmd.PersistentFlags().Bool("rabbitmq.tls", defaults.RabbitMQ.TLS, "Connect to RabbitMQ over TLS (amqps)")
+	_ = cmd.PersistentFlags().String("rabbitmq.queue_name", defaults.RabbitMQ.QueueName, "RabbitMQ queue name")
+	_ = cmd.PersistentFlags().String("rabbitmq.exchange", defaults.RabbitMQ.Exchange, "RabbitMQ exchange name")
+	_ = cmd.PersistentFlags().String("rabbitmq.mirror_exchange", defaults.RabbitMQ.MirrorExchange, "Secondary exchange receiving a best-effort copy of produced messages (empty = disabled)")
+	_ = cmd.PersistentFlags().Bool("rabbitmq.pause_on_flow_control", defaults.RabbitMQ.PauseOnFlowControl, "Pause the producer while RabbitMQ flow control is active")
+	_ = cmd.PersistentFlags().Bool("rabbitmq.log_lifecycle", defaults.RabbitMQ.LogLifecycle, "Log RabbitMQ connection and channel open/close events at info level")
+	_ = cmd.PersistentFlags().String("rabbitmq.declare_exchange", defaults.RabbitMQ.DeclareExchange, "Exchange declaration mode (active, passive, skip)")
+	_ = cmd.PersistentFlags().String("rabbitmq.declare_queue", defaults.RabbitMQ.DeclareQueue, "Queue declaration mode (active, passive, skip)")
+	_ = cmd.PersistentFlags().Int("rabbitmq.reconnect_max_attempts", defaults.RabbitMQ.ReconnectMaxAttempts, "Attempts to re-establish a lost RabbitMQ connection (0 = no reconnection)")
+	_ = cmd.PersistentFlags().Duration("rabbitmq.connect_timeout", defaults.RabbitMQ.ConnectTimeout, "Maximum time spent connecting to RabbitMQ at startup, retries included (0 = none)")
+	_ = cmd.PersistentFlags().Int("rabbitmq.connect_max_retries", defaults.RabbitMQ.ConnectMaxRetries, "Retries of a failed RabbitMQ connection at startup")
+	_ = cmd.PersistentFlags().Int("rabbitmq.prefetch_count", defaults.RabbitMQ.PrefetchCount, "Unacknowledged deliveries pushed to a consumer at once (0 = unlimited)")
+	_ = cmd.PersistentFlags().Int("rabbitmq.consumer_concurrency", defaults.RabbitMQ.ConsumerConcurrency, "Number of messages handled concurrently by the consumer")
+	_ = cmd.PersistentFlags().String("rabbitmq.dlx_name", defaults.RabbitMQ.DLXName, "Dead-letter exchange of the main queue (empty = dead-letter queue only)")
 
 	// Logger flags
-	_ = cmd.PersistentFlags().String("logger.level", "info", "Log level")
-	_ = cmd.PersistentFlags().String("logger.format", "console", "Log format")
-	_ = cmd.PersistentFlags().String("logger.output", "stdout", "Log output")
-	_ = cmd.PersistentFlags().Bool("logger.no_color", false, "Disable colored output")
+	_ = cmd.PersistentFlags().String("logger.level", defaults.Logger.Level, "Log level")
+	_ = cmd.PersistentFlags().String("logger.format", defaults.Logger.Format, "Log format (console or json)")
+	_ = cmd.PersistentFlags().String("logger.file_format", defaults.Logger.FileFormat, "Log format of file outputs (console or json, defaults to logger.format)")
+	_ = cmd.PersistentFlags().String("logger.output", defaults.Logger.Output, "Log outputs, comma-separated (stdout or file paths)")
+	_ = cmd.PersistentFlags().Bool("logger.no_color", defaults.Logger.NoColor, "Disable colored output")
 
 	// App flags
-	_ = cmd.PersistentFlags().String("app.name", "do-template-worker", "Application name")
-	_ = cmd.PersistentFlags().String("app.version", "1.0.0", "Application version")
-	_ = cmd.PersistentFlags().String("app.environment", "development", "Application environment")
-	_ = cmd.PersistentFlags().Bool("app.debug", false, "Debug mode")
+	_ = cmd.PersistentFlags().String("app.name", defaults.App.Name, "Application name")
+	_ = cmd.PersistentFlags().String("app.version", defaults.App.Version, "Application version")
+	_ = cmd.PersistentFlags().String("app.environment", defaults.App.Environment, "Application environment")
+	_ = cmd.PersistentFlags().Bool("app.debug", defaults.App.Debug, "Debug mode")
+	_ = cmd.PersistentFlags().Int("app.metrics_port", defaults.App.MetricsPort, "Port of the health and metrics HTTP server")
+	_ = cmd.PersistentFlags().Duration("app.shutdown_hook_timeout", defaults.App.ShutdownHookTimeout, "Timeout of each shutdown hook (0 = none)")
+	_ = cmd.PersistentFlags().Duration("app.shutdown_timeout", defaults.App.ShutdownTimeout, "Timeout of the whole shutdown, after which the process exits anyway (0 = none)")
+	_ = cmd.PersistentFlags().Bool("app.require_migrations", defaults.App.RequireMigrations, "Refuse to serve while database migrations are pending")
+	_ = cmd.PersistentFlags().Int("app.max_worker_restarts", defaults.App.MaxWorkerRestarts, "Restarts in a row of a dead worker before serve exits")
+	_ = cmd.PersistentFlags().Bool("app.tracing_enabled", defaults.App.TracingEnabled, "Propagate trace contexts through message headers")
+	_ = cmd.PersistentFlags().String("app.otlp_endpoint", defaults.App.OTLPEndpoint, "URL of the OTLP/HTTP collector receiving spans (empty = spans are only logged)")
+
+	// User flags
+	_ = cmd.PersistentFlags().Float64("user.create_rate_limit", defaults.User.CreateRateLimit, "Maximum user creations per second (0 = unlimited)")
+	_ = cmd.PersistentFlags().String("user.password_hashing", defaults.User.PasswordHashing, "Password hashing algorithm (none, bcrypt, argon2id)")
+	_ = cmd.PersistentFlags().Int("user.password_cost", defaults.User.PasswordCost, "Bcrypt cost or argon2id passes (0 = algorithm default)")
+
+	// Consumer flags
+	_ = cmd.PersistentFlags().Int("consumer.max_requeues", defaults.Consumer.MaxRequeues, "Maximum requeues of a failed message before dead-lettering (0 = unlimited)")
+	_ = cmd.PersistentFlags().Duration("consumer.process_timeout", defaults.Consumer.ProcessTimeout, "Maximum processing time of a message before dead-lettering (0 = no timeout)")
+	_ = cmd.PersistentFlags().String("consumer.ordering", defaults.Consumer.Ordering, "Consumer ordering mode (none, strict)")
+	_ = cmd.PersistentFlags().Duration("consumer.heartbeat_interval", defaults.Consumer.HeartbeatInterval, "Delay between two consumer heartbeat logs (0 = disabled)")
+	_ = cmd.PersistentFlags().Bool("consumer.requeue_on_shutdown", defaults.Consumer.RequeueOnShutdown, "Requeue messages left unfinished at shutdown")
+	_ = cmd.PersistentFlags().Duration("consumer.shutdown_grace_period", defaults.Consumer.ShutdownGracePeriod, "Time given to the messages being processed to finish on shutdown (0 = up to the shutdown hook timeout)")
+	_ = cmd.PersistentFlags().StringSlice("consumer.accept_sources", defaults.Consumer.AcceptSources, "Only process messages from these source services (empty = all)")
+	_ = cmd.PersistentFlags().String("consumer.malformed_messages", defaults.Consumer.MalformedMessages, "Handling of empty or invalid JSON messages (dead_letter, drop)")
+	_ = cmd.PersistentFlags().Bool("consumer.store_results", defaults.Consumer.StoreResults, "Store the outcome of processed messages in the message_results table")
+	_ = cmd.PersistentFlags().Bool("consumer.log_body", defaults.Consumer.LogBody, "Log the body of consumed messages at debug level")
+	_ = cmd.PersistentFlags().Int("consumer.log_body_max_bytes", defaults.Consumer.LogBodyMaxBytes, "Maximum number of logged bytes of a message body (0 = whole body)")
+	_ = cmd.PersistentFlags().StringSlice("consumer.log_body_redact", defaults.Consumer.LogBodyRedact, "Message body fields whose values are redacted in logs")
+	_ = cmd.PersistentFlags().Bool("consumer.transactional", defaults.Consumer.Transactional, "Commit the database writes of a message with a processed-message record before acking it")
+
+	// Producer flags
+	_ = cmd.PersistentFlags().String("producer.action", defaults.Producer.Action, "Action of the produced messages")
+	_ = cmd.PersistentFlags().Duration("producer.interval", defaults.Producer.Interval, "Delay between two produced messages")
+	_ = cmd.PersistentFlags().String("producer.payload_template", defaults.Producer.PayloadTemplate, "Template of the JSON payload of the produced messages (given .Seq, .Unix and .UnixNano)")
+	_ = cmd.PersistentFlags().Int("producer.max_backlog", defaults.Producer.MaxBacklog, "Skip production while the queue holds more ready messages (0 to disable)")
+	_ = cmd.PersistentFlags().Duration("producer.publish_timeout", defaults.Producer.PublishTimeout, "Give up publishing a message after this delay (0 to disable)")
+
+	// Jobs flags
+	_ = cmd.PersistentFlags().Duration("jobs.cleanup_schedule", defaults.Jobs.CleanupSchedule, "Interval between two cleanups run by serve (0 = disabled)")
+	_ = cmd.PersistentFlags().Duration("jobs.cleanup_retention", defaults.Jobs.CleanupRetention, "Age after which failed messages are deleted by the cleanup")
+
+	// Outbox flags
+	_ = cmd.PersistentFlags().Bool("outbox.enabled", defaults.Outbox.Enabled, "Write produced messages to the outbox table, published by the relay run by serve")
+	_ = cmd.PersistentFlags().Duration("outbox.relay_interval", defaults.Outbox.RelayInterval, "Delay between two polls of the outbox by the relay")
+	_ = cmd.PersistentFlags().Int("outbox.batch_size", defaults.Outbox.BatchSize, "Maximum number of messages published by a single outbox poll")
+
+	// HTTP flags
+	_ = cmd.PersistentFlags().Duration("http.read_header_timeout", defaults.HTTP.ReadHeaderTimeout, "HTTP server timeout for reading request headers")
+	_ = cmd.PersistentFlags().Duration("http.read_timeout", defaults.HTTP.ReadTimeout, "HTTP server timeout for reading a whole request")
+	_ = cmd.PersistentFlags().Duration("http.write_timeout", defaults.HTTP.WriteTimeout, "HTTP server timeout for writing a response")
+	_ = cmd.PersistentFlags().Duration("http.idle_timeout", defaults.HTTP.IdleTimeout, "HTTP server timeout for idle keep-alive connections")
+	_ = cmd.PersistentFlags().String("http.config_token", defaults.HTTP.ConfigToken, "Bearer token protecting the /config endpoint (empty disables it)")
+
+	// Shutdown flags
+	_ = cmd.PersistentFlags().Duration("shutdown.predrain_delay", defaults.Shutdown.PredrainDelay, "Delay between failing /readyz and stopping the workers on shutdown (0 = none)")
 
 	// Bind all flags to viper for automatic configuration
 	cs.bindFlagsToViper(cmd)
@@ -120,21 +595,44 @@ func (cs *Config) bindFlagsToViper(cmd *cobra.Command) {
 	_ = viper.BindPFlag("database.password", cmd.PersistentFlags().Lookup("database.password"))
 	_ = viper.BindPFlag("database.database", cmd.PersistentFlags().Lookup("database.database"))
 	_ = viper.BindPFlag("database.ssl_mode", cmd.PersistentFlags().Lookup("database.ssl_mode"))
+	_ = viper.BindPFlag("database.ssl_root_cert", cmd.PersistentFlags().Lookup("database.ssl_root_cert"))
+	_ = viper.BindPFlag("database.ssl_cert", cmd.PersistentFlags().Lookup("database.ssl_cert"))
+	_ = viper.BindPFlag("database.ssl_key", cmd.PersistentFlags().Lookup("database.ssl_key"))
 	_ = viper.BindPFlag("database.max_open_conns", cmd.PersistentFlags().Lookup("database.max_open_conns"))
 	_ = viper.BindPFlag("database.max_idle_conns", cmd.PersistentFlags().Lookup("database.max_idle_conns"))
 	_ = viper.BindPFlag("database.conn_max_lifetime", cmd.PersistentFlags().Lookup("database.conn_max_lifetime"))
+	_ = viper.BindPFlag("database.query_timeout", cmd.PersistentFlags().Lookup("database.query_timeout"))
+	_ = viper.BindPFlag("database.acquire_timeout", cmd.PersistentFlags().Lookup("database.acquire_timeout"))
+	_ = viper.BindPFlag("database.pool_degraded_threshold", cmd.PersistentFlags().Lookup("database.pool_degraded_threshold"))
+	_ = viper.BindPFlag("database.connect_timeout", cmd.PersistentFlags().Lookup("database.connect_timeout"))
+	_ = viper.BindPFlag("database.connect_max_retries", cmd.PersistentFlags().Lookup("database.connect_max_retries"))
+	_ = viper.BindPFlag("database.saturation_threshold", cmd.PersistentFlags().Lookup("database.saturation_threshold"))
 
 	// RabbitMQ flags
 	_ = viper.BindPFlag("rabbitmq.host", cmd.PersistentFlags().Lookup("rabbitmq.host"))
 	_ = viper.BindPFlag("rabbitmq.port", cmd.PersistentFlags().Lookup("rabbitmq.port"))
 	_ = viper.BindPFlag("rabbitmq.user", cmd.PersistentFlags().Lookup("rabbitmq.user"))
 	_ = viper.BindPFlag("rabbitmq.password", cmd.PersistentFlags().Lookup("rabbitmq.password"))
+	_ = viper.BindPFlag("rabbitmq.vhost", cmd.PersistentFlags().Lookup("rabbitmq.vhost"))
+	_ = viper.BindPFlag("rabbitmq.tls", cmd.PersistentFlags().Lookup("rabbitmq.tls"))
 	_ = viper.BindPFlag("rabbitmq.queue_name", cmd.PersistentFlags().Lookup("rabbitmq.queue_name"))
 	_ = viper.BindPFlag("rabbitmq.exchange", cmd.PersistentFlags().Lookup("rabbitmq.exchange"))
+	_ = viper.BindPFlag("rabbitmq.mirror_exchange", cmd.PersistentFlags().Lookup("rabbitmq.mirror_exchange"))
+	_ = viper.BindPFlag("rabbitmq.pause_on_flow_control", cmd.PersistentFlags().Lookup("rabbitmq.pause_on_flow_control"))
+	_ = viper.BindPFlag("rabbitmq.log_lifecycle", cmd.PersistentFlags().Lookup("rabbitmq.log_lifecycle"))
+	_ = viper.BindPFlag("rabbitmq.declare_exchange", cmd.PersistentFlags().Lookup("rabbitmq.declare_exchange"))
+	_ = viper.BindPFlag("rabbitmq.declare_queue", cmd.PersistentFlags().Lookup("rabbitmq.declare_queue"))
+	_ = viper.BindPFlag("rabbitmq.reconnect_max_attempts", cmd.PersistentFlags().Lookup("rabbitmq.reconnect_max_attempts"))
+	_ = viper.BindPFlag("rabbitmq.connect_timeout", cmd.PersistentFlags().Lookup("rabbitmq.connect_timeout"))
+	_ = viper.BindPFlag("rabbitmq.connect_max_retries", cmd.PersistentFlags().Lookup("rabbitmq.connect_max_retries"))
+	_ = viper.BindPFlag("rabbitmq.prefetch_count", cmd.PersistentFlags().Lookup("rabbitmq.prefetch_count"))
+	_ = viper.BindPFlag("rabbitmq.consumer_concurrency", cmd.PersistentFlags().Lookup("rabbitmq.consumer_concurrency"))
+	_ = viper.BindPFlag("rabbitmq.dlx_name", cmd.PersistentFlags().Lookup("rabbitmq.dlx_name"))
 
 	// Logger flags
 	_ = viper.BindPFlag("logger.level", cmd.PersistentFlags().Lookup("logger.level"))
 	_ = viper.BindPFlag("logger.format", cmd.PersistentFlags().Lookup("logger.format"))
+	_ = viper.BindPFlag("logger.file_format", cmd.PersistentFlags().Lookup("logger.file_format"))
 	_ = viper.BindPFlag("logger.output", cmd.PersistentFlags().Lookup("logger.output"))
 	_ = viper.BindPFlag("logger.no_color", cmd.PersistentFlags().Lookup("logger.no_color"))
 
@@ -143,4 +641,57 @@ func (cs *Config) bindFlagsToViper(cmd *cobra.Command) {
 	_ = viper.BindPFlag("app.version", cmd.PersistentFlags().Lookup("app.version"))
 	_ = viper.BindPFlag("app.environment", cmd.PersistentFlags().Lookup("app.environment"))
 	_ = viper.BindPFlag("app.debug", cmd.PersistentFlags().Lookup("app.debug"))
+	_ = viper.BindPFlag("app.metrics_port", cmd.PersistentFlags().Lookup("app.metrics_port"))
+	_ = viper.BindPFlag("app.shutdown_hook_timeout", cmd.PersistentFlags().Lookup("app.shutdown_hook_timeout"))
+	_ = viper.BindPFlag("app.shutdown_timeout", cmd.PersistentFlags().Lookup("app.shutdown_timeout"))
+	_ = viper.BindPFlag("app.require_migrations", cmd.PersistentFlags().Lookup("app.require_migrations"))
+	_ = viper.BindPFlag("app.max_worker_restarts", cmd.PersistentFlags().Lookup("app.max_worker_restarts"))
+	_ = viper.BindPFlag("app.tracing_enabled", cmd.PersistentFlags().Lookup("app.tracing_enabled"))
+	_ = viper.BindPFlag("app.otlp_endpoint", cmd.PersistentFlags().Lookup("app.otlp_endpoint"))
+
+	// User flags
+	_ = viper.BindPFlag("user.create_rate_limit", cmd.PersistentFlags().Lookup("user.create_rate_limit"))
+	_ = viper.BindPFlag("user.password_hashing", cmd.PersistentFlags().Lookup("user.password_hashing"))
+	_ = viper.BindPFlag("user.password_cost", cmd.PersistentFlags().Lookup("user.password_cost"))
+
+	// Consumer flags
+	_ = viper.BindPFlag("consumer.max_requeues", cmd.PersistentFlags().Lookup("consumer.max_requeues"))
+	_ = viper.BindPFlag("consumer.process_timeout", cmd.PersistentFlags().Lookup("consumer.process_timeout"))
+	_ = viper.BindPFlag("consumer.ordering", cmd.PersistentFlags().Lookup("consumer.ordering"))
+	_ = viper.BindPFlag("consumer.heartbeat_interval", cmd.PersistentFlags().Lookup("consumer.heartbeat_interval"))
+	_ = viper.BindPFlag("consumer.requeue_on_shutdown", cmd.PersistentFlags().Lookup("consumer.requeue_on_shutdown"))
+	_ = viper.BindPFlag("consumer.shutdown_grace_period", cmd.PersistentFlags().Lookup("consumer.shutdown_grace_period"))
+	_ = viper.BindPFlag("consumer.accept_sources", cmd.PersistentFlags().Lookup("consumer.accept_sources"))
+	_ = viper.BindPFlag("consumer.malformed_messages", cmd.PersistentFlags().Lookup("consumer.malformed_messages"))
+	_ = viper.BindPFlag("consumer.store_results", cmd.PersistentFlags().Lookup("consumer.store_results"))
+	_ = viper.BindPFlag("consumer.log_body", cmd.PersistentFlags().Lookup("consumer.log_body"))
+	_ = viper.BindPFlag("consumer.log_body_max_bytes", cmd.PersistentFlags().Lookup("consumer.log_body_max_bytes"))
+	_ = viper.BindPFlag("consumer.log_body_redact", cmd.PersistentFlags().Lookup("consumer.log_body_redact"))
+	_ = viper.BindPFlag("consumer.transactional", cmd.PersistentFlags().Lookup("consumer.transactional"))
+
+	// Producer flags
+	_ = viper.BindPFlag("producer.action", cmd.PersistentFlags().Lookup("producer.action"))
+	_ = viper.BindPFlag("producer.interval", cmd.PersistentFlags().Lookup("producer.interval"))
+	_ = viper.BindPFlag("producer.payload_template", cmd.PersistentFlags().Lookup("producer.payload_template"))
+	_ = viper.BindPFlag("producer.max_backlog", cmd.PersistentFlags().Lookup("producer.max_backlog"))
+	_ = viper.BindPFlag("producer.publish_timeout", cmd.PersistentFlags().Lookup("producer.publish_timeout"))
+
+	// Jobs flags
+	_ = viper.BindPFlag("jobs.cleanup_schedule", cmd.PersistentFlags().Lookup("jobs.cleanup_schedule"))
+	_ = viper.BindPFlag("jobs.cleanup_retention", cmd.PersistentFlags().Lookup("jobs.cleanup_retention"))
+
+	// Outbox flags
+	_ = viper.BindPFlag("outbox.enabled", cmd.PersistentFlags().Lookup("outbox.enabled"))
+	_ = viper.BindPFlag("outbox.relay_interval", cmd.PersistentFlags().Lookup("outbox.relay_interval"))
+	_ = viper.BindPFlag("outbox.batch_size", cmd.PersistentFlags().Lookup("outbox.batch_size"))
+
+	// HTTP flags
+	_ = viper.BindPFlag("http.read_header_timeout", cmd.PersistentFlags().Lookup("http.read_header_timeout"))
+	_ = viper.BindPFlag("http.read_timeout", cmd.PersistentFlags().Lookup("http.read_timeout"))
+	_ = viper.BindPFlag("http.write_timeout", cmd.PersistentFlags().Lookup("http.write_timeout"))
+	_ = viper.BindPFlag("http.idle_timeout", cmd.PersistentFlags().Lookup("http.idle_timeout"))
+	_ = viper.BindPFlag("http.config_token", cmd.PersistentFlags().Lookup("http.config_token"))
+
+	// Shutdown flags
+	_ = viper.BindPFlag("shutdown.predrain_delay", cmd.PersistentFlags().Lookup("shutdown.predrain_delay"))
 }
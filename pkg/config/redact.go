@@ -0,0 +1,105 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// redactedValue replaces secrets in a redacted configuration.
+const redactedValue = "[REDACTED]"
+
+// Redacted returns a copy of the configuration with every secret replaced by "[REDACTED]"
+// Unset secrets are left empty, so that the copy still tells whether a secret is configured.
+func (c *Config) Redacted() Config {
+	redacted := *c
+
+	redact(&redacted.Database.Password)
+	redact(&redacted.RabbitMQ.Password)
+	redact(&redacted.HTTP.ConfigToken)
+
+	redacted.Database.Shards = make([]DatabaseShardConfig, len(c.Database.Shards))
+	for i, shard := range c.Database.Shards {
+		redact(&shard.Password)
+		redacted.Database.Shards[i] = shard
+	}
+
+	return redacted
+}
+
+// redact replaces a secret, unless it is unset.
+func redact(secret *string) {
+	if *secret != "" {
+		*secret = redactedValue
+	}
+}
+
+// Settings returns the redacted configuration as nested maps keyed by config key, e.g.
+// settings["database"]["host"], ready to be encoded as JSON. Durations are rendered as strings.
+func (c *Config) Settings() map[string]any {
+	settings, _ := settingsOf(reflect.ValueOf(c.Redacted())).(map[string]any)
+	return settings
+}
+
+// settingsOf converts a configuration value, keying structs by their mapstructure tags.
+func settingsOf(v reflect.Value) any {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		settings := map[string]any{}
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+
+			if opts == "squash" {
+				for key, value := range settingsOf(v.Field(i)).(map[string]any) {
+					settings[key] = value
+				}
+				continue
+			}
+			if name == "" {
+				continue
+			}
+
+			settings[name] = settingsOf(v.Field(i))
+		}
+		return settings
+	case reflect.Slice:
+		list := make([]any, v.Len())
+		for i := range v.Len() {
+			list[i] = settingsOf(v.Index(i))
+		}
+		return list
+	default:
+		return v.Interface()
+	}
+}
+
+// Features returns the optional behaviors enabled by the configuration, by name.
+func (c *Config) Features() map[string]bool {
+	return map[string]bool{
+		"debug":                  c.App.Debug,
+		"require_migrations":     c.App.RequireMigrations,
+		"tracing":                c.App.TracingEnabled,
+		"database_sharding":      len(c.Database.Shards) > 0,
+		"rabbitmq_tls":           c.RabbitMQ.TLS,
+		"message_mirroring":      c.RabbitMQ.MirrorExchange != "",
+		"dead_letter_exchange":   c.RabbitMQ.DLXName != "",
+		"pause_on_flow_control":  c.RabbitMQ.PauseOnFlowControl,
+		"strict_ordering":        c.Consumer.Ordering == OrderingStrict,
+		"requeue_on_shutdown":    c.Consumer.RequeueOnShutdown,
+		"payload_schemas":        len(c.Consumer.Schemas) > 0,
+		"store_results":          c.Consumer.StoreResults,
+		"message_body_logging":   c.Consumer.LogBody,
+		"transactional_consumer": c.Consumer.Transactional,
+		"action_concurrency":     len(c.Consumer.ActionConcurrency) > 0,
+		"producer_backpressure":  c.Producer.MaxBacklog > 0,
+		"cleanup_job":            c.Jobs.CleanupSchedule > 0,
+		"outbox":                 c.Outbox.Enabled,
+		"password_storage":       c.User.PasswordHashing != "" && c.User.PasswordHashing != PasswordHashingNone,
+		"user_create_rate_limit": c.User.CreateRateLimit > 0,
+	}
+}
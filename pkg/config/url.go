@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Full-URL environment variables injected by cloud platforms (Heroku, Render, Fly...).
+const (
+	envDatabaseURL  = "DATABASE_URL"
+	envAMQPURL      = "AMQP_URL"
+	envCloudAMQPURL = "CLOUDAMQP_URL"
+)
+
+// applyURLEnv overrides the piecewise database and RabbitMQ settings with the full-URL
+// environment variables, when present
+// A URL takes precedence over every piecewise setting, including flags: platforms inject it
+// as the source of truth for the attached resource. Only the fields present in the URL are
+// overridden, e.g. a DATABASE_URL without sslmode keeps database.ssl_mode.
+func (cs *Config) applyURLEnv() error {
+	if raw := os.Getenv(envDatabaseURL); raw != "" {
+		if err := cs.Database.applyURL(raw); err != nil {
+			return fmt.Errorf("invalid %s: %w", envDatabaseURL, err)
+		}
+	}
+
+	// AMQP_URL wins over the CloudAMQP-specific variable
+	for _, env := range []string{envAMQPURL, envCloudAMQPURL} {
+		if raw := os.Getenv(env); raw != "" {
+			if err := cs.RabbitMQ.applyURL(raw); err != nil {
+				return fmt.Errorf("invalid %s: %w", env, err)
+			}
+			break
+		}
+	}
+
+	return nil
+}
+
+// applyURL sets the connection settings from a postgres:// URL.
+func (c *DatabaseConfig) applyURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	if err := applyURLAuthority(u, &c.Host, &c.Port, &c.User, &c.Password); err != nil {
+		return err
+	}
+	if name := strings.TrimPrefix(u.Path, "/"); name != "" {
+		c.Database = name
+	}
+	for param, field := range map[string]*string{
+		"sslmode":     &c.SSLMode,
+		"sslrootcert": &c.SSLRootCert,
+		"sslcert":     &c.SSLCert,
+		"sslkey":      &c.SSLKey,
+	} {
+		if value := u.Query().Get(param); value != "" {
+			*field = value
+		}
+	}
+
+	return nil
+}
+
+// applyURL sets the connection settings from an amqp:// or amqps:// URL.
+func (c *RabbitMQConfig) applyURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "amqp":
+		c.TLS = false
+	case "amqps":
+		c.TLS = true
+	default:
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	if err := applyURLAuthority(u, &c.Host, &c.Port, &c.User, &c.Password); err != nil {
+		return err
+	}
+	if vhost := strings.TrimPrefix(u.Path, "/"); vhost != "" {
+		c.VHost = vhost
+	}
+
+	return nil
+}
+
+// applyURLAuthority sets the host, port and credentials found in a URL.
+func applyURLAuthority(u *url.URL, host *string, port *int, user, password *string) error {
+	if h := u.Hostname(); h != "" {
+		*host = h
+	}
+	if p := u.Port(); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", p)
+		}
+		*port = n
+	}
+	if u.User != nil {
+		*user = u.User.Username()
+		if pass, ok := u.User.Password(); ok {
+			*password = pass
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// LogFormatConsole is the human-readable log format.
+	LogFormatConsole = "console"
+	// LogFormatJSON is the raw zerolog format, one JSON object per line, for log collectors.
+	LogFormatJSON = "json"
+)
+
+// logFormats lists the supported logger.format values.
+var logFormats = []string{LogFormatConsole, LogFormatJSON}
+
+// Validate checks the configuration, returning an error listing every problem found
+// It runs once flags, environment variables and config files are all loaded, before any
+// connection is opened, so that a misconfiguration fails at startup rather than on first use.
+func (c *Config) Validate() error {
+	var errs []error
+
+	errs = append(errs, c.Database.validate("database", true)...)
+	for i, shard := range c.Database.Shards {
+		name := shard.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		// Shard fields left unset are inherited from the top-level database configuration
+		errs = append(errs, shard.validate("database.shards["+name+"]", false)...)
+		errs = append(errs, shard.validateTLS("database.shards["+name+"]", cmp.Or(shard.SSLMode, c.Database.SSLMode))...)
+	}
+	errs = append(errs, c.Database.validateTLS("database", c.Database.SSLMode)...)
+	if c.Database.SaturationThreshold < 0 {
+		errs = append(errs, fmt.Errorf("database.saturation_threshold must not be negative, got %d", c.Database.SaturationThreshold))
+	}
+	if c.Database.ConnectTimeout < 0 {
+		errs = append(errs, fmt.Errorf("database.connect_timeout must not be negative, got %s", c.Database.ConnectTimeout))
+	}
+	if c.Database.ConnectMaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("database.connect_max_retries must not be negative, got %d", c.Database.ConnectMaxRetries))
+	}
+
+	errs = append(errs, required("rabbitmq.host", c.RabbitMQ.Host)...)
+	errs = append(errs, required("rabbitmq.user", c.RabbitMQ.User)...)
+	errs = append(errs, port("rabbitmq.port", c.RabbitMQ.Port)...)
+	if c.RabbitMQ.ReconnectMaxAttempts < 0 {
+		errs = append(errs, fmt.Errorf("rabbitmq.reconnect_max_attempts must not be negative, got %d", c.RabbitMQ.ReconnectMaxAttempts))
+	}
+	if c.RabbitMQ.ConnectTimeout < 0 {
+		errs = append(errs, fmt.Errorf("rabbitmq.connect_timeout must not be negative, got %s", c.RabbitMQ.ConnectTimeout))
+	}
+	if c.RabbitMQ.ConnectMaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("rabbitmq.connect_max_retries must not be negative, got %d", c.RabbitMQ.ConnectMaxRetries))
+	}
+	if c.RabbitMQ.PrefetchCount < 0 {
+		errs = append(errs, fmt.Errorf("rabbitmq.prefetch_count must not be negative, got %d", c.RabbitMQ.PrefetchCount))
+	}
+	errs = append(errs, c.validateConsumerConcurrency()...)
+	errs = append(errs, c.validateBindings()...)
+
+	if _, err := zerolog.ParseLevel(c.Logger.Level); err != nil || c.Logger.Level == "" {
+		errs = append(errs, fmt.Errorf("logger.level %q is invalid, expected one of trace, debug, info, warn, error, fatal, panic or disabled", c.Logger.Level))
+	}
+	if !slices.Contains(logFormats, c.Logger.Format) {
+		errs = append(errs, fmt.Errorf("logger.format %q is invalid, expected one of %s", c.Logger.Format, strings.Join(logFormats, ", ")))
+	}
+	if c.Logger.FileFormat != "" && !slices.Contains(logFormats, c.Logger.FileFormat) {
+		errs = append(errs, fmt.Errorf("logger.file_format %q is invalid, expected one of %s", c.Logger.FileFormat, strings.Join(logFormats, ", ")))
+	}
+
+	if c.Consumer.MaxRequeues < 0 {
+		errs = append(errs, fmt.Errorf("consumer.max_requeues must not be negative, got %d", c.Consumer.MaxRequeues))
+	}
+	if c.Consumer.LogBodyMaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("consumer.log_body_max_bytes must not be negative, got %d", c.Consumer.LogBodyMaxBytes))
+	}
+	if c.Consumer.Transactional && len(c.Database.Shards) > 0 {
+		errs = append(errs, errors.New("consumer.transactional is not supported with database.shards: a transaction cannot span shards"))
+	}
+
+	if c.Producer.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("producer.interval must be positive, got %s", c.Producer.Interval))
+	}
+	if c.Producer.PublishTimeout < 0 {
+		errs = append(errs, fmt.Errorf("producer.publish_timeout must not be negative, got %s", c.Producer.PublishTimeout))
+	}
+
+	if c.Outbox.Enabled {
+		if c.Outbox.RelayInterval <= 0 {
+			errs = append(errs, fmt.Errorf("outbox.relay_interval must be positive, got %s", c.Outbox.RelayInterval))
+		}
+		if c.Outbox.BatchSize <= 0 {
+			errs = append(errs, fmt.Errorf("outbox.batch_size must be positive, got %d", c.Outbox.BatchSize))
+		}
+	}
+
+	if grace := c.Consumer.ShutdownGracePeriod; grace < 0 {
+		errs = append(errs, fmt.Errorf("consumer.shutdown_grace_period must not be negative, got %s", grace))
+	} else if hookTimeout := c.App.ShutdownHookTimeout; hookTimeout > 0 && grace >= hookTimeout {
+		// The hook would be abandoned before the grace period elapses, leaving no time to abort
+		errs = append(errs, fmt.Errorf("consumer.shutdown_grace_period %s must be shorter than app.shutdown_hook_timeout %s", grace, hookTimeout))
+	}
+
+	if endpoint := c.App.OTLPEndpoint; endpoint != "" {
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("app.otlp_endpoint %q must be an http or https URL", endpoint))
+		} else if !c.App.TracingEnabled {
+			errs = append(errs, errors.New("app.otlp_endpoint requires app.tracing_enabled"))
+		}
+	}
+
+	if c.App.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("app.shutdown_timeout must not be negative, got %s", c.App.ShutdownTimeout))
+	}
+
+	if c.Shutdown.PredrainDelay < 0 {
+		errs = append(errs, fmt.Errorf("shutdown.predrain_delay must not be negative, got %s", c.Shutdown.PredrainDelay))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// validateBindings checks that every rabbitmq.bindings entry has a queue of its own and a handler.
+func (c *Config) validateBindings() []error {
+	var errs []error
+
+	queues := map[string]bool{c.RabbitMQ.QueueName: true}
+	for i, binding := range c.RabbitMQ.Bindings {
+		switch {
+		case binding.Queue == "":
+			errs = append(errs, fmt.Errorf("rabbitmq.bindings[%d].queue is required", i))
+		case queues[binding.Queue]:
+			errs = append(errs, fmt.Errorf("rabbitmq.bindings[%d].queue %q is consumed already", i, binding.Queue))
+		}
+		queues[binding.Queue] = true
+
+		if binding.Handler == "" {
+			errs = append(errs, fmt.Errorf("rabbitmq.bindings[%d].handler is required", i))
+		}
+	}
+
+	return errs
+}
+
+// validateConsumerConcurrency checks rabbitmq.consumer_concurrency against the other consumer settings.
+func (c *Config) validateConsumerConcurrency() []error {
+	concurrency := c.RabbitMQ.ConsumerConcurrency
+	switch {
+	case concurrency < 1:
+		return []error{fmt.Errorf("rabbitmq.consumer_concurrency must be positive, got %d", concurrency)}
+	case concurrency == 1:
+		return nil
+	case c.Consumer.Ordering == OrderingStrict:
+		return []error{errors.New("rabbitmq.consumer_concurrency can't be combined with consumer.ordering=strict")}
+	case len(c.Consumer.ActionConcurrency) > 0:
+		return []error{errors.New("rabbitmq.consumer_concurrency can't be combined with consumer.action_concurrency")}
+	case c.RabbitMQ.PrefetchCount > 0 && c.RabbitMQ.PrefetchCount < concurrency:
+		// Extra goroutines would wait for deliveries the broker holds back
+		return []error{fmt.Errorf("rabbitmq.prefetch_count %d is lower than rabbitmq.consumer_concurrency %d", c.RabbitMQ.PrefetchCount, concurrency)}
+	default:
+		return nil
+	}
+}
+
+// validate checks a database configuration. Unless complete, unset fields are not reported.
+func (c DatabaseConfig) validate(prefix string, complete bool) []error {
+	var errs []error
+
+	if complete {
+		errs = append(errs, required(prefix+".host", c.Host)...)
+		errs = append(errs, required(prefix+".user", c.User)...)
+		errs = append(errs, required(prefix+".database", c.Database)...)
+	}
+	if complete || c.Port != 0 {
+		errs = append(errs, port(prefix+".port", c.Port)...)
+	}
+
+	if c.MaxOpenConns < 0 || (complete && c.MaxOpenConns == 0) {
+		errs = append(errs, fmt.Errorf("%s.max_open_conns must be positive, got %d", prefix, c.MaxOpenConns))
+	}
+	if c.MaxIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("%s.max_idle_conns must not be negative, got %d", prefix, c.MaxIdleConns))
+	}
+	if c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("%s.max_idle_conns (%d) must not exceed max_open_conns (%d)", prefix, c.MaxIdleConns, c.MaxOpenConns))
+	}
+
+	return errs
+}
+
+// validateTLS checks the certificate files of a database configuration
+// The files are only read by the verify-ca and verify-full ssl modes, whose files must exist.
+func (c DatabaseConfig) validateTLS(prefix, sslMode string) []error {
+	var errs []error
+
+	if (c.SSLCert == "") != (c.SSLKey == "") {
+		errs = append(errs, fmt.Errorf("%s.ssl_cert and %s.ssl_key must be set together", prefix, prefix))
+	}
+
+	if sslMode != "verify-ca" && sslMode != "verify-full" {
+		return errs
+	}
+	files := []struct{ key, path string }{
+		{"ssl_root_cert", c.SSLRootCert},
+		{"ssl_cert", c.SSLCert},
+		{"ssl_key", c.SSLKey},
+	}
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			errs = append(errs, fmt.Errorf("%s.%s: %w", prefix, file.key, err))
+		}
+	}
+
+	return errs
+}
+
+// required reports an empty value.
+func required(key, value string) []error {
+	if value == "" {
+		return []error{fmt.Errorf("%s is required", key)}
+	}
+	return nil
+}
+
+// port reports a value outside of the TCP port range.
+func port(key string, value int) []error {
+	if value < 1 || value > 65535 {
+		return []error{fmt.Errorf("%s must be between 1 and 65535, got %d", key, value)}
+	}
+	return nil
+}
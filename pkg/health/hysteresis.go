@@ -0,0 +1,43 @@
+package health
+
+import "sync"
+
+// Hysteresis debounces a condition observed over time, such as a saturated connection pool
+// It only turns active after threshold consecutive observations of the condition, and inactive
+// again after threshold consecutive observations without it, so that a condition oscillating
+// around its trigger doesn't flap readiness. A zero threshold never turns active.
+type Hysteresis struct {
+	mu        sync.Mutex
+	threshold int
+	active    bool
+	// streak counts the consecutive observations contradicting active
+	streak int
+}
+
+// NewHysteresis creates a hysteresis flipping after threshold consecutive observations.
+func NewHysteresis(threshold int) *Hysteresis {
+	return &Hysteresis{threshold: threshold}
+}
+
+// Observe records an observation of the condition and reports whether the hysteresis is active.
+func (h *Hysteresis) Observe(condition bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.threshold <= 0 {
+		return false
+	}
+
+	if condition == h.active {
+		h.streak = 0
+		return h.active
+	}
+
+	h.streak++
+	if h.streak >= h.threshold {
+		h.active = condition
+		h.streak = 0
+	}
+
+	return h.active
+}
@@ -0,0 +1,35 @@
+package health
+
+import "testing"
+
+func TestHysteresis(t *testing.T) {
+	t.Parallel()
+
+	h := NewHysteresis(3)
+
+	// A brief spike is ignored
+	for i, observation := range []bool{true, true, false, true, true} {
+		if h.Observe(observation) {
+			t.Fatalf("observation %d: expected a broken streak not to activate", i)
+		}
+	}
+
+	if !h.Observe(true) {
+		t.Fatal("expected three consecutive observations to activate")
+	}
+
+	// Recovering takes as many consecutive observations without the condition
+	for i, observation := range []bool{false, false, true, false, false} {
+		if !h.Observe(observation) {
+			t.Fatalf("observation %d: expected a broken streak not to deactivate", i)
+		}
+	}
+
+	if h.Observe(false) {
+		t.Fatal("expected three consecutive observations to deactivate")
+	}
+
+	if NewHysteresis(0).Observe(true) {
+		t.Fatal("expected a zero threshold to never activate")
+	}
+}
@@ -0,0 +1,164 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/samber/do/v2"
+)
+
+// checkTimeout bounds the live checks run by /readyz.
+const checkTimeout = 2 * time.Second
+
+// ComponentStatus is the last known health of an application component.
+type ComponentStatus struct {
+	Healthy bool `json:"healthy"`
+	// Degraded flags a healthy component nearing a failure, e.g. a saturating pool.
+	// Degraded components don't fail readiness.
+	Degraded bool           `json:"degraded,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Details  map[string]any `json:"details,omitempty"`
+	Since    time.Time      `json:"since"`
+}
+
+// Check reports the live health of a component. Since is managed by the registry.
+type Check func(ctx context.Context) ComponentStatus
+
+// Registry tracks the health of the application components and serves it over HTTP
+// This service demonstrates how to share state between workers and the HTTP server through DI:
+// components report their status, the /readyz endpoint aggregates them.
+type Registry struct {
+	mu         sync.RWMutex
+	components map[string]ComponentStatus
+	checks     map[string]Check
+}
+
+// NewRegistry creates a new, empty health registry.
+func NewRegistry(injector do.Injector) (*Registry, error) {
+	return &Registry{components: map[string]ComponentStatus{}, checks: map[string]Check{}}, nil
+}
+
+// AddCheck registers a live check, run on each /readyz request, for components that can't
+// report their own status changes, such as the database pool.
+func (r *Registry) AddCheck(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.checks == nil {
+		r.checks = map[string]Check{}
+	}
+	r.checks[name] = check
+}
+
+// RunChecks runs the registered live checks and records their status.
+func (r *Registry) RunChecks(ctx context.Context) {
+	r.mu.RLock()
+	checks := make(map[string]Check, len(r.checks))
+	for name, check := range r.checks {
+		checks[name] = check
+	}
+	r.mu.RUnlock()
+
+	for name, check := range checks {
+		r.set(name, check(ctx))
+	}
+}
+
+// SetHealthy marks a component as healthy.
+func (r *Registry) SetHealthy(name string) {
+	r.set(name, ComponentStatus{Healthy: true})
+}
+
+// SetUnhealthy marks a component as unhealthy because of err.
+func (r *Registry) SetUnhealthy(name string, err error) {
+	status := ComponentStatus{Healthy: false}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	r.set(name, status)
+}
+
+// set records a status, keeping the time of the last transition.
+func (r *Registry) set(name string, status ComponentStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, ok := r.components[name]
+	if ok && previous.Healthy == status.Healthy && previous.Degraded == status.Degraded {
+		status.Since = previous.Since
+	} else {
+		status.Since = time.Now()
+	}
+
+	r.components[name] = status
+}
+
+// Ready reports whether every component is healthy, along with a snapshot of their statuses.
+func (r *Registry) Ready() (bool, map[string]ComponentStatus) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ready := true
+	components := make(map[string]ComponentStatus, len(r.components))
+	for name, status := range r.components {
+		components[name] = status
+		ready = ready && status.Healthy
+	}
+
+	return ready, components
+}
+
+// degraded reports whether any component is degraded.
+func degraded(components map[string]ComponentStatus) bool {
+	for _, status := range components {
+		if status.Degraded {
+			return true
+		}
+	}
+	return false
+}
+
+// readiness is the JSON body of the /readyz endpoint.
+type readiness struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Handler returns an HTTP handler serving /healthz and /readyz
+// /healthz only reports that the process is alive, /readyz returns 503 while any component is unhealthy,
+// and 200 with a "degraded" status while components are healthy but some are degraded.
+func (r *Registry) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), checkTimeout)
+		r.RunChecks(ctx)
+		cancel()
+
+		ready, components := r.Ready()
+
+		body := readiness{Status: "ready", Components: components}
+		code := http.StatusOK
+		switch {
+		case !ready:
+			body.Status = "not_ready"
+			code = http.StatusServiceUnavailable
+		case degraded(components):
+			body.Status = "degraded"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(body)
+	})
+
+	return mux
+}
@@ -0,0 +1,73 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistryReadiness(t *testing.T) {
+	t.Parallel()
+
+	registry := &Registry{components: map[string]ComponentStatus{}}
+	handler := registry.Handler()
+
+	readyz := func() int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return recorder.Code
+	}
+
+	registry.SetHealthy("consumer")
+	registry.SetUnhealthy("producer", errors.New("rabbitmq is down"))
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with an unhealthy component, got %d", code)
+	}
+
+	registry.SetHealthy("producer")
+	if code := readyz(); code != http.StatusOK {
+		t.Fatalf("expected 200 once every component is healthy, got %d", code)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected /healthz to return 200, got %d", recorder.Code)
+	}
+}
+
+func TestRegistryDegradedCheck(t *testing.T) {
+	t.Parallel()
+
+	registry := &Registry{components: map[string]ComponentStatus{}}
+	registry.SetHealthy("consumer")
+
+	utilization := 0.5
+	registry.AddCheck("database", func(ctx context.Context) ComponentStatus {
+		return ComponentStatus{Healthy: true, Degraded: utilization >= 0.9}
+	})
+
+	readyz := func() (int, string) {
+		recorder := httptest.NewRecorder()
+		registry.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var body readiness
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode /readyz body: %v", err)
+		}
+		return recorder.Code, body.Status
+	}
+
+	if code, status := readyz(); code != http.StatusOK || status != "ready" {
+		t.Fatalf("expected 200 ready, got %d %s", code, status)
+	}
+
+	// A degraded component is reported without failing readiness
+	utilization = 0.95
+	if code, status := readyz(); code != http.StatusOK || status != "degraded" {
+		t.Fatalf("expected 200 degraded, got %d %s", code, status)
+	}
+}
@@ -0,0 +1,58 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/samber/do-template-worker/pkg/config"
+)
+
+// configResponse is the JSON body of the /config endpoint.
+type configResponse struct {
+	Environment string          `json:"environment"`
+	Version     string          `json:"version"`
+	Features    map[string]bool `json:"features"`
+	Config      map[string]any  `json:"config"`
+}
+
+// ConfigHandler returns an HTTP handler serving the effective configuration, with secrets redacted
+// Even redacted, the configuration reveals the topology of the deployment, so requests must carry
+// the http.config_token as a bearer token.
+func ConfigHandler(cfg *config.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !authorized(req, cfg.HTTP.ConfigToken) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		body := configResponse{
+			Environment: cfg.App.Environment,
+			Version:     cfg.App.Version,
+			Features:    cfg.Features(),
+			Config:      cfg.Settings(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(body)
+	})
+}
+
+// authorized tells whether a request carries the expected bearer token. An empty token authorizes nothing.
+func authorized(req *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
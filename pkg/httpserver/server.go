@@ -0,0 +1,21 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"github.com/samber/do-template-worker/pkg/config"
+)
+
+// New creates an http.Server listening on addr, with the timeouts from the http.* configuration
+// Every HTTP surface of the application should be created through this function, so that
+// none of them runs with the unbounded defaults of http.Server.
+func New(cfg config.HTTPConfig, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
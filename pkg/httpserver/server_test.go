@@ -0,0 +1,82 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/config"
+)
+
+func TestNewAppliesTimeouts(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.HTTPConfig{
+		ReadHeaderTimeout: 1 * time.Second,
+		ReadTimeout:       2 * time.Second,
+		WriteTimeout:      3 * time.Second,
+		IdleTimeout:       4 * time.Second,
+	}
+
+	server := New(cfg, ":8080", http.NotFoundHandler())
+
+	if server.ReadHeaderTimeout != cfg.ReadHeaderTimeout || server.ReadTimeout != cfg.ReadTimeout ||
+		server.WriteTimeout != cfg.WriteTimeout || server.IdleTimeout != cfg.IdleTimeout {
+		t.Fatalf("expected timeouts %+v to be applied, got %+v", cfg, server)
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{
+		App:      config.AppConfig{Environment: "production"},
+		Database: config.DatabaseConfig{Host: "db", Password: "db-secret"},
+		HTTP:     config.HTTPConfig{ConfigToken: "token", ReadTimeout: 10 * time.Second},
+		Consumer: config.ConsumerConfig{StoreResults: true},
+	}
+	handler := ConfigHandler(cfg)
+
+	for name, header := range map[string]string{"missing": "", "wrong": "Bearer nope", "not bearer": "token"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/config", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s token: expected 401, got %d", name, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/config", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	if strings.Contains(body, "db-secret") || strings.Contains(body, `"token"`) {
+		t.Fatalf("expected secrets to be redacted, got %s", body)
+	}
+
+	var got struct {
+		Environment string                    `json:"environment"`
+		Features    map[string]bool           `json:"features"`
+		Config      map[string]map[string]any `json:"config"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if got.Environment != "production" || !got.Features["store_results"] {
+		t.Fatalf("unexpected environment or features: %+v", got)
+	}
+	if got.Config["database"]["host"] != "db" || got.Config["http"]["read_timeout"] != "10s" {
+		t.Fatalf("unexpected config: %v", got.Config)
+	}
+}
@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/repositories"
+	"github.com/samber/do/v2"
+)
+
+// CleanupResult summarizes a cleanup run.
+type CleanupResult struct {
+	FailedMessagesDeleted    int64
+	MessageResultsDeleted    int64
+	OutboxMessagesDeleted    int64
+	ProcessedMessagesDeleted int64
+}
+
+// CleanupJob is a periodic maintenance job purging old records
+// This struct demonstrates how scheduled work can live alongside the event-driven workers,
+// sharing their injected repositories.
+type CleanupJob struct {
+	failedRepo    repositories.FailedMessageRepository
+	resultRepo    repositories.MessageResultRepository
+	outboxRepo    repositories.OutboxRepository
+	processedRepo repositories.ProcessedMessageRepository
+	logger        *zerolog.Logger
+	config        *config.Config
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+// NewCleanupJob creates a new cleanup job instance
+// This function demonstrates how to initialize a scheduled job with dependency injection.
+func NewCleanupJob(injector do.Injector) (*CleanupJob, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &CleanupJob{
+		failedRepo:    do.MustInvoke[repositories.FailedMessageRepository](injector),
+		resultRepo:    do.MustInvoke[repositories.MessageResultRepository](injector),
+		outboxRepo:    do.MustInvoke[repositories.OutboxRepository](injector),
+		processedRepo: do.MustInvoke[repositories.ProcessedMessageRepository](injector),
+		logger:        do.MustInvoke[*zerolog.Logger](injector),
+		config:        do.MustInvoke[*config.Config](injector),
+		ctx:           ctx,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}, nil
+}
+
+// Run performs a single cleanup, deleting the records older than jobs.cleanup_retention.
+func (j *CleanupJob) Run(ctx context.Context) (CleanupResult, error) {
+	before := time.Now().Add(-j.config.Jobs.CleanupRetention)
+
+	deleted, err := j.failedRepo.DeleteFailedMessagesBefore(ctx, before)
+	if err != nil {
+		return CleanupResult{}, fmt.Errorf("failed to clean up failed messages: %w", err)
+	}
+
+	result := CleanupResult{FailedMessagesDeleted: deleted}
+
+	result.MessageResultsDeleted, err = j.resultRepo.DeleteMessageResultsBefore(ctx, before)
+	if err != nil {
+		return result, fmt.Errorf("failed to clean up message results: %w", err)
+	}
+
+	// Only published outbox messages are deleted: pending ones are yet to be relayed
+	result.OutboxMessagesDeleted, err = j.outboxRepo.DeleteOutboxMessagesBefore(ctx, before)
+	if err != nil {
+		return result, fmt.Errorf("failed to clean up outbox messages: %w", err)
+	}
+
+	result.ProcessedMessagesDeleted, err = j.processedRepo.DeleteProcessedMessagesBefore(ctx, before)
+	if err != nil {
+		return result, fmt.Errorf("failed to clean up processed messages: %w", err)
+	}
+
+	j.logger.Info().
+		Int64("failed_messages_deleted", result.FailedMessagesDeleted).
+		Int64("message_results_deleted", result.MessageResultsDeleted).
+		Int64("outbox_messages_deleted", result.OutboxMessagesDeleted).
+		Int64("processed_messages_deleted", result.ProcessedMessagesDeleted).
+		Time("before", before).
+		Msg("Cleanup completed")
+
+	return result, nil
+}
+
+// Start runs the cleanup every jobs.cleanup_schedule until the job is shut down
+// The first run happens one interval after start, so that restarts don't trigger a burst of cleanups.
+func (j *CleanupJob) Start() error {
+	interval := j.config.Jobs.CleanupSchedule
+	if interval <= 0 {
+		return fmt.Errorf("invalid jobs.cleanup_schedule %s, expected a positive interval", interval)
+	}
+
+	j.logger.Info().
+		Dur("interval", interval).
+		Dur("retention", j.config.Jobs.CleanupRetention).
+		Msg("Starting cleanup job")
+
+	go func() {
+		defer close(j.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-j.ctx.Done():
+				j.logger.Info().Msg("Cleanup job stopped")
+				return
+			case <-ticker.C:
+				if _, err := j.Run(j.ctx); err != nil {
+					j.logger.Error().Err(err).Msg("Cleanup failed")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the cleanup job, interrupting a run in progress.
+func (j *CleanupJob) Shutdown() error {
+	j.cancel()
+	return nil
+}
@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/repositories"
+)
+
+// fakeFailedMessageRepository records the cutoff of deletions.
+type fakeFailedMessageRepository struct {
+	repositories.FailedMessageRepository
+	before time.Time
+}
+
+func (r *fakeFailedMessageRepository) DeleteFailedMessagesBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.before = before
+	return 3, nil
+}
+
+// fakeMessageResultRepository records the cutoff of deletions.
+type fakeMessageResultRepository struct {
+	repositories.MessageResultRepository
+	before time.Time
+}
+
+func (r *fakeMessageResultRepository) DeleteMessageResultsBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.before = before
+	return 5, nil
+}
+
+// fakeOutboxRepository records the cutoff of deletions.
+type fakeOutboxRepository struct {
+	repositories.OutboxRepository
+	before time.Time
+}
+
+func (r *fakeOutboxRepository) DeleteOutboxMessagesBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.before = before
+	return 7, nil
+}
+
+// fakeProcessedMessageRepository records the cutoff of deletions.
+type fakeProcessedMessageRepository struct {
+	repositories.ProcessedMessageRepository
+	before time.Time
+}
+
+func (r *fakeProcessedMessageRepository) DeleteProcessedMessagesBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.before = before
+	return 11, nil
+}
+
+func TestCleanupJobDeletesRecordsOlderThanRetention(t *testing.T) {
+	t.Parallel()
+
+	logger := zerolog.Nop()
+	repo := &fakeFailedMessageRepository{}
+	resultRepo := &fakeMessageResultRepository{}
+	outboxRepo := &fakeOutboxRepository{}
+	processedRepo := &fakeProcessedMessageRepository{}
+	job := &CleanupJob{
+		failedRepo:    repo,
+		resultRepo:    resultRepo,
+		outboxRepo:    outboxRepo,
+		processedRepo: processedRepo,
+		logger:        &logger,
+		config:        &config.Config{Jobs: config.JobsConfig{CleanupRetention: 24 * time.Hour}},
+	}
+
+	result, err := job.Run(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if result.FailedMessagesDeleted != 3 {
+		t.Fatalf("expected 3 deleted failed messages, got %d", result.FailedMessagesDeleted)
+	}
+	if result.MessageResultsDeleted != 5 {
+		t.Fatalf("expected 5 deleted message results, got %d", result.MessageResultsDeleted)
+	}
+	if result.OutboxMessagesDeleted != 7 {
+		t.Fatalf("expected 7 deleted outbox messages, got %d", result.OutboxMessagesDeleted)
+	}
+	if result.ProcessedMessagesDeleted != 11 {
+		t.Fatalf("expected 11 deleted processed messages, got %d", result.ProcessedMessagesDeleted)
+	}
+	if !resultRepo.before.Equal(repo.before) || !outboxRepo.before.Equal(repo.before) || !processedRepo.before.Equal(repo.before) {
+		t.Fatalf("expected every table to share the cutoff, got %s, %s, %s and %s", repo.before, resultRepo.before, outboxRepo.before, processedRepo.before)
+	}
+	if age := time.Since(repo.before); age < 24*time.Hour || age > 25*time.Hour {
+		t.Fatalf("expected records older than 24h to be deleted, got cutoff %s ago", age)
+	}
+}
@@ -0,0 +1,8 @@
+package jobs
+
+import "github.com/samber/do/v2"
+
+// JobPackage provides scheduled jobs to the dependency injector.
+var JobPackage = do.Package(
+	do.Lazy(NewCleanupJob),
+)
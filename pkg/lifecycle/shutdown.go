@@ -0,0 +1,191 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do/v2"
+)
+
+// Suggested shutdown priorities. Hooks run in ascending priority order.
+const (
+	// PriorityStopIntake stops accepting new work: consumers, HTTP listeners.
+	PriorityStopIntake = 0
+	// PriorityDrain waits for in-flight work to complete.
+	PriorityDrain = 100
+	// PriorityFlush flushes buffered data: metrics, traces, logs.
+	PriorityFlush = 200
+)
+
+// ErrShutdownTimeout is returned by Stop when the shutdown didn't complete within app.shutdown_timeout.
+var ErrShutdownTimeout = errors.New("shutdown timed out")
+
+// ShutdownHook is a function run during shutdown.
+type ShutdownHook func(ctx context.Context) error
+
+// shutdownHook is a registered hook.
+type shutdownHook struct {
+	name     string
+	priority int
+	hook     ShutdownHook
+}
+
+// ShutdownManager runs shutdown hooks in an explicit order
+// The container tears services down in reverse dependency order, which can't express
+// constraints such as "stop accepting first" or "flush metrics last". Hooks registered here
+// run in ascending priority order, then in registration order, before the container shuts down.
+type ShutdownManager struct {
+	logger      *zerolog.Logger
+	hookTimeout time.Duration
+	// timeout bounds Stop as a whole
+	timeout time.Duration
+
+	mu    sync.Mutex
+	hooks []shutdownHook
+	once  sync.Once
+	err   error
+}
+
+// NewShutdownManager creates a new shutdown manager
+// This function demonstrates how to provide an application-wide coordination service through DI.
+func NewShutdownManager(injector do.Injector) (*ShutdownManager, error) {
+	appConfig := do.MustInvoke[*config.Config](injector)
+
+	return &ShutdownManager{
+		logger:      do.MustInvoke[*zerolog.Logger](injector),
+		hookTimeout: appConfig.App.ShutdownHookTimeout,
+		timeout:     appConfig.App.ShutdownTimeout,
+	}, nil
+}
+
+// Register adds a named shutdown hook with the given priority.
+func (m *ShutdownManager) Register(name string, priority int, hook ShutdownHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hooks = append(m.hooks, shutdownHook{name: name, priority: priority, hook: hook})
+}
+
+// Run executes the registered hooks in priority order and returns their aggregated errors
+// Each hook is bounded by app.shutdown_hook_timeout; a failing or stuck hook doesn't prevent
+// the next ones from running. Hooks only run once, later calls return the first result.
+func (m *ShutdownManager) Run(ctx context.Context) error {
+	m.once.Do(func() {
+		m.mu.Lock()
+		hooks := append([]shutdownHook(nil), m.hooks...)
+		m.mu.Unlock()
+
+		sort.SliceStable(hooks, func(i, j int) bool {
+			return hooks[i].priority < hooks[j].priority
+		})
+
+		var errs []error
+		for i, hook := range hooks {
+			if i == 0 || hook.priority != hooks[i-1].priority {
+				m.logger.Info().Str("phase", phaseName(hook.priority)).Int("priority", hook.priority).Msg("Shutdown phase started")
+			}
+
+			if err := m.runHook(ctx, hook); err != nil {
+				errs = append(errs, fmt.Errorf("shutdown hook %s: %w", hook.name, err))
+			}
+		}
+
+		m.err = errors.Join(errs...)
+	})
+
+	return m.err
+}
+
+// Stop shuts the application down: the registered hooks first, then the services of the container
+// Hooks stop the workers, which stop taking work and drain what they were processing. The container
+// then shuts its services down in reverse dependency order, each one only once every service
+// depending on it is down: workers first, then the RabbitMQ connection and the repositories, and
+// the database pools last. No worker can thus use a connection closed under it.
+//
+// The whole shutdown is bounded by app.shutdown_timeout: a service whose Shutdown hangs is left
+// behind and ErrShutdownTimeout is returned, for the caller to exit anyway.
+func (m *ShutdownManager) Stop(ctx context.Context, injector do.Injector) error {
+	if m.timeout <= 0 {
+		return m.stop(ctx, injector)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.stop(ctx, injector)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w after %s: %w", ErrShutdownTimeout, m.timeout, ctx.Err())
+	}
+}
+
+// stop runs the hooks, then shuts the services of the container down.
+func (m *ShutdownManager) stop(ctx context.Context, injector do.Injector) error {
+	err := m.Run(ctx)
+
+	if report := injector.ShutdownWithContext(ctx); report != nil && !report.Succeed {
+		err = errors.Join(err, report)
+	}
+
+	return err
+}
+
+// phaseName names the shutdown phase of a priority.
+func phaseName(priority int) string {
+	switch priority {
+	case PriorityStopIntake:
+		return "stop intake"
+	case PriorityDrain:
+		return "drain"
+	case PriorityFlush:
+		return "flush"
+	default:
+		return fmt.Sprintf("priority %d", priority)
+	}
+}
+
+// runHook runs a single hook with its timeout and logs its outcome
+// The hook runs in its own goroutine so that the timeout holds even if it ignores its context.
+func (m *ShutdownManager) runHook(ctx context.Context, hook shutdownHook) error {
+	if m.hookTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.hookTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.hook(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	event := m.logger.Info()
+	if err != nil {
+		event = m.logger.Error().Err(err)
+	}
+	event.Str("hook", hook.name).
+		Int("priority", hook.priority).
+		Dur("duration", time.Since(start)).
+		Msg("Shutdown hook completed")
+
+	return err
+}
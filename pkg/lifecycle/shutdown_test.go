@@ -0,0 +1,182 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do/v2"
+)
+
+// newTestShutdownManager builds a shutdown manager with the given hook timeout.
+func newTestShutdownManager(t *testing.T, hookTimeout time.Duration) *ShutdownManager {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	return &ShutdownManager{logger: &logger, hookTimeout: hookTimeout}
+}
+
+func TestShutdownManagerRunsHooksInPriorityOrder(t *testing.T) {
+	t.Parallel()
+
+	m := newTestShutdownManager(t, time.Second)
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	record := func(name string) ShutdownHook {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	m.Register("flush", PriorityFlush, record("flush"))
+	m.Register("stop", PriorityStopIntake, record("stop"))
+	m.Register("drain_a", PriorityDrain, record("drain_a"))
+	m.Register("drain_b", PriorityDrain, record("drain_b"))
+
+	if err := m.Run(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []string{"stop", "drain_a", "drain_b", "flush"}
+	if fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Fatalf("expected hooks to run in order %v, got %v", expected, order)
+	}
+}
+
+func TestShutdownManagerAggregatesErrorsAndTimeouts(t *testing.T) {
+	t.Parallel()
+
+	m := newTestShutdownManager(t, 50*time.Millisecond)
+
+	failure := errors.New("flush failed")
+	ran := false
+
+	m.Register("stuck", PriorityStopIntake, func(ctx context.Context) error {
+		// Deliberately ignore the context to make sure the timeout is still enforced
+		time.Sleep(time.Second)
+		return nil
+	})
+	m.Register("failing", PriorityDrain, func(ctx context.Context) error {
+		return failure
+	})
+	m.Register("last", PriorityFlush, func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+
+	err := m.Run(context.Background())
+
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, failure) {
+		t.Fatalf("expected the timeout and the failure to be aggregated, got %v", err)
+	}
+	if !ran {
+		t.Fatal("expected hooks after failing ones to run")
+	}
+}
+
+// shutdownRecorder records the order in which services and hooks are shut down.
+type shutdownRecorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *shutdownRecorder) record(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.order = append(r.order, name)
+}
+
+// recordedService is a container service recording its shutdown.
+type recordedService struct {
+	name     string
+	recorder *shutdownRecorder
+}
+
+func (s *recordedService) Shutdown() error {
+	s.recorder.record(s.name)
+	return nil
+}
+
+type (
+	testDatabase struct{ *recordedService }
+	testBroker   struct{ *recordedService }
+	testWorker   struct{ *recordedService }
+)
+
+func TestShutdownManagerStopsWorkersBeforeDependencies(t *testing.T) {
+	t.Parallel()
+
+	recorder := &shutdownRecorder{}
+	injector := do.New()
+	do.Provide(injector, func(i do.Injector) (*testDatabase, error) {
+		return &testDatabase{&recordedService{name: "database", recorder: recorder}}, nil
+	})
+	do.Provide(injector, func(i do.Injector) (*testBroker, error) {
+		return &testBroker{&recordedService{name: "rabbitmq", recorder: recorder}}, nil
+	})
+	do.Provide(injector, func(i do.Injector) (*testWorker, error) {
+		do.MustInvoke[*testDatabase](i)
+		do.MustInvoke[*testBroker](i)
+		return &testWorker{&recordedService{name: "worker", recorder: recorder}}, nil
+	})
+
+	// Dependencies are invoked first, as when serve starts its workers
+	do.MustInvoke[*testWorker](injector)
+
+	m := newTestShutdownManager(t, time.Second)
+	m.Register("worker", PriorityStopIntake, func(ctx context.Context) error {
+		recorder.record("worker_hook")
+		return nil
+	})
+
+	if err := m.Stop(context.Background(), injector); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The database and the broker don't depend on each other, so they shut down in any order
+	if len(recorder.order) != 4 || recorder.order[0] != "worker_hook" || recorder.order[1] != "worker" {
+		t.Fatalf("expected the hook, then the worker, then its dependencies, got %v", recorder.order)
+	}
+}
+
+// stuckService is a container service whose Shutdown never returns, ignoring any deadline.
+type stuckService struct {
+	release chan struct{}
+}
+
+func (s *stuckService) Shutdown() error {
+	<-s.release
+	return nil
+}
+
+func TestShutdownManagerStopTimesOut(t *testing.T) {
+	t.Parallel()
+
+	stuck := &stuckService{release: make(chan struct{})}
+	t.Cleanup(func() { close(stuck.release) })
+
+	injector := do.New()
+	do.ProvideValue(injector, stuck)
+
+	m := newTestShutdownManager(t, time.Second)
+	m.timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	err := m.Stop(context.Background(), injector)
+	if !errors.Is(err, ErrShutdownTimeout) {
+		t.Fatalf("expected the stuck service to time the shutdown out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected Stop to return at the timeout, returned after %s", elapsed)
+	}
+}
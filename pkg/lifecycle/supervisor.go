@@ -0,0 +1,81 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrTooManyRestarts is returned by Supervise once a run loop keeps dying after its last allowed restart.
+var ErrTooManyRestarts = errors.New("too many restarts")
+
+// SupervisorOptions tunes Supervise.
+type SupervisorOptions struct {
+	// MaxRestarts is the number of restarts allowed in a row. Zero never restarts.
+	MaxRestarts int
+	// InitialBackoff is the delay before the first restart, doubled on each restart up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// StableAfter resets the restart count and the backoff once a run lasted that long,
+	// so that rare crashes over a long uptime don't add up to the limit. Zero never resets them.
+	StableAfter time.Duration
+}
+
+// Supervise runs a blocking run loop, restarting it when it dies unexpectedly
+// A run loop returning nil has stopped on purpose and is not restarted. One returning an error
+// or panicking is restarted with exponential backoff, up to opts.MaxRestarts times in a row,
+// after which Supervise gives up with ErrTooManyRestarts. It returns nil once ctx is done.
+func Supervise(ctx context.Context, name string, run func() error, opts SupervisorOptions, logger *zerolog.Logger) error {
+	restarts := 0
+	backoff := opts.InitialBackoff
+
+	for {
+		started := time.Now()
+		err := runRecovered(run)
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+
+		if opts.StableAfter > 0 && time.Since(started) >= opts.StableAfter {
+			restarts = 0
+			backoff = opts.InitialBackoff
+		}
+
+		if restarts >= opts.MaxRestarts {
+			return fmt.Errorf("%s: %w (%d): %w", name, ErrTooManyRestarts, restarts, err)
+		}
+		restarts++
+
+		logger.Warn().
+			Err(err).
+			Str("worker", name).
+			Int("restart", restarts).
+			Int("max_restarts", opts.MaxRestarts).
+			Dur("backoff", backoff).
+			Msg("Worker died, restarting")
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		backoff = min(2*backoff, opts.MaxBackoff)
+	}
+}
+
+// runRecovered calls run, turning a panic into an error.
+func runRecovered(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return run()
+}
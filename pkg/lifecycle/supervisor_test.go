@@ -0,0 +1,72 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// testSupervisorOptions restarts quickly, so that tests don't wait for the backoff.
+var testSupervisorOptions = SupervisorOptions{MaxRestarts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestSuperviseRestartsUntilCleanStop(t *testing.T) {
+	t.Parallel()
+
+	logger := zerolog.Nop()
+	runs := 0
+
+	err := Supervise(context.Background(), "consumer", func() error {
+		runs++
+		switch runs {
+		case 1:
+			return errors.New("message channel closed")
+		case 2:
+			panic("nil map")
+		default:
+			return nil
+		}
+	}, testSupervisorOptions, &logger)
+	if err != nil {
+		t.Fatalf("expected the worker to recover, got %v", err)
+	}
+	if runs != 3 {
+		t.Fatalf("expected 3 runs, got %d", runs)
+	}
+}
+
+func TestSuperviseGivesUpAfterMaxRestarts(t *testing.T) {
+	t.Parallel()
+
+	logger := zerolog.Nop()
+	runs := 0
+
+	err := Supervise(context.Background(), "consumer", func() error {
+		runs++
+		panic("boom")
+	}, testSupervisorOptions, &logger)
+	if !errors.Is(err, ErrTooManyRestarts) || !strings.Contains(err.Error(), "panic: boom") {
+		t.Fatalf("expected ErrTooManyRestarts with the last reason, got %v", err)
+	}
+	if runs != 3 {
+		t.Fatalf("expected the first run and 2 restarts, got %d runs", runs)
+	}
+}
+
+func TestSuperviseStopsWithContext(t *testing.T) {
+	t.Parallel()
+
+	logger := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := Supervise(ctx, "producer", func() error {
+		cancel()
+		return errors.New("interrupted")
+	}, testSupervisorOptions, &logger)
+	if err != nil {
+		t.Fatalf("expected no error once the context is done, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+// CorrelationIDField is the log field carrying the correlation ID.
+const CorrelationIDField = "message_id"
+
+// correlationIDKey is the context key of the correlation ID.
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a context carrying the correlation ID, such as the ID of the message being
+// handled, and a child of its logger bound to it. Spans and loggers taken from the context with
+// zerolog.Ctx then log the ID, so that the logs of every layer handling a message can be traced
+// back to it. An empty ID leaves the context unchanged.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+
+	log := zerolog.Ctx(ctx).With().Str(CorrelationIDField, id).Logger()
+	return log.WithContext(context.WithValue(ctx, correlationIDKey{}, id))
+}
+
+// CorrelationID returns the correlation ID carried by the context, or an empty string.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
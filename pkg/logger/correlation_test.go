@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestWithCorrelationID(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	log := zerolog.New(&out)
+	ctx := log.WithContext(context.Background())
+
+	if WithCorrelationID(ctx, "") != ctx {
+		t.Fatal("expected an empty ID to leave the context unchanged")
+	}
+
+	ctx = WithCorrelationID(ctx, "msg_1")
+	if id := CorrelationID(ctx); id != "msg_1" {
+		t.Fatalf("expected the correlation ID to be carried, got %q", id)
+	}
+
+	// Layers down the call chain log the ID through the context logger
+	end := Span(ctx, "user.create")
+	end(nil)
+	zerolog.Ctx(ctx).Info().Msg("Created user")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 log lines, got %d: %s", len(lines), out.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, `"message_id":"msg_1"`) {
+			t.Fatalf("expected every line to carry the message ID, got %s", line)
+		}
+	}
+}
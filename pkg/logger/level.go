@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do/v2"
+)
+
+// LevelEnv is the environment variable overriding logger.level, to change the verbosity of a
+// single run without touching the configuration.
+const LevelEnv = "LOG_LEVEL"
+
+// resolveLevel returns the level of LOG_LEVEL when set, or the configured one, info when empty or invalid
+// An invalid LOG_LEVEL is reported and ignored, so that a typo doesn't silence the logs. An empty level
+// must not be parsed: zerolog reads it as NoLevel, which drops every message.
+func resolveLevel(configured string) (zerolog.Level, error) {
+	var envErr error
+	if override := os.Getenv(LevelEnv); override != "" {
+		level, err := zerolog.ParseLevel(override)
+		if err == nil {
+			return level, nil
+		}
+		envErr = fmt.Errorf("invalid %s %q, using logger.level: %w", LevelEnv, override, err)
+	}
+
+	level, err := zerolog.ParseLevel(configured)
+	if configured == "" || err != nil {
+		return zerolog.InfoLevel, envErr
+	}
+
+	return level, envErr
+}
+
+// LevelController changes the log level at runtime
+// The level is global to the process, so it applies to the injected logger and every logger derived from it.
+type LevelController struct{}
+
+// NewLevelController creates a LevelController. It depends on the logger, whose creation sets the initial level.
+func NewLevelController(i do.Injector) (*LevelController, error) {
+	do.MustInvoke[*zerolog.Logger](i)
+	return &LevelController{}, nil
+}
+
+// Level returns the current log level.
+func (c *LevelController) Level() string {
+	return zerolog.GlobalLevel().String()
+}
+
+// SetLevel sets the log level, e.g. debug, info or warn. An invalid level is rejected and leaves it unchanged.
+func (c *LevelController) SetLevel(level string) error {
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	zerolog.SetGlobalLevel(parsed)
+	return nil
+}
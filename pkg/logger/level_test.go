@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// The tests below set LOG_LEVEL or the global level, so they can't run in parallel with the others.
+
+func TestResolveLevel(t *testing.T) {
+	tests := map[string]struct {
+		env        string
+		configured string
+		expected   zerolog.Level
+		expectErr  bool
+	}{
+		"configured level":           {configured: "warn", expected: zerolog.WarnLevel},
+		"empty configured level":     {configured: "", expected: zerolog.InfoLevel},
+		"invalid configured level":   {configured: "loud", expected: zerolog.InfoLevel},
+		"LOG_LEVEL wins over config": {env: "debug", configured: "warn", expected: zerolog.DebugLevel},
+		"invalid LOG_LEVEL ignored":  {env: "verbose", configured: "warn", expected: zerolog.WarnLevel, expectErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(LevelEnv, tt.env)
+
+			level, err := resolveLevel(tt.configured)
+			if level != tt.expected || (err != nil) != tt.expectErr {
+				t.Fatalf("expected level %s (error: %t), got %s, %v", tt.expected, tt.expectErr, level, err)
+			}
+		})
+	}
+}
+
+func TestLevelControllerSetLevel(t *testing.T) {
+	initial := zerolog.GlobalLevel()
+	t.Cleanup(func() { zerolog.SetGlobalLevel(initial) })
+
+	controller := &LevelController{}
+	if err := controller.SetLevel("debug"); err != nil || controller.Level() != "debug" {
+		t.Fatalf("expected the level to be debug, got %s, %v", controller.Level(), err)
+	}
+
+	if err := controller.SetLevel("verbose"); err == nil || controller.Level() != "debug" {
+		t.Fatalf("expected an invalid level to be rejected and leave the level unchanged, got %s, %v", controller.Level(), err)
+	}
+}
@@ -1,8 +1,10 @@
 package logger
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/samber/do-template-worker/pkg/config"
@@ -19,47 +21,114 @@ type Config struct {
 
 // NewLogger creates a new zerolog logger instance with dependency injection support
 // This service is automatically registered with the do dependency injection container.
+// It is created before the command line is parsed, so it starts with the settings known at that point,
+// info level on stdout by default; the CLI calls Configure with the loaded configuration before running a command.
 func NewLogger(i do.Injector) (*zerolog.Logger, error) {
 	config := do.MustInvoke[*config.Config](i)
 
-	// Configure log level
-	level, err := zerolog.ParseLevel(config.Logger.Level)
-	if err != nil {
-		level = zerolog.InfoLevel
-	}
+	logger := zerolog.Nop()
+	Configure(&logger, config.Logger)
+
+	return &logger, nil
+}
+
+// Configure applies the level, format and outputs of a logger configuration to logger, in place
+// Every service holding the injected *zerolog.Logger sees the change; loggers derived from it earlier
+// keep their outputs. The level is global to the process, see LevelController.
+func Configure(logger *zerolog.Logger, cfg config.LoggerConfig) {
+	// Configure log level, LOG_LEVEL winning over logger.level
+	level, levelErr := resolveLevel(cfg.Level)
 
 	// Set global log level
 	zerolog.SetGlobalLevel(level)
 
-	// Configure output
-	var output io.Writer
-	if config.Logger.Output == "stdout" || config.Logger.Output == "" {
-		output = zerolog.ConsoleWriter{
-			Out:        os.Stdout,
-			NoColor:    config.Logger.NoColor,
-			TimeFormat: "2006-01-02 15:04:05",
+	// Configure outputs
+	outputs, warnings := newOutputWriters(cfg)
+
+	// Create and configure logger
+	*logger = zerolog.New(zerolog.MultiLevelWriter(outputs...)).With().Timestamp().Logger()
+
+	for _, warning := range warnings {
+		logger.Warn().Err(warning).Msg("Failed to configure log output")
+	}
+	if levelErr != nil {
+		logger.Warn().Err(levelErr).Msg("Failed to configure log level")
+	}
+}
+
+// newOutputWriters returns a writer per destination of logger.output, in its format
+// stdout is written in logger.format and files in logger.file_format, defaulting to logger.format.
+// Destinations failing to open are reported and skipped, falling back to stdout when none is left.
+func newOutputWriters(cfg config.LoggerConfig) ([]io.Writer, []error) {
+	if cfg.Format == "" {
+		cfg.Format = config.LogFormatConsole
+	}
+	fileFormat := cfg.FileFormat
+	if fileFormat == "" {
+		fileFormat = cfg.Format
+	}
+
+	var (
+		writers  []io.Writer
+		warnings []error
+		seen     = map[string]bool{}
+	)
+	add := func(out io.Writer, format string, noColor bool) {
+		writer, ok := newFormatWriter(out, format, noColor)
+		if !ok {
+			warnings = append(warnings, fmt.Errorf("unknown log format %q, falling back to console", format))
 		}
-	} else {
+		writers = append(writers, writer)
+	}
+
+	for _, destination := range strings.Split(cfg.Output, ",") {
+		destination = strings.TrimSpace(destination)
+		if destination == "" || seen[destination] {
+			continue
+		}
+		seen[destination] = true
+
+		if destination == "stdout" {
+			// Guard stdout against broken pipes (e.g. `do-template-worker ... | head`)
+			add(newBrokenPipeWriter(os.Stdout), cfg.Format, cfg.NoColor)
+			continue
+		}
+
 		//bearer:disable go_gosec_file_permissions_file_perm
-		file, err := os.OpenFile(config.Logger.Output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		file, err := os.OpenFile(destination, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 		if err != nil {
-			// Fall back to stdout if file creation fails
-			output = zerolog.ConsoleWriter{
-				Out:        os.Stdout,
-				NoColor:    true,
-				TimeFormat: "2006-01-02 15:04:05",
-			}
-		} else {
-			output = zerolog.MultiLevelWriter(zerolog.ConsoleWriter{
-				Out:        file,
-				NoColor:    true,
-				TimeFormat: "2006-01-02 15:04:05",
-			})
+			warnings = append(warnings, err)
+			continue
 		}
+		add(file, fileFormat, true)
 	}
 
-	// Create and configure logger
-	logger := zerolog.New(output).With().Timestamp().Logger()
+	if len(writers) == 0 {
+		add(newBrokenPipeWriter(os.Stdout), cfg.Format, cfg.NoColor)
+	}
 
-	return &logger, nil
+	return writers, warnings
+}
+
+// newFormatWriter wraps out to write logs in the given logger.format
+// json writes raw zerolog lines, console pretty-prints them. Unknown formats fall back to
+// console, reporting false.
+func newFormatWriter(out io.Writer, format string, noColor bool) (io.Writer, bool) {
+	switch format {
+	case config.LogFormatJSON:
+		return out, true
+	case config.LogFormatConsole:
+		return newConsoleWriter(out, noColor), true
+	default:
+		return newConsoleWriter(out, noColor), false
+	}
+}
+
+// newConsoleWriter returns the human-readable writer of the console format.
+func newConsoleWriter(out io.Writer, noColor bool) zerolog.ConsoleWriter {
+	return zerolog.ConsoleWriter{
+		Out:        out,
+		NoColor:    noColor,
+		TimeFormat: "2006-01-02 15:04:05",
+	}
 }
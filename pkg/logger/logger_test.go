@@ -0,0 +1,195 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/spf13/viper"
+)
+
+func TestNewFormatWriter(t *testing.T) {
+	t.Parallel()
+
+	log := func(t *testing.T, format string) (string, bool) {
+		t.Helper()
+
+		var out bytes.Buffer
+		writer, ok := newFormatWriter(&out, format, true)
+		logger := zerolog.New(writer)
+		logger.Info().Str("user_email", "jane@example.com").Msg("Created user")
+
+		return strings.TrimSpace(out.String()), ok
+	}
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		line, ok := log(t, config.LogFormatJSON)
+		if !ok {
+			t.Fatal("expected json to be a known format")
+		}
+
+		var entry map[string]string
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("expected a JSON line, got %q: %v", line, err)
+		}
+		if entry["level"] != "info" || entry["message"] != "Created user" || entry["user_email"] != "jane@example.com" {
+			t.Fatalf("unexpected JSON entry: %v", entry)
+		}
+	})
+
+	t.Run("console", func(t *testing.T) {
+		t.Parallel()
+
+		line, ok := log(t, config.LogFormatConsole)
+		if !ok {
+			t.Fatal("expected console to be a known format")
+		}
+		if line != "<nil> INF Created user user_email=jane@example.com" {
+			t.Fatalf("unexpected console line: %q", line)
+		}
+	})
+
+	t.Run("unknown format falls back to console", func(t *testing.T) {
+		t.Parallel()
+
+		line, ok := log(t, "xml")
+		if ok {
+			t.Fatal("expected xml to be an unknown format")
+		}
+		if !strings.Contains(line, "INF Created user") {
+			t.Fatalf("expected a console line, got %q", line)
+		}
+	})
+}
+
+func TestNewOutputWriters(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "worker.log")
+	consoleFile := filepath.Join(dir, "worker.txt")
+
+	t.Run("writes to every destination once", func(t *testing.T) {
+		t.Parallel()
+
+		writers, warnings := newOutputWriters(config.LoggerConfig{
+			Format:     config.LogFormatJSON,
+			FileFormat: config.LogFormatJSON,
+			Output:     jsonFile + ", " + jsonFile + "," + filepath.Join(dir, "missing", "worker.log"),
+		})
+		if len(writers) != 1 {
+			t.Fatalf("expected duplicates and unopenable files to be skipped, got %d writers", len(writers))
+		}
+		if len(warnings) != 1 {
+			t.Fatalf("expected the unopenable file to be reported, got %v", warnings)
+		}
+
+		logger := zerolog.New(zerolog.MultiLevelWriter(writers...))
+		logger.Info().Msg("Created user")
+
+		data, err := os.ReadFile(jsonFile)
+		if err != nil {
+			t.Fatalf("failed to read log file: %v", err)
+		}
+		if strings.TrimSpace(string(data)) != `{"level":"info","message":"Created user"}` {
+			t.Fatalf("unexpected log file content: %q", data)
+		}
+	})
+
+	t.Run("files default to logger.format", func(t *testing.T) {
+		t.Parallel()
+
+		writers, warnings := newOutputWriters(config.LoggerConfig{
+			Format: config.LogFormatConsole,
+			Output: consoleFile,
+		})
+		if len(writers) != 1 || len(warnings) != 0 {
+			t.Fatalf("expected a single writer without warnings, got %d writers and %v", len(writers), warnings)
+		}
+
+		logger := zerolog.New(writers[0])
+		logger.Info().Msg("Created user")
+
+		data, err := os.ReadFile(consoleFile)
+		if err != nil {
+			t.Fatalf("failed to read log file: %v", err)
+		}
+		if !strings.Contains(string(data), "INF Created user") {
+			t.Fatalf("expected an uncolored console line, got %q", data)
+		}
+	})
+
+	t.Run("falls back to stdout", func(t *testing.T) {
+		t.Parallel()
+
+		writers, warnings := newOutputWriters(config.LoggerConfig{
+			Format: config.LogFormatJSON,
+			Output: filepath.Join(dir, "missing", "worker.log"),
+		})
+		if len(writers) != 1 || len(warnings) != 1 {
+			t.Fatalf("expected a stdout writer and a warning, got %d writers and %v", len(writers), warnings)
+		}
+	})
+}
+
+// TestConfigureFromLoadedConfig resets viper and the global level, so it can't run in parallel with the others.
+func TestConfigureFromLoadedConfig(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	initial := zerolog.GlobalLevel()
+	t.Cleanup(func() { zerolog.SetGlobalLevel(initial) })
+	t.Setenv(LevelEnv, "")
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "worker.log")
+	file := filepath.Join(dir, "config.yaml")
+	content := "logger:\n  level: warn\n  format: json\n  output: " + output + "\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg config.Config
+	if err := cfg.Load([]string{file}); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	logger := zerolog.Nop()
+	Configure(&logger, cfg.Logger)
+	logger.Info().Msg("Dropped")
+	logger.Warn().Msg("Written")
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("expected logger.output to be created, got %v", err)
+	}
+
+	var entry map[string]string
+	if err := json.Unmarshal(bytes.TrimSpace(data), &entry); err != nil || entry["message"] != "Written" {
+		t.Fatalf("expected a single JSON warning in logger.output, got %q (%v)", data, err)
+	}
+}
+
+func TestConfigureDefaultsEmptySettings(t *testing.T) {
+	initial := zerolog.GlobalLevel()
+	t.Cleanup(func() { zerolog.SetGlobalLevel(initial) })
+	t.Setenv(LevelEnv, "")
+
+	// Before the configuration is loaded, every setting is empty: log at info level on stdout
+	_, warnings := newOutputWriters(config.LoggerConfig{})
+	if len(warnings) != 0 {
+		t.Fatalf("expected an empty format to default to console, got %v", warnings)
+	}
+
+	logger := zerolog.Nop()
+	Configure(&logger, config.LoggerConfig{})
+	if zerolog.GlobalLevel() != zerolog.InfoLevel {
+		t.Fatalf("expected an empty level to default to info, got %s", zerolog.GlobalLevel())
+	}
+}
@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the spans of StartSpan, with the global tracer provider installed by tracing.NewTracing.
+var tracer = otel.Tracer("github.com/samber/do-template-worker")
+
+// Span logs the start of a named operation and returns a function logging its end
+// It is a lightweight alternative to tracing: both log lines share a span_id, and the end
+// line carries the duration and outcome. The logger is taken from the context (see
+// zerolog.Logger.WithContext), so spans inherit any field bound to it.
+//
+// Usage:
+//
+//	end := logger.Span(ctx, "user.create")
+//	user, err := repo.CreateUser(ctx, user)
+//	end(err)
+func Span(ctx context.Context, name string) func(err error) {
+	_, end := StartSpan(ctx, name)
+	return end
+}
+
+// StartSpan is Span returning a context for the operations nested in the span
+// The span is also an OpenTelemetry span, recorded when tracing is enabled: its log lines then carry
+// its trace and parent span IDs, and the trace ID is bound to the context logger from the first span
+// of the trace on. Without tracing, spans are only logged.
+func StartSpan(ctx context.Context, name string) (context.Context, func(err error)) {
+	parent := trace.SpanContextFromContext(ctx)
+	ctx, span := tracer.Start(ctx, name)
+
+	spanID := newSpanID()
+	if sc := span.SpanContext(); sc.IsValid() {
+		spanID = sc.SpanID().String()
+
+		// Bind the trace ID once, when the trace starts or continues the trace of another service
+		if !parent.IsValid() || parent.IsRemote() {
+			ctx = zerolog.Ctx(ctx).With().Str("trace_id", sc.TraceID().String()).Logger().WithContext(ctx)
+		}
+	}
+
+	fields := zerolog.Ctx(ctx).With().
+		Str("span", name).
+		Str("span_id", spanID)
+	if parent.IsValid() {
+		fields = fields.Str("parent_span_id", parent.SpanID().String())
+	}
+
+	log := fields.Logger()
+	start := time.Now()
+	log.Debug().Msg("Span started")
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+
+		event := log.Debug().Dur("duration", time.Since(start))
+		if err != nil {
+			event = event.Str("outcome", "error").Err(err)
+		} else {
+			event = event.Str("outcome", "success")
+		}
+		event.Msg("Span ended")
+	}
+}
+
+// newSpanID returns a random 8-byte hexadecimal span identifier, for spans logged without tracing.
+func newSpanID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
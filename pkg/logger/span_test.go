@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestStartSpanRecordsTrace installs a global tracer provider, so it can't run in parallel with the others.
+func TestStartSpanRecordsTrace(t *testing.T) {
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	// Continue the trace of another service, as the consumer does with the headers of a message
+	remote := propagation.MapCarrier{"traceparent": "00-" + traceID + "-" + parentID + "-01"}
+	ctx := propagation.TraceContext{}.Extract(context.Background(), remote)
+
+	var out bytes.Buffer
+	log := zerolog.New(&out).Level(zerolog.DebugLevel)
+	ctx, endProcess := StartSpan(log.WithContext(ctx), "message.process")
+	end := Span(ctx, "user.create")
+	end(errors.New("duplicate"))
+	endProcess(nil)
+
+	// Both spans are recorded in the remote trace, nested in each other
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Fatalf("expected every span to be in the remote trace, got %s", span.SpanContext().TraceID())
+		}
+		spans[span.Name()] = span
+	}
+	process, create := spans["message.process"], spans["user.create"]
+	if process == nil || create == nil {
+		t.Fatalf("expected both spans to be recorded, got %v", spans)
+	}
+	if process.Parent().SpanID().String() != parentID || create.Parent().SpanID() != process.SpanContext().SpanID() {
+		t.Fatal("expected the spans to be nested in the remote span, then in each other")
+	}
+	if create.Status().Code != codes.Error {
+		t.Fatalf("expected the failed span to have an error status, got %v", create.Status())
+	}
+
+	// Their log lines carry the same IDs
+	parents := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entry struct {
+			Span         string `json:"span"`
+			TraceID      string `json:"trace_id"`
+			ParentSpanID string `json:"parent_span_id"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("failed to decode log line %q: %v", line, err)
+		}
+		if entry.TraceID != traceID {
+			t.Fatalf("expected every span to log the trace ID, got %s", line)
+		}
+		parents[entry.Span] = entry.ParentSpanID
+	}
+	if parents["message.process"] != parentID || parents["user.create"] != process.SpanContext().SpanID().String() {
+		t.Fatalf("expected the logged parent span IDs to match the recorded ones, got %v", parents)
+	}
+}
@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"syscall"
+)
+
+// brokenPipeWriter wraps a log output and silences it once the reader has gone away
+// When stdout is piped to a command that exits early (e.g. `| head`), every write fails
+// with EPIPE. Instead of surfacing a flood of write errors, the writer switches to discard mode.
+type brokenPipeWriter struct {
+	out    io.Writer
+	broken atomic.Bool
+}
+
+// newBrokenPipeWriter creates a writer that discards output after a broken pipe.
+func newBrokenPipeWriter(out io.Writer) *brokenPipeWriter {
+	return &brokenPipeWriter{out: out}
+}
+
+// Write writes to the underlying output until a broken pipe is detected.
+func (w *brokenPipeWriter) Write(p []byte) (int, error) {
+	if w.broken.Load() {
+		return len(p), nil
+	}
+
+	n, err := w.out.Write(p)
+	if err != nil && isBrokenPipe(err) {
+		w.broken.Store(true)
+		return len(p), nil
+	}
+
+	return n, err
+}
+
+// Broken reports whether the underlying output has been detected as a broken pipe.
+func (w *brokenPipeWriter) Broken() bool {
+	return w.broken.Load()
+}
+
+// isBrokenPipe reports whether err is caused by writing to a closed pipe.
+func isBrokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrClosedPipe)
+}
@@ -0,0 +1,40 @@
+package logger
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestBrokenPipeWriter(t *testing.T) {
+	t.Parallel()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer func() { _ = writer.Close() }()
+
+	// Simulate the downstream command exiting
+	_ = reader.Close()
+
+	out := newBrokenPipeWriter(writer)
+	logger := zerolog.New(out)
+
+	for range 10 {
+		logger.Info().Msg("hello")
+	}
+
+	if !out.Broken() {
+		t.Fatal("expected writer to detect the broken pipe")
+	}
+
+	n, err := out.Write([]byte("ignored"))
+	if err != nil {
+		t.Fatalf("expected no error after broken pipe, got %v", err)
+	}
+	if n != len("ignored") {
+		t.Fatalf("expected %d bytes written, got %d", len("ignored"), n)
+	}
+}
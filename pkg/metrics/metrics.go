@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/do/v2"
+)
+
+// Metrics holds the Prometheus registry and the application collectors
+// This service demonstrates how to share observability primitives through dependency injection.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	// MessagesProcessed counts messages processed by the consumer, by action and status.
+	MessagesProcessed *prometheus.CounterVec
+
+	// MessageProcessingDuration observes the time spent processing a message, by action.
+	MessageProcessingDuration *prometheus.HistogramVec
+
+	// MessagesDeadLettered counts messages routed to the dead-letter queue, by action.
+	MessagesDeadLettered *prometheus.CounterVec
+
+	// FlowControlSeconds accumulates the time publishers spent paused by broker flow control.
+	FlowControlSeconds prometheus.Counter
+
+	// ConnectionBlockedSeconds accumulates the time the broker connection spent blocked.
+	ConnectionBlockedSeconds prometheus.Counter
+}
+
+// NewMetrics creates a new metrics service with its own registry
+// Using a dedicated registry instead of the global one keeps services isolated and testable.
+func NewMetrics(injector do.Injector) (*Metrics, error) {
+	registry := prometheus.NewRegistry()
+
+	m := &Metrics{
+		registry: registry,
+		MessagesProcessed: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "messages_processed_total",
+				Help: "Total number of messages processed by the consumer.",
+			},
+			[]string{"action", "status"},
+		),
+		MessageProcessingDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "message_processing_duration_seconds",
+				Help:    "Time in seconds spent processing a message.",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"action"},
+		),
+		MessagesDeadLettered: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "messages_dead_lettered_total",
+				Help: "Total number of messages routed to the dead-letter queue.",
+			},
+			[]string{"action"},
+		),
+		FlowControlSeconds: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "rabbitmq_flow_control_seconds_total",
+				Help: "Total time in seconds publishers spent paused by RabbitMQ flow control.",
+			},
+		),
+		ConnectionBlockedSeconds: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "rabbitmq_connection_blocked_seconds_total",
+				Help: "Total time in seconds the RabbitMQ connection was blocked by the broker.",
+			},
+		),
+	}
+
+	registry.MustRegister(
+		m.MessagesProcessed,
+		m.MessageProcessingDuration,
+		m.MessagesDeadLettered, m.FlowControlSeconds, m.ConnectionBlockedSeconds,
+	)
+
+	return m, nil
+}
+
+// Registry returns the underlying Prometheus registry.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
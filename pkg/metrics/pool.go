@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector exports the connection counts of a database pool, read from the pool on every scrape.
+type poolCollector struct {
+	stat     func() *pgxpool.Stat
+	acquired *prometheus.Desc
+	idle     *prometheus.Desc
+	total    *prometheus.Desc
+}
+
+// newPoolCollector creates a collector for a pool, labelled with its name.
+func newPoolCollector(name string, stat func() *pgxpool.Stat) *poolCollector {
+	labels := prometheus.Labels{"pool": name}
+
+	return &poolCollector{
+		stat:     stat,
+		acquired: prometheus.NewDesc("db_pool_acquired_connections", "Number of database connections currently in use.", nil, labels),
+		idle:     prometheus.NewDesc("db_pool_idle_connections", "Number of idle database connections.", nil, labels),
+		total:    prometheus.NewDesc("db_pool_total_connections", "Number of database connections open or being opened.", nil, labels),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.total
+}
+
+// Collect implements prometheus.Collector.
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.stat()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stat.TotalConns()))
+}
+
+// RegisterDatabasePool exports the acquired, idle and total connections of a database pool as gauges
+// labelled with the pool name, so that pool exhaustion shows up under load. The returned function
+// unregisters them, for the pool to be closed.
+func (m *Metrics) RegisterDatabasePool(name string, stat func() *pgxpool.Stat) (func(), error) {
+	collector := newPoolCollector(name, stat)
+	if err := m.registry.Register(collector); err != nil {
+		return nil, err
+	}
+
+	return func() { m.registry.Unregister(collector) }, nil
+}
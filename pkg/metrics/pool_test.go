@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestRegisterDatabasePool(t *testing.T) {
+	t.Parallel()
+
+	// The pool connects lazily, so no database is needed to read its statistics
+	pool, err := pgxpool.New(t.Context(), "host=127.0.0.1 port=1 user=test dbname=test")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	m, _ := NewMetrics(nil)
+	unregister, err := m.RegisterDatabasePool("shard_a", pool.Stat)
+	if err != nil {
+		t.Fatalf("expected the pool to be registered, got %v", err)
+	}
+	if _, err := m.RegisterDatabasePool("shard_b", pool.Stat); err != nil {
+		t.Fatalf("expected pools with different names to be registered, got %v", err)
+	}
+	if _, err := m.RegisterDatabasePool("shard_a", pool.Stat); err == nil {
+		t.Fatal("expected a pool name to be registered once")
+	}
+
+	gauges := func() map[string]int {
+		families, err := m.Registry().Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+
+		gauges := map[string]int{}
+		for _, family := range families {
+			gauges[family.GetName()] = len(family.GetMetric())
+		}
+		return gauges
+	}
+
+	for _, name := range []string{"db_pool_acquired_connections", "db_pool_idle_connections", "db_pool_total_connections"} {
+		if count := gauges()[name]; count != 2 {
+			t.Fatalf("expected %s to be exported for both pools, got %d series", name, count)
+		}
+	}
+
+	unregister()
+	if count := gauges()["db_pool_total_connections"]; count != 1 {
+		t.Fatalf("expected the unregistered pool to be dropped, got %d series", count)
+	}
+}
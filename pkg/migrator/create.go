@@ -0,0 +1,68 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// migrationNamePattern restricts migration descriptions to characters safe in file names on every platform.
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ErrInvalidMigrationName is returned when a migration description can't be used in a file name.
+var ErrInvalidMigrationName = errors.New("invalid migration name")
+
+// Create scaffolds a migration and the migration reverting it in dir, with the next version
+// The files are named <version>_<name>.sql, in dir and in its down/ directory, like the embedded
+// migrations, and hold a header to fill in. It returns the paths of the created files.
+func Create(dir, name string) ([]string, error) {
+	if !migrationNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w %q, use lowercase letters, digits and underscores", ErrInvalidMigrationName, name)
+	}
+
+	list, err := Load(os.DirFS(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var version int64 = 1
+	if len(list) > 0 {
+		version = list[len(list)-1].Version + 1
+	}
+	file := fmt.Sprintf("%03d_%s.sql", version, name)
+
+	up := filepath.Join(dir, file)
+	down := filepath.Join(dir, downDir, file)
+
+	if err := os.MkdirAll(filepath.Dir(down), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(down), err)
+	}
+
+	// A stale down migration left without its migration would be silently picked up: refuse it
+	if _, err := os.Stat(down); err == nil {
+		return nil, fmt.Errorf("failed to create migration: %s already exists", down)
+	}
+
+	// Create the files exclusively, so that a stale file is never overwritten
+	files := []struct{ path, content string }{
+		{up, fmt.Sprintf("-- %s\n-- TODO: describe the migration\n\n", file)},
+		{down, fmt.Sprintf("-- %s (down)\n-- TODO: revert %s\n\n", file, file)},
+	}
+	for _, migration := range files {
+		f, err := os.OpenFile(migration.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create migration: %w", err)
+		}
+		_, err = f.WriteString(migration.content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", migration.path, err)
+		}
+	}
+
+	return []string{up, down}, nil
+}
@@ -0,0 +1,369 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samber/do-template-worker/migrations"
+	"github.com/samber/do-template-worker/pkg/repositories"
+	"github.com/samber/do/v2"
+)
+
+const (
+	// undefinedTableCode is the PostgreSQL error code raised when querying a missing table.
+	undefinedTableCode = "42P01"
+	// migrationLockID is the advisory lock held while migrating, so that two migrate commands
+	// never apply the same migration concurrently.
+	migrationLockID = 7237423001
+	// downDir is the directory of the migrations reverting the embedded migrations.
+	downDir = "down"
+)
+
+var (
+	// ErrPendingMigrations is returned when the database schema is behind the embedded migrations.
+	ErrPendingMigrations = errors.New("database migrations are pending")
+	// ErrMigrationInterrupted is returned when the context ends while a migration runs. The
+	// interrupted migration is rolled back; the migrations applied before it stay applied.
+	ErrMigrationInterrupted = errors.New("migration interrupted")
+)
+
+// Migration is an embedded SQL migration.
+type Migration struct {
+	Version int64
+	Name    string
+}
+
+// MigrationStatus tells whether a migration is applied to the database.
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// Migrator applies the embedded migrations and inspects the database schema version against them
+// Applied versions are recorded in the schema_migrations table.
+type Migrator struct {
+	db         *pgxpool.Pool
+	fsys       fs.FS
+	migrations []Migration
+}
+
+// querier runs queries, on the pool or on an acquired connection.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// NewMigrator creates a new migrator for the embedded migrations
+// This function demonstrates how to combine an injected service with embedded resources.
+func NewMigrator(injector do.Injector) (*Migrator, error) {
+	db := do.MustInvoke[*repositories.Database](injector)
+
+	list, err := Load(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db.Pool(), fsys: migrations.FS, migrations: list}, nil
+}
+
+// Load lists the migrations of a file system, sorted by version
+// Files must be named <version>_<description>.sql; other files are ignored.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	list := make([]Migration, 0, len(files))
+	seen := map[int64]string{}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".sql")
+
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q, expected <version>_<description>.sql", file)
+		}
+
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q, expected <version>_<description>.sql", file)
+		}
+
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, name, version)
+		}
+		seen[version] = name
+
+		list = append(list, Migration{Version: version, Name: name})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+
+	return list, nil
+}
+
+// Status returns every embedded migration along with whether it is applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := appliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	return status(m.migrations, applied), nil
+}
+
+// Up applies the pending migrations in version order and returns them
+// Each migration runs in its own transaction along with its schema_migrations record,
+// so that a failed migration leaves the previous ones applied and itself pending.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range pending(m.migrations, applied) {
+			if err := m.apply(ctx, conn, migration, migration.Name+".sql",
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the last steps applied migrations, most recent first, and returns them
+// It refuses to go past the base, when fewer migrations than requested are applied.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		plan, err := planDown(m.migrations, applied, steps)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range plan {
+			if err := m.apply(ctx, conn, migration, path.Join(downDir, migration.Name+".sql"),
+				`DELETE FROM schema_migrations WHERE version = $1`, migration.Version); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// withLock runs fn on a connection acquired from the pool, holding the migration lock
+// The schema_migrations table is created first if needed.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire a connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire the migration lock: %w", err)
+	}
+	defer func() {
+		// The lock is released with the session anyway, should this fail
+		_, _ = conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+	}()
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// apply runs a migration file and updates schema_migrations in a single transaction.
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, migration Migration, file, record string, args ...any) error {
+	script, err := fs.ReadFile(m.fsys, file)
+	if err != nil {
+		return fmt.Errorf("failed to read migration %s: %w", file, err)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return migrationError(ctx, file, fmt.Errorf("failed to begin migration %s: %w", migration.Name, err))
+	}
+	// The rollback must run even once ctx is done. If pgx closed the connection to cancel
+	// the query, the server rolls the transaction back with the session anyway.
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	// Without arguments, the script runs with the simple protocol, which allows several statements
+	if _, err := tx.Exec(ctx, string(script)); err != nil {
+		return migrationError(ctx, file, fmt.Errorf("migration %s failed: %w", file, err))
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return migrationError(ctx, file, fmt.Errorf("failed to record migration %s: %w", migration.Name, err))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return migrationError(ctx, file, fmt.Errorf("failed to commit migration %s: %w", migration.Name, err))
+	}
+
+	return nil
+}
+
+// migrationError reports a failure caused by the end of ctx as ErrMigrationInterrupted,
+// naming the interrupted migration. Other failures are returned as is.
+func migrationError(ctx context.Context, file string, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: %s was cancelled (%w) and rolled back", ErrMigrationInterrupted, file, context.Cause(ctx))
+}
+
+// CheckApplied returns an error wrapping ErrPendingMigrations and listing the pending
+// versions when the database is behind the embedded migrations. It never applies them.
+func (m *Migrator) CheckApplied(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	return pendingError(statuses)
+}
+
+// appliedVersions reads the applied versions. A missing schema_migrations table means none is.
+func appliedVersions(ctx context.Context, db querier) (map[int64]bool, error) {
+	rows, err := db.Query(ctx, `SELECT version FROM schema_migrations`)
+	if isUndefinedTable(err) {
+		return map[int64]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int64]bool{}
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[version] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		// pgx may only report the missing table once rows are read
+		if isUndefinedTable(err) {
+			return map[int64]bool{}, nil
+		}
+		return nil, fmt.Errorf("failed to iterate applied migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// isUndefinedTable reports whether err was raised by querying a missing table.
+func isUndefinedTable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == undefinedTableCode
+}
+
+// status pairs each migration with whether its version is applied.
+func status(list []Migration, applied map[int64]bool) []MigrationStatus {
+	statuses := make([]MigrationStatus, 0, len(list))
+	for _, migration := range list {
+		statuses = append(statuses, MigrationStatus{Migration: migration, Applied: applied[migration.Version]})
+	}
+
+	return statuses
+}
+
+// pending returns the migrations not applied yet, in version order.
+func pending(list []Migration, applied map[int64]bool) []Migration {
+	var migrations []Migration
+	for _, migration := range list {
+		if !applied[migration.Version] {
+			migrations = append(migrations, migration)
+		}
+	}
+
+	return migrations
+}
+
+// planDown returns the last steps applied migrations, most recent first
+// Applied versions missing from the embedded migrations were applied by a newer binary and
+// can't be reverted by this one.
+func planDown(list []Migration, applied map[int64]bool, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("invalid number of steps %d, expected a positive number", steps)
+	}
+
+	known := map[int64]bool{}
+	for _, migration := range list {
+		known[migration.Version] = true
+	}
+	for version := range applied {
+		if !known[version] {
+			return nil, fmt.Errorf("applied migration %d is unknown to this binary, refusing to migrate down", version)
+		}
+	}
+
+	var plan []Migration
+	for i := len(list) - 1; i >= 0 && len(plan) < steps; i-- {
+		if applied[list[i].Version] {
+			plan = append(plan, list[i])
+		}
+	}
+
+	if len(plan) < steps {
+		return nil, fmt.Errorf("refusing to migrate down past the base: %d migrations applied, %d steps requested", len(plan), steps)
+	}
+
+	return plan, nil
+}
+
+// pendingError lists the migrations not applied yet, or returns nil when there is none.
+func pendingError(statuses []MigrationStatus) error {
+	var pending []string
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Name)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrPendingMigrations, strings.Join(pending, ", "))
+}
@@ -0,0 +1,251 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samber/do-template-worker/migrations"
+)
+
+func TestLoadSortsByVersion(t *testing.T) {
+	t.Parallel()
+
+	list, err := Load(fstest.MapFS{
+		"010_add_index.sql":    {},
+		"002_add_column.sql":   {},
+		"001_create_table.sql": {},
+		"README.md":            {},
+	})
+	if err != nil {
+		t.Fatalf("expected migrations to load, got %v", err)
+	}
+
+	var names []string
+	for _, migration := range list {
+		names = append(names, migration.Name)
+	}
+	if got := strings.Join(names, ","); got != "001_create_table,002_add_column,010_add_index" {
+		t.Fatalf("unexpected migration order: %s", got)
+	}
+}
+
+func TestLoadRejectsInvalidNames(t *testing.T) {
+	t.Parallel()
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"no version":        {"create_table.sql": {}},
+		"duplicate version": {"001_a.sql": {}, "001_b.sql": {}},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	t.Parallel()
+
+	list, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("expected embedded migrations to load, got %v", err)
+	}
+	if len(list) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+}
+
+func TestPendingErrorListsPendingVersions(t *testing.T) {
+	t.Parallel()
+
+	list := []Migration{{1, "001_create_users"}, {2, "002_create_failed"}, {3, "003_add_password"}}
+
+	if err := pendingError(status(list, map[int64]bool{1: true, 2: true, 3: true})); err != nil {
+		t.Fatalf("expected no error when every migration is applied, got %v", err)
+	}
+
+	err := pendingError(status(list, map[int64]bool{1: true}))
+	if !errors.Is(err, ErrPendingMigrations) {
+		t.Fatalf("expected ErrPendingMigrations, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "002_create_failed, 003_add_password") {
+		t.Fatalf("expected pending versions in error, got %v", err)
+	}
+}
+
+func TestEmbeddedMigrationsCanBeReverted(t *testing.T) {
+	t.Parallel()
+
+	list, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("expected embedded migrations to load, got %v", err)
+	}
+
+	for _, migration := range list {
+		if _, err := fs.Stat(migrations.FS, path.Join(downDir, migration.Name+".sql")); err != nil {
+			t.Fatalf("expected a down migration for %s, got %v", migration.Name, err)
+		}
+	}
+}
+
+func TestPlanDown(t *testing.T) {
+	t.Parallel()
+
+	list := []Migration{{1, "001_create_users"}, {2, "002_create_failed"}, {3, "003_add_password"}}
+	applied := map[int64]bool{1: true, 2: true}
+
+	plan, err := planDown(list, applied, 2)
+	if err != nil {
+		t.Fatalf("expected a plan, got %v", err)
+	}
+	if fmt.Sprint(plan) != fmt.Sprint([]Migration{{2, "002_create_failed"}, {1, "001_create_users"}}) {
+		t.Fatalf("expected the applied migrations to be reverted most recent first, got %v", plan)
+	}
+
+	if _, err := planDown(list, applied, 3); err == nil || !strings.Contains(err.Error(), "past the base") {
+		t.Fatalf("expected to refuse migrating down past the base, got %v", err)
+	}
+	if _, err := planDown(list, applied, 0); err == nil {
+		t.Fatal("expected an error for zero steps")
+	}
+	if _, err := planDown(list, map[int64]bool{1: true, 4: true}, 1); err == nil {
+		t.Fatal("expected to refuse reverting a migration unknown to the binary")
+	}
+}
+
+func TestPending(t *testing.T) {
+	t.Parallel()
+
+	list := []Migration{{1, "001_create_users"}, {2, "002_create_failed"}, {3, "003_add_password"}}
+
+	got := pending(list, map[int64]bool{2: true})
+	if fmt.Sprint(got) != fmt.Sprint([]Migration{{1, "001_create_users"}, {3, "003_add_password"}}) {
+		t.Fatalf("unexpected pending migrations: %v", got)
+	}
+}
+
+func TestMigrationErrorReportsInterruptions(t *testing.T) {
+	t.Parallel()
+
+	failure := errors.New("syntax error")
+	if err := migrationError(context.Background(), "001_a.sql", failure); err != failure {
+		t.Fatalf("expected failures to be returned as is, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := migrationError(ctx, "001_a.sql", failure)
+	if !errors.Is(err, ErrMigrationInterrupted) || !strings.Contains(err.Error(), "001_a.sql") {
+		t.Fatalf("expected ErrMigrationInterrupted naming the migration, got %v", err)
+	}
+}
+
+func TestUpInterruptsSlowMigration(t *testing.T) {
+	t.Parallel()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	// A version no real migration uses, sleeping well past the timeout
+	fsys := fstest.MapFS{"900001_slow.sql": {Data: []byte("SELECT pg_sleep(30);")}}
+	list, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("expected migrations to load, got %v", err)
+	}
+	m := &Migrator{db: pool, fsys: fsys, migrations: list}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	applied, err := m.Up(ctx)
+	if !errors.Is(err, ErrMigrationInterrupted) || !strings.Contains(err.Error(), "900001_slow.sql") {
+		t.Fatalf("expected the slow migration to be interrupted, got %v", err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("expected no applied migration, got %v", applied)
+	}
+
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("failed to read migration status: %v", err)
+	}
+	if statuses[0].Applied {
+		t.Fatal("expected the interrupted migration to be rolled back")
+	}
+}
+
+func TestCreateScaffoldsNextVersion(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, "007_create_table.sql"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Create(dir, "add_index")
+	if err != nil {
+		t.Fatalf("expected the migration to be created, got %v", err)
+	}
+
+	expected := []string{path.Join(dir, "008_add_index.sql"), path.Join(dir, "down", "008_add_index.sql")}
+	if fmt.Sprint(files) != fmt.Sprint(expected) {
+		t.Fatalf("expected files %v, got %v", expected, files)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil || !strings.HasPrefix(string(content), "-- 008_add_index.sql") {
+			t.Fatalf("expected %s to start with its name, got %q (%v)", file, content, err)
+		}
+	}
+
+	list, err := Load(os.DirFS(dir))
+	if err != nil || len(list) != 2 || list[1].Name != "008_add_index" {
+		t.Fatalf("expected the created migration to load, got %v (%v)", list, err)
+	}
+}
+
+func TestCreateRejectsInvalidNames(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"", "add/index", "add index", "../escape", "Add_Index"} {
+		if _, err := Create(t.TempDir(), name); !errors.Is(err, ErrInvalidMigrationName) {
+			t.Fatalf("name %q: expected ErrInvalidMigrationName, got %v", name, err)
+		}
+	}
+}
+
+func TestCreateRefusesExistingDownMigration(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(path.Join(dir, "down"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(dir, "down", "001_stale.sql"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Create(dir, "stale"); err == nil {
+		t.Fatal("expected a stale down migration to be refused")
+	}
+	if _, err := os.Stat(path.Join(dir, "001_stale.sql")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected no migration to be created, got %v", err)
+	}
+}
@@ -0,0 +1,7 @@
+package migrator
+
+import "github.com/samber/do/v2"
+
+var Package = do.Package(
+	do.Lazy(NewMigrator),
+)
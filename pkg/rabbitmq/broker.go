@@ -0,0 +1,44 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// MessageBroker is the broker the workers publish messages to and consume them from
+// RabbitMQService implements it and is bound to it in the dependency injector, so that tests can
+// provide a fake instead of connecting to a live broker. Deliveries are amqp091 deliveries, acked
+// and nacked through their Acknowledger.
+type MessageBroker interface {
+	// PublishMessage publishes a message to the queue.
+	PublishMessage(message []byte) error
+	// PublishMessageWithOptions is PublishMessage with message properties and headers.
+	PublishMessageWithOptions(message []byte, opts PublishOptions) error
+	// PublishMirrored publishes a message to the queue and a best-effort copy to the mirror exchange.
+	PublishMirrored(message []byte) error
+	// PublishMirroredWithOptions is PublishMirrored with message properties and headers.
+	PublishMirroredWithOptions(message []byte, opts PublishOptions) error
+	// RequeueMessage publishes a copy of a delivery back to the queue with extra headers.
+	RequeueMessage(msg amqp091.Delivery, headers amqp091.Table) error
+	// PublishDeadLetter publishes a copy of a delivery to the dead-letter queue with extra headers.
+	PublishDeadLetter(msg amqp091.Delivery, headers amqp091.Table) error
+
+	// ConsumeMessage starts consuming messages from the queue.
+	ConsumeMessage() (<-chan amqp091.Delivery, error)
+	// ConsumeMessageWithOptions starts consuming messages from the queue with the given options.
+	ConsumeMessageWithOptions(opts ConsumeOptions) (<-chan amqp091.Delivery, error)
+	// CancelConsumer stops sending deliveries to the consumer with the given tag.
+	CancelConsumer(tag string) error
+
+	// QueueDepth returns the number of messages ready for delivery in the queue.
+	QueueDepth() (int, error)
+	// WaitForFlow blocks while the broker asks publishers to pause, until ctx is done.
+	WaitForFlow(ctx context.Context) error
+	// HealthCheckWithContext checks that the broker answers.
+	HealthCheckWithContext(ctx context.Context) error
+	// Shutdown closes the connection to the broker.
+	Shutdown() error
+}
+
+var _ MessageBroker = (*RabbitMQService)(nil)
@@ -0,0 +1,78 @@
+package rabbitmq
+
+import (
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// ConnectionState describes the state of the broker connection.
+type ConnectionState string
+
+// Connection states.
+const (
+	// StateConnected means the connection is open.
+	StateConnected ConnectionState = "connected"
+	// StateReconnecting means the connection was lost and is being re-established.
+	StateReconnecting ConnectionState = "reconnecting"
+	// StateDown means the connection was lost and is not being re-established.
+	StateDown ConnectionState = "down"
+)
+
+// ConnectionStatus is a snapshot of the broker connection state
+// It gives operators insight into broker flapping rather than a binary up/down.
+type ConnectionStatus struct {
+	State ConnectionState `json:"state"`
+	// Since is when the connection entered its current state.
+	Since time.Time `json:"since"`
+	// LastReconnect is when the connection was last re-established, zero if it never was.
+	LastReconnect time.Time `json:"last_reconnect,omitzero"`
+	// LastError is the error that closed the connection, if any.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ConnectionState returns a snapshot of the broker connection state.
+func (r *RabbitMQService) ConnectionState() ConnectionStatus {
+	r.stateMu.RLock()
+	defer r.stateMu.RUnlock()
+
+	return r.status
+}
+
+// setConnectionState records a connection state change.
+func (r *RabbitMQService) setConnectionState(state ConnectionState, cause error) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	switch {
+	case state == StateConnected && r.status.State != "" && r.status.State != StateConnected:
+		r.status.LastReconnect = time.Now()
+		r.logger.Info().Dur("downtime", time.Since(r.status.Since)).Msg("RabbitMQ reconnected")
+	case state == StateReconnecting && r.status.State != StateReconnecting:
+		r.logger.Warn().AnErr("cause", cause).Msg("RabbitMQ reconnecting")
+	}
+
+	r.status.State = state
+	r.status.Since = time.Now()
+	if cause != nil {
+		r.status.LastError = cause.Error()
+	}
+}
+
+// watchConnection reconnects when the broker closes the connection, or marks it as down
+// amqp091 closes the channel without sending an error on a graceful Close.
+func (r *RabbitMQService) watchConnection(closes <-chan *amqp091.Error) {
+	for err := range closes {
+		r.logger.Error().Err(err).Int("code", err.Code).Msg("RabbitMQ connection lost")
+
+		// The new connection has its own watcher
+		if r.reconnect(err) {
+			r.lifecycleEvent().Msg("RabbitMQ connection closed")
+			return
+		}
+		r.setConnectionState(StateDown, err)
+	}
+
+	r.lifecycleEvent().Msg("RabbitMQ connection closed")
+	r.markClosed()
+}
@@ -0,0 +1,48 @@
+package rabbitmq
+
+import (
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog"
+)
+
+// lifecycleEvent starts a log event for a routine connection or channel lifecycle event
+// Routine events are logged at info level with rabbitmq.log_lifecycle, at debug level otherwise.
+// Abnormal events (connection lost, blocked connection) are always logged at warn level or above.
+func (r *RabbitMQService) lifecycleEvent() *zerolog.Event {
+	if r.config.LogLifecycle {
+		return r.logger.Info()
+	}
+	return r.logger.Debug()
+}
+
+// watchChannel logs when a long-lived channel closes, with the error sent by the broker if any.
+func (r *RabbitMQService) watchChannel(name string, closes <-chan *amqp091.Error) {
+	for err := range closes {
+		r.logger.Error().Err(err).Str("channel", name).Int("code", err.Code).Msg("RabbitMQ channel closed by the broker")
+	}
+
+	r.lifecycleEvent().Str("channel", name).Msg("RabbitMQ channel closed")
+}
+
+// watchBlocked tracks the connection blocked state sent by the broker
+// The broker blocks publishing connections when it runs low on memory or disk space. A blocked
+// connection stalls publishes silently, so it is logged as a warning and the time spent blocked
+// is exported as rabbitmq_connection_blocked_seconds_total.
+func (r *RabbitMQService) watchBlocked(blockings <-chan amqp091.Blocking) {
+	var since time.Time
+
+	for blocking := range blockings {
+		switch {
+		case blocking.Active && since.IsZero():
+			since = time.Now()
+			r.logger.Warn().Str("reason", blocking.Reason).Msg("RabbitMQ connection blocked by the broker")
+		case !blocking.Active && !since.IsZero():
+			blocked := time.Since(since)
+			since = time.Time{}
+			r.metrics.ConnectionBlockedSeconds.Add(blocked.Seconds())
+			r.logger.Info().Dur("blocked", blocked).Msg("RabbitMQ connection unblocked")
+		}
+	}
+}
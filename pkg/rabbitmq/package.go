@@ -1,6 +1,8 @@
 package rabbitmq
 
 import (
+	"cmp"
+
 	"github.com/samber/do-template-worker/pkg/config"
 	"github.com/samber/do/v2"
 )
@@ -10,13 +12,39 @@ import (
 func ProvideRabbitMQConfig(injector do.Injector) (*Config, error) {
 	appConfig := do.MustInvoke[*config.Config](injector)
 
+	// Bindings default to the main exchange, and to their queue name as routing key
+	bindings := make([]Binding, 0, len(appConfig.RabbitMQ.Bindings))
+	for _, binding := range appConfig.RabbitMQ.Bindings {
+		bindings = append(bindings, Binding{
+			Queue:      binding.Queue,
+			Exchange:   cmp.Or(binding.Exchange, appConfig.RabbitMQ.Exchange),
+			RoutingKey: cmp.Or(binding.RoutingKey, binding.Queue),
+		})
+	}
+
 	// Convert from config.RabbitMQConfig to rabbitmq.Config
 	return &Config{
 		Host:      appConfig.RabbitMQ.Host,
 		Port:      appConfig.RabbitMQ.Port,
 		User:      appConfig.RabbitMQ.User,
 		Password:  appConfig.RabbitMQ.Password,
+		VHost:     appConfig.RabbitMQ.VHost,
+		TLS:       appConfig.RabbitMQ.TLS,
 		QueueName: appConfig.RabbitMQ.QueueName,
 		Exchange:  appConfig.RabbitMQ.Exchange,
+
+		MirrorExchange:     appConfig.RabbitMQ.MirrorExchange,
+		AppID:              appConfig.App.Name,
+		PauseOnFlowControl: appConfig.RabbitMQ.PauseOnFlowControl,
+		LogLifecycle:       appConfig.RabbitMQ.LogLifecycle,
+		DeclareExchange:    appConfig.RabbitMQ.DeclareExchange,
+		DeclareQueue:       appConfig.RabbitMQ.DeclareQueue,
+
+		ReconnectMaxAttempts: appConfig.RabbitMQ.ReconnectMaxAttempts,
+		ConnectTimeout:       appConfig.RabbitMQ.ConnectTimeout,
+		ConnectMaxRetries:    appConfig.RabbitMQ.ConnectMaxRetries,
+		DeadLetterExchange:   appConfig.RabbitMQ.DLXName,
+		PrefetchCount:        appConfig.RabbitMQ.PrefetchCount,
+		Bindings:             bindings,
 	}, nil
 }
@@ -1,19 +1,87 @@
 package rabbitmq
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/metrics"
 	"github.com/samber/do/v2"
 )
 
+const (
+	// HeaderRequeueCount holds how many times a message has been requeued by the consumer.
+	HeaderRequeueCount = "x-requeue-count"
+	// HeaderDeadLetterReason holds why a message was routed to the dead-letter queue.
+	HeaderDeadLetterReason = "x-dead-letter-reason"
+	// HeaderOriginalExchange holds the exchange a dead-lettered message was originally published to.
+	HeaderOriginalExchange = "x-original-exchange"
+	// HeaderOriginalRoutingKey holds the routing key a dead-lettered message was originally published with.
+	HeaderOriginalRoutingKey = "x-original-routing-key"
+	// HeaderFailedConsumer identifies the consumer that dead-lettered a message.
+	HeaderFailedConsumer = "x-failed-consumer"
+	// HeaderDeadLetteredAt holds when a message was dead-lettered.
+	HeaderDeadLetteredAt = "x-dead-lettered-at"
+	// HeaderAttempts holds how many times processing was attempted before dead-lettering.
+	HeaderAttempts = "x-attempts"
+)
+
 // RabbitMQService represents a RabbitMQ connection and channel manager
 // This struct demonstrates how to manage RabbitMQ connections with dependency injection.
+//
+// Thread-safety: the service is a DI singleton shared by every worker. All workers share
+// a single AMQP connection, which is safe for concurrent use. AMQP channels are not, so:
+//   - publishes go through a dedicated publish channel guarded by a mutex, so any
+//     goroutine may call the Publish* and Requeue* methods concurrently;
+//   - every ConsumeMessage call opens its own channel, so consumers never share a channel
+//     with each other or with publishers.
+//
+// All channels are closed by Shutdown, before the connection.
+//
+// When the broker drops the connection, it is re-dialed with exponential backoff up to
+// rabbitmq.reconnect_max_attempts times, and the topology declared again. The publish channel is
+// replaced, and consumers receive deliveries from a fresh channel without noticing.
 type RabbitMQService struct {
+	connMu  sync.RWMutex
 	conn    *amqp091.Connection
-	channel *amqp091.Channel
 	config  *Config `do:""`
+	logger  *zerolog.Logger
+	metrics *metrics.Metrics
+
+	// reconnected is closed and replaced on each reconnection, closed is closed once the
+	// connection is closed for good, on shutdown or when reconnecting gives up
+	reconnectMu  sync.Mutex
+	reconnected  chan struct{}
+	closed       chan struct{}
+	closeOnce    sync.Once
+	shuttingDown atomic.Bool
+
+	publishMu      sync.Mutex
+	publishChannel *amqp091.Channel
+
+	channelsMu sync.Mutex
+	channels   []*amqp091.Channel
+	// consumers maps the tag of each active consumer to its channel, so that it can be cancelled
+	consumers map[string]*amqp091.Channel
+
+	stateMu sync.RWMutex
+	status  ConnectionStatus
+
+	flowMu      sync.Mutex
+	flowPaused  bool
+	flowSince   time.Time
+	flowResumed chan struct{}
 }
 
 // Config holds RabbitMQ configuration.
@@ -22,8 +90,90 @@ type Config struct {
 	Port      int    `mapstructure:"port"`
 	User      string `mapstructure:"user"`
 	Password  string `mapstructure:"password"`
+	VHost     string `mapstructure:"vhost"`
+	TLS       bool   `mapstructure:"tls"`
 	QueueName string `mapstructure:"queue_name"`
 	Exchange  string `mapstructure:"exchange"`
+
+	// MirrorExchange receives a best-effort copy of the messages published with PublishMirrored.
+	MirrorExchange string `mapstructure:"mirror_exchange"`
+	// AppID is the application name set as the app-id of published messages, taken from app.name.
+	AppID string
+
+	PauseOnFlowControl bool `mapstructure:"pause_on_flow_control"`
+	// LogLifecycle logs connection and channel open/close events at info level instead of debug.
+	LogLifecycle bool `mapstructure:"log_lifecycle"`
+
+	// DeclareExchange and DeclareQueue are one of config.DeclareActive, config.DeclarePassive
+	// or config.DeclareSkip. The queue mode also applies to its binding and to the dead-letter queue.
+	DeclareExchange string `mapstructure:"declare_exchange"`
+	DeclareQueue    string `mapstructure:"declare_queue"`
+
+	// ReconnectMaxAttempts is how many times a lost connection is re-dialed. Zero disables reconnection.
+	ReconnectMaxAttempts int `mapstructure:"reconnect_max_attempts"`
+	// ConnectTimeout bounds the connection retries at startup. Zero disables it.
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+	// ConnectMaxRetries is how many times a failed connection is retried at startup.
+	ConnectMaxRetries int `mapstructure:"connect_max_retries"`
+	// PrefetchCount bounds the unacknowledged deliveries of ConsumeMessage. Zero means unlimited.
+	PrefetchCount int `mapstructure:"prefetch_count"`
+
+	// DeadLetterExchange routes dead-lettered messages to the dead-letter queue, and is set as the
+	// x-dead-letter-exchange of the main queue. Empty publishes them straight to the dead-letter queue.
+	DeadLetterExchange string `mapstructure:"dlx_name"`
+
+	// Bindings are extra queues, declared along with the main queue and consumed with ConsumeOptions.Queue.
+	Bindings []Binding `mapstructure:"bindings"`
+}
+
+// Binding binds a queue to an exchange with a routing key.
+type Binding struct {
+	Queue      string `mapstructure:"queue"`
+	Exchange   string `mapstructure:"exchange"`
+	RoutingKey string `mapstructure:"routing_key"`
+}
+
+// URL returns the AMQP connection URL.
+func (c *Config) URL() string {
+	u := url.URL{
+		Scheme: "amqp",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+	}
+	if c.TLS {
+		u.Scheme = "amqps"
+	}
+	if c.VHost != "" && c.VHost != "/" {
+		u.Path = "/" + c.VHost
+		u.RawPath = "/" + url.PathEscape(c.VHost)
+	}
+
+	return u.String()
+}
+
+// DeadLetterQueueName returns the name of the queue receiving dead-lettered messages.
+func (c *Config) DeadLetterQueueName() string {
+	return c.QueueName + ".dlq"
+}
+
+// deadLetterRoute returns the exchange and routing key dead-lettered messages are published with.
+func (c *Config) deadLetterRoute() (string, string) {
+	// The default exchange routes to the queue named by the routing key
+	return c.DeadLetterExchange, c.DeadLetterQueueName()
+}
+
+// queueArguments returns the arguments of the main queue: with a dead-letter exchange, messages
+// the broker dead-letters, e.g. rejected without requeue or expired, reach the dead-letter queue.
+func (c *Config) queueArguments() amqp091.Table {
+	if c.DeadLetterExchange == "" {
+		return nil
+	}
+
+	exchange, routingKey := c.deadLetterRoute()
+	return amqp091.Table{
+		"x-dead-letter-exchange":    exchange,
+		"x-dead-letter-routing-key": routingKey,
+	}
 }
 
 // NewRabbitMQService creates a new RabbitMQ service instance
@@ -31,110 +181,651 @@ type Config struct {
 func NewRabbitMQService(injector do.Injector) (*RabbitMQService, error) {
 	// Get configuration from injector
 	config := do.MustInvoke[*Config](injector)
+	logger := do.MustInvoke[*zerolog.Logger](injector)
+
+	// A broker restarting or still starting up must not crash startup: transient failures are retried
+	var (
+		conn    *amqp091.Connection
+		channel *amqp091.Channel
+	)
+	err := retryTransient(connectRetry(config), func() error {
+		var err error
+		conn, channel, err = connect(config)
+		return err
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &RabbitMQService{
+		config:      config,
+		logger:      logger,
+		metrics:     do.MustInvoke[*metrics.Metrics](injector),
+		reconnected: make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+
+	service.attach(conn, channel)
+	service.setConnectionState(StateConnected, nil)
+
+	return service, nil
+}
+
+// attach makes a freshly opened connection and publish channel the current ones, and watches them.
+func (r *RabbitMQService) attach(conn *amqp091.Connection, channel *amqp091.Channel) {
+	r.connMu.Lock()
+	r.conn = conn
+	r.connMu.Unlock()
+
+	r.publishMu.Lock()
+	r.publishChannel = channel
+	r.publishMu.Unlock()
+
+	r.lifecycleEvent().Str("host", r.config.Host).Int("port", r.config.Port).Str("vhost", r.config.VHost).Msg("RabbitMQ connection opened")
+	go r.watchConnection(conn.NotifyClose(make(chan *amqp091.Error, 1)))
+	go r.watchBlocked(conn.NotifyBlocked(make(chan amqp091.Blocking, 1)))
+
+	// Watch flow control on the publish channel
+	r.lifecycleEvent().Str("channel", "publish").Msg("RabbitMQ channel opened")
+	go r.watchChannel("publish", channel.NotifyClose(make(chan *amqp091.Error, 1)))
+	go r.watchFlow(channel.NotifyFlow(make(chan bool, 1)))
+}
+
+// connection returns the current connection, nil before the service is connected.
+func (r *RabbitMQService) connection() *amqp091.Connection {
+	r.connMu.RLock()
+	defer r.connMu.RUnlock()
 
-	// Build connection URL
-	url := fmt.Sprintf("amqp://%s:%s@%s:%d", config.User, config.Password, config.Host, config.Port)
+	return r.conn
+}
 
-	// Connect to RabbitMQ
-	conn, err := amqp091.Dial(url)
+// connect dials RabbitMQ, opens the publish channel and declares the topology on it
+// The connection is closed on failure: a failed declaration closes the channel, and may leave
+// the connection unusable, so a retry starts over from the dial.
+func connect(config *Config) (*amqp091.Connection, *amqp091.Channel, error) {
+	conn, err := amqp091.Dial(config.URL())
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
 	}
 
-	// Create channel
+	// Create the publish channel, also used to declare the topology
 	channel, err := conn.Channel()
 	if err != nil {
 		_ = conn.Close()
-		return nil, fmt.Errorf("failed to create RabbitMQ channel: %w", err)
+		return nil, nil, fmt.Errorf("failed to create RabbitMQ channel: %w", err)
 	}
 
-	// Declare exchange
-	err = channel.ExchangeDeclare(
-		config.Exchange,
-		"direct",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
+	if err := declareTopology(channel, config); err != nil {
 		_ = conn.Close()
-		return nil, fmt.Errorf("failed to declare exchange: %w", err)
+		return nil, nil, err
 	}
 
-	// Declare queue
-	_, err = channel.QueueDeclare(
-		config.QueueName,
-		true,
-		false,
-		false,
+	return conn, channel, nil
+}
+
+// declareTopology declares the exchange, the main queue with its binding, and the dead-letter queue
+// With rabbitmq.dlx_name, the dead-letter exchange is declared too, and the dead-letter queue bound to it.
+// The exchange and the queues are each declared, checked passively or skipped, depending on
+// rabbitmq.declare_exchange and rabbitmq.declare_queue. This lets an ops team own the exchange
+// while the application owns its queues, or the other way around.
+func declareTopology(channel *amqp091.Channel, cfg *Config) error {
+	// Declare exchanges. Publishing to a missing exchange would close the publish channel,
+	// so the mirror exchange must exist as well.
+	exchanges := []string{cfg.Exchange}
+	if cfg.MirrorExchange != "" {
+		exchanges = append(exchanges, cfg.MirrorExchange)
+	}
+	if cfg.DeadLetterExchange != "" {
+		exchanges = append(exchanges, cfg.DeadLetterExchange)
+	}
+	for _, binding := range cfg.Bindings {
+		if !slices.Contains(exchanges, binding.Exchange) {
+			exchanges = append(exchanges, binding.Exchange)
+		}
+	}
+
+	for _, exchange := range exchanges {
+		err := declare(cfg.DeclareExchange, func(passive bool) error {
+			if passive {
+				return channel.ExchangeDeclarePassive(exchange, "direct", true, false, false, false, nil)
+			}
+			return channel.ExchangeDeclare(exchange, "direct", true, false, false, false, nil)
+		})
+		if err != nil {
+			return topologyError(err, "exchange", exchange, "declare_exchange", cfg.DeclareExchange)
+		}
+	}
+
+	// Declare queues. Passive declarations ignore arguments, so a main queue declared without
+	// dead-letter exchange is only reported when declared actively, as PRECONDITION_FAILED. The
+	// queues of bindings share the dead-letter queue of the main queue.
+	type declaredQueue struct {
+		name string
+		args amqp091.Table
+	}
+	queues := []declaredQueue{
+		{cfg.QueueName, cfg.queueArguments()},
+		{cfg.DeadLetterQueueName(), nil},
+	}
+	for _, binding := range cfg.Bindings {
+		queues = append(queues, declaredQueue{binding.Queue, cfg.queueArguments()})
+	}
+	for _, queue := range queues {
+		err := declare(cfg.DeclareQueue, func(passive bool) error {
+			if passive {
+				_, err := channel.QueueDeclarePassive(queue.name, true, false, false, false, nil)
+				return err
+			}
+			_, err := channel.QueueDeclare(queue.name, true, false, false, false, queue.args)
+			return err
+		})
+		if err != nil {
+			return topologyError(err, "queue", queue.name, "declare_queue", cfg.DeclareQueue)
+		}
+	}
+
+	// Bind queue to exchange, unless queues are managed outside the application
+	if cfg.DeclareQueue != config.DeclareActive {
+		return nil
+	}
+
+	err := channel.QueueBind(
+		cfg.QueueName,
+		cfg.QueueName,
+		cfg.Exchange,
 		false,
 		nil,
 	)
 	if err != nil {
-		_ = conn.Close()
-		return nil, fmt.Errorf("failed to declare queue: %w", err)
+		return topologyError(
+			fmt.Errorf("failed to bind queue to exchange: %w", err),
+			"exchange", cfg.Exchange, "declare_exchange", cfg.DeclareExchange,
+		)
 	}
 
-	// Bind queue to exchange
-	err = channel.QueueBind(
-		config.QueueName,
-		config.QueueName,
-		config.Exchange,
-		false,
-		nil,
-	)
+	for _, binding := range cfg.Bindings {
+		if err := channel.QueueBind(binding.Queue, binding.RoutingKey, binding.Exchange, false, nil); err != nil {
+			return topologyError(
+				fmt.Errorf("failed to bind queue %q to exchange: %w", binding.Queue, err),
+				"exchange", binding.Exchange, "declare_exchange", cfg.DeclareExchange,
+			)
+		}
+	}
+
+	if cfg.DeadLetterExchange == "" {
+		return nil
+	}
+
+	exchange, routingKey := cfg.deadLetterRoute()
+	if err := channel.QueueBind(cfg.DeadLetterQueueName(), routingKey, exchange, false, nil); err != nil {
+		return topologyError(
+			fmt.Errorf("failed to bind dead-letter queue to exchange: %w", err),
+			"exchange", exchange, "declare_exchange", cfg.DeclareExchange,
+		)
+	}
+
+	return nil
+}
+
+// declare runs an active or passive declaration according to mode, or nothing when mode is config.DeclareSkip.
+func declare(mode string, fn func(passive bool) error) error {
+	switch mode {
+	case config.DeclareSkip:
+		return nil
+	case config.DeclarePassive:
+		return fn(true)
+	case "", config.DeclareActive:
+		return fn(false)
+	default:
+		return fmt.Errorf("unknown declare mode %q", mode)
+	}
+}
+
+// topologyError explains a missing exchange or queue that the application was told not to declare.
+func topologyError(err error, kind, name, option, mode string) error {
+	var amqpErr *amqp091.Error
+	if mode == config.DeclarePassive || mode == config.DeclareSkip {
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp091.NotFound {
+			return fmt.Errorf("%s %q does not exist and rabbitmq.%s=%s: create it or set rabbitmq.%s=%s: %w",
+				kind, name, option, mode, option, config.DeclareActive, err)
+		}
+	}
+
+	return fmt.Errorf("failed to declare %s %q: %w", kind, name, err)
+}
+
+// Channel opens a new channel on the shared connection
+// The channel is owned by the caller but is tracked so that Shutdown closes it, until it closes.
+func (r *RabbitMQService) Channel() (*amqp091.Channel, error) {
+	conn := r.connection()
+	if conn == nil {
+		return nil, errNotConnected
+	}
+
+	channel, err := conn.Channel()
 	if err != nil {
-		_ = conn.Close()
-		return nil, fmt.Errorf("failed to bind queue to exchange: %w", err)
+		return nil, fmt.Errorf("failed to create RabbitMQ channel: %w", err)
+	}
+
+	r.lifecycleEvent().Str("channel", "dedicated").Msg("RabbitMQ channel opened")
+	r.trackChannel(channel, channel.NotifyClose(make(chan *amqp091.Error, 1)))
+
+	return channel, nil
+}
+
+// trackChannel tracks a dedicated channel until it closes
+// Closed channels are forgotten, so that the channels of consumers restarted by reconnections don't
+// pile up until Shutdown.
+func (r *RabbitMQService) trackChannel(channel *amqp091.Channel, closes <-chan *amqp091.Error) {
+	r.channelsMu.Lock()
+	r.channels = append(r.channels, channel)
+	r.channelsMu.Unlock()
+
+	go func() {
+		r.watchChannel("dedicated", closes)
+
+		r.channelsMu.Lock()
+		r.channels = slices.DeleteFunc(r.channels, func(c *amqp091.Channel) bool { return c == channel })
+		r.channelsMu.Unlock()
+	}()
+}
+
+// watchFlow tracks the flow control state sent by the broker on the publish channel
+// The broker sends false when publishers must pause (e.g. under memory pressure) and true
+// once they may resume. The channel is closed by amqp091 when the AMQP channel closes.
+func (r *RabbitMQService) watchFlow(flows <-chan bool) {
+	for active := range flows {
+		r.flowMu.Lock()
+
+		switch {
+		case !active && !r.flowPaused:
+			r.flowPaused = true
+			r.flowSince = time.Now()
+			r.flowResumed = make(chan struct{})
+			r.logger.Warn().Msg("RabbitMQ flow control active, publishers paused")
+		case active && r.flowPaused:
+			paused := time.Since(r.flowSince)
+			r.flowPaused = false
+			close(r.flowResumed)
+			r.metrics.FlowControlSeconds.Add(paused.Seconds())
+			r.logger.Info().Dur("paused", paused).Msg("RabbitMQ flow control lifted, publishers resumed")
+		}
+
+		r.flowMu.Unlock()
+	}
+}
+
+// WaitForFlow blocks while the broker applies flow control, or until the context is done
+// It returns immediately when rabbitmq.pause_on_flow_control is disabled, in which case
+// publishes during flow control may block or fail instead.
+func (r *RabbitMQService) WaitForFlow(ctx context.Context) error {
+	if !r.config.PauseOnFlowControl {
+		return nil
 	}
 
-	return &RabbitMQService{
-		conn:    conn,
-		channel: channel,
-		config:  config,
-	}, nil
+	r.flowMu.Lock()
+	if !r.flowPaused {
+		r.flowMu.Unlock()
+		return nil
+	}
+	resumed := r.flowResumed
+	r.flowMu.Unlock()
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// publish sends a message on the shared publish channel.
+func (r *RabbitMQService) publish(exchange, routingKey string, msg amqp091.Publishing) error {
+	r.publishMu.Lock()
+	defer r.publishMu.Unlock()
+
+	return r.publishChannel.Publish(exchange, routingKey, false, false, msg)
 }
 
 // PublishMessage publishes a message to the RabbitMQ queue
 // This method demonstrates how to send messages using dependency injection.
 func (r *RabbitMQService) PublishMessage(message []byte) error {
-	return r.channel.Publish(
-		r.config.Exchange,
-		r.config.QueueName,
-		false,
-		false,
-		amqp091.Publishing{
-			ContentType: "application/json",
-			Body:        message,
-			Timestamp:   time.Now(),
-		},
-	)
+	return r.PublishMessageWithOptions(message, PublishOptions{})
+}
+
+// PublishMessageWithOptions is PublishMessage with message properties and headers.
+func (r *RabbitMQService) PublishMessageWithOptions(message []byte, opts PublishOptions) error {
+	return r.publish(r.config.Exchange, r.config.QueueName, r.newPublishing(message, opts))
+}
+
+// PublishMirrored publishes a message to the RabbitMQ queue and a copy to rabbitmq.mirror_exchange
+// The mirror is best-effort: a failed mirror publish is logged but doesn't fail the call, so that
+// an archive or a migration target can never disrupt the primary flow. Without a mirror exchange,
+// it behaves like PublishMessage.
+func (r *RabbitMQService) PublishMirrored(message []byte) error {
+	return r.PublishMirroredWithOptions(message, PublishOptions{})
+}
+
+// PublishMirroredWithOptions is PublishMirrored with message properties and headers, such as a trace context.
+func (r *RabbitMQService) PublishMirroredWithOptions(message []byte, opts PublishOptions) error {
+	return r.publishMirrored(r.publish, r.newPublishing(message, opts))
+}
+
+// publishMirrored publishes msg to the primary exchange, then to the mirror exchange when configured.
+func (r *RabbitMQService) publishMirrored(publish func(exchange, routingKey string, msg amqp091.Publishing) error, msg amqp091.Publishing) error {
+	if err := publish(r.config.Exchange, r.config.QueueName, msg); err != nil {
+		return err
+	}
+
+	if r.config.MirrorExchange == "" {
+		return nil
+	}
+
+	if err := publish(r.config.MirrorExchange, r.config.QueueName, msg); err != nil {
+		r.logger.Warn().Err(err).Str("exchange", r.config.MirrorExchange).Msg("Failed to mirror message")
+	}
+
+	return nil
+}
+
+// PublishOptions are the options of PublishMessageWithOptions and PublishMirroredWithOptions.
+type PublishOptions struct {
+	// MessageID and Type are set as the message-id and type properties, so that tools such as the
+	// dead-letter inspection can tell messages apart without parsing their body. Empty omits them.
+	MessageID string
+	Type      string
+	// Headers are the message headers, such as a trace context.
+	Headers amqp091.Table
+}
+
+// newPublishing builds a JSON publishing for a message body, with app-id set to the application name.
+func (r *RabbitMQService) newPublishing(message []byte, opts PublishOptions) amqp091.Publishing {
+	return amqp091.Publishing{
+		ContentType: "application/json",
+		Body:        message,
+		Timestamp:   time.Now(),
+		MessageId:   opts.MessageID,
+		Type:        opts.Type,
+		AppId:       r.config.AppID,
+		Headers:     opts.Headers,
+	}
+}
+
+// RequeueMessage publishes a copy of a delivery back to its queue with extra headers
+// Unlike Nack with requeue, republishing lets the consumer carry state such as a retry counter.
+// Deliveries of a binding queue go back through the exchange and routing key of the binding,
+// any other delivery to the main queue.
+func (r *RabbitMQService) RequeueMessage(msg amqp091.Delivery, headers amqp091.Table) error {
+	exchange, routingKey := r.config.Exchange, r.config.QueueName
+	for _, binding := range r.config.Bindings {
+		if msg.Exchange == binding.Exchange && msg.RoutingKey == binding.RoutingKey {
+			exchange, routingKey = binding.Exchange, binding.RoutingKey
+			break
+		}
+	}
+
+	return r.publish(exchange, routingKey, copyDelivery(msg, headers))
+}
+
+// PublishDeadLetter publishes a copy of a delivery to the dead-letter queue with extra headers.
+func (r *RabbitMQService) PublishDeadLetter(msg amqp091.Delivery, headers amqp091.Table) error {
+	exchange, routingKey := r.config.deadLetterRoute()
+	return r.publish(exchange, routingKey, copyDelivery(msg, headers))
+}
+
+// copyDelivery builds a publishing from a delivery, merging the given headers over the original ones.
+func copyDelivery(msg amqp091.Delivery, headers amqp091.Table) amqp091.Publishing {
+	merged := amqp091.Table{}
+	for k, v := range msg.Headers {
+		merged[k] = v
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+
+	return amqp091.Publishing{
+		Headers:      merged,
+		ContentType:  msg.ContentType,
+		DeliveryMode: msg.DeliveryMode,
+		MessageId:    msg.MessageId,
+		Timestamp:    msg.Timestamp,
+		Type:         msg.Type,
+		AppId:        msg.AppId,
+		Body:         msg.Body,
+	}
+}
+
+// ConsumeOptions tunes how a consumer receives deliveries.
+type ConsumeOptions struct {
+	// PrefetchCount bounds the number of unacknowledged deliveries. Zero means unlimited.
+	PrefetchCount int
+	// Exclusive requests exclusive access to the queue: no other consumer may consume from it.
+	Exclusive bool
+	// Tag identifies the consumer, so that it can be stopped with CancelConsumer. Empty lets the
+	// broker generate a tag, the consumer then running until its channel is closed.
+	Tag string
+	// Queue is the queue consumed, that of one of rabbitmq.bindings. Empty consumes the main queue.
+	Queue string
 }
 
 // ConsumeMessage starts consuming messages from the RabbitMQ queue
-// This method demonstrates how to consume messages using dependency injection.
+// Each call uses a dedicated channel, so consumers never share a channel with publishers.
 func (r *RabbitMQService) ConsumeMessage() (<-chan amqp091.Delivery, error) {
-	return r.channel.Consume(
-		r.config.QueueName,
-		"",
-		false,
+	return r.ConsumeMessageWithOptions(ConsumeOptions{PrefetchCount: r.config.PrefetchCount})
+}
+
+// ConsumeMessageWithOptions starts consuming messages from the RabbitMQ queue with the given options
+// With reconnection enabled, the returned channel outlives the connection: after a reconnection,
+// deliveries come from a fresh channel. It is closed once the connection is closed for good, or
+// when the broker closes the consumer channel while the connection stays up.
+func (r *RabbitMQService) ConsumeMessageWithOptions(opts ConsumeOptions) (<-chan amqp091.Delivery, error) {
+	reconnected := r.reconnection()
+
+	deliveries, err := r.consume(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.config.ReconnectMaxAttempts <= 0 {
+		return deliveries, nil
+	}
+
+	out := make(chan amqp091.Delivery)
+	go r.forwardDeliveries(opts, deliveries, reconnected, out)
+
+	return out, nil
+}
+
+// consume opens a dedicated channel and starts consuming the queue on it.
+func (r *RabbitMQService) consume(opts ConsumeOptions) (<-chan amqp091.Delivery, error) {
+	channel, err := r.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.PrefetchCount > 0 {
+		if err := channel.Qos(opts.PrefetchCount, 0, false); err != nil {
+			_ = channel.Close()
+			return nil, fmt.Errorf("failed to set consumer QoS: %w", err)
+		}
+	}
+
+	queue := cmp.Or(opts.Queue, r.config.QueueName)
+	deliveries, err := channel.Consume(
+		queue,
+		opts.Tag,
 		false,
+		opts.Exclusive,
 		false,
 		false,
 		nil,
 	)
+	if err != nil {
+		_ = channel.Close()
+		return nil, topologyError(err, "queue", queue, "declare_queue", r.config.DeclareQueue)
+	}
+
+	if opts.Tag != "" {
+		r.channelsMu.Lock()
+		if r.consumers == nil {
+			r.consumers = make(map[string]*amqp091.Channel)
+		}
+		r.consumers[opts.Tag] = channel
+		r.channelsMu.Unlock()
+	}
+
+	return deliveries, nil
+}
+
+// CancelConsumer stops the broker from sending deliveries to the consumer with the given tag
+// Deliveries sent already are still delivered and must be acked or nacked as usual; the delivery
+// channel is closed once they all are. Cancelling an unknown consumer does nothing.
+func (r *RabbitMQService) CancelConsumer(tag string) error {
+	r.channelsMu.Lock()
+	channel, ok := r.consumers[tag]
+	delete(r.consumers, tag)
+	r.channelsMu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	if err := channel.Cancel(tag, false); err != nil {
+		return fmt.Errorf("failed to cancel RabbitMQ consumer: %w", err)
+	}
+
+	return nil
+}
+
+// consumerCancelled tells whether the consumer started with the given options was cancelled with CancelConsumer.
+func (r *RabbitMQService) consumerCancelled(opts ConsumeOptions) bool {
+	if opts.Tag == "" {
+		return false
+	}
+
+	r.channelsMu.Lock()
+	defer r.channelsMu.Unlock()
+
+	_, ok := r.consumers[opts.Tag]
+	return !ok
+}
+
+// QueueDepth returns the number of messages ready for delivery in the queue
+// It uses a short-lived channel, since a failed passive declare closes the channel it runs on.
+func (r *RabbitMQService) QueueDepth() (int, error) {
+	conn := r.connection()
+	if conn == nil {
+		return 0, errNotConnected
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create RabbitMQ channel: %w", err)
+	}
+	defer func() { _ = channel.Close() }()
+
+	queue, err := channel.QueueDeclarePassive(r.config.QueueName, true, false, false, false, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect queue: %w", err)
+	}
+
+	return queue.Messages, nil
+}
+
+// HealthCheckWithContext checks the RabbitMQ connection
+// An open connection isn't enough: a passive declare of the queue confirms that the broker
+// still answers on a channel. amqp091 calls ignore contexts, so ctx only bounds the wait.
+func (r *RabbitMQService) HealthCheckWithContext(ctx context.Context) error {
+	if conn := r.connection(); conn == nil || conn.IsClosed() {
+		return errors.New("rabbitmq health check failed: connection closed")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.QueueDepth()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("rabbitmq health check failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("rabbitmq health check failed: %w", ctx.Err())
+	}
+}
+
+// HealthCheck implements do.HealthcheckerWithContext, so that the injector's health checks cover the connection.
+func (r *RabbitMQService) HealthCheck(ctx context.Context) error {
+	return r.HealthCheckWithContext(ctx)
+}
+
+var _ do.HealthcheckerWithContext = (*RabbitMQService)(nil)
+
+// Peek fetches up to count messages from the queue and requeues them all once fetched
+// Messages are held unacknowledged while peeking, so they are briefly invisible to consumers,
+// and requeued messages may come back in a different order.
+func (r *RabbitMQService) Peek(count int) ([]amqp091.Delivery, error) {
+	conn := r.connection()
+	if conn == nil {
+		return nil, errNotConnected
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RabbitMQ channel: %w", err)
+	}
+	// Closing the channel requeues whatever was not explicitly requeued
+	defer func() { _ = channel.Close() }()
+
+	var messages []amqp091.Delivery
+	for len(messages) < count {
+		msg, ok, err := channel.Get(r.config.QueueName, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get message: %w", err)
+		}
+		if !ok {
+			// The queue is empty
+			break
+		}
+		messages = append(messages, msg)
+	}
+
+	if len(messages) > 0 {
+		// Requeue every peeked message at once
+		if err := channel.Nack(messages[len(messages)-1].DeliveryTag, true, true); err != nil {
+			return nil, fmt.Errorf("failed to requeue peeked messages: %w", err)
+		}
+	}
+
+	return messages, nil
 }
 
 // Close closes the RabbitMQ connection and channel
 // This method demonstrates proper resource cleanup in dependency injection.
 func (r *RabbitMQService) Shutdown() error {
-	if r.channel != nil {
-		_ = r.channel.Close()
+	// Closing the connection must not trigger a reconnection
+	r.shuttingDown.Store(true)
+	defer r.markClosed()
+
+	r.channelsMu.Lock()
+	for _, channel := range r.channels {
+		_ = channel.Close()
 	}
-	if r.conn != nil {
-		_ = r.conn.Close()
+	r.channels = nil
+	r.consumers = nil
+	r.channelsMu.Unlock()
+
+	r.publishMu.Lock()
+	if r.publishChannel != nil {
+		_ = r.publishChannel.Close()
+	}
+	r.publishMu.Unlock()
+
+	if conn := r.connection(); conn != nil {
+		_ = conn.Close()
 	}
 	return nil
 }
@@ -0,0 +1,404 @@
+// Package rabbitmqtest provides an in-memory message broker, to run the workers without RabbitMQ.
+package rabbitmqtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+)
+
+// ErrClosed is returned when using a broker after Shutdown.
+var ErrClosed = errors.New("in-memory broker closed")
+
+// InMemoryBroker is a rabbitmq.MessageBroker keeping a single queue in memory
+// Deliveries follow the semantics the consumer relies on: they stay unacked until acked or nacked
+// through their Acknowledger, a nack with requeue puts the message back at the head of the queue as
+// redelivered, and a consumer receives at most its prefetch count of unacked deliveries. Messages
+// nacked without requeue are rejected, and dead letters are kept aside; both can be inspected.
+//
+// Register it in place of RabbitMQ before invoking the workers:
+//
+//	do.OverrideValue[rabbitmq.MessageBroker](injector, rabbitmqtest.NewInMemoryBroker())
+type InMemoryBroker struct {
+	// AppID is set as the app-id of published messages, like rabbitmq.Config.AppID.
+	AppID string
+
+	mu sync.Mutex
+	// changed is closed and replaced whenever the queue, a consumer or the broker changes, to wake up dispatchers
+	changed chan struct{}
+	closed  bool
+
+	queue       []amqp091.Delivery
+	consumers   map[string]*consumer
+	unacked     map[uint64]unacked
+	nextTag     uint64
+	nextID      int
+	deadLetters []amqp091.Delivery
+	rejected    []amqp091.Delivery
+}
+
+// consumer is a consumer of the queue, fed by its own dispatcher goroutine.
+type consumer struct {
+	opts    rabbitmq.ConsumeOptions
+	out     chan amqp091.Delivery
+	unacked int
+	// cancelled is closed by CancelConsumer and Shutdown
+	cancelled chan struct{}
+}
+
+// unacked is a delivery waiting for its ack or nack.
+type unacked struct {
+	msg      amqp091.Delivery
+	consumer *consumer
+}
+
+var _ rabbitmq.MessageBroker = (*InMemoryBroker)(nil)
+
+// NewInMemoryBroker creates an empty in-memory broker.
+func NewInMemoryBroker() *InMemoryBroker {
+	return &InMemoryBroker{
+		changed:   make(chan struct{}),
+		consumers: map[string]*consumer{},
+		unacked:   map[uint64]unacked{},
+	}
+}
+
+// notify wakes up the dispatchers waiting for a change. It must be called with mu held.
+func (b *InMemoryBroker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// enqueue appends a message to the queue.
+func (b *InMemoryBroker) enqueue(msg amqp091.Delivery) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	b.queue = append(b.queue, msg)
+	b.notify()
+	return nil
+}
+
+// PublishMessage publishes a message to the queue.
+func (b *InMemoryBroker) PublishMessage(message []byte) error {
+	return b.PublishMessageWithOptions(message, rabbitmq.PublishOptions{})
+}
+
+// PublishMessageWithOptions publishes a message with properties and headers to the queue.
+func (b *InMemoryBroker) PublishMessageWithOptions(message []byte, opts rabbitmq.PublishOptions) error {
+	return b.enqueue(amqp091.Delivery{
+		Headers:     maps.Clone(opts.Headers),
+		ContentType: "application/json",
+		Timestamp:   time.Now(),
+		MessageId:   opts.MessageID,
+		Type:        opts.Type,
+		AppId:       b.AppID,
+		Body:        message,
+	})
+}
+
+// PublishMirrored publishes a message to the queue, there being no mirror exchange in memory.
+func (b *InMemoryBroker) PublishMirrored(message []byte) error {
+	return b.PublishMessage(message)
+}
+
+// PublishMirroredWithOptions publishes a message with properties and headers to the queue.
+func (b *InMemoryBroker) PublishMirroredWithOptions(message []byte, opts rabbitmq.PublishOptions) error {
+	return b.PublishMessageWithOptions(message, opts)
+}
+
+// RequeueMessage publishes a copy of a delivery back to the queue, merging the given headers over its own.
+func (b *InMemoryBroker) RequeueMessage(msg amqp091.Delivery, headers amqp091.Table) error {
+	return b.enqueue(copyDelivery(msg, headers))
+}
+
+// PublishDeadLetter keeps a copy of a delivery, with the given headers, among the dead letters.
+func (b *InMemoryBroker) PublishDeadLetter(msg amqp091.Delivery, headers amqp091.Table) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	b.deadLetters = append(b.deadLetters, copyDelivery(msg, headers))
+	return nil
+}
+
+// copyDelivery copies a delivery for publishing, merging the given headers over its own.
+func copyDelivery(msg amqp091.Delivery, headers amqp091.Table) amqp091.Delivery {
+	merged := amqp091.Table{}
+	maps.Copy(merged, msg.Headers)
+	maps.Copy(merged, headers)
+
+	return amqp091.Delivery{
+		Headers:      merged,
+		ContentType:  msg.ContentType,
+		DeliveryMode: msg.DeliveryMode,
+		MessageId:    msg.MessageId,
+		Timestamp:    msg.Timestamp,
+		Type:         msg.Type,
+		AppId:        msg.AppId,
+		Body:         msg.Body,
+	}
+}
+
+// ConsumeMessage starts consuming messages from the queue, without a prefetch limit.
+func (b *InMemoryBroker) ConsumeMessage() (<-chan amqp091.Delivery, error) {
+	return b.ConsumeMessageWithOptions(rabbitmq.ConsumeOptions{})
+}
+
+// ConsumeMessageWithOptions starts consuming messages from the queue with the given options
+// The returned channel is closed once the consumer is cancelled or the broker shut down. The broker
+// has a single queue, so consuming the queue of a binding fails.
+func (b *InMemoryBroker) ConsumeMessageWithOptions(opts rabbitmq.ConsumeOptions) (<-chan amqp091.Delivery, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if opts.Queue != "" {
+		return nil, fmt.Errorf("failed to consume queue %q: the in-memory broker has a single queue", opts.Queue)
+	}
+	for _, c := range b.consumers {
+		if opts.Exclusive || c.opts.Exclusive {
+			return nil, errors.New("failed to consume: the queue has an exclusive consumer")
+		}
+	}
+
+	if opts.Tag == "" {
+		b.nextID++
+		opts.Tag = fmt.Sprintf("ctag-%d", b.nextID)
+	}
+	if _, ok := b.consumers[opts.Tag]; ok {
+		return nil, fmt.Errorf("failed to consume: consumer tag %q is in use", opts.Tag)
+	}
+
+	c := &consumer{opts: opts, out: make(chan amqp091.Delivery), cancelled: make(chan struct{})}
+	b.consumers[opts.Tag] = c
+	go b.dispatch(c)
+
+	return c.out, nil
+}
+
+// dispatch sends the messages of the queue to a consumer until it is cancelled.
+func (b *InMemoryBroker) dispatch(c *consumer) {
+	defer close(c.out)
+
+	for {
+		msg, ok := b.next(c)
+		if !ok {
+			return
+		}
+
+		select {
+		case c.out <- msg:
+		case <-c.cancelled:
+			// The consumer went away before receiving the delivery
+			_ = b.settle(msg.DeliveryTag, false, true)
+			return
+		}
+	}
+}
+
+// next waits for a message the consumer can receive, and records it as unacked
+// It returns false once the consumer is cancelled.
+func (b *InMemoryBroker) next(c *consumer) (amqp091.Delivery, bool) {
+	for {
+		b.mu.Lock()
+		select {
+		case <-c.cancelled:
+			b.mu.Unlock()
+			return amqp091.Delivery{}, false
+		default:
+		}
+
+		prefetch := c.opts.PrefetchCount
+		if len(b.queue) > 0 && (prefetch <= 0 || c.unacked < prefetch) {
+			msg := b.queue[0]
+			b.queue = b.queue[1:]
+
+			b.nextTag++
+			msg.DeliveryTag = b.nextTag
+			msg.ConsumerTag = c.opts.Tag
+			msg.Acknowledger = acknowledger{b}
+
+			b.unacked[msg.DeliveryTag] = unacked{msg: msg, consumer: c}
+			c.unacked++
+			b.mu.Unlock()
+			return msg, true
+		}
+
+		changed := b.changed
+		b.mu.Unlock()
+		<-changed
+	}
+}
+
+// settle acks or nacks an unacked delivery, requeuing it at the head of the queue or rejecting it.
+func (b *InMemoryBroker) settle(tag uint64, ack, requeue bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending, ok := b.unacked[tag]
+	if !ok {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	delete(b.unacked, tag)
+	pending.consumer.unacked--
+
+	switch {
+	case ack:
+	case requeue:
+		msg := pending.msg
+		msg.Redelivered = true
+		msg.Acknowledger = nil
+		b.queue = append([]amqp091.Delivery{msg}, b.queue...)
+	default:
+		b.rejected = append(b.rejected, pending.msg)
+	}
+
+	b.notify()
+	return nil
+}
+
+// CancelConsumer stops sending deliveries to the consumer with the given tag
+// Deliveries received already stay unacked until they are acked or nacked. Cancelling an unknown consumer does nothing.
+func (b *InMemoryBroker) CancelConsumer(tag string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.consumers[tag]; ok {
+		delete(b.consumers, tag)
+		close(c.cancelled)
+		b.notify()
+	}
+
+	return nil
+}
+
+// QueueDepth returns the number of messages ready for delivery, unacked deliveries excluded.
+func (b *InMemoryBroker) QueueDepth() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.queue), nil
+}
+
+// WaitForFlow returns immediately: an in-memory broker never applies flow control.
+func (b *InMemoryBroker) WaitForFlow(ctx context.Context) error {
+	return nil
+}
+
+// HealthCheckWithContext fails once the broker is shut down.
+func (b *InMemoryBroker) HealthCheckWithContext(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	return nil
+}
+
+// Shutdown cancels every consumer and rejects further publishes. It can be called several times.
+func (b *InMemoryBroker) Shutdown() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	b.closed = true
+	for tag, c := range b.consumers {
+		delete(b.consumers, tag)
+		close(c.cancelled)
+	}
+	b.notify()
+
+	return nil
+}
+
+// Unacked returns the number of deliveries waiting for their ack or nack.
+func (b *InMemoryBroker) Unacked() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.unacked)
+}
+
+// DeadLetters returns the messages published to the dead-letter queue, in order.
+func (b *InMemoryBroker) DeadLetters() []amqp091.Delivery {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]amqp091.Delivery(nil), b.deadLetters...)
+}
+
+// Rejected returns the deliveries nacked or rejected without requeue, in order.
+func (b *InMemoryBroker) Rejected() []amqp091.Delivery {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]amqp091.Delivery(nil), b.rejected...)
+}
+
+// acknowledger settles the deliveries of a broker.
+type acknowledger struct {
+	broker *InMemoryBroker
+}
+
+// Ack acknowledges a delivery, or every unacked delivery up to its tag of the same consumer with multiple.
+func (a acknowledger) Ack(tag uint64, multiple bool) error {
+	return a.settleUpTo(tag, multiple, true, false)
+}
+
+// Nack negatively acknowledges a delivery, requeuing it or rejecting it.
+func (a acknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	return a.settleUpTo(tag, multiple, false, requeue)
+}
+
+// Reject negatively acknowledges a single delivery.
+func (a acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.settleUpTo(tag, false, false, requeue)
+}
+
+// settleUpTo settles a delivery, and with multiple the earlier unacked deliveries of its consumer
+// Deliveries are settled latest first, so that requeued ones get back to the queue in their order.
+func (a acknowledger) settleUpTo(tag uint64, multiple, ack, requeue bool) error {
+	tags := []uint64{tag}
+	if multiple {
+		a.broker.mu.Lock()
+		if pending, ok := a.broker.unacked[tag]; ok {
+			for other, p := range a.broker.unacked {
+				if other < tag && p.consumer == pending.consumer {
+					tags = append(tags, other)
+				}
+			}
+		}
+		a.broker.mu.Unlock()
+	}
+
+	slices.Sort(tags)
+	for _, t := range slices.Backward(tags) {
+		if err := a.broker.settle(t, ack, requeue); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
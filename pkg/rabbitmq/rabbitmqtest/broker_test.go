@@ -0,0 +1,205 @@
+package rabbitmqtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+)
+
+// receive returns the next delivery of a consumer, failing the test after a second.
+func receive(t *testing.T, deliveries <-chan amqp091.Delivery) amqp091.Delivery {
+	t.Helper()
+
+	select {
+	case msg, ok := <-deliveries:
+		if !ok {
+			t.Fatal("expected a delivery, the channel is closed")
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("expected a delivery, got none")
+		return amqp091.Delivery{}
+	}
+}
+
+// expectNone fails the test when the consumer receives a delivery within a short delay.
+func expectNone(t *testing.T, deliveries <-chan amqp091.Delivery) {
+	t.Helper()
+
+	select {
+	case msg, ok := <-deliveries:
+		if ok {
+			t.Fatalf("expected no delivery, got %s", msg.Body)
+		}
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestInMemoryBrokerAckAndNack(t *testing.T) {
+	t.Parallel()
+
+	broker := NewInMemoryBroker()
+	t.Cleanup(func() { _ = broker.Shutdown() })
+
+	for _, body := range []string{"first", "second", "third"} {
+		if err := broker.PublishMessage([]byte(body)); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	deliveries, err := broker.ConsumeMessageWithOptions(rabbitmq.ConsumeOptions{PrefetchCount: 2, Tag: "consumer"})
+	if err != nil {
+		t.Fatalf("failed to consume: %v", err)
+	}
+
+	first := receive(t, deliveries)
+	second := receive(t, deliveries)
+	if string(first.Body) != "first" || string(second.Body) != "second" || first.ConsumerTag != "consumer" {
+		t.Fatalf("expected deliveries in order, got %s and %s", first.Body, second.Body)
+	}
+
+	// The prefetch count is reached until a delivery is settled
+	expectNone(t, deliveries)
+	if depth, _ := broker.QueueDepth(); depth != 1 || broker.Unacked() != 2 {
+		t.Fatalf("expected 1 ready and 2 unacked messages, got %d and %d", depth, broker.Unacked())
+	}
+
+	// A requeued delivery comes back first, as redelivered
+	if err := first.Nack(false, true); err != nil {
+		t.Fatalf("failed to nack: %v", err)
+	}
+	redelivered := receive(t, deliveries)
+	if string(redelivered.Body) != "first" || !redelivered.Redelivered {
+		t.Fatalf("expected the requeued delivery to be redelivered, got %s (redelivered: %t)", redelivered.Body, redelivered.Redelivered)
+	}
+
+	if err := second.Ack(false); err != nil {
+		t.Fatalf("failed to ack: %v", err)
+	}
+	if err := second.Ack(false); err == nil {
+		t.Fatal("expected acking a delivery twice to fail")
+	}
+
+	third := receive(t, deliveries)
+	if err := third.Reject(false); err != nil {
+		t.Fatalf("failed to reject: %v", err)
+	}
+	if rejected := broker.Rejected(); len(rejected) != 1 || string(rejected[0].Body) != "third" {
+		t.Fatalf("expected the rejected delivery to be recorded, got %v", rejected)
+	}
+
+	// Acking with multiple settles every earlier delivery of the consumer
+	if err := broker.PublishMessage([]byte("fourth")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	fourth := receive(t, deliveries)
+	if err := fourth.Ack(true); err != nil {
+		t.Fatalf("failed to ack: %v", err)
+	}
+	if broker.Unacked() != 0 {
+		t.Fatalf("expected every delivery to be settled, got %d unacked", broker.Unacked())
+	}
+}
+
+func TestInMemoryBrokerPublishOptions(t *testing.T) {
+	t.Parallel()
+
+	broker := NewInMemoryBroker()
+	broker.AppID = "billing"
+	t.Cleanup(func() { _ = broker.Shutdown() })
+
+	opts := rabbitmq.PublishOptions{MessageID: "msg_1", Type: "create_user", Headers: amqp091.Table{"attempt": int32(1)}}
+	if err := broker.PublishMirroredWithOptions([]byte("{}"), opts); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	deliveries, err := broker.ConsumeMessage()
+	if err != nil {
+		t.Fatalf("failed to consume: %v", err)
+	}
+
+	msg := receive(t, deliveries)
+	if msg.MessageId != "msg_1" || msg.Type != "create_user" || msg.AppId != "billing" || msg.Headers["attempt"] != int32(1) {
+		t.Fatalf("expected the publish options to be delivered, got %+v", msg)
+	}
+}
+
+func TestInMemoryBrokerRequeueAndDeadLetter(t *testing.T) {
+	t.Parallel()
+
+	broker := NewInMemoryBroker()
+	t.Cleanup(func() { _ = broker.Shutdown() })
+
+	original := amqp091.Delivery{Body: []byte("message"), Headers: amqp091.Table{"trace": "abc"}}
+	if err := broker.RequeueMessage(original, amqp091.Table{rabbitmq.HeaderRequeueCount: int32(1)}); err != nil {
+		t.Fatalf("failed to requeue: %v", err)
+	}
+	if err := broker.PublishDeadLetter(original, amqp091.Table{rabbitmq.HeaderDeadLetterReason: "failed"}); err != nil {
+		t.Fatalf("failed to dead-letter: %v", err)
+	}
+
+	deliveries, err := broker.ConsumeMessage()
+	if err != nil {
+		t.Fatalf("failed to consume: %v", err)
+	}
+	requeued := receive(t, deliveries)
+	if requeued.Headers["trace"] != "abc" || requeued.Headers[rabbitmq.HeaderRequeueCount] != int32(1) {
+		t.Fatalf("expected the requeued copy to merge the headers, got %v", requeued.Headers)
+	}
+
+	deadLetters := broker.DeadLetters()
+	if len(deadLetters) != 1 || deadLetters[0].Headers[rabbitmq.HeaderDeadLetterReason] != "failed" {
+		t.Fatalf("expected one dead letter with its reason, got %v", deadLetters)
+	}
+}
+
+func TestInMemoryBrokerCancelAndShutdown(t *testing.T) {
+	t.Parallel()
+
+	broker := NewInMemoryBroker()
+
+	deliveries, err := broker.ConsumeMessageWithOptions(rabbitmq.ConsumeOptions{Tag: "exclusive", Exclusive: true})
+	if err != nil {
+		t.Fatalf("failed to consume: %v", err)
+	}
+	if _, err := broker.ConsumeMessage(); err == nil {
+		t.Fatal("expected a second consumer to be refused next to an exclusive one")
+	}
+
+	if err := broker.CancelConsumer("exclusive"); err != nil {
+		t.Fatalf("failed to cancel consumer: %v", err)
+	}
+	if _, ok := <-deliveries; ok {
+		t.Fatal("expected the channel of a cancelled consumer to be closed")
+	}
+
+	// Messages published without a consumer wait in the queue
+	if err := broker.PublishMessage([]byte("waiting")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if depth, _ := broker.QueueDepth(); depth != 1 {
+		t.Fatalf("expected 1 ready message, got %d", depth)
+	}
+
+	deliveries, err = broker.ConsumeMessage()
+	if err != nil {
+		t.Fatalf("failed to consume: %v", err)
+	}
+	_ = receive(t, deliveries)
+
+	if err := broker.Shutdown(); err != nil {
+		t.Fatalf("failed to shut down: %v", err)
+	}
+	if _, ok := <-deliveries; ok {
+		t.Fatal("expected consumers to be closed on shutdown")
+	}
+	if err := broker.PublishMessage([]byte("late")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after shutdown, got %v", err)
+	}
+	if err := broker.HealthCheckWithContext(t.Context()); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected the health check to fail after shutdown, got %v", err)
+	}
+}
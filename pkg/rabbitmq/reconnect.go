@@ -0,0 +1,162 @@
+package rabbitmq
+
+import (
+	"cmp"
+	"errors"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// reconnectInitialBackoff is the delay before the first reconnection attempt.
+	reconnectInitialBackoff = 1 * time.Second
+	// reconnectMaxBackoff caps the exponential backoff between two reconnection attempts.
+	reconnectMaxBackoff = 30 * time.Second
+)
+
+var (
+	// errNotConnected is returned when the service has no connection to open a channel on.
+	errNotConnected = errors.New("rabbitmq: not connected")
+	// errShuttingDown stops reconnecting once the service is shut down.
+	errShuttingDown = errors.New("rabbitmq: shutting down")
+)
+
+// reconnect re-dials a lost connection with exponential backoff, declares the topology again, and
+// makes the new connection the current one. It reports whether the connection was re-established.
+func (r *RabbitMQService) reconnect(cause error) bool {
+	if r.config.ReconnectMaxAttempts <= 0 || r.shuttingDown.Load() {
+		return false
+	}
+
+	r.setConnectionState(StateReconnecting, cause)
+
+	policy := retryPolicy{
+		attempts:       r.config.ReconnectMaxAttempts,
+		initialBackoff: reconnectInitialBackoff,
+		maxBackoff:     reconnectMaxBackoff,
+	}
+
+	var (
+		conn    *amqp091.Connection
+		channel *amqp091.Channel
+	)
+	err := retryTransient(policy, func() error {
+		if r.shuttingDown.Load() {
+			return errShuttingDown
+		}
+
+		var err error
+		conn, channel, err = connect(r.config)
+		return err
+	}, r.logger)
+	if err != nil {
+		r.logger.Error().Err(err).Int("max_attempts", r.config.ReconnectMaxAttempts).Msg("RabbitMQ reconnection failed")
+		return false
+	}
+
+	// Channels opened on the lost connection are closed already
+	r.channelsMu.Lock()
+	r.channels = nil
+	r.channelsMu.Unlock()
+
+	r.resetFlow()
+	r.attach(conn, channel)
+	r.setConnectionState(StateConnected, nil)
+
+	// Wake up the consumers waiting for the new connection
+	r.reconnectMu.Lock()
+	close(r.reconnected)
+	r.reconnected = make(chan struct{})
+	r.reconnectMu.Unlock()
+
+	return true
+}
+
+// reconnection returns a channel closed on the next reconnection.
+func (r *RabbitMQService) reconnection() <-chan struct{} {
+	r.reconnectMu.Lock()
+	defer r.reconnectMu.Unlock()
+
+	return r.reconnected
+}
+
+// markClosed records that the connection is closed for good, releasing the consumers waiting for a reconnection.
+func (r *RabbitMQService) markClosed() {
+	r.closeOnce.Do(func() {
+		if r.closed != nil {
+			close(r.closed)
+		}
+	})
+}
+
+// resetFlow lifts the flow control of the lost publish channel: a new channel starts unpaused.
+func (r *RabbitMQService) resetFlow() {
+	r.flowMu.Lock()
+	defer r.flowMu.Unlock()
+
+	if r.flowPaused {
+		r.flowPaused = false
+		close(r.flowResumed)
+	}
+}
+
+// forwardDeliveries forwards deliveries to out, consuming again on the new connection after each reconnection
+// out is closed once the connection is closed for good, once the consumer is cancelled, or when the
+// consumer channel closes while the connection stays up, e.g. because the queue was deleted, so that
+// the consumer notices.
+func (r *RabbitMQService) forwardDeliveries(opts ConsumeOptions, deliveries <-chan amqp091.Delivery, reconnected <-chan struct{}, out chan<- amqp091.Delivery) {
+	defer close(out)
+
+	for {
+		for delivery := range deliveries {
+			select {
+			case out <- delivery:
+			case <-r.closed:
+				return
+			}
+		}
+
+		if r.consumerCancelled(opts) {
+			return
+		}
+
+		// Only a lost connection is followed by a reconnection
+		if conn := r.connection(); conn != nil && !conn.IsClosed() && !r.reconnectedSince(reconnected) {
+			r.logger.Warn().Str("queue", cmp.Or(opts.Queue, r.config.QueueName)).Msg("RabbitMQ consumer channel closed")
+			return
+		}
+
+		select {
+		case <-reconnected:
+		case <-r.closed:
+			return
+		}
+
+		reconnected = r.reconnection()
+
+		// The consumer may have been cancelled while reconnecting
+		if r.consumerCancelled(opts) {
+			return
+		}
+
+		var err error
+		deliveries, err = r.consume(opts)
+		if err != nil {
+			r.logger.Error().Err(err).Str("queue", cmp.Or(opts.Queue, r.config.QueueName)).Msg("Failed to resume RabbitMQ consumer")
+			return
+		}
+
+		r.lifecycleEvent().Str("queue", r.config.QueueName).Msg("RabbitMQ consumer resumed")
+	}
+}
+
+// reconnectedSince tells whether a reconnection happened since the given reconnection channel was taken.
+func (r *RabbitMQService) reconnectedSince(reconnected <-chan struct{}) bool {
+	select {
+	case <-reconnected:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,86 @@
+package rabbitmq
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog"
+)
+
+// retryPolicy tunes retryTransient.
+type retryPolicy struct {
+	// attempts is the total number of attempts, the first one included.
+	attempts int
+	// initialBackoff is the delay before the first retry, doubled on each retry up to maxBackoff.
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	// timeout stops retrying once the next attempt would start after it. Zero disables it.
+	timeout time.Duration
+}
+
+// connectRetry is the retry policy of the connection and topology declaration at startup
+// It rides out a broker restarting or still starting up, e.g. with docker-compose, for up to
+// rabbitmq.connect_max_retries retries within rabbitmq.connect_timeout.
+func connectRetry(config *Config) retryPolicy {
+	return retryPolicy{
+		attempts:       config.ConnectMaxRetries + 1,
+		initialBackoff: 1 * time.Second,
+		maxBackoff:     8 * time.Second,
+		timeout:        config.ConnectTimeout,
+	}
+}
+
+// retryTransient calls fn until it succeeds, fails with a permanent error, or runs out of attempts
+// Only errors classified as transient by isTransient are retried, with exponential backoff.
+// The last error is returned as is.
+func retryTransient(policy retryPolicy, fn func() error, logger *zerolog.Logger) error {
+	backoff := policy.initialBackoff
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isTransient(err) || attempt >= policy.attempts {
+			return err
+		}
+		if policy.timeout > 0 && time.Since(start)+backoff > policy.timeout {
+			return err
+		}
+
+		logger.Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Int("max_attempts", policy.attempts).
+			Dur("backoff", backoff).
+			Msg("RabbitMQ unavailable, retrying")
+
+		time.Sleep(backoff)
+		backoff = min(2*backoff, policy.maxBackoff)
+	}
+}
+
+// isTransient tells whether an error may go away by retrying later
+// Network errors, connections closed mid-handshake and the broker closing the connection on its
+// own (forced close, resource or internal errors) are transient. Other broker errors, such as a
+// 406 PRECONDITION_FAILED on a declaration whose properties mismatch the existing exchange or
+// queue, a 404 on a passive declaration or a 403 ACCESS_REFUSED, need a fix and are permanent.
+func isTransient(err error) bool {
+	if errors.Is(err, amqp091.ErrClosed) {
+		return true
+	}
+
+	var amqpErr *amqp091.Error
+	if errors.As(err, &amqpErr) {
+		switch amqpErr.Code {
+		case amqp091.ConnectionForced, amqp091.ResourceError, amqp091.InternalError:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
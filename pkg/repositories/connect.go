@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+)
+
+// cannotConnectNowCode is the SQLSTATE of a server refusing connections while it starts up or shuts down.
+const cannotConnectNowCode = "57P03"
+
+// connectPolicy tunes connectWithRetry.
+type connectPolicy struct {
+	// retries is the number of retries after the first attempt.
+	retries int
+	// initialBackoff is the delay before the first retry, doubled on each retry up to maxBackoff.
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// newConnectPolicy returns the startup connection policy of database.connect_max_retries.
+func newConnectPolicy(retries int) connectPolicy {
+	return connectPolicy{
+		retries:        retries,
+		initialBackoff: 1 * time.Second,
+		maxBackoff:     8 * time.Second,
+	}
+}
+
+// connectWithRetry calls connect until it succeeds, fails with a permanent error, runs out of
+// retries or ctx is done, so that the worker can start alongside a database still starting up,
+// e.g. with docker-compose. Each failed attempt is logged, and the last error is returned as is.
+func connectWithRetry(ctx context.Context, policy connectPolicy, connect func(ctx context.Context) error, logger *zerolog.Logger) error {
+	backoff := policy.initialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := connect(ctx)
+		if err == nil || !isTransientConnectError(err) || attempt > policy.retries || ctx.Err() != nil {
+			return err
+		}
+
+		logger.Warn().
+			Err(err).
+			Int("attempt", attempt).
+			Int("max_retries", policy.retries).
+			Dur("backoff", backoff).
+			Msg("Database unavailable, retrying")
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, policy.maxBackoff)
+	}
+}
+
+// isTransientConnectError tells whether a connection error may go away by retrying later
+// A server answering with an error, such as a failed authentication or a missing database, needs a
+// fix, unless it is still starting up. Network errors, such as a refused connection, are transient.
+func isTransientConnectError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == cannotConnectNowCode
+	}
+
+	return true
+}
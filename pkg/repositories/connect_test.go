@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+)
+
+func TestConnectWithRetry(t *testing.T) {
+	t.Parallel()
+
+	logger := zerolog.Nop()
+	policy := connectPolicy{retries: 3, initialBackoff: time.Millisecond, maxBackoff: 2 * time.Millisecond}
+	refused := errors.New("dial tcp: connection refused")
+
+	// failing returns a connect function failing with the given errors, then succeeding
+	failing := func(attempts *int, errs ...error) func(context.Context) error {
+		return func(context.Context) error {
+			*attempts++
+			if *attempts <= len(errs) {
+				return errs[*attempts-1]
+			}
+			return nil
+		}
+	}
+
+	t.Run("succeeds once the database is up", func(t *testing.T) {
+		t.Parallel()
+
+		var attempts int
+		starting := &pgconn.PgError{Code: cannotConnectNowCode}
+		err := connectWithRetry(context.Background(), policy, failing(&attempts, refused, starting), &logger)
+		if err != nil || attempts != 3 {
+			t.Fatalf("expected success on the third attempt, got %v after %d attempts", err, attempts)
+		}
+	})
+
+	t.Run("gives up after its retries", func(t *testing.T) {
+		t.Parallel()
+
+		var attempts int
+		err := connectWithRetry(context.Background(), policy, failing(&attempts, refused, refused, refused, refused, refused), &logger)
+		if !errors.Is(err, refused) || attempts != 4 {
+			t.Fatalf("expected the last error after 4 attempts, got %v after %d attempts", err, attempts)
+		}
+	})
+
+	t.Run("doesn't retry permanent errors", func(t *testing.T) {
+		t.Parallel()
+
+		var attempts int
+		authFailed := &pgconn.PgError{Code: "28P01"}
+		err := connectWithRetry(context.Background(), policy, failing(&attempts, authFailed), &logger)
+		if !errors.Is(err, authFailed) || attempts != 1 {
+			t.Fatalf("expected the authentication error without retry, got %v after %d attempts", err, attempts)
+		}
+	})
+
+	t.Run("stops at the connect timeout", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		var attempts int
+		slow := connectPolicy{retries: 100, initialBackoff: time.Hour, maxBackoff: time.Hour}
+		start := time.Now()
+		err := connectWithRetry(ctx, slow, failing(&attempts, refused, refused), &logger)
+		if !errors.Is(err, refused) || attempts != 1 || time.Since(start) > time.Second {
+			t.Fatalf("expected the timeout to cut the backoff short, got %v after %d attempts", err, attempts)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do/v2"
+)
+
+// FailedMessage represents a message that was dead-lettered
+// This struct gives operators a durable, queryable record of processing failures.
+type FailedMessage struct {
+	ID        int64     `json:"id"`
+	MessageID string    `json:"message_id"`
+	Action    string    `json:"action"`
+	Body      []byte    `json:"body"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// FailedMessageRepository defines the interface for failed message data access operations.
+type FailedMessageRepository interface {
+	CreateFailedMessage(ctx context.Context, message *FailedMessage) (*FailedMessage, error)
+	ListFailedMessages(ctx context.Context, limit, offset int) ([]*FailedMessage, error)
+	DeleteFailedMessagesBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// failedMessageRepository implements the FailedMessageRepository interface.
+type failedMessageRepository struct {
+	db           *boundedPool
+	queryTimeout time.Duration
+}
+
+// NewFailedMessageRepository creates a new FailedMessageRepository instance
+// Failed messages are kept in the main database, even with database shards, so that they are listed in one place.
+func NewFailedMessageRepository(injector do.Injector) (FailedMessageRepository, error) {
+	db := do.MustInvoke[*Database](injector)
+	appConfig := do.MustInvoke[*config.Config](injector)
+
+	return &failedMessageRepository{
+		db:           newBoundedPool(db.Pool(), appConfig.Database.AcquireTimeout),
+		queryTimeout: appConfig.Database.QueryTimeout,
+	}, nil
+}
+
+// CreateFailedMessage records a failed message.
+func (r *failedMessageRepository) CreateFailedMessage(ctx context.Context, message *FailedMessage) (*FailedMessage, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO failed_messages (message_id, action, body, error, attempts, failed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	if message.FailedAt.IsZero() {
+		message.FailedAt = time.Now()
+	}
+
+	err := r.db.QueryRow(
+		ctx, query,
+		message.MessageID, message.Action, message.Body, message.Error, message.Attempts, message.FailedAt,
+	).Scan(&message.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create failed message: %w", err)
+	}
+
+	return message, nil
+}
+
+// ListFailedMessages retrieves failed messages, most recent first.
+func (r *failedMessageRepository) ListFailedMessages(ctx context.Context, limit, offset int) ([]*FailedMessage, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, message_id, action, body, error, attempts, failed_at
+		FROM failed_messages
+		ORDER BY failed_at DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*FailedMessage
+	for rows.Next() {
+		var message FailedMessage
+		if err := rows.Scan(
+			&message.ID, &message.MessageID, &message.Action, &message.Body,
+			&message.Error, &message.Attempts, &message.FailedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan failed message: %w", err)
+		}
+		messages = append(messages, &message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate failed messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// DeleteFailedMessagesBefore purges the failed messages recorded before the given time and returns how many were deleted.
+func (r *failedMessageRepository) DeleteFailedMessagesBefore(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM failed_messages WHERE failed_at < $1`
+
+	result, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete failed messages: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do/v2"
+)
+
+// Message result statuses.
+const (
+	MessageResultSucceeded = "succeeded"
+	MessageResultFailed    = "failed"
+)
+
+// ErrMessageResultNotFound is returned when no result is stored for a message ID.
+var ErrMessageResultNotFound = errors.New("message result not found")
+
+// MessageResult represents the outcome of a processed message
+// This struct lets external systems poll for the outcome of the messages they published.
+type MessageResult struct {
+	MessageID   string          `json:"message_id"`
+	Action      string          `json:"action"`
+	Status      string          `json:"status"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	ProcessedAt time.Time       `json:"processed_at"`
+}
+
+// MessageResultRepository defines the interface for message result data access operations.
+type MessageResultRepository interface {
+	SaveMessageResult(ctx context.Context, result *MessageResult) error
+	GetMessageResult(ctx context.Context, messageID string) (*MessageResult, error)
+	DeleteMessageResultsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// messageResultRepository implements the MessageResultRepository interface.
+type messageResultRepository struct {
+	db           *boundedPool
+	queryTimeout time.Duration
+}
+
+// NewMessageResultRepository creates a new MessageResultRepository instance
+// Results are kept in the main database, even with database shards, keyed by message ID rather than by user.
+func NewMessageResultRepository(injector do.Injector) (MessageResultRepository, error) {
+	db := do.MustInvoke[*Database](injector)
+	appConfig := do.MustInvoke[*config.Config](injector)
+
+	return &messageResultRepository{
+		db:           newBoundedPool(db.Pool(), appConfig.Database.AcquireTimeout),
+		queryTimeout: appConfig.Database.QueryTimeout,
+	}, nil
+}
+
+// SaveMessageResult stores the result of a message, replacing any previous result for the same message ID.
+func (r *messageResultRepository) SaveMessageResult(ctx context.Context, result *MessageResult) error {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO message_results (message_id, action, status, result, error, processed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (message_id) DO UPDATE
+		SET action = EXCLUDED.action, status = EXCLUDED.status, result = EXCLUDED.result,
+			error = EXCLUDED.error, processed_at = EXCLUDED.processed_at
+	`
+
+	if result.ProcessedAt.IsZero() {
+		result.ProcessedAt = time.Now()
+	}
+
+	// A nil raw message must be stored as NULL, not as an empty JSON document
+	var payload any
+	if len(result.Result) > 0 {
+		payload = string(result.Result)
+	}
+
+	var errorMessage *string
+	if result.Error != "" {
+		errorMessage = &result.Error
+	}
+
+	_, err := r.db.Exec(
+		ctx, query,
+		result.MessageID, result.Action, result.Status, payload, errorMessage, result.ProcessedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save message result: %w", err)
+	}
+
+	return nil
+}
+
+// GetMessageResult retrieves the result of a message, or ErrMessageResultNotFound when none is stored.
+func (r *messageResultRepository) GetMessageResult(ctx context.Context, messageID string) (*MessageResult, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT message_id, action, status, result, COALESCE(error, ''), processed_at
+		FROM message_results
+		WHERE message_id = $1
+	`
+
+	var (
+		result  MessageResult
+		payload []byte
+	)
+	err := r.db.QueryRow(ctx, query, messageID).Scan(
+		&result.MessageID, &result.Action, &result.Status, &payload, &result.Error, &result.ProcessedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrMessageResultNotFound, messageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message result: %w", err)
+	}
+
+	result.Result = payload
+
+	return &result, nil
+}
+
+// DeleteMessageResultsBefore purges the results stored before the given time and returns how many were deleted.
+func (r *messageResultRepository) DeleteMessageResultsBefore(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM message_results WHERE processed_at < $1`
+
+	result, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete message results: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
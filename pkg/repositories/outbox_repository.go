@@ -0,0 +1,163 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do/v2"
+)
+
+// OutboxMessage represents a message waiting in the outbox to be published
+// This struct lets a message be written in the same transaction as the business writes it
+// announces, so that neither is lost when the process crashes between the two.
+type OutboxMessage struct {
+	ID        int64  `json:"id"`
+	MessageID string `json:"message_id"`
+	// Type is published as the AMQP type property, the action of the message
+	Type        string     `json:"type"`
+	Body        []byte     `json:"body"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+}
+
+// OutboxRepository defines the interface for outbox data access operations.
+type OutboxRepository interface {
+	// Begin starts the transaction shared by business writes and EnqueueOutboxMessage.
+	Begin(ctx context.Context) (pgx.Tx, error)
+	EnqueueOutboxMessage(ctx context.Context, tx pgx.Tx, message *OutboxMessage) error
+	RelayOutboxMessages(ctx context.Context, limit int, publish func(*OutboxMessage) error) (int, error)
+	DeleteOutboxMessagesBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// outboxRepository implements the OutboxRepository interface.
+type outboxRepository struct {
+	db           *boundedPool
+	queryTimeout time.Duration
+}
+
+// NewOutboxRepository creates a new OutboxRepository instance
+// The outbox uses the main database pool, so that Begin opens transactions spanning business writes too.
+func NewOutboxRepository(injector do.Injector) (OutboxRepository, error) {
+	db := do.MustInvoke[*Database](injector)
+	appConfig := do.MustInvoke[*config.Config](injector)
+
+	return &outboxRepository{
+		db:           newBoundedPool(db.Pool(), appConfig.Database.AcquireTimeout),
+		queryTimeout: appConfig.Database.QueryTimeout,
+	}, nil
+}
+
+// Begin starts a transaction. Callers must commit or roll it back.
+func (r *outboxRepository) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	return tx, nil
+}
+
+// EnqueueOutboxMessage writes a message to the outbox within the caller's transaction
+// The message is only visible to the relay, and thus published, once the transaction commits.
+func (r *outboxRepository) EnqueueOutboxMessage(ctx context.Context, tx pgx.Tx, message *OutboxMessage) error {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO outbox (message_id, type, body, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+
+	err := tx.QueryRow(ctx, query, message.MessageID, message.Type, message.Body, message.CreatedAt).Scan(&message.ID)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// RelayOutboxMessages publishes up to limit unpublished messages, oldest first, and marks them published
+// Messages are locked with SKIP LOCKED, so that concurrent relays never publish the same message.
+// Publishing stops at the first failure to keep messages in order; the messages published until then
+// are still marked. A crash between publishing and marking publishes them again: delivery is at least
+// once, and consumers must deduplicate by message ID. It returns the number of published messages.
+func (r *outboxRepository) RelayOutboxMessages(ctx context.Context, limit int, publish func(*OutboxMessage) error) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	tx, err := r.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Rolling back a committed transaction is a no-op
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	query := `
+		SELECT id, message_id, type, body, created_at
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := tx.Query(ctx, query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch outbox messages: %w", err)
+	}
+	messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*OutboxMessage, error) {
+		var message OutboxMessage
+		err := row.Scan(&message.ID, &message.MessageID, &message.Type, &message.Body, &message.CreatedAt)
+		return &message, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan outbox messages: %w", err)
+	}
+
+	var (
+		published  []int64
+		publishErr error
+	)
+	for _, message := range messages {
+		if err := publish(message); err != nil {
+			publishErr = fmt.Errorf("failed to publish outbox message %s: %w", message.MessageID, err)
+			break
+		}
+		published = append(published, message.ID)
+	}
+
+	if len(published) > 0 {
+		if _, err := tx.Exec(ctx, `UPDATE outbox SET published_at = $2 WHERE id = ANY($1)`, published, time.Now()); err != nil {
+			return 0, fmt.Errorf("failed to mark outbox messages published: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return 0, fmt.Errorf("failed to commit outbox messages: %w", err)
+		}
+	}
+
+	return len(published), publishErr
+}
+
+// DeleteOutboxMessagesBefore purges the messages published before the given time and returns how many were deleted
+// Unpublished messages are never deleted, however old.
+func (r *outboxRepository) DeleteOutboxMessagesBefore(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM outbox WHERE published_at < $1`
+
+	result, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete outbox messages: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
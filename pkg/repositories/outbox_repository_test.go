@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestOutboxRepositoryRelaysCommittedMessages(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pool := newTestPool(t)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "TRUNCATE outbox")
+	})
+
+	repo := &outboxRepository{db: newBoundedPool(pool, 0)}
+
+	enqueue := func(id string, commit bool) {
+		t.Helper()
+
+		tx, err := repo.Begin(ctx)
+		if err != nil {
+			t.Fatalf("failed to begin transaction: %v", err)
+		}
+		if err := repo.EnqueueOutboxMessage(ctx, tx, &OutboxMessage{MessageID: id, Body: []byte(`{}`)}); err != nil {
+			t.Fatalf("failed to enqueue %s: %v", id, err)
+		}
+		if commit {
+			err = tx.Commit(ctx)
+		} else {
+			err = tx.Rollback(ctx)
+		}
+		if err != nil {
+			t.Fatalf("failed to end transaction: %v", err)
+		}
+	}
+	enqueue("msg_1", true)
+	enqueue("msg_rolled_back", false)
+	enqueue("msg_2", true)
+
+	// A failure stops the batch, leaving the failed message in the outbox
+	var published []string
+	failure := errors.New("broker down")
+	count, err := repo.RelayOutboxMessages(ctx, 10, func(message *OutboxMessage) error {
+		if message.MessageID == "msg_2" {
+			return failure
+		}
+		published = append(published, message.MessageID)
+		return nil
+	})
+	if !errors.Is(err, failure) || count != 1 {
+		t.Fatalf("expected 1 published message and the publish error, got %d and %v", count, err)
+	}
+
+	count, err = repo.RelayOutboxMessages(ctx, 10, func(message *OutboxMessage) error {
+		published = append(published, message.MessageID)
+		return nil
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("expected the failed message to be relayed again, got %d and %v", count, err)
+	}
+
+	if len(published) != 2 || published[0] != "msg_1" || published[1] != "msg_2" {
+		t.Fatalf("expected committed messages only, in order, got %v", published)
+	}
+}
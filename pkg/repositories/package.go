@@ -4,6 +4,11 @@ import "github.com/samber/do/v2"
 
 var Package = do.Package(
 	do.Lazy(NewDatabase),
+	do.Lazy(NewShardedDatabase),
+	do.Lazy(NewPasswordHasher),
 	do.Lazy(NewUserRepository),
-	do.Bind[*userRepository, UserRepository](),
+	do.Lazy(NewFailedMessageRepository),
+	do.Lazy(NewMessageResultRepository),
+	do.Lazy(NewOutboxRepository),
+	do.Lazy(NewProcessedMessageRepository),
 )
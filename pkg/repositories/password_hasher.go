@@ -0,0 +1,155 @@
+package repositories
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do/v2"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordHashingDisabled is returned when passwords are used while user.password_hashing is "none".
+var ErrPasswordHashingDisabled = errors.New("password hashing is disabled")
+
+// Argon2id parameters, following the OWASP recommendations.
+const (
+	argon2idDefaultTime = 2
+	argon2idMemory      = 19 * 1024
+	argon2idThreads     = 1
+	argon2idKeyLength   = 32
+	argon2idSaltLength  = 16
+)
+
+// PasswordHasher hashes and verifies passwords
+// This interface demonstrates how to swap algorithms through configuration while the
+// repository only depends on the contract.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (bool, error)
+}
+
+// NewPasswordHasher creates the PasswordHasher selected by user.password_hashing
+// Password storage is opt-in: without a configured algorithm every call returns ErrPasswordHashingDisabled.
+func NewPasswordHasher(injector do.Injector) (PasswordHasher, error) {
+	appConfig := do.MustInvoke[*config.Config](injector)
+	cost := appConfig.User.PasswordCost
+
+	switch appConfig.User.PasswordHashing {
+	case "", config.PasswordHashingNone:
+		return disabledPasswordHasher{}, nil
+	case config.PasswordHashingBcrypt:
+		if cost == 0 {
+			cost = bcrypt.DefaultCost
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("invalid bcrypt cost %d: must be between %d and %d", cost, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return bcryptPasswordHasher{cost: cost}, nil
+	case config.PasswordHashingArgon2id:
+		if cost == 0 {
+			cost = argon2idDefaultTime
+		}
+		if cost < 0 {
+			return nil, fmt.Errorf("invalid argon2id passes %d: must be positive", cost)
+		}
+		return argon2idPasswordHasher{time: uint32(cost)}, nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", appConfig.User.PasswordHashing)
+	}
+}
+
+// disabledPasswordHasher rejects every password.
+type disabledPasswordHasher struct{}
+
+func (disabledPasswordHasher) Hash(string) (string, error) {
+	return "", ErrPasswordHashingDisabled
+}
+
+func (disabledPasswordHasher) Verify(string, string) (bool, error) {
+	return false, ErrPasswordHashingDisabled
+}
+
+// bcryptPasswordHasher hashes passwords with bcrypt.
+type bcryptPasswordHasher struct {
+	cost int
+}
+
+func (h bcryptPasswordHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return string(hash), nil
+}
+
+func (h bcryptPasswordHasher) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to verify password: %w", err)
+	}
+
+	return true, nil
+}
+
+// argon2idPasswordHasher hashes passwords with argon2id
+// Hashes use the PHC string format, so parameters can change without invalidating stored hashes.
+type argon2idPasswordHasher struct {
+	time uint32
+}
+
+func (h argon2idPasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.time, argon2idMemory, argon2idThreads, argon2idKeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2idMemory, h.time, argon2idThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h argon2idPasswordHasher) Verify(password, hash string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errors.New("failed to verify password: invalid argon2id hash")
+	}
+
+	var (
+		version      int
+		memory, time uint32
+		threads      uint8
+	)
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errors.New("failed to verify password: unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, fmt.Errorf("failed to verify password: invalid argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("failed to verify password: invalid salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("failed to verify password: invalid key: %w", err)
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
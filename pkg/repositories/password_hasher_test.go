@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	t.Parallel()
+
+	hashers := map[string]PasswordHasher{
+		"bcrypt":   bcryptPasswordHasher{cost: 4},
+		"argon2id": argon2idPasswordHasher{time: 1},
+	}
+
+	for name, hasher := range hashers {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			hash, err := hasher.Hash("s3cret")
+			if err != nil {
+				t.Fatalf("failed to hash password: %v", err)
+			}
+			if hash == "s3cret" {
+				t.Fatal("expected password to be hashed")
+			}
+
+			if ok, err := hasher.Verify("s3cret", hash); err != nil || !ok {
+				t.Fatalf("expected password to match, got %v, %v", ok, err)
+			}
+			if ok, err := hasher.Verify("wrong", hash); err != nil || ok {
+				t.Fatalf("expected password mismatch, got %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestDisabledPasswordHasher(t *testing.T) {
+	t.Parallel()
+
+	if _, err := (disabledPasswordHasher{}).Hash("s3cret"); !errors.Is(err, ErrPasswordHashingDisabled) {
+		t.Fatalf("expected ErrPasswordHashingDisabled, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrPoolExhausted is returned when no connection could be acquired within database.acquire_timeout.
+var ErrPoolExhausted = errors.New("connection pool exhausted")
+
+// querier runs queries on a boundedPool or within a transaction
+// Begin starts a transaction on a boundedPool, and a savepoint within a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// boundedPool runs queries on a pgx pool, bounding the wait for a free connection
+// pgxpool waits for a connection as long as the query context allows, so a saturated pool
+// looks like slow queries. Bounding the acquisition separately makes saturation fail fast
+// with ErrPoolExhausted, while queries keep the whole query timeout once they have a connection.
+type boundedPool struct {
+	pool           *pgxpool.Pool
+	acquireTimeout time.Duration
+}
+
+// newBoundedPool wraps a pool. A zero acquire timeout waits for a connection as long as the context allows.
+func newBoundedPool(pool *pgxpool.Pool, acquireTimeout time.Duration) *boundedPool {
+	return &boundedPool{pool: pool, acquireTimeout: acquireTimeout}
+}
+
+// acquire gets a connection from the pool within the acquire timeout.
+func (p *boundedPool) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	if p.acquireTimeout <= 0 {
+		return p.pool.Acquire(ctx)
+	}
+
+	acquireCtx, cancel := context.WithTimeout(ctx, p.acquireTimeout)
+	defer cancel()
+
+	conn, err := p.pool.Acquire(acquireCtx)
+	if err != nil {
+		return nil, p.acquireError(ctx, acquireCtx, err)
+	}
+
+	return conn, nil
+}
+
+// acquireError reports an acquisition cut short by the acquire timeout as ErrPoolExhausted
+// Errors caused by the caller's own context or by the database are returned as is.
+func (p *boundedPool) acquireError(ctx, acquireCtx context.Context, err error) error {
+	if ctx.Err() != nil || !errors.Is(acquireCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	stat := p.pool.Stat()
+	return fmt.Errorf("%w: no connection available within %s (%d/%d connections in use)",
+		ErrPoolExhausted, p.acquireTimeout, stat.AcquiredConns(), stat.MaxConns())
+}
+
+// Exec acquires a connection and executes a statement on it.
+func (p *boundedPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer conn.Release()
+
+	return conn.Exec(ctx, sql, args...)
+}
+
+// Query acquires a connection and runs a query on it. The connection is released when the rows are closed.
+func (p *boundedPool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+
+	return &releasingRows{Rows: rows, conn: conn}, nil
+}
+
+// QueryRow acquires a connection and runs a single row query on it. The connection is released by Scan.
+func (p *boundedPool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+
+	return &releasingRow{row: conn.QueryRow(ctx, sql, args...), conn: conn}
+}
+
+// Begin acquires a connection and starts a transaction on it. The connection is released once the transaction ends.
+func (p *boundedPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+
+	return &releasingTx{Tx: tx, conn: conn}, nil
+}
+
+// releasingTx releases its connection once committed or rolled back.
+type releasingTx struct {
+	pgx.Tx
+	conn *pgxpool.Conn
+	once sync.Once
+}
+
+// Commit commits the transaction and releases the connection.
+func (t *releasingTx) Commit(ctx context.Context) error {
+	defer t.once.Do(t.conn.Release)
+	return t.Tx.Commit(ctx)
+}
+
+// Rollback rolls the transaction back and releases the connection.
+func (t *releasingTx) Rollback(ctx context.Context) error {
+	defer t.once.Do(t.conn.Release)
+	return t.Tx.Rollback(ctx)
+}
+
+// releasingRows releases its connection once closed.
+type releasingRows struct {
+	pgx.Rows
+	conn *pgxpool.Conn
+	once sync.Once
+}
+
+// Close closes the rows and releases the connection.
+func (r *releasingRows) Close() {
+	r.Rows.Close()
+	r.once.Do(r.conn.Release)
+}
+
+// releasingRow releases its connection once scanned.
+type releasingRow struct {
+	row  pgx.Row
+	conn *pgxpool.Conn
+}
+
+// Scan scans the row and releases the connection.
+func (r *releasingRow) Scan(dest ...any) error {
+	defer r.conn.Release()
+	return r.row.Scan(dest...)
+}
+
+// errRow is a row failing with the error that prevented running its query.
+type errRow struct {
+	err error
+}
+
+// Scan returns the row error.
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
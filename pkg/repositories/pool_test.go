@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestBoundedPoolFailsFastWhenExhausted(t *testing.T) {
+	t.Parallel()
+
+	pool := newTestPool(t)
+
+	config := pool.Config()
+	config.MaxConns = 1
+	exhausted, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	t.Cleanup(exhausted.Close)
+
+	// Hold the only connection of the pool
+	conn, err := exhausted.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	db := newBoundedPool(exhausted, 100*time.Millisecond)
+
+	start := time.Now()
+	var one int
+	err = db.QueryRow(context.Background(), "SELECT 1").Scan(&one)
+
+	if !errors.Is(err, ErrPoolExhausted) {
+		t.Fatalf("expected ErrPoolExhausted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the acquisition to fail fast, took %s", elapsed)
+	}
+}
+
+func TestBoundedPoolAcquireError(t *testing.T) {
+	t.Parallel()
+
+	// Pools connect lazily: no database is needed to inspect their stats
+	pool, err := pgxpool.New(context.Background(), "host=127.0.0.1 port=1 pool_max_conns=2")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	db := newBoundedPool(pool, time.Second)
+	cause := errors.New("acquire failed")
+
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if err := db.acquireError(context.Background(), expired, cause); !errors.Is(err, ErrPoolExhausted) {
+		t.Fatalf("expected the acquire timeout to report ErrPoolExhausted, got %v", err)
+	}
+
+	// The caller's own deadline is not a pool saturation
+	if err := db.acquireError(expired, expired, cause); !errors.Is(err, cause) || errors.Is(err, ErrPoolExhausted) {
+		t.Fatalf("expected the original error when the caller's context is done, got %v", err)
+	}
+
+	// Neither is a database error
+	if err := db.acquireError(context.Background(), context.Background(), cause); !errors.Is(err, cause) {
+		t.Fatalf("expected the original error, got %v", err)
+	}
+}
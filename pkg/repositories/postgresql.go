@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
 	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/metrics"
 	"github.com/samber/do/v2"
 )
 
@@ -14,6 +16,8 @@ import (
 // This service demonstrates how to create and manage database connections using dependency injection.
 type Database struct {
 	pool *pgxpool.Pool
+	// unregisterMetrics stops exporting the pool gauges
+	unregisterMetrics func()
 }
 
 // NewDatabase creates a new PostgreSQL database connection pool
@@ -21,8 +25,24 @@ type Database struct {
 func NewDatabase(injector do.Injector) (*Database, error) {
 	// Get configuration from the injector
 	appConfig := do.MustInvoke[*config.Config](injector)
-	cfg := appConfig.Database
 
+	pool, err := newPool(appConfig.Database, do.MustInvoke[*zerolog.Logger](injector))
+	if err != nil {
+		return nil, err
+	}
+
+	unregister, err := do.MustInvoke[*metrics.Metrics](injector).RegisterDatabasePool("default", pool.Stat)
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to register database pool metrics: %w", err)
+	}
+
+	return &Database{pool: pool, unregisterMetrics: unregister}, nil
+}
+
+// newPool creates and pings a PostgreSQL connection pool
+// The ping is retried up to database.connect_max_retries times within database.connect_timeout.
+func newPool(cfg config.DatabaseConfig, logger *zerolog.Logger) (*pgxpool.Pool, error) {
 	// Build connection string
 	connString := fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s pool_max_conns=%d pool_min_conns=%d pool_max_conn_lifetime=%s",
@@ -37,6 +57,17 @@ func NewDatabase(injector do.Injector) (*Database, error) {
 		time.Duration(cfg.ConnMaxLifetime)*time.Second,
 	)
 
+	// Certificate files, for the verify-ca and verify-full ssl modes and mutual TLS
+	for _, param := range []struct{ key, file string }{
+		{"sslrootcert", cfg.SSLRootCert},
+		{"sslcert", cfg.SSLCert},
+		{"sslkey", cfg.SSLKey},
+	} {
+		if param.file != "" {
+			connString += fmt.Sprintf(" %s=%s", param.key, param.file)
+		}
+	}
+
 	// Create connection pool config
 	poolConfig, err := pgxpool.ParseConfig(connString)
 	if err != nil {
@@ -56,13 +87,19 @@ func NewDatabase(injector do.Injector) (*Database, error) {
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
 	}
 
-	// Test the connection
-	if err := pool.Ping(context.Background()); err != nil {
+	// Test the connection, waiting for a database still starting up
+	ctx := context.Background()
+	if cfg.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ConnectTimeout)
+		defer cancel()
+	}
+	if err := connectWithRetry(ctx, newConnectPolicy(cfg.ConnectMaxRetries), pool.Ping, logger); err != nil {
 		pool.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &Database{pool: pool}, nil
+	return pool, nil
 }
 
 // Pool returns the underlying pgxpool.Pool
@@ -71,6 +108,37 @@ func (db *Database) Pool() *pgxpool.Pool {
 	return db.pool
 }
 
+// Stats returns a snapshot of the connection pool statistics: acquired, idle and total connections,
+// acquire counts and durations.
+func (db *Database) Stats() *pgxpool.Stat {
+	return db.pool.Stat()
+}
+
+// PoolUtilization is a snapshot of the connection pool usage.
+type PoolUtilization struct {
+	Acquired int32   `json:"acquired"`
+	Max      int32   `json:"max"`
+	Ratio    float64 `json:"ratio"`
+}
+
+// PoolUtilization returns how many of the pool's connections are in use
+// A pool running close to its maximum is about to make callers wait for connections.
+func (db *Database) PoolUtilization() PoolUtilization {
+	stat := db.Stats()
+
+	utilization := PoolUtilization{Acquired: stat.AcquiredConns(), Max: stat.MaxConns()}
+	if utilization.Max > 0 {
+		utilization.Ratio = float64(utilization.Acquired) / float64(utilization.Max)
+	}
+
+	return utilization
+}
+
+// Saturated reports whether every connection of the pool is in use, callers then waiting for one to be released.
+func (u PoolUtilization) Saturated() bool {
+	return u.Max > 0 && u.Acquired >= u.Max
+}
+
 // Health checks the database connection
 // This method demonstrates how to implement health checks for services.
 func (db *Database) HealthCheckWithContext(ctx context.Context) error {
@@ -80,7 +148,17 @@ func (db *Database) HealthCheckWithContext(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheck implements do.HealthcheckerWithContext, so that the injector's health checks ping the database.
+func (db *Database) HealthCheck(ctx context.Context) error {
+	return db.HealthCheckWithContext(ctx)
+}
+
+var _ do.HealthcheckerWithContext = (*Database)(nil)
+
 func (db *Database) Shutdown() error {
+	if db.unregisterMetrics != nil {
+		db.unregisterMetrics()
+	}
 	if db.pool != nil {
 		db.pool.Close()
 	}
@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do/v2"
+)
+
+// ErrMessageAlreadyProcessed is returned by ProcessOnce when the message has been processed already.
+var ErrMessageAlreadyProcessed = errors.New("message already processed")
+
+// ProcessedMessageRepository defines the interface for processed message data access operations
+// This interface lets a consumer commit the database writes of a message together with the record
+// that it was processed, so that a redelivery of the message is detected instead of processed twice.
+type ProcessedMessageRepository interface {
+	ProcessOnce(ctx context.Context, messageID, action string, fn func(ctx context.Context, users UserRepository) error) error
+	DeleteProcessedMessagesBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// processedMessageRepository implements the ProcessedMessageRepository interface.
+type processedMessageRepository struct {
+	db           *boundedPool
+	hasher       PasswordHasher
+	queryTimeout time.Duration
+}
+
+// NewProcessedMessageRepository creates a new ProcessedMessageRepository instance
+// Transactions only span a single database, so database shards are not supported.
+func NewProcessedMessageRepository(injector do.Injector) (ProcessedMessageRepository, error) {
+	db := do.MustInvoke[*Database](injector)
+	appConfig := do.MustInvoke[*config.Config](injector)
+
+	return &processedMessageRepository{
+		db:           newBoundedPool(db.Pool(), appConfig.Database.AcquireTimeout),
+		hasher:       do.MustInvoke[PasswordHasher](injector),
+		queryTimeout: appConfig.Database.QueryTimeout,
+	}, nil
+}
+
+// ProcessOnce runs fn in a transaction recording the message as processed, and commits it
+// fn must write through the given UserRepository, which is scoped to the transaction: its writes
+// and the record are committed together, or not at all when fn fails. A message recorded already
+// is not processed again and ErrMessageAlreadyProcessed is returned. Concurrent deliveries of the
+// same message wait for each other on the record, so that only one of them commits.
+func (r *processedMessageRepository) ProcessOnce(ctx context.Context, messageID, action string, fn func(ctx context.Context, users UserRepository) error) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// Rolling back a committed transaction is a no-op
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	query := `
+		INSERT INTO processed_messages (message_id, action, processed_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id) DO NOTHING
+	`
+
+	queryCtx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	result, err := tx.Exec(queryCtx, query, messageID, action, time.Now())
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to record processed message: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrMessageAlreadyProcessed
+	}
+
+	if err := fn(ctx, &userRepository{db: tx, hasher: r.hasher, queryTimeout: r.queryTimeout}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit processed message: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteProcessedMessagesBefore purges the records of messages processed before the given time and returns how many were deleted
+// A message redelivered after its record is deleted is processed again.
+func (r *processedMessageRepository) DeleteProcessedMessagesBefore(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM processed_messages WHERE processed_at < $1`
+
+	result, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete processed messages: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestProcessedMessageRepositoryProcessesOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pool := newTestPool(t)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DELETE FROM processed_messages WHERE message_id LIKE 'processed_once_%'")
+		_, _ = pool.Exec(ctx, "DELETE FROM users WHERE email LIKE 'processed.once.%'")
+	})
+
+	repo := &processedMessageRepository{db: newBoundedPool(pool, 0)}
+	users := &userRepository{db: newBoundedPool(pool, 0)}
+
+	create := func(id, email string, fail error) error {
+		return repo.ProcessOnce(ctx, id, "create_user", func(ctx context.Context, users UserRepository) error {
+			if _, err := users.CreateUser(ctx, &User{Name: "Processed Once", Email: email}); err != nil {
+				return err
+			}
+			return fail
+		})
+	}
+
+	// A failing handler rolls back both its writes and the record, so that the message can be retried
+	failure := errors.New("handler failed")
+	if err := create("processed_once_1", "processed.once.rolled-back@example.com", failure); !errors.Is(err, failure) {
+		t.Fatalf("expected the handler error, got %v", err)
+	}
+	if _, err := users.GetUserByEmail(ctx, "processed.once.rolled-back@example.com"); err == nil {
+		t.Fatal("expected the user of the failed attempt to be rolled back")
+	}
+
+	if err := create("processed_once_1", "processed.once@example.com", nil); err != nil {
+		t.Fatalf("expected the retried message to be processed, got %v", err)
+	}
+	if _, err := users.GetUserByEmail(ctx, "processed.once@example.com"); err != nil {
+		t.Fatalf("expected the user to be committed, got %v", err)
+	}
+
+	// A redelivery, e.g. after the ack was lost, is detected before any write
+	called := false
+	err := repo.ProcessOnce(ctx, "processed_once_1", "create_user", func(ctx context.Context, users UserRepository) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrMessageAlreadyProcessed) || called {
+		t.Fatalf("expected the redelivered message to be skipped, got %v (handler called: %t)", err, called)
+	}
+}
@@ -0,0 +1,133 @@
+// Package repositoriestest provides helpers to set up the database state of repository tests.
+package repositoriestest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.yaml.in/yaml/v3"
+)
+
+// Fixtures maps a table name to the rows to insert into it, each row mapping a column to its value.
+type Fixtures map[string][]map[string]any
+
+// LoadFixtures loads seed data from a YAML or JSON file into the database
+// Tables are loaded in alphabetical order, within a single transaction.
+//
+// Example fixture file:
+//
+//	users:
+//	  - name: Alice
+//	    email: alice@example.com
+func LoadFixtures(ctx context.Context, pool *pgxpool.Pool, path string) error {
+	fixtures, err := readFixtures(path)
+	if err != nil {
+		return err
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin fixtures transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tables := make([]string, 0, len(fixtures))
+	for table := range fixtures {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		for _, row := range fixtures[table] {
+			if err := insertRow(ctx, tx, table, row); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit fixtures: %w", err)
+	}
+
+	return nil
+}
+
+// Truncate empties the given tables and resets their identity sequences.
+func Truncate(ctx context.Context, pool *pgxpool.Pool, tables ...string) error {
+	if len(tables) == 0 {
+		return nil
+	}
+
+	identifiers := make([]string, 0, len(tables))
+	for _, table := range tables {
+		identifiers = append(identifiers, pgx.Identifier{table}.Sanitize())
+	}
+
+	query := fmt.Sprintf("TRUNCATE TABLE %s RESTART IDENTITY CASCADE", strings.Join(identifiers, ", "))
+	if _, err := pool.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to truncate tables: %w", err)
+	}
+
+	return nil
+}
+
+// readFixtures decodes a fixture file, picking the format from its extension.
+func readFixtures(path string) (Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	var fixtures Fixtures
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &fixtures)
+	case ".json":
+		err = json.Unmarshal(data, &fixtures)
+	default:
+		return nil, fmt.Errorf("unsupported fixtures format %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode fixtures: %w", err)
+	}
+
+	return fixtures, nil
+}
+
+// insertRow inserts a single fixture row, with columns in alphabetical order.
+func insertRow(ctx context.Context, tx pgx.Tx, table string, row map[string]any) error {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	identifiers := make([]string, 0, len(columns))
+	placeholders := make([]string, 0, len(columns))
+	args := make([]any, 0, len(columns))
+	for i, column := range columns {
+		identifiers = append(identifiers, pgx.Identifier{column}.Sanitize())
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+		args = append(args, row[column])
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		pgx.Identifier{table}.Sanitize(),
+		strings.Join(identifiers, ", "),
+		strings.Join(placeholders, ", "),
+	)
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to insert fixture into %s: %w", table, err)
+	}
+
+	return nil
+}
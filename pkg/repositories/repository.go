@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Table maps a model to a database table, for Repository.
+type Table[T any] struct {
+	// Name is the name of the table, also used in error messages, e.g. users
+	Name string
+	// Model is the name of a single row in error messages, e.g. user
+	Model string
+	// Columns is the comma-separated list of the columns read into a model, in the order of Fields
+	Columns string
+	// Fields returns the destinations of Columns in a model
+	Fields func(model *T) []any
+	// Scope restricts every read to the rows matching it, e.g. deleted_at IS NULL. Empty reads every row.
+	Scope string
+	// ErrNotFound is returned, wrapped, when no row matches. Empty returns pgx.ErrNoRows.
+	ErrNotFound error
+}
+
+// Repository implements the reads shared by the repositories of a model
+// Repositories embed the queries specific to their model, and delegate to it getting, listing and
+// counting rows, so that they don't repeat the QueryRow, Scan and rows.Err patterns. Its queries are
+// bounded by the query timeout, like those of the repository using it.
+type Repository[T any] struct {
+	db           querier
+	table        Table[T]
+	queryTimeout time.Duration
+}
+
+// newRepository creates a Repository running its queries on db, a pool or a transaction.
+func newRepository[T any](db querier, table Table[T], queryTimeout time.Duration) *Repository[T] {
+	return &Repository[T]{db: db, table: table, queryTimeout: queryTimeout}
+}
+
+// Select returns a query selecting the columns of the rows in scope matching the given condition
+// The condition is written into the query as is, so its values must be passed as arguments. An empty
+// condition selects every row in scope.
+func (r *Repository[T]) Select(where string) string {
+	query := `SELECT ` + r.table.Columns + ` FROM ` + r.table.Name
+
+	switch {
+	case where != "" && r.table.Scope != "":
+		query += ` WHERE ` + where + ` AND ` + r.table.Scope
+	case where != "":
+		query += ` WHERE ` + where
+	case r.table.Scope != "":
+		query += ` WHERE ` + r.table.Scope
+	}
+
+	return query
+}
+
+// Get returns the row in scope whose column equals value, or an ErrNotFound naming them.
+func (r *Repository[T]) Get(ctx context.Context, column string, value any) (*T, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	var model T
+	err := r.db.QueryRow(ctx, r.Select(column+` = $1`), value).Scan(r.table.Fields(&model)...)
+	if errors.Is(err, pgx.ErrNoRows) && r.table.ErrNotFound != nil {
+		return nil, fmt.Errorf("%w: %s %v", r.table.ErrNotFound, column, value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s by %s: %w", r.table.Model, column, err)
+	}
+
+	return &model, nil
+}
+
+// List runs a query selecting the Columns of the table, such as one built with Select, and returns its rows.
+func (r *Repository[T]) List(ctx context.Context, query string, args ...any) ([]*T, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", r.table.Name, err)
+	}
+
+	return collectRows(rows, r.table)
+}
+
+// Count returns the number of rows in scope.
+func (r *Repository[T]) Count(ctx context.Context) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `SELECT COUNT(*) FROM ` + r.table.Name
+	if r.table.Scope != "" {
+		query += ` WHERE ` + r.table.Scope
+	}
+
+	var count int64
+	if err := r.db.QueryRow(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", r.table.Name, err)
+	}
+
+	return count, nil
+}
+
+// collectRows scans every row into a model of the table, then closes the rows.
+func collectRows[T any](rows pgx.Rows, table Table[T]) ([]*T, error) {
+	defer rows.Close()
+
+	var models []*T
+	for rows.Next() {
+		var model T
+		if err := rows.Scan(table.Fields(&model)...); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", table.Model, err)
+		}
+		models = append(models, &model)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate %s: %w", table.Name, err)
+	}
+
+	return models, nil
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// rowQuerier answers every QueryRow with the same row, recording the query.
+type rowQuerier struct {
+	querier
+	row   pgx.Row
+	query string
+	args  []any
+}
+
+func (q *rowQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	q.query, q.args = sql, args
+	return q.row
+}
+
+// scanRow scans fixed values, one per destination.
+type scanRow []any
+
+func (r scanRow) Scan(dest ...any) error {
+	for i, d := range dest {
+		switch d := d.(type) {
+		case *int64:
+			*d = r[i].(int64)
+		case *string:
+			*d = r[i].(string)
+		}
+	}
+	return nil
+}
+
+type testModel struct {
+	ID   int64
+	Name string
+}
+
+var testTable = Table[testModel]{
+	Name:        "models",
+	Model:       "model",
+	Columns:     "id, name",
+	Fields:      func(m *testModel) []any { return []any{&m.ID, &m.Name} },
+	Scope:       "deleted_at IS NULL",
+	ErrNotFound: errors.New("model not found"),
+}
+
+func TestRepositorySelect(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepository(nil, testTable, 0)
+	if got := repo.Select("name = $1"); got != "SELECT id, name FROM models WHERE name = $1 AND deleted_at IS NULL" {
+		t.Fatalf("unexpected query: %s", got)
+	}
+	if got := repo.Select(""); got != "SELECT id, name FROM models WHERE deleted_at IS NULL" {
+		t.Fatalf("unexpected query: %s", got)
+	}
+
+	unscoped := testTable
+	unscoped.Scope = ""
+	if got := newRepository(nil, unscoped, 0).Select(""); got != "SELECT id, name FROM models" {
+		t.Fatalf("unexpected query: %s", got)
+	}
+}
+
+func TestRepositoryGet(t *testing.T) {
+	t.Parallel()
+
+	db := &rowQuerier{row: scanRow{int64(7), "Alice"}}
+	repo := newRepository(db, testTable, 0)
+
+	model, err := repo.Get(context.Background(), "id", 7)
+	if err != nil || model.ID != 7 || model.Name != "Alice" {
+		t.Fatalf("expected the row to be scanned into the model, got %+v, %v", model, err)
+	}
+	if !strings.HasSuffix(db.query, "WHERE id = $1 AND deleted_at IS NULL") || db.args[0] != 7 {
+		t.Fatalf("unexpected query %q with %v", db.query, db.args)
+	}
+
+	db.row = errRow{pgx.ErrNoRows}
+	if _, err := repo.Get(context.Background(), "id", 8); !errors.Is(err, testTable.ErrNotFound) || err.Error() != "model not found: id 8" {
+		t.Fatalf("expected a not found error naming the ID, got %v", err)
+	}
+
+	db.row = errRow{&pgconn.PgError{Code: "57014"}}
+	if _, err := repo.Get(context.Background(), "id", 9); err == nil || !strings.HasPrefix(err.Error(), "failed to get model by id") {
+		t.Fatalf("expected the query error, got %v", err)
+	}
+}
+
+func TestRepositoryCount(t *testing.T) {
+	t.Parallel()
+
+	db := &rowQuerier{row: scanRow{int64(3)}}
+	count, err := newRepository(db, testTable, 0).Count(context.Background())
+	if err != nil || count != 3 {
+		t.Fatalf("expected 3 rows, got %d, %v", count, err)
+	}
+	if db.query != "SELECT COUNT(*) FROM models WHERE deleted_at IS NULL" {
+		t.Fatalf("unexpected query: %s", db.query)
+	}
+}
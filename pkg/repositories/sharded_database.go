@@ -0,0 +1,233 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/metrics"
+	"github.com/samber/do/v2"
+)
+
+// ShardedDatabase holds one PostgreSQL connection pool per configured shard
+// This service demonstrates how the DI pattern scales from one backend to many: consumers
+// depend on the ShardedDatabase and ask it for the pool owning a given key.
+//
+// Keys are routed by modulo: key k lives on shard k % n. IDs start at 1, so ID k lives on shard
+// (k-1) % n, which requires the users_id_seq sequence of shard i (0-based) to be set up with
+// `ALTER SEQUENCE users_id_seq INCREMENT BY <n> RESTART WITH <i+1>`. This is checked at startup.
+type ShardedDatabase struct {
+	names []string
+	pools []*pgxpool.Pool
+	// unregisterMetrics stops exporting the gauges of every shard pool
+	unregisterMetrics []func()
+}
+
+// NewShardedDatabase creates a connection pool for every shard in database.shards.
+func NewShardedDatabase(injector do.Injector) (*ShardedDatabase, error) {
+	appConfig := do.MustInvoke[*config.Config](injector)
+
+	if len(appConfig.Database.Shards) == 0 {
+		return nil, errors.New("no database shards configured")
+	}
+
+	logger := do.MustInvoke[*zerolog.Logger](injector)
+	appMetrics := do.MustInvoke[*metrics.Metrics](injector)
+
+	db := &ShardedDatabase{}
+	for i, shard := range appConfig.Database.Shards {
+		name := shard.Name
+		if name == "" {
+			name = fmt.Sprintf("shard_%d", i)
+		}
+
+		shardLogger := logger.With().Str("shard", name).Logger()
+		pool, err := newPool(shardConfig(appConfig.Database, shard.DatabaseConfig), &shardLogger)
+		if err != nil {
+			_ = db.Shutdown()
+			return nil, fmt.Errorf("database shard %s: %w", name, err)
+		}
+
+		db.names = append(db.names, name)
+		db.pools = append(db.pools, pool)
+
+		unregister, err := appMetrics.RegisterDatabasePool(name, pool.Stat)
+		if err != nil {
+			_ = db.Shutdown()
+			return nil, fmt.Errorf("failed to register database shard %s pool metrics: %w", name, err)
+		}
+		db.unregisterMetrics = append(db.unregisterMetrics, unregister)
+
+		if err := checkIDSequence(pool, i, len(appConfig.Database.Shards), appConfig.Database.QueryTimeout, &shardLogger); err != nil {
+			_ = db.Shutdown()
+			return nil, fmt.Errorf("database shard %s: %w", name, err)
+		}
+	}
+
+	return db, nil
+}
+
+// checkIDSequence checks that the users_id_seq sequence of shard index only issues IDs routed back to it
+// A misaligned sequence would create users that can't be found by ID, so it fails with the statement
+// aligning it. A missing sequence, before the migrations are applied, is only reported.
+func checkIDSequence(pool *pgxpool.Pool, index, shards int, queryTimeout time.Duration, logger *zerolog.Logger) error {
+	ctx, cancel := withQueryTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var (
+		lastValue, increment int64
+		isCalled             bool
+	)
+	err := pool.QueryRow(ctx, `
+		SELECT last_value, is_called, (SELECT increment_by FROM pg_sequences WHERE sequencename = 'users_id_seq')
+		FROM users_id_seq`).Scan(&lastValue, &isCalled, &increment)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == undefinedTableCode {
+		logger.Warn().Msg("users_id_seq not found, skipping the shard ID sequence check")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check users_id_seq: %w", err)
+	}
+
+	next := lastValue
+	if isCalled {
+		next += increment
+	}
+	if !idSequenceAligned(next, increment, index, shards) {
+		return fmt.Errorf("users_id_seq issues IDs of other shards (next %d, increment %d): run "+
+			"`ALTER SEQUENCE users_id_seq INCREMENT BY %d RESTART WITH <id>` with an id above the existing ones and (id-1) %% %d = %d",
+			next, increment, shards, shards, index)
+	}
+
+	return nil
+}
+
+// idSequenceAligned reports whether a sequence issuing next, then every increment, only issues IDs of shard index.
+func idSequenceAligned(next, increment int64, index, shards int) bool {
+	return increment == int64(shards) && idShardIndex(next, shards) == index
+}
+
+// shardConfig fills the unset fields of a shard configuration from the top-level database configuration.
+func shardConfig(base, shard config.DatabaseConfig) config.DatabaseConfig {
+	cfg := base
+	cfg.Shards = nil
+
+	if shard.Host != "" {
+		cfg.Host = shard.Host
+	}
+	if shard.Port != 0 {
+		cfg.Port = shard.Port
+	}
+	if shard.User != "" {
+		cfg.User = shard.User
+	}
+	if shard.Password != "" {
+		cfg.Password = shard.Password
+	}
+	if shard.Database != "" {
+		cfg.Database = shard.Database
+	}
+	if shard.SSLMode != "" {
+		cfg.SSLMode = shard.SSLMode
+	}
+	if shard.SSLRootCert != "" {
+		cfg.SSLRootCert = shard.SSLRootCert
+	}
+	if shard.SSLCert != "" {
+		cfg.SSLCert = shard.SSLCert
+	}
+	if shard.SSLKey != "" {
+		cfg.SSLKey = shard.SSLKey
+	}
+	if shard.MaxOpenConns != 0 {
+		cfg.MaxOpenConns = shard.MaxOpenConns
+	}
+	if shard.MaxIdleConns != 0 {
+		cfg.MaxIdleConns = shard.MaxIdleConns
+	}
+	if shard.ConnMaxLifetime != 0 {
+		cfg.ConnMaxLifetime = shard.ConnMaxLifetime
+	}
+
+	return cfg
+}
+
+// Len returns the number of shards.
+func (db *ShardedDatabase) Len() int {
+	return len(db.pools)
+}
+
+// ShardIndex returns the index of the shard owning the given key.
+func (db *ShardedDatabase) ShardIndex(key int64) int {
+	return shardIndex(key, len(db.pools))
+}
+
+// IDShardIndex returns the index of the shard owning the given user ID.
+func (db *ShardedDatabase) IDShardIndex(id int64) int {
+	return idShardIndex(id, len(db.pools))
+}
+
+// PoolFor returns the pool of the shard owning the given key.
+func (db *ShardedDatabase) PoolFor(key int64) *pgxpool.Pool {
+	return db.pools[db.ShardIndex(key)]
+}
+
+// Pools returns every shard pool, in configuration order.
+func (db *ShardedDatabase) Pools() []*pgxpool.Pool {
+	return db.pools
+}
+
+// HealthCheckWithContext pings every shard.
+func (db *ShardedDatabase) HealthCheckWithContext(ctx context.Context) error {
+	var errs []error
+	for i, pool := range db.pools {
+		if err := pool.Ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("database shard %s health check failed: %w", db.names[i], err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// HealthCheck implements do.HealthcheckerWithContext, so that the injector's health checks ping every shard.
+func (db *ShardedDatabase) HealthCheck(ctx context.Context) error {
+	return db.HealthCheckWithContext(ctx)
+}
+
+var _ do.HealthcheckerWithContext = (*ShardedDatabase)(nil)
+
+// Shutdown closes every shard pool.
+func (db *ShardedDatabase) Shutdown() error {
+	for _, unregister := range db.unregisterMetrics {
+		unregister()
+	}
+	for _, pool := range db.pools {
+		pool.Close()
+	}
+	return nil
+}
+
+// shardIndex maps a key to a shard by modulo.
+func shardIndex(key int64, shards int) int {
+	return int(uint64(key) % uint64(shards))
+}
+
+// idShardIndex maps an ID to a shard by modulo, IDs starting at 1 on the first shard.
+func idShardIndex(id int64, shards int) int {
+	return shardIndex(id-1, shards)
+}
+
+// shardKey hashes a string into a routing key.
+func shardKey(s string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return int64(h.Sum64() >> 1)
+}
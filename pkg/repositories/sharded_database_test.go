@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/samber/do-template-worker/pkg/config"
+)
+
+func TestShardIndex(t *testing.T) {
+	t.Parallel()
+
+	for key, want := range map[int64]int{1: 1, 2: 2, 3: 0, 4: 1, 300: 0} {
+		if got := shardIndex(key, 3); got != want {
+			t.Fatalf("shardIndex(%d, 3) = %d, want %d", key, got, want)
+		}
+	}
+
+	email := shardKey("alice@example.com")
+	if email < 0 || email != shardKey("alice@example.com") {
+		t.Fatalf("expected a stable, non-negative key, got %d", email)
+	}
+}
+
+func TestIDShardIndexMatchesAlignedSequences(t *testing.T) {
+	t.Parallel()
+
+	// Shard i issues i+1, i+1+n, i+1+2n, ... once aligned as documented on ShardedDatabase
+	const shards = 3
+	for index := range shards {
+		for id := int64(index + 1); id < 20; id += shards {
+			if got := idShardIndex(id, shards); got != index {
+				t.Fatalf("ID %d issued by shard %d routes to shard %d", id, index, got)
+			}
+		}
+	}
+
+	tests := map[string]struct {
+		next, increment int64
+		index           int
+		expected        bool
+	}{
+		"aligned, unused":          {next: 2, increment: 3, index: 1, expected: true},
+		"aligned, used":            {next: 10, increment: 3, index: 0, expected: true},
+		"default sequence":         {next: 1, increment: 1, index: 0, expected: false},
+		"offset of another shard":  {next: 3, increment: 3, index: 1, expected: false},
+		"restarted with the index": {next: 1, increment: 3, index: 1, expected: false},
+	}
+	for name, tt := range tests {
+		if got := idSequenceAligned(tt.next, tt.increment, tt.index, shards); got != tt.expected {
+			t.Fatalf("%s: expected aligned=%t, got %t", name, tt.expected, got)
+		}
+	}
+}
+
+// sequenceUserRepository creates users with IDs from an aligned shard sequence, and finds them by ID.
+type sequenceUserRepository struct {
+	UserRepository
+	next, increment int64
+	users           map[int64]*User
+}
+
+func (r *sequenceUserRepository) CreateUser(ctx context.Context, user *User) (*User, error) {
+	user.ID = r.next
+	r.next += r.increment
+	r.users[user.ID] = user
+	return user, nil
+}
+
+func (r *sequenceUserRepository) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: id %d", ErrUserNotFound, id)
+	}
+	return user, nil
+}
+
+func TestShardedUserRepositoryFindsCreatedUsersByID(t *testing.T) {
+	t.Parallel()
+
+	const shards = 3
+	repo := &shardedUserRepository{db: &ShardedDatabase{pools: make([]*pgxpool.Pool, shards)}}
+	for index := range shards {
+		repo.shards = append(repo.shards, &sequenceUserRepository{next: int64(index + 1), increment: shards, users: map[int64]*User{}})
+	}
+
+	for i := range 30 {
+		email := fmt.Sprintf("user_%d@example.com", i)
+		user, err := repo.CreateUser(context.Background(), &User{Email: email})
+		if err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+
+		found, err := repo.GetUserByID(context.Background(), user.ID)
+		if err != nil || found.Email != email {
+			t.Fatalf("expected user %d to be found on the shard that created it, got %v (%v)", user.ID, found, err)
+		}
+	}
+}
+
+func TestShardConfigInheritsUnsetFields(t *testing.T) {
+	t.Parallel()
+
+	base := config.DatabaseConfig{Host: "primary", Port: 5432, User: "postgres", Database: "app", MaxOpenConns: 25}
+	cfg := shardConfig(base, config.DatabaseConfig{Host: "shard-1", MaxOpenConns: 10})
+
+	if cfg.Host != "shard-1" || cfg.MaxOpenConns != 10 {
+		t.Fatalf("expected shard fields to override base, got %+v", cfg)
+	}
+	if cfg.Port != 5432 || cfg.User != "postgres" || cfg.Database != "app" {
+		t.Fatalf("expected unset fields to be inherited, got %+v", cfg)
+	}
+}
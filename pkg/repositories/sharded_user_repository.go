@@ -0,0 +1,194 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// shardedUserRepository routes user operations to the shard owning the user
+// Users are created on the shard selected by their email, and each shard's ID sequence is
+// aligned so that the ID of a user maps back to the same shard (see ShardedDatabase).
+// Reads and writes by ID are routed by ID, reads by email by email, and listing fans out.
+type shardedUserRepository struct {
+	db     *ShardedDatabase
+	shards []UserRepository
+}
+
+// newShardedUserRepository creates a UserRepository backed by one userRepository per shard.
+func newShardedUserRepository(db *ShardedDatabase, hasher PasswordHasher, queryTimeout, acquireTimeout time.Duration) UserRepository {
+	shards := make([]UserRepository, 0, db.Len())
+	for _, pool := range db.Pools() {
+		shards = append(shards, &userRepository{db: newBoundedPool(pool, acquireTimeout), hasher: hasher, queryTimeout: queryTimeout})
+	}
+
+	return &shardedUserRepository{db: db, shards: shards}
+}
+
+// byID returns the repository of the shard owning the given user ID.
+func (r *shardedUserRepository) byID(id int64) UserRepository {
+	return r.shards[r.db.IDShardIndex(id)]
+}
+
+// byEmail returns the repository of the shard owning the given email.
+func (r *shardedUserRepository) byEmail(email string) UserRepository {
+	return r.shards[r.db.ShardIndex(shardKey(email))]
+}
+
+// CreateUser creates the user on the shard owning its email.
+func (r *shardedUserRepository) CreateUser(ctx context.Context, user *User) (*User, error) {
+	return r.byEmail(user.Email).CreateUser(ctx, user)
+}
+
+// CreateUsers creates the users on the shards owning their emails, in a batch per shard
+// Each batch is created all or none, but a failing shard doesn't roll back the batches of the others.
+func (r *shardedUserRepository) CreateUsers(ctx context.Context, users []*User) ([]*User, error) {
+	batches := make(map[int][]*User)
+	for _, user := range users {
+		index := r.db.ShardIndex(shardKey(user.Email))
+		batches[index] = append(batches[index], user)
+	}
+
+	for index, batch := range batches {
+		if _, err := r.shards[index].CreateUsers(ctx, batch); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+// GetUserByID retrieves a user from the shard owning its ID.
+func (r *shardedUserRepository) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	return r.byID(id).GetUserByID(ctx, id)
+}
+
+// GetUserByEmail retrieves a user from the shard owning its email.
+func (r *shardedUserRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	return r.byEmail(email).GetUserByEmail(ctx, email)
+}
+
+// UpdateUser updates a user on the shard owning its ID
+// Emails select the shard of new users, so an email can't change to one owned by another shard.
+func (r *shardedUserRepository) UpdateUser(ctx context.Context, user *User) (*User, error) {
+	shard, err := r.updateShard(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.UpdateUser(ctx, user)
+}
+
+// UpdateUserOptimistic updates a user on the shard owning its ID, unless it was updated since expectedUpdatedAt.
+func (r *shardedUserRepository) UpdateUserOptimistic(ctx context.Context, user *User, expectedUpdatedAt time.Time) (*User, error) {
+	shard, err := r.updateShard(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.UpdateUserOptimistic(ctx, user, expectedUpdatedAt)
+}
+
+// updateShard returns the shard owning the ID of a user, which must own its email too.
+func (r *shardedUserRepository) updateShard(user *User) (UserRepository, error) {
+	shard := r.byID(user.ID)
+	if shard != r.byEmail(user.Email) {
+		return nil, errors.New("failed to update user: email belongs to another shard")
+	}
+
+	return shard, nil
+}
+
+// DeleteUser soft-deletes a user on the shard owning its ID.
+func (r *shardedUserRepository) DeleteUser(ctx context.Context, id int64) error {
+	return r.byID(id).DeleteUser(ctx, id)
+}
+
+// RestoreUser restores a soft-deleted user on the shard owning its ID.
+func (r *shardedUserRepository) RestoreUser(ctx context.Context, id int64) error {
+	return r.byID(id).RestoreUser(ctx, id)
+}
+
+// HardDeleteUser permanently deletes a user from the shard owning its ID.
+func (r *shardedUserRepository) HardDeleteUser(ctx context.Context, id int64) error {
+	return r.byID(id).HardDeleteUser(ctx, id)
+}
+
+// ListUsers lists users across every shard, most recent first.
+func (r *shardedUserRepository) ListUsers(ctx context.Context, limit, offset int) ([]*User, error) {
+	return r.ListUsersWithOptions(ctx, ListUsersOptions{Limit: limit, Offset: offset})
+}
+
+// ListUsersWithOptions lists users across every shard, filtered, sorted and paginated by the options
+// Each shard returns its first limit+offset matching users, which are merged before paginating. Names
+// and emails are merged by byte order, which may differ from the collation sorting them on each shard.
+func (r *shardedUserRepository) ListUsersWithOptions(ctx context.Context, opts ListUsersOptions) ([]*User, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	shardOpts := opts
+	shardOpts.Offset = 0
+	if opts.Limit > 0 {
+		shardOpts.Limit = opts.Limit + opts.Offset
+	}
+
+	var users []*User
+	for _, shard := range r.shards {
+		shardUsers, err := shard.ListUsersWithOptions(ctx, shardOpts)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, shardUsers...)
+	}
+
+	slices.SortStableFunc(users, func(a, b *User) int {
+		return compareUsers(opts, a, b)
+	})
+
+	if opts.Offset >= len(users) {
+		return nil, nil
+	}
+	users = users[opts.Offset:]
+	if opts.Limit > 0 {
+		users = users[:min(opts.Limit, len(users))]
+	}
+
+	return users, nil
+}
+
+// ListUsersPage lists a page of users across every shard along with their total number, see listUsersPage.
+func (r *shardedUserRepository) ListUsersPage(ctx context.Context, limit, offset int) ([]*User, int64, error) {
+	return listUsersPage(ctx, r, limit, offset)
+}
+
+// CountUsers sums the number of users of every shard.
+func (r *shardedUserRepository) CountUsers(ctx context.Context) (int64, error) {
+	var total int64
+	for _, shard := range r.shards {
+		count, err := shard.CountUsers(ctx)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+
+	return total, nil
+}
+
+// SetPassword sets the password of a user on the shard owning its ID.
+func (r *shardedUserRepository) SetPassword(ctx context.Context, id int64, password string) error {
+	return r.byID(id).SetPassword(ctx, id, password)
+}
+
+// VerifyPassword verifies the password of a user on the shard owning its email.
+func (r *shardedUserRepository) VerifyPassword(ctx context.Context, email, password string) (*User, bool, error) {
+	return r.byEmail(email).VerifyPassword(ctx, email, password)
+}
+
+// WithTx fails: users live on different shards, and a transaction can't span shards.
+func (r *shardedUserRepository) WithTx(ctx context.Context, fn func(repo UserRepository) error) error {
+	return errors.New("failed to begin transaction: transactions are not supported with database shards")
+}
@@ -0,0 +1,21 @@
+package repositories
+
+import (
+	"context"
+	"time"
+)
+
+// withQueryTimeout bounds a repository call by database.query_timeout when the caller set no deadline
+// Existing deadlines are kept as is, even when longer than the default: callers that set one
+// know what they are doing. A zero timeout disables the default.
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithQueryTimeoutAddsDefaultDeadline(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := withQueryTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("expected a deadline")
+	}
+	if remaining := time.Until(deadline); remaining > time.Second {
+		t.Fatalf("expected the deadline within 1s, got %s", remaining)
+	}
+}
+
+func TestWithQueryTimeoutKeepsExistingDeadline(t *testing.T) {
+	t.Parallel()
+
+	parent, parentCancel := context.WithTimeout(context.Background(), time.Hour)
+	defer parentCancel()
+	expected, _ := parent.Deadline()
+
+	ctx, cancel := withQueryTimeout(parent, time.Second)
+	defer cancel()
+
+	if deadline, _ := ctx.Deadline(); !deadline.Equal(expected) {
+		t.Fatalf("expected the caller's deadline %s to be kept, got %s", expected, deadline)
+	}
+}
+
+func TestWithQueryTimeoutCancelsSlowQuery(t *testing.T) {
+	t.Parallel()
+
+	pool := newTestPool(t)
+
+	ctx, cancel := withQueryTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := pool.Exec(ctx, "SELECT pg_sleep(5)")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the query to be cancelled by the deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected the query to be cancelled quickly, took %s", elapsed)
+	}
+}
@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UserSortColumn is a column users can be sorted by.
+type UserSortColumn string
+
+// Sortable user columns. Sorting by any other column is rejected, since the column is written into the query.
+const (
+	UserSortByID        UserSortColumn = "id"
+	UserSortByName      UserSortColumn = "name"
+	UserSortByEmail     UserSortColumn = "email"
+	UserSortByCreatedAt UserSortColumn = "created_at"
+	UserSortByUpdatedAt UserSortColumn = "updated_at"
+)
+
+// SortDirection is the direction of a sort.
+type SortDirection string
+
+// Sort directions.
+const (
+	SortAscending  SortDirection = "asc"
+	SortDescending SortDirection = "desc"
+)
+
+// ErrInvalidUserSort is returned when listing users sorted by an unknown column or in an unknown direction.
+var ErrInvalidUserSort = errors.New("invalid user sort")
+
+// ListUsersOptions filters, sorts and paginates the users listed by ListUsersWithOptions
+// The zero value lists every user, most recently created first, without a limit.
+type ListUsersOptions struct {
+	// Limit is the maximum number of users returned, 0 for no limit
+	Limit int
+	// Offset is the number of users skipped
+	Offset int
+	// Search keeps users whose name or email contains it, case-insensitively
+	Search string
+	// EmailDomain keeps users whose email is at this domain, case-insensitively, e.g. example.com
+	EmailDomain string
+	// SortBy is the column users are sorted by, created_at by default
+	SortBy UserSortColumn
+	// SortDirection is the direction of the sort, descending by default
+	SortDirection SortDirection
+}
+
+// withDefaults returns the options with the default sort, or ErrInvalidUserSort for an unknown one.
+func (o ListUsersOptions) withDefaults() (ListUsersOptions, error) {
+	o.SortBy = cmp.Or(o.SortBy, UserSortByCreatedAt)
+	o.SortDirection = cmp.Or(o.SortDirection, SortDescending)
+
+	switch o.SortBy {
+	case UserSortByID, UserSortByName, UserSortByEmail, UserSortByCreatedAt, UserSortByUpdatedAt:
+	default:
+		return o, fmt.Errorf("%w: unknown column %q, expected one of: id, name, email, created_at, updated_at", ErrInvalidUserSort, o.SortBy)
+	}
+
+	switch o.SortDirection {
+	case SortAscending, SortDescending:
+	default:
+		return o, fmt.Errorf("%w: unknown direction %q, expected asc or desc", ErrInvalidUserSort, o.SortDirection)
+	}
+
+	return o, nil
+}
+
+// listUsersQuery builds the query listing the live users matching the options, and its arguments
+// Filter values are always passed as arguments, and the sort comes from the allowlist of withDefaults.
+// Users are sorted by ID last, so that pagination is stable when sorted values are equal.
+func listUsersQuery(opts ListUsersOptions) (string, []any, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		conditions = []string{"deleted_at IS NULL"}
+		args       []any
+	)
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if opts.Search != "" {
+		pattern := arg("%" + escapeLike(opts.Search) + "%")
+		conditions = append(conditions, "(name ILIKE "+pattern+" OR email ILIKE "+pattern+")")
+	}
+	if domain := strings.TrimPrefix(opts.EmailDomain, "@"); domain != "" {
+		conditions = append(conditions, "email ILIKE "+arg("%@"+escapeLike(domain)))
+	}
+
+	direction := strings.ToUpper(string(opts.SortDirection))
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + string(opts.SortBy) + ` ` + direction + `, id ` + direction
+
+	if opts.Limit > 0 {
+		query += `
+		LIMIT ` + arg(opts.Limit)
+	}
+	if opts.Offset > 0 {
+		query += `
+		OFFSET ` + arg(opts.Offset)
+	}
+
+	return query, args, nil
+}
+
+// escapeLike escapes the LIKE wildcards of s, so that it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// compareUsers compares two users in the order of the options, which must have their defaults, as
+// listUsersQuery sorts them. It merges the users listed by several shards.
+func compareUsers(opts ListUsersOptions, a, b *User) int {
+	var c int
+	switch opts.SortBy {
+	case UserSortByName:
+		c = cmp.Compare(a.Name, b.Name)
+	case UserSortByEmail:
+		c = cmp.Compare(a.Email, b.Email)
+	case UserSortByCreatedAt:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case UserSortByUpdatedAt:
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	c = cmp.Or(c, cmp.Compare(a.ID, b.ID))
+
+	if opts.SortDirection == SortDescending {
+		return -c
+	}
+
+	return c
+}
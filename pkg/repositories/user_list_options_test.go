@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListUsersQuery(t *testing.T) {
+	t.Parallel()
+
+	query, args, err := listUsersQuery(ListUsersOptions{})
+	if err != nil {
+		t.Fatalf("expected the default options to be valid, got %v", err)
+	}
+	if !strings.Contains(query, "ORDER BY created_at DESC, id DESC") || strings.Contains(query, "LIMIT") || len(args) != 0 {
+		t.Fatalf("expected every user, most recent first, got %q %v", query, args)
+	}
+
+	query, args, err = listUsersQuery(ListUsersOptions{
+		Limit: 10, Offset: 20, Search: "50%_off", EmailDomain: "@Example.com",
+		SortBy: UserSortByName, SortDirection: SortAscending,
+	})
+	if err != nil {
+		t.Fatalf("expected the options to be valid, got %v", err)
+	}
+	for _, part := range []string{"(name ILIKE $1 OR email ILIKE $1)", "email ILIKE $2", "ORDER BY name ASC, id ASC", "LIMIT $3", "OFFSET $4"} {
+		if !strings.Contains(query, part) {
+			t.Fatalf("expected the query to contain %q, got %q", part, query)
+		}
+	}
+	if want := []any{`%50\%\_off%`, "%@Example.com", 10, 20}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("expected args %v, got %v", want, args)
+	}
+
+	if _, _, err := listUsersQuery(ListUsersOptions{SortBy: "password_hash; DROP TABLE users"}); !errors.Is(err, ErrInvalidUserSort) {
+		t.Fatalf("expected an unknown sort column to be rejected, got %v", err)
+	}
+	if _, _, err := listUsersQuery(ListUsersOptions{SortDirection: "sideways"}); !errors.Is(err, ErrInvalidUserSort) {
+		t.Fatalf("expected an unknown sort direction to be rejected, got %v", err)
+	}
+}
+
+func TestCompareUsers(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	users := []*User{
+		{ID: 1, Name: "Bob", CreatedAt: now},
+		{ID: 2, Name: "Alice", CreatedAt: now.Add(time.Second)},
+		{ID: 3, Name: "Bob", CreatedAt: now.Add(-time.Second)},
+	}
+
+	ids := func(opts ListUsersOptions) []int64 {
+		opts, err := opts.withDefaults()
+		if err != nil {
+			t.Fatalf("unexpected invalid options: %v", err)
+		}
+
+		sorted := slices.Clone(users)
+		slices.SortFunc(sorted, func(a, b *User) int { return compareUsers(opts, a, b) })
+
+		var ids []int64
+		for _, user := range sorted {
+			ids = append(ids, user.ID)
+		}
+		return ids
+	}
+
+	if got := ids(ListUsersOptions{}); !slices.Equal(got, []int64{2, 1, 3}) {
+		t.Fatalf("expected the most recent users first, got %v", got)
+	}
+	if got := ids(ListUsersOptions{SortBy: UserSortByName, SortDirection: SortAscending}); !slices.Equal(got, []int64{2, 1, 3}) {
+		t.Fatalf("expected users by name then ID, got %v", got)
+	}
+	if got := ids(ListUsersOptions{SortBy: UserSortByName}); !slices.Equal(got, []int64{3, 1, 2}) {
+		t.Fatalf("expected users by descending name then ID, got %v", got)
+	}
+}
@@ -4,178 +4,607 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/mail"
+	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/logger"
 	"github.com/samber/do/v2"
 )
 
 // User represents a user model
 // This struct demonstrates how to define domain models for data access.
 type User struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	Status    UserStatus `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// UserStatus is the lifecycle status of a user.
+type UserStatus string
+
+// User statuses. The users table rejects any other value.
+const (
+	UserStatusActive    UserStatus = "active"
+	UserStatusInactive  UserStatus = "inactive"
+	UserStatusSuspended UserStatus = "suspended"
+)
+
+// ErrInvalidUserStatus is returned when writing a user with an unknown status.
+var ErrInvalidUserStatus = errors.New("invalid user status")
+
+// ErrInvalidUser is returned when writing a user with a missing name or a malformed email
+// Retrying can't fix it, so consumers should dead-letter the message carrying the user.
+var ErrInvalidUser = errors.New("invalid user")
+
+// ErrDuplicateEmail is returned when writing a user with the email of another user
+// Retrying can't fix it: the user exists already, e.g. created by an earlier message.
+var ErrDuplicateEmail = errors.New("duplicate user email")
+
+// uniqueViolationCode is the SQLSTATE of a unique constraint violation.
+const uniqueViolationCode = "23505"
+
+// undefinedTableCode is the SQLSTATE raised when querying a missing table or sequence.
+const undefinedTableCode = "42P01"
+
+// ErrUserNotFound is returned when no user matches the requested ID or email.
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrConcurrentModification is returned when updating a user that changed since it was read
+// Retrying can fix it: read the user again, reapply the change and update it with its new UpdatedAt.
+var ErrConcurrentModification = errors.New("user modified concurrently")
+
+// Valid reports whether the status is one of the known user statuses.
+func (s UserStatus) Valid() bool {
+	switch s {
+	case UserStatusActive, UserStatusInactive, UserStatusSuspended:
+		return true
+	default:
+		return false
+	}
+}
+
+// maxUserFieldLength is the length of the VARCHAR columns of the users table.
+const maxUserFieldLength = 255
+
+// Validate checks that the user has a name and a well-formed email, returning an ErrInvalidUser otherwise
+// The email must be a bare RFC 5322 address, such as john@example.com, without a display name. The
+// status is checked separately, with ErrInvalidUserStatus.
+func (u *User) Validate() error {
+	if strings.TrimSpace(u.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidUser)
+	}
+	if utf8.RuneCountInString(u.Name) > maxUserFieldLength {
+		return fmt.Errorf("%w: name is longer than %d characters", ErrInvalidUser, maxUserFieldLength)
+	}
+
+	if u.Email == "" {
+		return fmt.Errorf("%w: email is required", ErrInvalidUser)
+	}
+	if address, err := mail.ParseAddress(u.Email); err != nil || address.Address != u.Email {
+		return fmt.Errorf("%w: malformed email %q", ErrInvalidUser, u.Email)
+	}
+	if utf8.RuneCountInString(u.Email) > maxUserFieldLength {
+		return fmt.Errorf("%w: email is longer than %d characters", ErrInvalidUser, maxUserFieldLength)
+	}
+
+	return nil
+}
+
+// userColumns are the columns of a User, in the order of userFields.
+const userColumns = `id, name, email, first_name, last_name, status, created_at, updated_at`
+
+// userFields returns the destinations of userColumns in a user.
+func userFields(user *User) []any {
+	return []any{
+		&user.ID, &user.Name, &user.Email, &user.FirstName, &user.LastName,
+		&user.Status, &user.CreatedAt, &user.UpdatedAt,
+	}
+}
+
+// usersTable maps a User to the users table. Soft-deleted users are out of its scope.
+var usersTable = Table[User]{
+	Name:        "users",
+	Model:       "user",
+	Columns:     userColumns,
+	Fields:      userFields,
+	Scope:       "deleted_at IS NULL",
+	ErrNotFound: ErrUserNotFound,
+}
+
+// scanUser scans a row selected with userColumns, followed by the given extra destinations.
+func scanUser(row pgx.Row, user *User, extra ...any) error {
+	return row.Scan(append(userFields(user), extra...)...)
+}
+
+// duplicateEmailError returns an ErrDuplicateEmail for a unique constraint violation, or err unchanged
+// Users are only unique by ID and email, and IDs are generated, so a violation is about the email.
+func duplicateEmailError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+		return fmt.Errorf("%w: %s", ErrDuplicateEmail, pgErr.Detail)
+	}
+
+	return err
+}
+
+// checkStatus defaults an empty status to active and rejects unknown ones.
+func checkStatus(user *User) error {
+	if user.Status == "" {
+		user.Status = UserStatusActive
+	}
+	if !user.Status.Valid() {
+		return fmt.Errorf("%w %q, expected one of: active, inactive, suspended", ErrInvalidUserStatus, user.Status)
+	}
+
+	return nil
 }
 
 // UserRepository defines the interface for user data access operations
 // This interface demonstrates how to define contracts for repository pattern.
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *User) (*User, error)
+	CreateUsers(ctx context.Context, users []*User) ([]*User, error)
 	GetUserByID(ctx context.Context, id int64) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	UpdateUser(ctx context.Context, user *User) (*User, error)
+	UpdateUserOptimistic(ctx context.Context, user *User, expectedUpdatedAt time.Time) (*User, error)
 	DeleteUser(ctx context.Context, id int64) error
+	RestoreUser(ctx context.Context, id int64) error
+	HardDeleteUser(ctx context.Context, id int64) error
 	ListUsers(ctx context.Context, limit, offset int) ([]*User, error)
+	ListUsersWithOptions(ctx context.Context, opts ListUsersOptions) ([]*User, error)
+	ListUsersPage(ctx context.Context, limit, offset int) ([]*User, int64, error)
+	CountUsers(ctx context.Context) (int64, error)
+	SetPassword(ctx context.Context, id int64, password string) error
+	VerifyPassword(ctx context.Context, email, password string) (*User, bool, error)
+	// WithTx runs fn in a transaction, committed when fn succeeds and rolled back when it fails. fn
+	// must go through the given UserRepository, which is scoped to the transaction.
+	WithTx(ctx context.Context, fn func(repo UserRepository) error) error
 }
 
 // userRepository implements the UserRepository interface
 // This struct demonstrates how to implement repository pattern with dependency injection.
 type userRepository struct {
-	db *pgxpool.Pool `do:""`
+	db           querier
+	hasher       PasswordHasher
+	queryTimeout time.Duration
+}
+
+// users returns the generic repository of the users table, running its queries where r does.
+func (r *userRepository) users() *Repository[User] {
+	return newRepository(r.db, usersTable, r.queryTimeout)
 }
 
 // NewUserRepository creates a new UserRepository instance
 // This function demonstrates how to initialize a repository with database dependency.
 func NewUserRepository(injector do.Injector) (UserRepository, error) {
-	// Get database pool from the injector
-	db := do.MustInvoke[*Database](injector)
+	appConfig := do.MustInvoke[*config.Config](injector)
+	hasher := do.MustInvoke[PasswordHasher](injector)
+
+	var repo UserRepository
+	if len(appConfig.Database.Shards) > 0 {
+		// Route users across the configured shards
+		repo = newShardedUserRepository(
+			do.MustInvoke[*ShardedDatabase](injector), hasher,
+			appConfig.Database.QueryTimeout, appConfig.Database.AcquireTimeout,
+		)
+	} else {
+		// Get database pool from the injector
+		db := do.MustInvoke[*Database](injector)
+		repo = &userRepository{
+			db:           newBoundedPool(db.Pool(), appConfig.Database.AcquireTimeout),
+			hasher:       hasher,
+			queryTimeout: appConfig.Database.QueryTimeout,
+		}
+	}
 
-	return &userRepository{db: db.Pool()}, nil
+	return repo, nil
 }
 
 // CreateUser creates a new user in the database
 // This method demonstrates how to implement CREATE operation with dependency injection.
-func (r *userRepository) CreateUser(ctx context.Context, user *User) (*User, error) {
+func (r *userRepository) CreateUser(ctx context.Context, user *User) (_ *User, err error) {
+	end := logger.Span(ctx, "user.create")
+	defer func() { end(err) }()
+
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	if err = user.Validate(); err != nil {
+		return nil, err
+	}
+	if err = checkStatus(user); err != nil {
+		return nil, err
+	}
+
 	query := `
-		INSERT INTO users (name, email, created_at, updated_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, name, email, created_at, updated_at
-	`
+		INSERT INTO users (name, email, first_name, last_name, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + userColumns
 
 	now := time.Now()
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
-	err := r.db.QueryRow(ctx, query, user.Name, user.Email, user.CreatedAt, user.UpdatedAt).Scan(
-		&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt,
-	)
+	err = scanUser(r.db.QueryRow(
+		ctx, query,
+		user.Name, user.Email, user.FirstName, user.LastName, user.Status, user.CreatedAt, user.UpdatedAt,
+	), user)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, fmt.Errorf("failed to create user: %w", duplicateEmailError(err))
 	}
 
 	return user, nil
 }
 
-// GetUserByID retrieves a user by ID
-// This method demonstrates how to implement READ operation with dependency injection.
-func (r *userRepository) GetUserByID(ctx context.Context, id int64) (*User, error) {
-	query := `
-		SELECT id, name, email, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`
-
-	var user User
-	err := r.db.QueryRow(ctx, query, id).Scan(
-		&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt,
+// CreateUsers creates users in bulk, all of them or none
+// The users are sent as arrays in a single INSERT, so that a batch takes one round-trip whatever
+// its size. The given users are updated with their generated ID and timestamps, and returned.
+func (r *userRepository) CreateUsers(ctx context.Context, users []*User) (_ []*User, err error) {
+	end := logger.Span(ctx, "user.create_batch")
+	defer func() { end(err) }()
+
+	if len(users) == 0 {
+		return users, nil
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	var (
+		now        = time.Now()
+		names      = make([]string, len(users))
+		emails     = make([]string, len(users))
+		firstNames = make([]string, len(users))
+		lastNames  = make([]string, len(users))
+		statuses   = make([]string, len(users))
+		byEmail    = make(map[string]*User, len(users))
 	)
+	for i, user := range users {
+		if err = user.Validate(); err != nil {
+			return nil, err
+		}
+		if err = checkStatus(user); err != nil {
+			return nil, err
+		}
+
+		user.CreatedAt = now
+		user.UpdatedAt = now
+
+		names[i] = user.Name
+		emails[i] = user.Email
+		firstNames[i] = user.FirstName
+		lastNames[i] = user.LastName
+		statuses[i] = string(user.Status)
+		byEmail[user.Email] = user
+	}
+
+	query := `
+		INSERT INTO users (name, email, first_name, last_name, status, created_at, updated_at)
+		SELECT name, email, first_name, last_name, status, $6, $6
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[]) AS u(name, email, first_name, last_name, status)
+		RETURNING ` + userColumns
+
+	rows, err := r.db.Query(ctx, query, names, emails, firstNames, lastNames, statuses, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create users: %w", duplicateEmailError(err))
+	}
+
+	created, err := collectRows(rows, usersTable)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+		return nil, fmt.Errorf("failed to create users: %w", duplicateEmailError(err))
 	}
 
-	return &user, nil
+	// Emails are unique, so they match each returned row to its user whatever the order of the rows
+	for _, c := range created {
+		if user, ok := byEmail[c.Email]; ok {
+			*user = *c
+		}
+	}
+
+	return users, nil
+}
+
+// GetUserByID retrieves a user by ID
+// This method demonstrates how to implement READ operation with dependency injection.
+func (r *userRepository) GetUserByID(ctx context.Context, id int64) (_ *User, err error) {
+	end := logger.Span(ctx, "user.get_by_id")
+	defer func() { end(err) }()
+
+	return r.users().Get(ctx, "id", id)
 }
 
 // GetUserByEmail retrieves a user by email
 // This method demonstrates how to implement READ operation with dependency injection.
-func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
-	query := `
-		SELECT id, name, email, created_at, updated_at
-		FROM users
-		WHERE email = $1
-	`
-
-	var user User
-	err := r.db.QueryRow(ctx, query, email).Scan(
-		&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user by email: %w", err)
-	}
+func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (_ *User, err error) {
+	end := logger.Span(ctx, "user.get_by_email")
+	defer func() { end(err) }()
 
-	return &user, nil
+	return r.users().Get(ctx, "email", email)
 }
 
 // UpdateUser updates an existing user
 // This method demonstrates how to implement UPDATE operation with dependency injection.
-func (r *userRepository) UpdateUser(ctx context.Context, user *User) (*User, error) {
+func (r *userRepository) UpdateUser(ctx context.Context, user *User) (_ *User, err error) {
+	end := logger.Span(ctx, "user.update")
+	defer func() { end(err) }()
+
+	return r.update(ctx, user, nil)
+}
+
+// UpdateUserOptimistic updates an existing user, unless it was updated since expectedUpdatedAt
+// expectedUpdatedAt is the UpdatedAt of the user as read before changing it. When another update
+// happened meanwhile, nothing is written and ErrConcurrentModification is returned, so that
+// concurrent updates never silently overwrite each other.
+func (r *userRepository) UpdateUserOptimistic(ctx context.Context, user *User, expectedUpdatedAt time.Time) (_ *User, err error) {
+	end := logger.Span(ctx, "user.update_optimistic")
+	defer func() { end(err) }()
+
+	return r.update(ctx, user, &expectedUpdatedAt)
+}
+
+// update writes a user, only when its updated_at is still expectedUpdatedAt unless it is nil.
+func (r *userRepository) update(ctx context.Context, user *User, expectedUpdatedAt *time.Time) (*User, error) {
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	if err := user.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkStatus(user); err != nil {
+		return nil, err
+	}
+
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, updated_at = $3
-		WHERE id = $4
-		RETURNING id, name, email, created_at, updated_at
-	`
+		SET name = $1, email = $2, first_name = $3, last_name = $4, status = $5, updated_at = $6
+		WHERE id = $7 AND deleted_at IS NULL`
 
-	user.UpdatedAt = time.Now()
+	// user is only set by the scan of the updated row, a failed update leaving it untouched
+	updatedAt := time.Now()
 
-	err := r.db.QueryRow(ctx, query, user.Name, user.Email, user.UpdatedAt, user.ID).Scan(
-		&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt,
-	)
+	args := []any{user.Name, user.Email, user.FirstName, user.LastName, user.Status, updatedAt, user.ID}
+	if expectedUpdatedAt != nil {
+		query += ` AND updated_at = $8`
+		args = append(args, *expectedUpdatedAt)
+	}
+
+	err := scanUser(r.db.QueryRow(ctx, query+` RETURNING `+userColumns, args...), user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, r.updateConflict(ctx, user.ID, expectedUpdatedAt != nil)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to update user: %w", err)
+		return nil, fmt.Errorf("failed to update user: %w", duplicateEmailError(err))
 	}
 
 	return user, nil
 }
 
-// DeleteUser deletes a user by ID
-// This method demonstrates how to implement DELETE operation with dependency injection.
-func (r *userRepository) DeleteUser(ctx context.Context, id int64) error {
+// updateConflict tells why an update matched no row: the user is gone, or, when the update was
+// conditioned on its updated_at, it was modified concurrently.
+func (r *userRepository) updateConflict(ctx context.Context, id int64, optimistic bool) error {
+	if !optimistic {
+		return fmt.Errorf("%w: id %d", ErrUserNotFound, id)
+	}
+
+	if _, err := r.users().Get(ctx, "id", id); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: id %d", ErrConcurrentModification, id)
+}
+
+// DeleteUser soft-deletes a user by ID
+// The row is kept with deleted_at set, for auditability, and every read ignores it from then on.
+// Its email is released, so that a new user can take it.
+func (r *userRepository) DeleteUser(ctx context.Context, id int64) (err error) {
+	end := logger.Span(ctx, "user.delete")
+	defer func() { end(err) }()
+
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `UPDATE users SET deleted_at = $1, updated_at = $1 WHERE id = $2 AND deleted_at IS NULL`
+
+	result, err := r.db.Exec(ctx, query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%w: id %d", ErrUserNotFound, id)
+	}
+
+	return nil
+}
+
+// RestoreUser restores a soft-deleted user by ID
+// It returns ErrUserNotFound when no soft-deleted user has this ID, and ErrDuplicateEmail when a
+// live user took its email meanwhile.
+func (r *userRepository) RestoreUser(ctx context.Context, id int64) (err error) {
+	end := logger.Span(ctx, "user.restore")
+	defer func() { end(err) }()
+
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `UPDATE users SET deleted_at = NULL, updated_at = $1 WHERE id = $2 AND deleted_at IS NOT NULL`
+
+	result, err := r.db.Exec(ctx, query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to restore user: %w", duplicateEmailError(err))
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%w: id %d", ErrUserNotFound, id)
+	}
+
+	return nil
+}
+
+// HardDeleteUser permanently deletes a user by ID, whether it is soft-deleted or not.
+func (r *userRepository) HardDeleteUser(ctx context.Context, id int64) (err error) {
+	end := logger.Span(ctx, "user.hard_delete")
+	defer func() { end(err) }()
+
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `DELETE FROM users WHERE id = $1`
 
 	result, err := r.db.Exec(ctx, query, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+		return fmt.Errorf("failed to hard-delete user: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
-		return errors.New("user not found")
+		return fmt.Errorf("%w: id %d", ErrUserNotFound, id)
 	}
 
 	return nil
 }
 
-// ListUsers retrieves a list of users with pagination
-// This method demonstrates how to implement LIST operation with dependency injection.
+// ListUsers retrieves a list of users with pagination, most recent first
+// It is kept for compatibility, ListUsersWithOptions filtering and sorting them too.
 func (r *userRepository) ListUsers(ctx context.Context, limit, offset int) ([]*User, error) {
-	query := `
-		SELECT id, name, email, created_at, updated_at
-		FROM users
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
-	`
+	return r.ListUsersWithOptions(ctx, ListUsersOptions{Limit: limit, Offset: offset})
+}
 
-	rows, err := r.db.Query(ctx, query, limit, offset)
+// ListUsersWithOptions retrieves a list of users filtered, sorted and paginated by the options
+// This method demonstrates how to implement LIST operation with dependency injection.
+func (r *userRepository) ListUsersWithOptions(ctx context.Context, opts ListUsersOptions) (_ []*User, err error) {
+	end := logger.Span(ctx, "user.list")
+	defer func() { end(err) }()
+
+	query, args, err := listUsersQuery(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list users: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	var users []*User
-	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan user: %w", err)
-		}
-		users = append(users, &user)
+	return r.users().List(ctx, query, args...)
+}
+
+// ListUsersPage retrieves a page of users along with the total number of users, see listUsersPage.
+func (r *userRepository) ListUsersPage(ctx context.Context, limit, offset int) ([]*User, int64, error) {
+	return listUsersPage(ctx, r, limit, offset)
+}
+
+// CountUsers returns the total number of users.
+func (r *userRepository) CountUsers(ctx context.Context) (_ int64, err error) {
+	end := logger.Span(ctx, "user.count")
+	defer func() { end(err) }()
+
+	return r.users().Count(ctx)
+}
+
+// listUsersPage lists a page of users of a repository and counts them all, for pagination
+// The page and the total are read by two queries, so users written in between may make them disagree.
+func listUsersPage(ctx context.Context, repo UserRepository, limit, offset int) ([]*User, int64, error) {
+	users, err := repo.ListUsers(ctx, limit, offset)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate users: %w", err)
+	total, err := repo.CountUsers(ctx)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return users, nil
+	return users, total, nil
+}
+
+// SetPassword hashes and stores the password of a user
+// The hash is written to its own column and is never read back into a User, so it can't leak
+// through logs or API responses. It returns ErrPasswordHashingDisabled unless hashing is configured.
+func (r *userRepository) SetPassword(ctx context.Context, id int64, password string) (err error) {
+	end := logger.Span(ctx, "user.set_password")
+	defer func() { end(err) }()
+
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	hash, err := r.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL`
+
+	result, err := r.db.Exec(ctx, query, hash, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%w: id %d", ErrUserNotFound, id)
+	}
+
+	return nil
+}
+
+// VerifyPassword checks the password of the user with the given email
+// It returns the user and true on success, or false when the password doesn't match or
+// the user has no password set.
+func (r *userRepository) VerifyPassword(ctx context.Context, email, password string) (_ *User, _ bool, err error) {
+	end := logger.Span(ctx, "user.verify_password")
+	defer func() { end(err) }()
+
+	ctx, cancel := withQueryTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	query := `SELECT ` + userColumns + `, password_hash FROM users WHERE email = $1 AND deleted_at IS NULL`
+
+	var (
+		user User
+		hash *string
+	)
+	err = scanUser(r.db.QueryRow(ctx, query, email), &user, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, fmt.Errorf("%w: email %s", ErrUserNotFound, email)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get user by email: %w", err)
+	}
+
+	if hash == nil {
+		return nil, false, nil
+	}
+
+	ok, err := r.hasher.Verify(password, *hash)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	return &user, true, nil
+}
+
+// WithTx runs fn in a transaction, committing it when fn succeeds and rolling it back otherwise
+// Called on a repository scoped to a transaction already, fn runs in a savepoint of that transaction.
+func (r *userRepository) WithTx(ctx context.Context, fn func(repo UserRepository) error) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// Rolling back a committed transaction is a no-op
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	if err := fn(&userRepository{db: tx, hasher: r.hasher, queryTimeout: r.queryTimeout}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
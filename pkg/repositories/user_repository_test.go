@@ -0,0 +1,475 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samber/do-template-worker/pkg/repositories/repositoriestest"
+)
+
+// newTestPool connects to the database referenced by TEST_DATABASE_URL, or skips the test.
+func newTestPool(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+// TestUserRepositoryWithFixtures counts every user and truncates the users table, so it can't run in
+// parallel with the other tests writing users: it runs before them, parallel tests only starting once
+// the sequential ones are done.
+func TestUserRepositoryWithFixtures(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	// Start from an empty table, whatever previous runs left behind
+	if err := repositoriestest.Truncate(ctx, pool, "users"); err != nil {
+		t.Fatalf("failed to truncate users: %v", err)
+	}
+	if err := repositoriestest.LoadFixtures(ctx, pool, "repositoriestest/testdata/users.yaml"); err != nil {
+		t.Fatalf("failed to load fixtures: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = repositoriestest.Truncate(ctx, pool, "users")
+	})
+
+	repo := &userRepository{db: newBoundedPool(pool, 0)}
+
+	user, err := repo.GetUserByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("expected fixture user, got %v", err)
+	}
+	if user.Name != "Alice Martin" {
+		t.Fatalf("expected name %q, got %q", "Alice Martin", user.Name)
+	}
+	if user.Status != UserStatusActive {
+		t.Fatalf("expected fixture users to default to %q, got %q", UserStatusActive, user.Status)
+	}
+
+	users, err := repo.ListUsers(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("failed to list users: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(users))
+	}
+
+	if _, err := repo.GetUserByEmail(ctx, "nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound for an unknown email, got %v", err)
+	}
+	if err := repo.DeleteUser(ctx, -1); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound when deleting an unknown user, got %v", err)
+	}
+
+	page, total, err := repo.ListUsersPage(ctx, 1, 0)
+	if err != nil {
+		t.Fatalf("failed to list users page: %v", err)
+	}
+	if len(page) != 1 || total != 2 {
+		t.Fatalf("expected a page of 1 user out of 2, got %d users out of %d", len(page), total)
+	}
+}
+
+func TestUserRepositoryWithTx(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pool := newTestPool(t)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DELETE FROM users WHERE email LIKE 'with.tx.%'")
+	})
+
+	repo := &userRepository{db: newBoundedPool(pool, 0)}
+
+	// A failing fn rolls back every write of the transaction
+	failure := errors.New("audit failed")
+	err := repo.WithTx(ctx, func(tx UserRepository) error {
+		if _, err := tx.CreateUser(ctx, &User{Name: "With Tx", Email: "with.tx.rolled-back@example.com"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected the fn error, got %v", err)
+	}
+	if _, err := repo.GetUserByEmail(ctx, "with.tx.rolled-back@example.com"); err == nil {
+		t.Fatal("expected the user to be rolled back")
+	}
+
+	// A nested WithTx runs in a savepoint: its failure only rolls back its own writes
+	err = repo.WithTx(ctx, func(tx UserRepository) error {
+		if _, err := tx.CreateUser(ctx, &User{Name: "With Tx", Email: "with.tx@example.com"}); err != nil {
+			return err
+		}
+
+		nested := tx.WithTx(ctx, func(tx UserRepository) error {
+			if _, err := tx.CreateUser(ctx, &User{Name: "With Tx", Email: "with.tx.nested@example.com"}); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(nested, failure) {
+			t.Errorf("expected the nested fn error, got %v", nested)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected the transaction to commit, got %v", err)
+	}
+	if _, err := repo.GetUserByEmail(ctx, "with.tx@example.com"); err != nil {
+		t.Fatalf("expected the user to be committed, got %v", err)
+	}
+	if _, err := repo.GetUserByEmail(ctx, "with.tx.nested@example.com"); err == nil {
+		t.Fatal("expected the user of the failed savepoint to be rolled back")
+	}
+}
+
+func TestUserRepositoryCreateUsers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pool := newTestPool(t)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DELETE FROM users WHERE email LIKE 'create.users.%'")
+	})
+
+	repo := &userRepository{db: newBoundedPool(pool, 0)}
+
+	users := []*User{
+		{Name: "First", Email: "create.users.1@example.com", FirstName: "Ada"},
+		{Name: "Second", Email: "create.users.2@example.com", Status: UserStatusSuspended},
+	}
+	created, err := repo.CreateUsers(ctx, users)
+	if err != nil {
+		t.Fatalf("failed to create users: %v", err)
+	}
+	for i, user := range created {
+		if user.ID == 0 || user.CreatedAt.IsZero() || user.Email != users[i].Email {
+			t.Fatalf("expected user %d to be populated in order, got %+v", i, user)
+		}
+	}
+	if created[0].Status != UserStatusActive || created[1].Status != UserStatusSuspended || created[0].FirstName != "Ada" {
+		t.Fatalf("unexpected created users: %+v, %+v", created[0], created[1])
+	}
+
+	// A duplicate email fails the whole batch
+	_, err = repo.CreateUsers(ctx, []*User{
+		{Name: "Third", Email: "create.users.3@example.com"},
+		{Name: "Duplicate", Email: "create.users.1@example.com"},
+	})
+	if err == nil {
+		t.Fatal("expected a duplicate email to fail the batch")
+	}
+	if _, err := repo.GetUserByEmail(ctx, "create.users.3@example.com"); err == nil {
+		t.Fatal("expected no user of the failed batch to be created")
+	}
+}
+
+func TestUserRepositorySoftDelete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pool := newTestPool(t)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DELETE FROM users WHERE email LIKE 'soft.delete.%'")
+	})
+
+	repo := &userRepository{db: newBoundedPool(pool, 0)}
+
+	user, err := repo.CreateUser(ctx, &User{Name: "Soft", Email: "soft.delete@example.com"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	if err := repo.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if _, err := repo.GetUserByID(ctx, user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected a soft-deleted user to be hidden, got %v", err)
+	}
+	if err := repo.DeleteUser(ctx, user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected deleting a soft-deleted user to fail, got %v", err)
+	}
+
+	var deleted bool
+	if err := pool.QueryRow(ctx, "SELECT deleted_at IS NOT NULL FROM users WHERE id = $1", user.ID).Scan(&deleted); err != nil || !deleted {
+		t.Fatalf("expected the row to be kept with deleted_at set, got %v (%v)", deleted, err)
+	}
+
+	if err := repo.RestoreUser(ctx, user.ID); err != nil {
+		t.Fatalf("failed to restore user: %v", err)
+	}
+	if _, err := repo.GetUserByEmail(ctx, "soft.delete@example.com"); err != nil {
+		t.Fatalf("expected a restored user to be visible, got %v", err)
+	}
+	if err := repo.RestoreUser(ctx, user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected restoring a live user to fail, got %v", err)
+	}
+
+	if err := repo.HardDeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("failed to hard-delete user: %v", err)
+	}
+	if err := repo.RestoreUser(ctx, user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected a hard-deleted user to be gone, got %v", err)
+	}
+}
+
+func TestUserRepositoryUpdateUserOptimistic(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pool := newTestPool(t)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DELETE FROM users WHERE email LIKE 'optimistic.%'")
+	})
+
+	repo := &userRepository{db: newBoundedPool(pool, 0)}
+
+	user, err := repo.CreateUser(ctx, &User{Name: "Optimistic", Email: "optimistic@example.com"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	read := user.UpdatedAt
+
+	first := *user
+	first.Name = "First"
+	updated, err := repo.UpdateUserOptimistic(ctx, &first, read)
+	if err != nil {
+		t.Fatalf("expected the first update to succeed, got %v", err)
+	}
+
+	second := *user
+	second.Name = "Second"
+	if _, err := repo.UpdateUserOptimistic(ctx, &second, read); !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("expected the stale update to be refused, got %v", err)
+	}
+	if _, err := repo.UpdateUserOptimistic(ctx, &second, updated.UpdatedAt); err != nil {
+		t.Fatalf("expected the update with the new timestamp to succeed, got %v", err)
+	}
+
+	if err := repo.HardDeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("failed to hard-delete user: %v", err)
+	}
+	if _, err := repo.UpdateUserOptimistic(ctx, &second, read); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected a missing user to be reported, got %v", err)
+	}
+}
+
+// queuedRowQuerier answers each QueryRow with the next row.
+type queuedRowQuerier struct {
+	querier
+	rows    []pgx.Row
+	queries []string
+}
+
+func (q *queuedRowQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	q.queries = append(q.queries, sql)
+	row := q.rows[0]
+	q.rows = q.rows[1:]
+	return row
+}
+
+func TestUpdateUserOptimisticConflicts(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		existing pgx.Row
+		expected error
+	}{
+		"modified": {existing: scanRow{int64(1), "Alice", "alice@example.com", "", "", nil, nil, nil}, expected: ErrConcurrentModification},
+		"deleted":  {existing: errRow{pgx.ErrNoRows}, expected: ErrUserNotFound},
+	} {
+		db := &queuedRowQuerier{rows: []pgx.Row{errRow{pgx.ErrNoRows}, tc.existing}}
+		repo := &userRepository{db: db}
+
+		read := time.Now()
+		user := &User{ID: 1, Name: "Alice", Email: "alice@example.com", UpdatedAt: read}
+		_, err := repo.UpdateUserOptimistic(context.Background(), user, read)
+		if !errors.Is(err, tc.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, tc.expected, err)
+		}
+		if !user.UpdatedAt.Equal(read) {
+			t.Fatalf("%s: expected a failed update to leave the user untouched, got updated_at %s", name, user.UpdatedAt)
+		}
+		if !strings.Contains(db.queries[0], "AND updated_at = $8") {
+			t.Fatalf("%s: expected the update to check updated_at, got %s", name, db.queries[0])
+		}
+	}
+}
+
+func TestUserRepositoryReusesSoftDeletedEmail(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pool := newTestPool(t)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DELETE FROM users WHERE email = 'reused.email@example.com'")
+	})
+
+	repo := &userRepository{db: newBoundedPool(pool, 0)}
+
+	deleted, err := repo.CreateUser(ctx, &User{Name: "First", Email: "reused.email@example.com"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := repo.DeleteUser(ctx, deleted.ID); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+
+	created, err := repo.CreateUser(ctx, &User{Name: "Second", Email: "reused.email@example.com"})
+	if err != nil {
+		t.Fatalf("expected the email of a soft-deleted user to be reusable, got %v", err)
+	}
+	if found, err := repo.GetUserByEmail(ctx, "reused.email@example.com"); err != nil || found.ID != created.ID {
+		t.Fatalf("expected the new user to own the email, got %v (%v)", found, err)
+	}
+
+	if err := repo.RestoreUser(ctx, deleted.ID); !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("expected restoring a user whose email was reused to fail, got %v", err)
+	}
+	if _, err := repo.CreateUser(ctx, &User{Name: "Third", Email: "reused.email@example.com"}); !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("expected the email to stay unique among live users, got %v", err)
+	}
+}
+
+// execQuerier answers every Exec with the same error.
+type execQuerier struct {
+	querier
+	err error
+}
+
+func (q *execQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, q.err
+}
+
+func TestRestoreUserReportsReusedEmail(t *testing.T) {
+	t.Parallel()
+
+	repo := &userRepository{db: &execQuerier{err: &pgconn.PgError{Code: uniqueViolationCode, Detail: "Key (email)=(jane@example.com) already exists."}}}
+	if err := repo.RestoreUser(context.Background(), 1); !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("expected ErrDuplicateEmail, got %v", err)
+	}
+}
+
+// BenchmarkCreateUsers compares a batch insert with a CreateUser call per user.
+func BenchmarkCreateUsers(b *testing.B) {
+	ctx := context.Background()
+	pool := newTestPool(b)
+	b.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DELETE FROM users WHERE email LIKE 'bench.create.users.%'")
+	})
+
+	repo := &userRepository{db: newBoundedPool(pool, 0)}
+
+	const batchSize = 100
+	newBatch := func(run string, n int) []*User {
+		users := make([]*User, batchSize)
+		for i := range users {
+			users[i] = &User{Name: "Bench", Email: fmt.Sprintf("bench.create.users.%s.%d.%d@example.com", run, n, i)}
+		}
+		return users
+	}
+
+	b.Run("batch", func(b *testing.B) {
+		// The benchmark function runs several times, each run needing its own emails
+		run := fmt.Sprintf("batch.%d", time.Now().UnixNano())
+		for n := range b.N {
+			if _, err := repo.CreateUsers(ctx, newBatch(run, n)); err != nil {
+				b.Fatalf("failed to create users: %v", err)
+			}
+		}
+	})
+
+	b.Run("loop", func(b *testing.B) {
+		run := fmt.Sprintf("loop.%d", time.Now().UnixNano())
+		for n := range b.N {
+			for _, user := range newBatch(run, n) {
+				if _, err := repo.CreateUser(ctx, user); err != nil {
+					b.Fatalf("failed to create user: %v", err)
+				}
+			}
+		}
+	})
+}
+
+func TestCheckStatus(t *testing.T) {
+	t.Parallel()
+
+	user := &User{}
+	if err := checkStatus(user); err != nil || user.Status != UserStatusActive {
+		t.Fatalf("expected an empty status to default to active, got %q (%v)", user.Status, err)
+	}
+
+	user = &User{Status: UserStatusSuspended}
+	if err := checkStatus(user); err != nil {
+		t.Fatalf("expected suspended to be valid, got %v", err)
+	}
+
+	user = &User{Status: "deleted"}
+	if err := checkStatus(user); !errors.Is(err, ErrInvalidUserStatus) {
+		t.Fatalf("expected ErrInvalidUserStatus, got %v", err)
+	}
+}
+
+func TestUserValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := []User{
+		{Name: "John", Email: "john@example.com"},
+		{Name: "Jane Doe", Email: "jane.doe+news@mail.example.co.uk"},
+	}
+	for _, user := range valid {
+		if err := user.Validate(); err != nil {
+			t.Fatalf("expected %+v to be valid, got %v", user, err)
+		}
+	}
+
+	invalid := map[string]User{
+		"name is required":    {Name: "  ", Email: "john@example.com"},
+		"email is required":   {Name: "John"},
+		"malformed email":     {Name: "John", Email: "john"},
+		"malformed email \"J": {Name: "John", Email: "John <john@example.com>"},
+		"email is longer":     {Name: "John", Email: strings.Repeat("j", 250) + "@example.com"},
+		"name is longer":      {Name: strings.Repeat("J", 256), Email: "john@example.com"},
+	}
+	for want, user := range invalid {
+		if err := user.Validate(); !errors.Is(err, ErrInvalidUser) || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected an ErrInvalidUser mentioning %q, got %v", want, err)
+		}
+	}
+}
+
+func TestDuplicateEmailError(t *testing.T) {
+	t.Parallel()
+
+	violation := &pgconn.PgError{Code: uniqueViolationCode, Detail: "Key (email)=(john@example.com) already exists."}
+	err := duplicateEmailError(fmt.Errorf("scan: %w", violation))
+	if !errors.Is(err, ErrDuplicateEmail) || !strings.Contains(err.Error(), "john@example.com") {
+		t.Fatalf("expected ErrDuplicateEmail naming the email, got %v", err)
+	}
+
+	for _, other := range []error{&pgconn.PgError{Code: "23514"}, errors.New("connection reset")} {
+		if err := duplicateEmailError(other); err != other {
+			t.Fatalf("expected %v to be left unchanged, got %v", other, err)
+		}
+	}
+}
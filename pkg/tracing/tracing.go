@@ -0,0 +1,113 @@
+// Package tracing sets up OpenTelemetry tracing, and propagates trace contexts through message headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Tracing installs the OpenTelemetry tracer provider and propagator of the process
+// With app.tracing_enabled, spans are recorded and trace contexts propagated with the W3C Trace
+// Context propagator; with app.otlp_endpoint too, spans are exported to that collector in batches.
+// Disabled, the global no-op provider is left in place: spans cost nothing and nothing is propagated.
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+}
+
+// NewTracing creates the tracer provider configured by app.tracing_enabled and app.otlp_endpoint,
+// and installs it as the global one, used by logger.StartSpan.
+func NewTracing(i do.Injector) (*Tracing, error) {
+	appConfig := do.MustInvoke[*config.Config](i)
+
+	if !appConfig.App.TracingEnabled {
+		return &Tracing{}, nil
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", appConfig.App.Name),
+			attribute.String("service.version", appConfig.App.Version),
+			attribute.String("deployment.environment", appConfig.App.Environment),
+		)),
+	}
+
+	if endpoint := appConfig.App.OTLPEndpoint; endpoint != "" {
+		// The exporter connects lazily, so an unreachable collector doesn't keep the worker from starting
+		exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return &Tracing{provider: provider}, nil
+}
+
+// Shutdown exports the spans still buffered, then stops the exporter.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t.provider == nil {
+		return nil
+	}
+
+	if err := t.provider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to flush spans: %w", err)
+	}
+
+	return nil
+}
+
+// Inject returns the message headers propagating the trace context of ctx, nil outside a recorded span.
+func Inject(ctx context.Context) amqp091.Table {
+	headers := amqp091.Table{}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+
+	if len(headers) == 0 {
+		return nil
+	}
+
+	return headers
+}
+
+// Extract returns ctx carrying the trace context found in message headers, so that the spans
+// started from it continue the trace of the producer. Without one, ctx is returned unchanged.
+func Extract(ctx context.Context, headers amqp091.Table) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier(headers))
+}
+
+// headerCarrier adapts AMQP message headers to a propagation.TextMapCarrier.
+type headerCarrier amqp091.Table
+
+// Get returns the value of a header, empty when missing or not a string.
+func (c headerCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+// Set sets a header.
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys returns the names of the headers.
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestTracing(t *testing.T, app config.AppConfig) *Tracing {
+	t.Helper()
+
+	injector := do.New()
+	do.ProvideValue(injector, &config.Config{App: app})
+
+	tracing, err := NewTracing(injector)
+	if err != nil {
+		t.Fatalf("failed to create tracing: %v", err)
+	}
+	t.Cleanup(func() { _ = tracing.Shutdown(context.Background()) })
+
+	return tracing
+}
+
+func TestNewTracingDisabled(t *testing.T) {
+	t.Parallel()
+
+	if tracing := newTestTracing(t, config.AppConfig{}); tracing.provider != nil {
+		t.Fatal("expected no tracer provider when tracing is disabled")
+	}
+}
+
+// TestInjectExtract installs the global tracer provider and propagator, so it can't run in parallel with the others.
+func TestInjectExtract(t *testing.T) {
+	newTestTracing(t, config.AppConfig{Name: "worker", TracingEnabled: true})
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "message.publish")
+	defer span.End()
+
+	headers := Inject(ctx)
+	if traceparent, _ := headers["traceparent"].(string); traceparent == "" {
+		t.Fatalf("expected a traceparent header, got %v", headers)
+	}
+
+	remote := trace.SpanContextFromContext(Extract(context.Background(), headers))
+	if !remote.IsRemote() || remote.TraceID() != span.SpanContext().TraceID() || remote.SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("expected the extracted context to be the published span, got %v", remote)
+	}
+
+	if headers := Inject(context.Background()); headers != nil {
+		t.Fatalf("expected no headers outside a span, got %v", headers)
+	}
+	if ctx := Extract(context.Background(), amqp091.Table{"traceparent": 42}); trace.SpanContextFromContext(ctx).IsValid() {
+		t.Fatal("expected a header that isn't a string to be ignored")
+	}
+}
+
+// TestNewTracingExportsSpans installs the global tracer provider, so it can't run in parallel with the others.
+func TestNewTracingExportsSpans(t *testing.T) {
+	exported := make(chan string, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case exported <- r.URL.Path:
+		default:
+		}
+	}))
+	t.Cleanup(collector.Close)
+
+	tracing := newTestTracing(t, config.AppConfig{Name: "worker", TracingEnabled: true, OTLPEndpoint: collector.URL})
+
+	_, span := otel.Tracer("test").Start(context.Background(), "message.process")
+	span.End()
+
+	// Spans are exported in batches: shutting down flushes the pending one
+	if err := tracing.Shutdown(t.Context()); err != nil {
+		t.Fatalf("expected the spans to be flushed, got %v", err)
+	}
+
+	select {
+	case path := <-exported:
+		if path != "/v1/traces" {
+			t.Fatalf("expected spans to be posted to /v1/traces, got %s", path)
+		}
+	default:
+		t.Fatal("expected the span to be exported to app.otlp_endpoint")
+	}
+}
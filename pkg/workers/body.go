@@ -0,0 +1,75 @@
+package workers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// redactedField replaces the value of redacted fields in logged message bodies.
+const redactedField = "[REDACTED]"
+
+// loggableBody prepares a message body for debug logging, redacting the given fields and keeping at most
+// maxBytes bytes. It reports whether the body was truncated. Fields are matched case-insensitively, at
+// any depth. A body that isn't valid JSON can't be redacted, so it is omitted unless no field is redacted.
+func loggableBody(body []byte, maxBytes int, redact []string) (string, bool) {
+	if len(redact) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return "", false
+		}
+
+		redacted, err := json.Marshal(redactFields(value, redact))
+		if err != nil {
+			return "", false
+		}
+		body = redacted
+	}
+
+	if maxBytes <= 0 || len(body) <= maxBytes {
+		return string(body), false
+	}
+
+	// Don't cut a multi-byte character in half
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+
+	return string(body[:end]), true
+}
+
+// redactFields replaces the values of the given fields in a decoded JSON value.
+func redactFields(value any, fields []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if containsFold(fields, key) {
+				v[key] = redactedField
+				continue
+			}
+			v[key] = redactFields(field, fields)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactFields(item, fields)
+		}
+	}
+
+	return value
+}
+
+// containsFold reports whether values contains s, ignoring case.
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+
+	return false
+}
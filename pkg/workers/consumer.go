@@ -1,149 +1,1142 @@
 package workers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rabbitmq/amqp091-go"
 	"github.com/rs/zerolog"
 	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/logger"
+	"github.com/samber/do-template-worker/pkg/metrics"
 	"github.com/samber/do-template-worker/pkg/rabbitmq"
 	"github.com/samber/do-template-worker/pkg/repositories"
+	"github.com/samber/do-template-worker/pkg/tracing"
 	"github.com/samber/do/v2"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimitRetryDelay is how long the consumer waits before requeueing a rate limited message.
+	rateLimitRetryDelay = 1 * time.Second
+	// strictRetryDelay is how long the consumer waits before retrying a message in strict ordering mode.
+	strictRetryDelay = 1 * time.Second
+	// defaultActionConcurrency is how many messages of the actions missing from
+	// consumer.action_concurrency are processed at once.
+	defaultActionConcurrency = 1
+)
+
+var (
+	// ErrProcessTimeout is returned when a message handler exceeds consumer.process_timeout.
+	ErrProcessTimeout = errors.New("message processing timed out")
+	// ErrHandlerPanic is returned when a message handler panics.
+	ErrHandlerPanic = errors.New("handler panic")
+	// ErrMalformedMessage is returned when a message body is empty or not valid JSON.
+	ErrMalformedMessage = errors.New("malformed message")
+	// ErrInvalidPayload is returned by handlers when a payload can't be decoded into the type of its action
+	// or misses required fields.
+	ErrInvalidPayload = errors.New("invalid payload")
+
+	// ErrRateLimited is returned by handlers when user creation exceeds user.create_rate_limit
+	// The message is requeued after rateLimitRetryDelay.
+	ErrRateLimited = errors.New("user creation rate limited")
+
+	// ErrDatabaseNotReady is returned by Start when the database can't be reached, see CheckDatabase.
+	ErrDatabaseNotReady = errors.New("database not ready")
+
+	// errMessageChannelClosed is returned by Run when the broker closes the delivery channel.
+	errMessageChannelClosed = errors.New("message channel closed")
 )
 
 // ConsumerWorker is a worker that consumes messages from RabbitMQ
 // This struct demonstrates how to implement a consumer worker with dependency injection.
 type ConsumerWorker struct {
-	rabbitMQ *rabbitmq.RabbitMQService
-	userRepo repositories.UserRepository
-	logger   *zerolog.Logger
-	config   *config.Config
+	id         string
+	rabbitMQ   rabbitmq.MessageBroker
+	userRepo   repositories.UserRepository
+	failedRepo repositories.FailedMessageRepository
+	resultRepo repositories.MessageResultRepository
+	database   databaseChecker
+	// processedRepo is only set with consumer.transactional, handlers then writing in its transactions
+	processedRepo repositories.ProcessedMessageRepository
+	logger        *zerolog.Logger
+	config        *config.Config
+	metrics       *metrics.Metrics
+	handlers      map[string]MessageHandler
+	schemas       map[string]*jsonschema.Schema
+	// createLimiter throttles user creation to user.create_rate_limit, nil when unlimited
+	createLimiter *rate.Limiter
+	// bindings are the queues of rabbitmq.bindings, consumed along with the main queue
+	bindings []boundQueue
 	ctx      context.Context
 	cancel   context.CancelFunc
+	// handlerCtx is the context of handlers, which outlives ctx: on shutdown, ctx stops the intake of
+	// deliveries while handlers drain, then abort cancels the handlers still running, see Shutdown.
+	handlerCtx context.Context
+	abort      context.CancelFunc
+
+	// processed counts deliveries handled since the last heartbeat
+	processed atomic.Int64
+	// heartbeatOnce starts a single heartbeat whatever the number of runs
+	heartbeatOnce sync.Once
+
+	// pools bound the concurrency of each action listed in consumer.action_concurrency, and
+	// defaultPool that of the other actions. Both are nil without consumer.action_concurrency.
+	pools       map[string]chan struct{}
+	defaultPool chan struct{}
+	// inflight tracks the deliveries being handled, so that Shutdown waits for them. trackMu orders
+	// tracking new deliveries before Shutdown starts waiting, see track.
+	inflight sync.WaitGroup
+	trackMu  sync.Mutex
+}
+
+// boundQueue is a queue of rabbitmq.bindings, consumed with its own consumer tag.
+type boundQueue struct {
+	queue string
+	tag   string
+	// action is the action every message of the queue is dispatched as
+	action string
+}
+
+// databaseReadyTimeout bounds the database check run before consuming.
+const databaseReadyTimeout = 5 * time.Second
+
+// databaseChecker is the database, or the shards, the handlers write to.
+type databaseChecker interface {
+	HealthCheckWithContext(ctx context.Context) error
 }
 
 // NewConsumerWorker creates a new consumer worker instance
 // This function demonstrates how to initialize a consumer with dependency injection.
 func NewConsumerWorker(injector do.Injector) (*ConsumerWorker, error) {
+	return newConsumerWorker(injector, do.MustInvoke[rabbitmq.MessageBroker](injector))
+}
+
+// NewOfflineConsumerWorker creates a consumer worker without connecting to RabbitMQ
+// It can only process messages handed to Process, e.g. to replay a message read from a file.
+func NewOfflineConsumerWorker(injector do.Injector) (*ConsumerWorker, error) {
+	return newConsumerWorker(injector, nil)
+}
+
+// newConsumerWorker creates a consumer worker consuming from the given broker.
+func newConsumerWorker(injector do.Injector, rabbitMQ rabbitmq.MessageBroker) (*ConsumerWorker, error) {
+	appConfig := do.MustInvoke[*config.Config](injector)
+
+	// Install the tracer provider before the first span is started
+	do.MustInvoke[*tracing.Tracing](injector)
+
+	schemas, err := compileSchemas(appConfig.Consumer.Schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	pools, err := actionPools(appConfig.Consumer, appConfig.RabbitMQ.PrefetchCount)
+	if err != nil {
+		return nil, err
+	}
+
+	var processedRepo repositories.ProcessedMessageRepository
+	if appConfig.Consumer.Transactional {
+		processedRepo = do.MustInvoke[repositories.ProcessedMessageRepository](injector)
+	}
+
+	var database databaseChecker
+	if len(appConfig.Database.Shards) > 0 {
+		database = do.MustInvoke[*repositories.ShardedDatabase](injector)
+	} else {
+		database = do.MustInvoke[*repositories.Database](injector)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
+	handlerCtx, abort := context.WithCancel(context.Background())
+
+	w := &ConsumerWorker{
+		id:            consumerID(),
+		rabbitMQ:      rabbitMQ,
+		userRepo:      do.MustInvoke[repositories.UserRepository](injector),
+		failedRepo:    do.MustInvoke[repositories.FailedMessageRepository](injector),
+		resultRepo:    do.MustInvoke[repositories.MessageResultRepository](injector),
+		processedRepo: processedRepo,
+		database:      database,
+		logger:        do.MustInvoke[*zerolog.Logger](injector),
+		config:        appConfig,
+		metrics:       do.MustInvoke[*metrics.Metrics](injector),
+		schemas:       schemas,
+		createLimiter: newCreateLimiter(appConfig.User.CreateRateLimit),
+		ctx:           ctx,
+		cancel:        cancel,
+		handlerCtx:    handlerCtx,
+		abort:         abort,
+		pools:         pools,
+	}
+	if pools != nil {
+		w.defaultPool = make(chan struct{}, defaultActionConcurrency)
+	}
+
+	// Register a handler per supported action
+	w.handlers = map[string]MessageHandler{
+		"create_user": w.handleCreateUser,
+	}
+
+	// Consume the queue of each binding with its own consumer, telling its deliveries apart by tag
+	for _, binding := range appConfig.RabbitMQ.Bindings {
+		if _, ok := w.handlers[binding.Handler]; !ok {
+			return nil, fmt.Errorf("no handler %q for rabbitmq.bindings queue %q, expected one of: %s",
+				binding.Handler, binding.Queue, strings.Join(slices.Sorted(maps.Keys(w.handlers)), ", "))
+		}
+
+		w.bindings = append(w.bindings, boundQueue{queue: binding.Queue, tag: w.id + "-" + binding.Queue, action: binding.Handler})
+	}
+
+	return w, nil
+}
+
+// newCreateLimiter returns the limiter of user creations, allowing bursts of one second of creations, or
+// nil when perSecond is zero or negative.
+func newCreateLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
 
-	return &ConsumerWorker{
-		rabbitMQ: do.MustInvoke[*rabbitmq.RabbitMQService](injector),
-		userRepo: do.MustInvoke[repositories.UserRepository](injector),
-		logger:   do.MustInvoke[*zerolog.Logger](injector),
-		config:   do.MustInvoke[*config.Config](injector),
-		ctx:      ctx,
-		cancel:   cancel,
-	}, nil
+	return rate.NewLimiter(rate.Limit(perSecond), int(math.Max(1, math.Floor(perSecond))))
 }
 
 // Start starts the consumer worker
 // This method demonstrates how to start a consumer worker with dependency injection.
+//
+// With consumer.ordering=strict, messages are processed in strict FIFO order:
+//   - prefetch is 1, so the broker never hands out a message before the previous one is acked;
+//   - the consumer is exclusive, so no other consumer can take messages from the queue;
+//   - messages are acked manually, after processing;
+//   - failed messages are retried in place instead of being requeued at the tail of the queue,
+//     then dead-lettered once consumer.max_requeues is reached.
 func (w *ConsumerWorker) Start() error {
-	w.logger.Info().Msg("Starting consumer worker")
+	// Fail fast rather than dead-letter every message while the database is unreachable
+	if err := w.CheckDatabase(); err != nil {
+		return err
+	}
 
 	// Start consuming messages
 	go func() {
-		// Create a new channel for each consumer instance
-		msgChan, err := w.rabbitMQ.ConsumeMessage()
+		if err := w.Run(); err != nil {
+			w.logger.Error().Err(err).Msg("Consumer worker stopped unexpectedly")
+		}
+	}()
+
+	return nil
+}
+
+// CheckDatabase pings the database within a short timeout, returning an ErrDatabaseNotReady when it is unreachable
+// Consuming without a database would fail every message, dead-lettering them, so it gates consumption.
+func (w *ConsumerWorker) CheckDatabase() error {
+	ctx, cancel := context.WithTimeout(w.ctx, databaseReadyTimeout)
+	defer cancel()
+
+	if err := w.database.HealthCheckWithContext(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseNotReady, err)
+	}
+
+	return nil
+}
+
+// Run consumes messages until the worker is shut down, then returns nil
+// It returns an error when consumption stops on its own, such as when the broker closes the channel.
+// Run can be called again to resume consuming, which is how serve supervises the consumer.
+func (w *ConsumerWorker) Run() error {
+	strict := w.config.Consumer.Ordering == config.OrderingStrict
+
+	w.logger.Info().Bool("strict_ordering", strict).Msg("Starting consumer worker")
+
+	w.heartbeatOnce.Do(func() {
+		if interval := w.config.Consumer.HeartbeatInterval; interval > 0 {
+			go w.heartbeat(interval)
+		}
+	})
+
+	opts := rabbitmq.ConsumeOptions{PrefetchCount: w.config.RabbitMQ.PrefetchCount, Tag: w.id}
+	if strict {
+		opts = rabbitmq.ConsumeOptions{PrefetchCount: 1, Exclusive: true, Tag: w.id}
+	}
+
+	// The queue of each binding gets its own consumer, with the same options
+	consumers := []rabbitmq.ConsumeOptions{opts}
+	for _, binding := range w.bindings {
+		bindingOpts := opts
+		bindingOpts.Queue, bindingOpts.Tag = binding.queue, binding.tag
+		consumers = append(consumers, bindingOpts)
+	}
+
+	// Create a new channel for each consumer instance
+	msgChans := make([]<-chan amqp091.Delivery, 0, len(consumers))
+	for _, consumer := range consumers {
+		msgChan, err := w.rabbitMQ.ConsumeMessageWithOptions(consumer)
 		if err != nil {
-			w.logger.Error().Err(err).Msg("Failed to start consuming messages")
+			w.cancelConsumers()
+			return fmt.Errorf("failed to start consuming messages: %w", err)
+		}
+		msgChans = append(msgChans, msgChan)
+	}
+
+	return w.consumeAll(msgChans)
+}
+
+// consumeAll consumes every delivery channel until the worker is stopped
+// When one of them stops on its own, the other consumers are cancelled and the error returned, so
+// that Run can be called again to start them all over.
+func (w *ConsumerWorker) consumeAll(msgChans []<-chan amqp091.Delivery) error {
+	if len(msgChans) == 1 {
+		return w.consume(msgChans[0])
+	}
+
+	errs := make(chan error, len(msgChans))
+	for _, msgChan := range msgChans {
+		go func() {
+			errs <- w.consume(msgChan)
+		}()
+	}
+
+	var err error
+	for range msgChans {
+		if consumeErr := <-errs; consumeErr != nil && err == nil {
+			err = consumeErr
+			w.cancelConsumers()
+		}
+	}
+
+	return err
+}
+
+// cancelConsumers cancels the consumer of the main queue and those of the bindings.
+func (w *ConsumerWorker) cancelConsumers() {
+	tags := []string{w.id}
+	for _, binding := range w.bindings {
+		tags = append(tags, binding.tag)
+	}
+
+	for _, tag := range tags {
+		if err := w.rabbitMQ.CancelConsumer(tag); err != nil {
+			w.logger.Warn().Err(err).Str("consumer_tag", tag).Msg("Failed to cancel consumer, deliveries sent meanwhile will be redelivered")
+		}
+	}
+}
+
+// heartbeat periodically logs that the consumer is alive, even when the queue is idle
+// Monitoring can detect a dead or stuck consumer by the absence of this log.
+func (w *ConsumerWorker) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
 			return
+		case <-ticker.C:
+			event := w.logger.Info().Int64("processed", w.processed.Swap(0))
+
+			backlog, err := w.rabbitMQ.QueueDepth()
+			if err != nil {
+				event = event.AnErr("backlog_error", err)
+			} else {
+				event = event.Int("backlog", backlog)
+			}
+
+			event.Dur("interval", interval).Msg("Consumer alive")
 		}
+	}
+}
 
-		for {
-			select {
-			case <-w.ctx.Done():
-				w.logger.Info().Msg("Consumer worker stopped")
-				return
-			case msg, ok := <-msgChan:
-				if !ok {
-					w.logger.Info().Msg("Message channel closed")
-					return
-				}
+// consume processes deliveries until the worker is stopped or the channel is closed
+// With rabbitmq.consumer_concurrency, that many goroutines read from the channel, each message being
+// acked, requeued or dead-lettered by the goroutine handling it. A closed channel is reported as
+// errMessageChannelClosed.
+func (w *ConsumerWorker) consume(msgChan <-chan amqp091.Delivery) error {
+	handle := w.handleDelivery
+	if w.config.Consumer.Ordering == config.OrderingStrict {
+		handle = w.handleDeliveryInOrder
+	}
+
+	// Let the messages dispatched to action pools finish before returning
+	defer w.inflight.Wait()
+
+	// Strict ordering and action pools rule out concurrent consumer loops, see config.Validate
+	concurrency := max(1, w.config.RabbitMQ.ConsumerConcurrency)
+
+	errs := make(chan error, concurrency)
+	for range concurrency {
+		go func() {
+			errs <- w.consumeLoop(msgChan, handle)
+		}()
+	}
+
+	var err error
+	for range concurrency {
+		if loopErr := <-errs; loopErr != nil {
+			err = loopErr
+		}
+	}
+	if err == nil {
+		w.logger.Info().Msg("Consumer worker stopped")
+	}
 
-				if err := w.processMessage(msg); err != nil {
-					w.logger.Error().Err(err).Msg("Failed to process message")
-					_ = msg.Nack(false, true)
-				} else {
-					_ = msg.Ack(false)
+	return err
+}
+
+// consumeLoop handles deliveries one at a time until the worker is stopped or the channel is closed.
+func (w *ConsumerWorker) consumeLoop(msgChan <-chan amqp091.Delivery, handle func(amqp091.Delivery)) error {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil
+		case msg, ok := <-msgChan:
+			if !ok {
+				if w.ctx.Err() != nil {
+					// Cancelling the consumer on shutdown closes the channel
+					return nil
 				}
+				return errMessageChannelClosed
 			}
+
+			if !w.track() {
+				w.releaseOnShutdown(msg)
+				return nil
+			}
+
+			if w.pools == nil {
+				handle(msg)
+				w.processed.Add(1)
+				w.inflight.Done()
+				continue
+			}
+
+			w.dispatch(handle, msg)
 		}
-	}()
+	}
+}
 
-	return nil
+// track adds a delivery to the in-flight deliveries Shutdown waits for
+// It reports false once the worker is stopped, the delivery being then left to the caller.
+func (w *ConsumerWorker) track() bool {
+	w.trackMu.Lock()
+	defer w.trackMu.Unlock()
+
+	if w.ctx.Err() != nil {
+		return false
+	}
+
+	w.inflight.Add(1)
+	return true
+}
+
+// actionPools builds a pool per action listed in consumer.action_concurrency
+// A positive prefetch count must leave room for every slot, or the broker would hold back the deliveries
+// that the pools are meant to process concurrently.
+// A pool is a semaphore holding as many slots as messages of the action may be processed at once.
+func actionPools(cfg config.ConsumerConfig, prefetchCount int) (map[string]chan struct{}, error) {
+	if len(cfg.ActionConcurrency) == 0 {
+		return nil, nil
+	}
+
+	if cfg.Ordering == config.OrderingStrict {
+		return nil, errors.New("consumer.action_concurrency can't be combined with consumer.ordering=strict")
+	}
+
+	slots := defaultActionConcurrency
+	pools := make(map[string]chan struct{}, len(cfg.ActionConcurrency))
+	for action, concurrency := range cfg.ActionConcurrency {
+		if concurrency <= 0 {
+			return nil, fmt.Errorf("invalid consumer.action_concurrency %d for action %q, expected a positive number", concurrency, action)
+		}
+		pools[action] = make(chan struct{}, concurrency)
+		slots += concurrency
+	}
+
+	if prefetchCount > 0 && prefetchCount < slots {
+		return nil, fmt.Errorf("rabbitmq.prefetch_count %d is lower than the %d messages consumer.action_concurrency processes at once", prefetchCount, slots)
+	}
+
+	return pools, nil
 }
 
-// Shutdown stops the consumer worker
-// This method demonstrates how to stop a consumer worker with dependency injection.
-func (w *ConsumerWorker) Shutdown() error {
+// dispatch handles a delivery in its own goroutine, once a slot of its action's pool is free
+// The consume loop never waits for a pool, so a busy action can't hold back the others.
+// Deliveries waiting for a slot are bounded by the prefetch count only: each one is an
+// unacknowledged message held in memory.
+func (w *ConsumerWorker) dispatch(handle func(amqp091.Delivery), msg amqp091.Delivery) {
+	pool, ok := w.pools[messageEnvelope(msg.Body).Action]
+	if !ok {
+		pool = w.defaultPool
+	}
+
+	// The delivery is tracked by the consume loop already
+	go func() {
+		defer w.inflight.Done()
+
+		select {
+		case <-w.ctx.Done():
+			w.releaseOnShutdown(msg)
+			return
+		case pool <- struct{}{}:
+		}
+		defer func() { <-pool }()
+
+		handle(msg)
+		w.processed.Add(1)
+	}()
+}
+
+// Shutdown stops the consumer worker, draining the deliveries being handled
+// It stops the intake of deliveries, cancelling the consumer so that the broker stops sending them,
+// then lets the handlers in flight finish and ack, until ctx is done or consumer.shutdown_grace_period
+// elapses. Handlers still running are then aborted and their messages handed back, see releaseOnShutdown.
+func (w *ConsumerWorker) Shutdown(ctx context.Context) error {
 	w.logger.Info().Msg("Stopping consumer worker")
+
+	// Cancel under the tracking lock: no delivery is tracked afterwards, so the wait can't miss any
+	w.trackMu.Lock()
 	w.cancel()
+	w.trackMu.Unlock()
+
+	if w.rabbitMQ != nil {
+		w.cancelConsumers()
+	}
+
+	if grace := w.config.Consumer.ShutdownGracePeriod; grace > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, grace)
+		defer cancel()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		w.inflight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	w.logger.Warn().Msg("Consumer shutdown grace period elapsed, aborting the messages in flight")
+	w.abort()
+	<-drained
+
 	return nil
 }
 
+// handleDelivery processes a delivery and acknowledges, requeues or dead-letters it.
+func (w *ConsumerWorker) handleDelivery(msg amqp091.Delivery) {
+	err := w.processWithTimeout(msg)
+	if err == nil {
+		w.ack(msg)
+		return
+	}
+
+	if w.handlerCtx.Err() != nil {
+		w.releaseOnShutdown(msg)
+		return
+	}
+
+	if errors.Is(err, ErrProcessTimeout) {
+		// Retrying a slow handler would most likely time out again
+		w.logger.Error().Err(err).Msg("Message processing timed out")
+		w.deadLetter(msg, err.Error(), headerInt(msg.Headers, rabbitmq.HeaderRequeueCount)+1)
+		return
+	}
+
+	if isPermanentFailure(err) {
+		// An invalid message stays invalid, retrying it is pointless
+		w.discard(msg, err, headerInt(msg.Headers, rabbitmq.HeaderRequeueCount)+1)
+		return
+	}
+
+	if errors.Is(err, ErrRateLimited) {
+		// Back off before handing the message back to the broker
+		w.logger.Warn().Err(err).Dur("retry_delay", rateLimitRetryDelay).Msg("Message processing rate limited")
+		w.waitBeforeRetry(rateLimitRetryDelay)
+	} else {
+		w.logger.Error().Err(err).Msg("Failed to process message")
+	}
+
+	if w.ctx.Err() != nil {
+		w.releaseOnShutdown(msg)
+		return
+	}
+
+	w.retryMessage(msg, err)
+}
+
+// handleDeliveryInOrder processes a delivery in strict ordering mode
+// Failures are retried in place, so no later message can overtake the failing one.
+func (w *ConsumerWorker) handleDeliveryInOrder(msg amqp091.Delivery) {
+	maxRequeues := w.config.Consumer.MaxRequeues
+
+	for attempt := 0; ; attempt++ {
+		err := w.processWithTimeout(msg)
+		if err == nil {
+			w.ack(msg)
+			return
+		}
+
+		if w.handlerCtx.Err() != nil {
+			w.releaseOnShutdown(msg)
+			return
+		}
+
+		if errors.Is(err, ErrProcessTimeout) {
+			w.logger.Error().Err(err).Msg("Message processing timed out")
+			w.deadLetter(msg, err.Error(), attempt+1)
+			return
+		}
+
+		if isPermanentFailure(err) {
+			w.discard(msg, err, attempt+1)
+			return
+		}
+
+		if maxRequeues > 0 && attempt >= maxRequeues {
+			w.deadLetter(msg, fmt.Sprintf("max retries (%d) reached: %v", maxRequeues, err), attempt+1)
+			return
+		}
+
+		w.logger.Error().Err(err).Int("attempt", attempt+1).Msg("Failed to process message, retrying in place")
+		w.waitBeforeRetry(strictRetryDelay)
+
+		if w.ctx.Err() != nil {
+			// Hand the message back: with a single exclusive consumer it stays at the head of the queue
+			w.releaseOnShutdown(msg)
+			return
+		}
+	}
+}
+
+// ack acknowledges a processed message
+// A failed ack leaves the message unacked, so the broker redelivers it once the channel closes. In
+// transactional mode, the processed_messages record then keeps it from being processed twice.
+func (w *ConsumerWorker) ack(msg amqp091.Delivery) {
+	if err := msg.Ack(false); err != nil {
+		w.logger.Warn().Err(err).Uint64("delivery_tag", msg.DeliveryTag).Msg("Failed to ack message, it will be redelivered")
+	}
+}
+
+// isPermanentFailure reports whether a message failed in a way no retry can fix.
+func isPermanentFailure(err error) bool {
+	return errors.Is(err, ErrMalformedMessage) || errors.Is(err, ErrSchemaViolation) ||
+		errors.Is(err, ErrInvalidPayload) || errors.Is(err, repositories.ErrInvalidUserStatus) ||
+		errors.Is(err, repositories.ErrInvalidUser)
+}
+
+// discard gets rid of a message that can never be processed
+// Malformed messages are dropped with consumer.malformed_messages=drop, everything else is dead-lettered.
+func (w *ConsumerWorker) discard(msg amqp091.Delivery, cause error, attempts int) {
+	if errors.Is(cause, ErrMalformedMessage) && w.config.Consumer.MalformedMessages == config.MalformedDrop {
+		w.logger.Warn().Err(cause).Int("body_size", len(msg.Body)).Msg("Dropping malformed message")
+		_ = msg.Ack(false)
+		return
+	}
+
+	w.logger.Error().Err(cause).Msg("Message can't be processed, dead-lettering")
+	w.deadLetter(msg, cause.Error(), attempts)
+}
+
+// releaseOnShutdown hands back a message that could not be finished before shutdown
+// With consumer.requeue_on_shutdown (the default) the message is requeued for another consumer.
+// Otherwise it is nacked without requeue, leaving it to the broker's dead-letter or redelivery
+// policy: requeuing is pointless churn when the last consumer is scaling to zero.
+func (w *ConsumerWorker) releaseOnShutdown(msg amqp091.Delivery) {
+	requeue := w.config.Consumer.RequeueOnShutdown
+	w.logger.Warn().Bool("requeue", requeue).Msg("Releasing unfinished message on shutdown")
+	_ = msg.Nack(false, requeue)
+}
+
+// retryMessage requeues a failed message, or dead-letters it once consumer.max_requeues is reached
+// The requeue count travels with the message in a header, so the cap holds across consumers.
+func (w *ConsumerWorker) retryMessage(msg amqp091.Delivery, cause error) {
+	maxRequeues := w.config.Consumer.MaxRequeues
+	if maxRequeues <= 0 {
+		_ = msg.Nack(false, true)
+		return
+	}
+
+	count := headerInt(msg.Headers, rabbitmq.HeaderRequeueCount)
+	if count >= maxRequeues {
+		w.deadLetter(msg, fmt.Sprintf("max requeues (%d) reached: %v", maxRequeues, cause), count+1)
+		return
+	}
+
+	headers := amqp091.Table{rabbitmq.HeaderRequeueCount: int32(count + 1)}
+	if err := w.rabbitMQ.RequeueMessage(msg, headers); err != nil {
+		w.logger.Error().Err(err).Msg("Failed to requeue message")
+		_ = msg.Nack(false, true)
+		return
+	}
+
+	_ = msg.Ack(false)
+}
+
+// deadLetter publishes a message to the dead-letter queue and acknowledges the original.
+func (w *ConsumerWorker) deadLetter(msg amqp091.Delivery, reason string, attempts int) {
+	if err := w.rabbitMQ.PublishDeadLetter(msg, w.deadLetterHeaders(msg, reason, attempts)); err != nil {
+		w.logger.Error().Err(err).Msg("Failed to dead-letter message")
+		_ = msg.Nack(false, true)
+		return
+	}
+
+	envelope := messageEnvelope(msg.Body)
+	w.metrics.MessagesDeadLettered.WithLabelValues(envelope.Action).Inc()
+	w.logger.Warn().Str("action", envelope.Action).Str("reason", reason).Msg("Message dead-lettered")
+
+	w.recordFailure(envelope, msg, reason, attempts)
+	w.storeResult(envelope, repositories.MessageResultFailed, nil, reason)
+
+	_ = msg.Ack(false)
+}
+
+// deadLetterHeaders describes why, where and when a message was dead-lettered
+// The headers make each dead-letter queue entry self-describing for triage.
+func (w *ConsumerWorker) deadLetterHeaders(msg amqp091.Delivery, reason string, attempts int) amqp091.Table {
+	return amqp091.Table{
+		rabbitmq.HeaderDeadLetterReason:   reason,
+		rabbitmq.HeaderOriginalExchange:   msg.Exchange,
+		rabbitmq.HeaderOriginalRoutingKey: msg.RoutingKey,
+		rabbitmq.HeaderFailedConsumer:     w.id,
+		rabbitmq.HeaderDeadLetteredAt:     time.Now().UTC(),
+		rabbitmq.HeaderAttempts:           int32(attempts),
+	}
+}
+
+// recordFailure persists a dead-lettered message to the failed_messages table
+// Recording is best-effort: the message is already safe in the dead-letter queue.
+func (w *ConsumerWorker) recordFailure(envelope WorkerMessage, msg amqp091.Delivery, reason string, attempts int) {
+	failed := &repositories.FailedMessage{
+		MessageID: envelope.ID,
+		Action:    envelope.Action,
+		Body:      msg.Body,
+		Error:     reason,
+		Attempts:  attempts,
+	}
+
+	if _, err := w.failedRepo.CreateFailedMessage(w.handlerCtx, failed); err != nil {
+		w.logger.Error().Err(err).Str("message_id", envelope.ID).Msg("Failed to record failed message")
+	}
+}
+
+// storeResult persists the outcome of a message to the message_results table with consumer.store_results
+// Storing is best-effort: the message was processed or dead-lettered whatever happens here.
+// Messages without ID can't be looked up, so their outcome is not stored.
+func (w *ConsumerWorker) storeResult(message WorkerMessage, status string, result interface{}, reason string) {
+	if !w.config.Consumer.StoreResults || message.ID == "" {
+		return
+	}
+
+	stored := &repositories.MessageResult{
+		MessageID: message.ID,
+		Action:    message.Action,
+		Status:    status,
+		Error:     reason,
+	}
+
+	if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			w.logger.Error().Err(err).Str("message_id", message.ID).Msg("Failed to encode message result")
+		}
+		stored.Result = data
+	}
+
+	if err := w.resultRepo.SaveMessageResult(w.handlerCtx, stored); err != nil {
+		w.logger.Error().Err(err).Str("message_id", message.ID).Msg("Failed to store message result")
+	}
+}
+
+// waitBeforeRetry blocks for the given delay or until the worker is stopped.
+func (w *ConsumerWorker) waitBeforeRetry(delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-w.ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// processWithTimeout runs processMessage, bounded by consumer.process_timeout when set
+// The handler runs in its own goroutine so that neither the deadline nor an aborted shutdown wait
+// for a handler ignoring its context.
+func (w *ConsumerWorker) processWithTimeout(msg amqp091.Delivery) error {
+	// Carry the logger in the context so that spans down the call chain can use it
+	ctx := w.logger.WithContext(w.handlerCtx)
+
+	timeout := w.config.Consumer.ProcessTimeout
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		// A panicking handler fails its message, which is retried or dead-lettered, instead of the process
+		defer func() {
+			if r := recover(); r != nil {
+				w.logger.Error().Str("stack", string(debug.Stack())).Msg("Message handler panicked")
+				done <- fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+			}
+		}()
+
+		done <- w.processMessage(ctx, msg)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if w.handlerCtx.Err() != nil {
+			// The worker aborted the handler on shutdown, this is not a handler timeout
+			return w.handlerCtx.Err()
+		}
+		return fmt.Errorf("%w after %s", ErrProcessTimeout, timeout)
+	}
+}
+
 // processMessage processes a message from RabbitMQ
 // This method demonstrates how to process a message with dependency injection and UserRepository.
-func (w *ConsumerWorker) processMessage(msg amqp091.Delivery) error {
+func (w *ConsumerWorker) processMessage(ctx context.Context, msg amqp091.Delivery) (err error) {
+	if w.config.App.TracingEnabled {
+		// Continue the trace of the producer, if any
+		ctx = tracing.Extract(ctx, msg.Headers)
+	}
+
+	ctx, end := logger.StartSpan(ctx, "message.process")
+	defer func() { end(err) }()
+
+	start := time.Now()
+	report, err := w.process(ctx, msg, false)
+	w.metrics.MessagesProcessed.WithLabelValues(report.Action, report.Status).Inc()
+	w.metrics.MessageProcessingDuration.WithLabelValues(report.Action).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// process runs a message through the pipeline: decoding, source filtering, action dispatch, payload
+// validation and handler, reporting its outcome. A dry run handles the message without side effects:
+// handlers write through a UserRepository discarding writes, and no record nor result is stored.
+func (w *ConsumerWorker) process(ctx context.Context, msg amqp091.Delivery, dryRun bool) (ProcessReport, error) {
+	w.logBody(msg.Body)
+
 	// Deserialize message
-	var message WorkerMessage
-	if err := json.Unmarshal(msg.Body, &message); err != nil {
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+	message, err := decodeMessage(msg.Body)
+	if err != nil {
+		return ProcessReport{Status: ProcessFailed, Error: err.Error()}, err
+	}
+
+	// Messages of a binding queue all go to the handler of the binding
+	if binding, ok := w.binding(msg.ConsumerTag); ok {
+		message.Action = binding.action
+	}
+
+	// Bind the message ID to the logger of the handler and the repositories it calls
+	ctx = logger.WithCorrelationID(ctx, message.ID)
+	log := zerolog.Ctx(ctx)
+
+	report := ProcessReport{MessageID: message.ID, Action: message.Action, Source: message.Source, Status: ProcessSkipped}
+	fail := func(err error) (ProcessReport, error) {
+		report.Status = ProcessFailed
+		report.Error = err.Error()
+		return report, err
+	}
+
+	if !w.acceptsSource(message.Source) {
+		// Shared queue: the message is meant for another consumer
+		log.Debug().
+			Str("source", message.Source).
+			Msg("Skipping message from unaccepted source")
+		report.Reason = "unaccepted source"
+		return report, nil
 	}
 
-	w.logger.Info().
-		Str("message_id", message.ID).
+	log.Info().
 		Str("action", message.Action).
+		Str("source", message.Source).
+		Bool("redelivered", msg.Redelivered).
+		Int("attempt", deliveryAttempt(msg)).
+		Bool("dry_run", dryRun).
 		Msg("Processing message")
 
 	// Process message based on action
-	switch message.Action {
-	case "create_user":
-		return w.handleCreateUser(message.Payload)
+	handler, ok := w.handlers[message.Action]
+	if !ok {
+		log.Warn().Str("action", message.Action).Msg("Unknown action")
+		report.Reason = "unknown action"
+		return report, nil
+	}
+	handler = traceHandler(message.Action, handler)
+
+	if err := w.validatePayload(message.Action, message.Payload); err != nil {
+		return fail(err)
+	}
+
+	var result interface{}
+	ctx = context.WithValue(ctx, sourceContextKey{}, message.Source)
+	ctx = context.WithValue(ctx, resultContextKey{}, &result)
+
+	switch {
+	case dryRun:
+		err = handler(context.WithValue(ctx, usersContextKey{}, dryRunUserRepository{w.userRepo}), message.Payload)
+	case w.processedRepo != nil && message.ID != "":
+		// Commit the handler writes with the processed-message record, before the message is acked
+		err = w.processedRepo.ProcessOnce(ctx, message.ID, message.Action, func(ctx context.Context, users repositories.UserRepository) error {
+			return handler(context.WithValue(ctx, usersContextKey{}, users), message.Payload)
+		})
+		if errors.Is(err, repositories.ErrMessageAlreadyProcessed) {
+			// A redelivery of a committed message, e.g. after a failed ack
+			log.Info().Msg("Skipping already processed message")
+			report.Reason = "already processed"
+			return report, nil
+		}
+	case w.processedRepo != nil:
+		// Without an ID there is nothing to record, so a redelivery would be processed again
+		log.Warn().Str("action", message.Action).Msg("Processing message without ID, it can't be deduplicated")
+		err = handler(ctx, message.Payload)
 	default:
-		w.logger.Warn().Str("action", message.Action).Msg("Unknown action")
-		return nil
+		err = handler(ctx, message.Payload)
+	}
+
+	if errors.Is(err, repositories.ErrDuplicateEmail) {
+		// The user exists already, e.g. two messages created the same one: requeuing would fail forever
+		log.Warn().Err(err).Msg("Skipping message writing a duplicate email")
+		report.Reason = "duplicate email"
+		return report, nil
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	report.Status = ProcessSucceeded
+	report.Result = result
+	if !dryRun {
+		w.storeResult(message, repositories.MessageResultSucceeded, result, "")
+	}
+
+	return report, nil
+}
+
+// traceHandler wraps a handler in a span named after its action, parent of the spans of the repositories it calls.
+func traceHandler(action string, handler MessageHandler) MessageHandler {
+	return func(ctx context.Context, payload json.RawMessage) (err error) {
+		ctx, end := logger.StartSpan(ctx, "message."+action)
+		defer func() { end(err) }()
+
+		return handler(ctx, payload)
+	}
+}
+
+// logBody logs the message body at debug level with consumer.log_body, truncated and redacted.
+func (w *ConsumerWorker) logBody(body []byte) {
+	event := w.logger.Debug()
+	if !w.config.Consumer.LogBody || !event.Enabled() {
+		event.Discard()
+		return
+	}
+
+	logged, truncated := loggableBody(body, w.config.Consumer.LogBodyMaxBytes, w.config.Consumer.LogBodyRedact)
+	event.Str("body", logged).
+		Int("body_size", len(body)).
+		Bool("body_truncated", truncated).
+		Msg("Message body")
+}
+
+// binding returns the binding whose queue the consumer with the given tag consumes.
+func (w *ConsumerWorker) binding(consumerTag string) (boundQueue, bool) {
+	for _, binding := range w.bindings {
+		if consumerTag != "" && binding.tag == consumerTag {
+			return binding, true
+		}
+	}
+
+	return boundQueue{}, false
+}
+
+// acceptsSource reports whether messages from the given source are processed
+// Every source is accepted when consumer.accept_sources is empty.
+func (w *ConsumerWorker) acceptsSource(source string) bool {
+	accepted := w.config.Consumer.AcceptSources
+	if len(accepted) == 0 {
+		return true
+	}
+
+	return slices.Contains(accepted, source)
+}
+
+// users returns the UserRepository handlers write through
+// In transactional mode, it is scoped to the transaction of the message being handled.
+func (w *ConsumerWorker) users(ctx context.Context) repositories.UserRepository {
+	if users, ok := ctx.Value(usersContextKey{}).(repositories.UserRepository); ok {
+		return users
 	}
+
+	return w.userRepo
 }
 
 // handleCreateUser handles the create user action
 // This method demonstrates how to use UserRepository with dependency injection.
-func (w *ConsumerWorker) handleCreateUser(payload interface{}) error {
-	userPayload, ok := payload.(map[string]interface{})
-	if !ok {
-		return errors.New("invalid payload type")
+func (w *ConsumerWorker) handleCreateUser(ctx context.Context, payload json.RawMessage) error {
+	var userPayload UserPayload
+	if err := decodePayload(payload, &userPayload); err != nil {
+		return err
 	}
 
-	name, ok := userPayload["name"].(string)
-	if !ok {
-		return errors.New("name not found in payload")
+	var missing []string
+	if userPayload.Name == "" {
+		missing = append(missing, "name")
 	}
-
-	email, ok := userPayload["email"].(string)
-	if !ok {
-		return errors.New("email not found in payload")
+	if userPayload.Email == "" {
+		missing = append(missing, "email")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrInvalidPayload, strings.Join(missing, ", "))
 	}
 
-	// Create user using UserRepository
+	// Create user using UserRepository, profile fields are optional and the status defaults to active
 	user := &repositories.User{
-		Name:  name,
-		Email: email,
+		Name:      userPayload.Name,
+		Email:     userPayload.Email,
+		FirstName: userPayload.FirstName,
+		LastName:  userPayload.LastName,
+		Status:    repositories.UserStatus(userPayload.Status),
+	}
+
+	if w.createLimiter != nil && !w.createLimiter.Allow() {
+		return ErrRateLimited
 	}
 
-	createdUser, err := w.userRepo.CreateUser(w.ctx, user)
+	createdUser, err := w.users(ctx).CreateUser(ctx, user)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 
-	w.logger.Info().
+	zerolog.Ctx(ctx).Info().
 		Int64("user_id", createdUser.ID).
 		Str("user_name", createdUser.Name).
 		Str("user_email", createdUser.Email).
+		Str("user_status", string(createdUser.Status)).
 		Msg("Created user from message")
 
+	SetMessageResult(ctx, map[string]int64{"user_id": createdUser.ID})
+
 	return nil
 }
+
+// decodePayload decodes a payload into the type of its action, reporting a missing or mistyped payload as ErrInvalidPayload.
+func decodePayload(payload json.RawMessage, v any) error {
+	if len(payload) == 0 || string(payload) == "null" {
+		return fmt.Errorf("%w: missing payload", ErrInvalidPayload)
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+
+	return nil
+}
+
+// decodeMessage deserializes a message body
+// Decoding errors are permanent: an empty body, a syntax error or a body of the wrong shape
+// won't decode any better on the next attempt, so they are reported as ErrMalformedMessage.
+func decodeMessage(body []byte) (WorkerMessage, error) {
+	var message WorkerMessage
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return message, fmt.Errorf("%w: empty body", ErrMalformedMessage)
+	}
+
+	if err := json.Unmarshal(body, &message); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return message, fmt.Errorf("%w: invalid JSON at offset %d: %w", ErrMalformedMessage, syntaxErr.Offset, err)
+		}
+		return message, fmt.Errorf("%w: %w", ErrMalformedMessage, err)
+	}
+
+	return message, nil
+}
+
+// messageEnvelope decodes a raw message body on a best-effort basis, for labelling and auditing purposes
+// The action defaults to "unknown" when the body cannot be decoded.
+func messageEnvelope(body []byte) WorkerMessage {
+	var message WorkerMessage
+	if err := json.Unmarshal(body, &message); err != nil || message.Action == "" {
+		message.Action = "unknown"
+	}
+
+	return message
+}
+
+// consumerID identifies this consumer process in dead-letter headers.
+func consumerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// deliveryAttempt tells which processing attempt a delivery is, starting at 1
+// Previous attempts are counted from the consumer requeue header and the broker x-death
+// header. A redelivered message without either was requeued in place, so it is at least
+// a second attempt.
+func deliveryAttempt(msg amqp091.Delivery) int {
+	attempt := 1 + headerInt(msg.Headers, rabbitmq.HeaderRequeueCount) + deathCount(msg.Headers)
+	if msg.Redelivered && attempt < 2 {
+		attempt = 2
+	}
+
+	return attempt
+}
+
+// deathCount sums the counts of the x-death header, which the broker maintains each time
+// a message is dead-lettered through a queue.
+func deathCount(headers amqp091.Table) int {
+	deaths, ok := headers["x-death"].([]interface{})
+	if !ok {
+		return 0
+	}
+
+	count := 0
+	for _, death := range deaths {
+		if table, ok := death.(amqp091.Table); ok {
+			count += headerInt(table, "count")
+		}
+	}
+
+	return count
+}
+
+// headerInt reads an integer AMQP header, returning 0 when missing or of an unexpected type.
+func headerInt(headers amqp091.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
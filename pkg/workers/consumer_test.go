@@ -0,0 +1,1248 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/metrics"
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+	"github.com/samber/do-template-worker/pkg/rabbitmq/rabbitmqtest"
+	"github.com/samber/do-template-worker/pkg/repositories"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestConsumerWorker builds a consumer worker with the given handlers and no broker.
+func newTestConsumerWorker(t *testing.T, cfg *config.Config, handlers map[string]MessageHandler) *ConsumerWorker {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	handlerCtx, abort := context.WithCancel(context.Background())
+	t.Cleanup(abort)
+
+	logger := zerolog.Nop()
+	m, _ := metrics.NewMetrics(nil)
+
+	return &ConsumerWorker{
+		logger:     &logger,
+		metrics:    m,
+		config:     cfg,
+		handlers:   handlers,
+		ctx:        ctx,
+		cancel:     cancel,
+		handlerCtx: handlerCtx,
+		abort:      abort,
+	}
+}
+
+// fakeAcknowledger records the acknowledgements of test deliveries.
+type fakeAcknowledger struct {
+	mu       sync.Mutex
+	acks     []uint64
+	nacks    []uint64
+	requeues []bool
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acks = append(a.acks, tag)
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.nacks = append(a.nacks, tag)
+	a.requeues = append(a.requeues, requeue)
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// newTestDelivery builds a delivery for the given action, using the message ID as payload.
+func newTestDelivery(ack amqp091.Acknowledger, tag uint64, action, id string) amqp091.Delivery {
+	return amqp091.Delivery{
+		Acknowledger: ack,
+		DeliveryTag:  tag,
+		Body:         []byte(fmt.Sprintf(`{"action":%q,"id":%q,"payload":%q}`, action, id, id)),
+	}
+}
+
+func TestConsumerWorkerStrictOrdering(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		processed []string
+		failed    bool
+	)
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{Ordering: config.OrderingStrict}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"record": func(ctx context.Context, payload json.RawMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			var id string
+			_ = json.Unmarshal(payload, &id)
+			processed = append(processed, id)
+
+			// Fail the first message once: it must be retried before the next ones
+			if id == "msg_1" && !failed {
+				failed = true
+				return errors.New("transient failure")
+			}
+			return nil
+		},
+	})
+
+	ack := &fakeAcknowledger{}
+	msgChan := make(chan amqp091.Delivery, 3)
+	msgChan <- newTestDelivery(ack, 1, "record", "msg_1")
+	msgChan <- newTestDelivery(ack, 2, "record", "msg_2")
+	msgChan <- newTestDelivery(ack, 3, "record", "msg_3")
+	close(msgChan)
+
+	if err := w.consume(msgChan); !errors.Is(err, errMessageChannelClosed) {
+		t.Fatalf("expected the closed channel to be reported, got %v", err)
+	}
+
+	expected := []string{"msg_1", "msg_1", "msg_2", "msg_3"}
+	if fmt.Sprint(processed) != fmt.Sprint(expected) {
+		t.Fatalf("expected processing order %v, got %v", expected, processed)
+	}
+	if fmt.Sprint(ack.acks) != fmt.Sprint([]uint64{1, 2, 3}) {
+		t.Fatalf("expected acks in order [1 2 3], got %v", ack.acks)
+	}
+	if len(ack.nacks) != 0 {
+		t.Fatalf("expected no nacks, got %v", ack.nacks)
+	}
+}
+
+func TestConsumerWorkerProcessTimeout(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{ProcessTimeout: 50 * time.Millisecond}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"slow": func(ctx context.Context, payload json.RawMessage) error {
+			// Deliberately ignore the context to make sure the deadline is still enforced
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	start := time.Now()
+	err := w.processWithTimeout(amqp091.Delivery{Body: []byte(`{"action":"slow","id":"msg_1"}`)})
+
+	if !errors.Is(err, ErrProcessTimeout) {
+		t.Fatalf("expected ErrProcessTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected processing to be interrupted quickly, took %s", elapsed)
+	}
+}
+
+func TestConsumerWorkerProcessWithinTimeout(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{ProcessTimeout: time.Second}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"fast": func(ctx context.Context, payload json.RawMessage) error {
+			return nil
+		},
+	})
+
+	if err := w.processWithTimeout(amqp091.Delivery{Body: []byte(`{"action":"fast","id":"msg_1"}`)}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestConsumerWorkerProcessingMetrics(t *testing.T) {
+	t.Parallel()
+
+	w := newTestConsumerWorker(t, &config.Config{}, map[string]MessageHandler{
+		"fast": func(ctx context.Context, payload json.RawMessage) error {
+			return nil
+		},
+		"broken": func(ctx context.Context, payload json.RawMessage) error {
+			return errors.New("boom")
+		},
+	})
+
+	_ = w.processWithTimeout(amqp091.Delivery{Body: []byte(`{"action":"fast","id":"msg_1"}`)})
+	_ = w.processWithTimeout(amqp091.Delivery{Body: []byte(`{"action":"fast","id":"msg_2"}`)})
+	_ = w.processWithTimeout(amqp091.Delivery{Body: []byte(`{"action":"broken","id":"msg_3"}`)})
+
+	if got := testutil.ToFloat64(w.metrics.MessagesProcessed.WithLabelValues("fast", ProcessSucceeded)); got != 2 {
+		t.Fatalf("expected 2 succeeded fast messages, got %v", got)
+	}
+	if got := testutil.ToFloat64(w.metrics.MessagesProcessed.WithLabelValues("broken", ProcessFailed)); got != 1 {
+		t.Fatalf("expected 1 failed broken message, got %v", got)
+	}
+	if got := testutil.CollectAndCount(w.metrics.MessageProcessingDuration, "message_processing_duration_seconds"); got != 2 {
+		t.Fatalf("expected a duration histogram per action, got %d", got)
+	}
+}
+
+// enableTracing installs a recording tracer provider and the W3C propagator, as tracing.NewTracing does.
+// They are global and left installed, which only gets the spans of the other tests recorded too.
+func enableTracing(t *testing.T) {
+	t.Helper()
+
+	tracingOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+}
+
+var tracingOnce sync.Once
+
+func TestConsumerWorkerContinuesTrace(t *testing.T) {
+	t.Parallel()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	enableTracing(t)
+
+	var spanContext trace.SpanContext
+	cfg := &config.Config{App: config.AppConfig{TracingEnabled: true}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"traced": func(ctx context.Context, payload json.RawMessage) error {
+			spanContext = trace.SpanContextFromContext(ctx)
+			return nil
+		},
+	})
+
+	err := w.processWithTimeout(amqp091.Delivery{
+		Headers: amqp091.Table{"traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"},
+		Body:    []byte(`{"action":"traced","id":"msg_1"}`),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The handler runs in the span named after its action, within the trace of the producer
+	if spanContext.TraceID().String() != traceID || spanContext.SpanID().String() == "00f067aa0ba902b7" || spanContext.IsRemote() {
+		t.Fatalf("expected the handler to run in a child span of the producer trace, got %v", spanContext)
+	}
+}
+
+func TestConsumerWorkerReleaseOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	for _, requeue := range []bool{true, false} {
+		cfg := &config.Config{Consumer: config.ConsumerConfig{RequeueOnShutdown: requeue}}
+		w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+			"interrupted": func(ctx context.Context, payload json.RawMessage) error {
+				return errors.New("interrupted by shutdown")
+			},
+		})
+		w.cancel()
+
+		ack := &fakeAcknowledger{}
+		w.handleDelivery(newTestDelivery(ack, 1, "interrupted", "msg_1"))
+
+		if len(ack.acks) != 0 || fmt.Sprint(ack.requeues) != fmt.Sprint([]bool{requeue}) {
+			t.Fatalf("requeue_on_shutdown=%v: expected a single nack with requeue=%v, got acks %v, requeues %v",
+				requeue, requeue, ack.acks, ack.requeues)
+		}
+	}
+}
+
+func TestConsumerWorkerDeadLetterHeaders(t *testing.T) {
+	t.Parallel()
+
+	w := newTestConsumerWorker(t, &config.Config{}, nil)
+	w.id = "worker-1"
+
+	msg := newTestDelivery(&fakeAcknowledger{}, 1, "create_user", "msg_1")
+	msg.Exchange = "worker_exchange"
+	msg.RoutingKey = "worker_queue"
+
+	headers := w.deadLetterHeaders(msg, "max requeues (3) reached: boom", 4)
+
+	expected := amqp091.Table{
+		rabbitmq.HeaderDeadLetterReason:   "max requeues (3) reached: boom",
+		rabbitmq.HeaderOriginalExchange:   "worker_exchange",
+		rabbitmq.HeaderOriginalRoutingKey: "worker_queue",
+		rabbitmq.HeaderFailedConsumer:     "worker-1",
+		rabbitmq.HeaderAttempts:           int32(4),
+	}
+	for key, value := range expected {
+		if headers[key] != value {
+			t.Fatalf("expected header %s=%v, got %v", key, value, headers[key])
+		}
+	}
+
+	if at, ok := headers[rabbitmq.HeaderDeadLetteredAt].(time.Time); !ok || time.Since(at) > time.Minute {
+		t.Fatalf("expected a recent %s header, got %v", rabbitmq.HeaderDeadLetteredAt, headers[rabbitmq.HeaderDeadLetteredAt])
+	}
+
+	// Headers must be valid AMQP field values to be published
+	if err := headers.Validate(); err != nil {
+		t.Fatalf("expected valid AMQP headers, got %v", err)
+	}
+}
+
+func TestConsumerWorkerSchemaValidation(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "create_user.json")
+	schema := `{"type":"object","required":["name","email"],"properties":{"email":{"type":"string","minLength":3}}}`
+	if err := os.WriteFile(path, []byte(schema), 0o600); err != nil {
+		t.Fatalf("failed to write schema: %v", err)
+	}
+
+	schemas, err := compileSchemas(map[string]string{"create_user": path})
+	if err != nil {
+		t.Fatalf("expected schema to compile, got %v", err)
+	}
+
+	var calls int
+	w := newTestConsumerWorker(t, &config.Config{}, map[string]MessageHandler{
+		"create_user": func(ctx context.Context, payload json.RawMessage) error {
+			calls++
+			return nil
+		},
+	})
+	w.schemas = schemas
+
+	valid := amqp091.Delivery{Body: []byte(`{"action":"create_user","id":"msg_1","payload":{"name":"John","email":"john@example.com"}}`)}
+	if err := w.processWithTimeout(valid); err != nil {
+		t.Fatalf("expected valid payload to be processed, got %v", err)
+	}
+
+	invalid := amqp091.Delivery{Body: []byte(`{"action":"create_user","id":"msg_2","payload":{"name":"John"}}`)}
+	if err := w.processWithTimeout(invalid); !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("expected ErrSchemaViolation, got %v", err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected the handler to be called for the valid payload only, got %d calls", calls)
+	}
+
+	if _, err := compileSchemas(map[string]string{"create_user": filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Fatal("expected a missing schema file to fail compilation")
+	}
+}
+
+func TestConsumerWorkerAcceptSources(t *testing.T) {
+	t.Parallel()
+
+	var sources []string
+	cfg := &config.Config{Consumer: config.ConsumerConfig{AcceptSources: []string{"billing"}}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"record": func(ctx context.Context, payload json.RawMessage) error {
+			sources = append(sources, MessageSource(ctx))
+			return nil
+		},
+	})
+
+	for _, source := range []string{"billing", "shipping", ""} {
+		msg := amqp091.Delivery{Body: []byte(fmt.Sprintf(`{"action":"record","id":"msg_1","source":%q}`, source))}
+		if err := w.processWithTimeout(msg); err != nil {
+			t.Fatalf("source %q: expected no error, got %v", source, err)
+		}
+	}
+
+	if fmt.Sprint(sources) != fmt.Sprint([]string{"billing"}) {
+		t.Fatalf("expected only the billing message to be handled, got sources %v", sources)
+	}
+}
+
+func TestConsumerWorkerMalformedMessages(t *testing.T) {
+	t.Parallel()
+
+	bodies := map[string]string{
+		"empty body":     "",
+		"blank body":     "  \n",
+		"truncated JSON": `{"action":"record","id":"msg_1"`,
+		"non-JSON":       "plain text",
+		"wrong shape":    `["record"]`,
+	}
+
+	for name, body := range bodies {
+		w := newTestConsumerWorker(t, &config.Config{}, map[string]MessageHandler{
+			"record": func(ctx context.Context, payload json.RawMessage) error {
+				t.Fatalf("%s: handler must not be called", name)
+				return nil
+			},
+		})
+
+		err := w.processWithTimeout(amqp091.Delivery{Body: []byte(body)})
+		if !errors.Is(err, ErrMalformedMessage) || !isPermanentFailure(err) {
+			t.Fatalf("%s: expected a permanent ErrMalformedMessage, got %v", name, err)
+		}
+	}
+}
+
+func TestConsumerWorkerDropsMalformedMessages(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{MalformedMessages: config.MalformedDrop, MaxRequeues: 3}}
+	w := newTestConsumerWorker(t, cfg, nil)
+
+	ack := &fakeAcknowledger{}
+	w.handleDelivery(amqp091.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte("{not json")})
+
+	if fmt.Sprint(ack.acks) != fmt.Sprint([]uint64{1}) || len(ack.nacks) != 0 {
+		t.Fatalf("expected the malformed message to be acked and never requeued, got acks %v, nacks %v", ack.acks, ack.nacks)
+	}
+}
+
+func TestLoggableBody(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"action":"create_user","payload":{"name":"Zoé","Email":"zoe@example.com","tags":[{"password":"secret"}]}}`)
+
+	logged, truncated := loggableBody(body, 0, []string{"email", "password"})
+	expected := `{"action":"create_user","payload":{"Email":"[REDACTED]","name":"Zoé","tags":[{"password":"[REDACTED]"}]}}`
+	if logged != expected || truncated {
+		t.Fatalf("expected redacted body %s, got %s (truncated: %t)", expected, logged, truncated)
+	}
+
+	// Truncation never splits a character: "é" takes two bytes
+	logged, truncated = loggableBody(body, 67, []string{"email"})
+	if logged != `{"action":"create_user","payload":{"Email":"[REDACTED]","name":"Zo` || !truncated {
+		t.Fatalf("expected a body truncated before the split character, got %s (truncated: %t)", logged, truncated)
+	}
+
+	// A body that can't be parsed can't be redacted either
+	if logged, _ := loggableBody([]byte(`{"email":"zoe@example.com"`), 0, []string{"email"}); logged != "" {
+		t.Fatalf("expected an invalid body to be omitted, got %s", logged)
+	}
+	if logged, truncated := loggableBody([]byte("not json"), 3, nil); logged != "not" || !truncated {
+		t.Fatalf("expected an unredacted body to be truncated as is, got %s (truncated: %t)", logged, truncated)
+	}
+}
+
+func TestDeliveryAttempt(t *testing.T) {
+	t.Parallel()
+
+	deliveries := map[string]struct {
+		msg      amqp091.Delivery
+		expected int
+	}{
+		"first delivery":     {msg: amqp091.Delivery{}, expected: 1},
+		"requeued in place":  {msg: amqp091.Delivery{Redelivered: true}, expected: 2},
+		"requeued by worker": {msg: amqp091.Delivery{Headers: amqp091.Table{rabbitmq.HeaderRequeueCount: int32(2)}}, expected: 3},
+		"dead-lettered by broker": {
+			msg: amqp091.Delivery{Headers: amqp091.Table{"x-death": []interface{}{
+				amqp091.Table{"queue": "worker_queue", "count": int64(2)},
+				amqp091.Table{"queue": "worker_queue.retry", "count": int64(1)},
+			}}},
+			expected: 4,
+		},
+	}
+
+	for name, tt := range deliveries {
+		if got := deliveryAttempt(tt.msg); got != tt.expected {
+			t.Fatalf("%s: expected attempt %d, got %d", name, tt.expected, got)
+		}
+	}
+}
+
+// fakeMessageResultRepository records the saved message results.
+type fakeMessageResultRepository struct {
+	repositories.MessageResultRepository
+	saved []*repositories.MessageResult
+}
+
+func (r *fakeMessageResultRepository) SaveMessageResult(ctx context.Context, result *repositories.MessageResult) error {
+	r.saved = append(r.saved, result)
+	return nil
+}
+
+func TestConsumerWorkerStoresResults(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]MessageHandler{
+		"record": func(ctx context.Context, payload json.RawMessage) error {
+			SetMessageResult(ctx, map[string]interface{}{"record_id": payload})
+			return nil
+		},
+	}
+
+	for _, storeResults := range []bool{true, false} {
+		cfg := &config.Config{Consumer: config.ConsumerConfig{StoreResults: storeResults}}
+		w := newTestConsumerWorker(t, cfg, handlers)
+		repo := &fakeMessageResultRepository{}
+		w.resultRepo = repo
+
+		if err := w.processWithTimeout(newTestDelivery(nil, 1, "record", "msg_1")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !storeResults {
+			if len(repo.saved) != 0 {
+				t.Fatalf("expected no stored result without consumer.store_results, got %d", len(repo.saved))
+			}
+			continue
+		}
+
+		if len(repo.saved) != 1 {
+			t.Fatalf("expected one stored result, got %d", len(repo.saved))
+		}
+		saved := repo.saved[0]
+		if saved.MessageID != "msg_1" || saved.Status != repositories.MessageResultSucceeded || string(saved.Result) != `{"record_id":"msg_1"}` {
+			t.Fatalf("unexpected stored result: %+v (result %s)", saved, saved.Result)
+		}
+	}
+}
+
+// fakeProcessedMessageRepository mimics the processed_messages transaction: users created by a
+// handler are only committed, along with the message ID, when the handler succeeds.
+type fakeProcessedMessageRepository struct {
+	processed map[string]bool
+	users     []*repositories.User
+}
+
+func (r *fakeProcessedMessageRepository) ProcessOnce(ctx context.Context, messageID, action string, fn func(ctx context.Context, users repositories.UserRepository) error) error {
+	if r.processed[messageID] {
+		return repositories.ErrMessageAlreadyProcessed
+	}
+
+	tx := &fakeUserRepository{}
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+
+	r.processed[messageID] = true
+	r.users = append(r.users, tx.created...)
+	return nil
+}
+
+func (r *fakeProcessedMessageRepository) DeleteProcessedMessagesBefore(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// fakeUserRepository records the users it creates.
+type fakeUserRepository struct {
+	repositories.UserRepository
+	created []*repositories.User
+	err     error
+}
+
+func (r *fakeUserRepository) CreateUser(ctx context.Context, user *repositories.User) (*repositories.User, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	user.ID = int64(len(r.created) + 1)
+	r.created = append(r.created, user)
+	return user, nil
+}
+
+// failingAcknowledger fails the first acks, as when the channel is lost right after processing.
+type failingAcknowledger struct {
+	fakeAcknowledger
+	failures int
+}
+
+func (a *failingAcknowledger) Ack(tag uint64, multiple bool) error {
+	if a.failures > 0 {
+		a.failures--
+		return amqp091.ErrClosed
+	}
+	return a.fakeAcknowledger.Ack(tag, multiple)
+}
+
+func TestHandleCreateUserDecodesPayload(t *testing.T) {
+	t.Parallel()
+
+	w := newTestConsumerWorker(t, &config.Config{}, nil)
+	users := &fakeUserRepository{}
+	w.userRepo = users
+
+	payload := json.RawMessage(`{"name":"Alice","email":"alice@example.com","first_name":"Alice","status":"inactive"}`)
+	if err := w.handleCreateUser(context.Background(), payload); err != nil {
+		t.Fatalf("expected the user to be created, got %v", err)
+	}
+	if len(users.created) != 1 || users.created[0].FirstName != "Alice" || users.created[0].Status != repositories.UserStatusInactive {
+		t.Fatalf("unexpected created users: %+v", users.created)
+	}
+
+	invalid := map[string]string{
+		`{"name":"Alice"}`:           "missing email",
+		`{}`:                         "missing name, email",
+		`null`:                       "missing payload",
+		`{"name":1,"email":"a@b.c"}`: "cannot unmarshal number",
+		`"alice@example.com"`:        "cannot unmarshal string",
+	}
+	for payload, want := range invalid {
+		err := w.handleCreateUser(context.Background(), json.RawMessage(payload))
+		if !errors.Is(err, ErrInvalidPayload) || !isPermanentFailure(err) || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected a permanent invalid payload error mentioning %q, got %v", payload, want, err)
+		}
+	}
+	if len(users.created) != 1 {
+		t.Fatalf("expected invalid payloads to create no user, got %d users", len(users.created))
+	}
+
+	// The repository rejects invalid users, which no retry can fix
+	w.userRepo = &fakeUserRepository{err: fmt.Errorf("%w: malformed email", repositories.ErrInvalidUser)}
+	if err := w.handleCreateUser(context.Background(), json.RawMessage(`{"name":"Bob","email":"not an email"}`)); !isPermanentFailure(err) {
+		t.Fatalf("expected an invalid user to be a permanent failure, got %v", err)
+	}
+}
+
+func TestHandleCreateUserRateLimit(t *testing.T) {
+	t.Parallel()
+
+	w := newTestConsumerWorker(t, &config.Config{}, nil)
+	users := &fakeUserRepository{}
+	w.userRepo = users
+	w.createLimiter = newCreateLimiter(1)
+
+	payload := json.RawMessage(`{"name":"Alice","email":"alice@example.com"}`)
+	if err := w.handleCreateUser(context.Background(), payload); err != nil {
+		t.Fatalf("expected the first user to be created, got %v", err)
+	}
+	if err := w.handleCreateUser(context.Background(), payload); !errors.Is(err, ErrRateLimited) || isPermanentFailure(err) {
+		t.Fatalf("expected a retryable ErrRateLimited once the limit is exhausted, got %v", err)
+	}
+
+	// Invalid payloads are rejected before taking a token
+	if err := w.handleCreateUser(context.Background(), json.RawMessage(`{}`)); !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("expected an invalid payload error, got %v", err)
+	}
+	if len(users.created) != 1 {
+		t.Fatalf("expected rate limited messages to create no user, got %d users", len(users.created))
+	}
+
+	if newCreateLimiter(0) != nil {
+		t.Fatal("expected no limiter without user.create_rate_limit")
+	}
+}
+
+func TestConsumerWorkerRequeuesRateLimitedMessages(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{MaxRequeues: 3}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"create_user": func(ctx context.Context, payload json.RawMessage) error { return ErrRateLimited },
+	})
+	broker := &fakeBroker{}
+	w.rabbitMQ = broker
+
+	ack := &fakeAcknowledger{}
+	start := time.Now()
+	w.handleDelivery(newTestDelivery(ack, 1, "create_user", "msg_1"))
+
+	if elapsed := time.Since(start); elapsed < rateLimitRetryDelay {
+		t.Fatalf("expected the consumer to wait %s before requeueing, waited %s", rateLimitRetryDelay, elapsed)
+	}
+	if len(broker.requeued) != 1 || broker.requeued[0][rabbitmq.HeaderRequeueCount] != int32(1) {
+		t.Fatalf("expected the message to be requeued once with its count, got %v", broker.requeued)
+	}
+	if fmt.Sprint(ack.acks) != fmt.Sprint([]uint64{1}) {
+		t.Fatalf("expected the original delivery to be acked once requeued, got %v", ack.acks)
+	}
+}
+
+func TestConsumerWorkerTransactionalAckFailure(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{Transactional: true}}
+	w := newTestConsumerWorker(t, cfg, nil)
+	w.handlers = map[string]MessageHandler{"create_user": w.handleCreateUser}
+	// Writes outside of the message transaction would land here
+	w.userRepo = &fakeUserRepository{err: errors.New("unexpected write outside of the transaction")}
+	repo := &fakeProcessedMessageRepository{processed: map[string]bool{}}
+	w.processedRepo = repo
+
+	body := []byte(`{"action":"create_user","id":"msg_1","payload":{"name":"Alice","email":"alice@example.com"}}`)
+
+	// The user is committed, but the ack is lost: the broker redelivers the message
+	ack := &failingAcknowledger{failures: 1}
+	w.handleDelivery(amqp091.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: body})
+	if len(ack.acks) != 0 || len(ack.nacks) != 0 {
+		t.Fatalf("expected the message to be left unacked, got acks %v and nacks %v", ack.acks, ack.nacks)
+	}
+	if len(repo.users) != 1 || !repo.processed["msg_1"] {
+		t.Fatalf("expected the user and the processed message to be committed, got %d users", len(repo.users))
+	}
+
+	// The redelivery is acked without creating the user again
+	w.handleDelivery(amqp091.Delivery{Acknowledger: ack, DeliveryTag: 2, Body: body, Redelivered: true})
+	if fmt.Sprint(ack.acks) != fmt.Sprint([]uint64{2}) {
+		t.Fatalf("expected the redelivery to be acked, got acks %v and nacks %v", ack.acks, ack.nacks)
+	}
+	if len(repo.users) != 1 {
+		t.Fatalf("expected a single user, got %d", len(repo.users))
+	}
+}
+
+func TestConsumerWorkerTransactionalWithoutID(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{Transactional: true}}
+	w := newTestConsumerWorker(t, cfg, nil)
+	w.handlers = map[string]MessageHandler{"create_user": w.handleCreateUser}
+	users := &fakeUserRepository{}
+	w.userRepo = users
+	repo := &fakeProcessedMessageRepository{processed: map[string]bool{}}
+	w.processedRepo = repo
+
+	// Without an ID there is nothing to record: the message is processed outside of a transaction
+	body := []byte(`{"action":"create_user","payload":{"name":"Alice","email":"alice@example.com"}}`)
+	report, err := w.Process(context.Background(), body, false)
+	if err != nil || report.Status != ProcessSucceeded {
+		t.Fatalf("expected the message to be processed, got %+v, %v", report, err)
+	}
+	if len(users.created) != 1 || len(repo.processed) != 0 {
+		t.Fatalf("expected the user to be created without a processed record, got %d users and %d records", len(users.created), len(repo.processed))
+	}
+}
+
+func TestConsumerWorkerTransactionalRollback(t *testing.T) {
+	t.Parallel()
+
+	failure := errors.New("database unavailable")
+	cfg := &config.Config{Consumer: config.ConsumerConfig{Transactional: true}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"record": func(ctx context.Context, payload json.RawMessage) error {
+			return failure
+		},
+	})
+	repo := &fakeProcessedMessageRepository{processed: map[string]bool{}}
+	w.processedRepo = repo
+
+	// A failed handler records nothing, so that the retried message is processed
+	if err := w.processWithTimeout(newTestDelivery(nil, 1, "record", "msg_1")); !errors.Is(err, failure) {
+		t.Fatalf("expected the handler error, got %v", err)
+	}
+	if repo.processed["msg_1"] {
+		t.Fatal("expected a failed message not to be recorded as processed")
+	}
+}
+
+func TestConsumerWorkerProcess(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{StoreResults: true}}
+	w := newTestConsumerWorker(t, cfg, nil)
+	w.handlers = map[string]MessageHandler{"create_user": w.handleCreateUser}
+	users := &fakeUserRepository{}
+	w.userRepo = users
+	results := &fakeMessageResultRepository{}
+	w.resultRepo = results
+
+	body := []byte(`{"action":"create_user","id":"msg_1","payload":{"name":"Alice","email":"alice@example.com"}}`)
+
+	// A dry run goes through the handler without writing anything
+	report, err := w.Process(context.Background(), body, true)
+	if err != nil || report.Status != ProcessSucceeded || !report.DryRun {
+		t.Fatalf("expected a successful dry run, got %+v, %v", report, err)
+	}
+	if len(users.created) != 0 || len(results.saved) != 0 {
+		t.Fatalf("expected no side effect, got %d users and %d results", len(users.created), len(results.saved))
+	}
+
+	report, err = w.Process(context.Background(), body, false)
+	if err != nil || report.Status != ProcessSucceeded || report.MessageID != "msg_1" {
+		t.Fatalf("expected the message to be processed, got %+v, %v", report, err)
+	}
+	if fmt.Sprint(report.Result) != "map[user_id:1]" || len(users.created) != 1 || len(results.saved) != 1 {
+		t.Fatalf("expected the user to be created and the result stored, got %+v", report)
+	}
+
+	report, err = w.Process(context.Background(), []byte(`{"action":"unknown","id":"msg_2"}`), false)
+	if err != nil || report.Status != ProcessSkipped || report.Reason != "unknown action" {
+		t.Fatalf("expected an unknown action to be skipped, got %+v, %v", report, err)
+	}
+
+	report, err = w.Process(context.Background(), []byte(`{"action":`), true)
+	if !errors.Is(err, ErrMalformedMessage) || report.Status != ProcessFailed || report.Error == "" {
+		t.Fatalf("expected a malformed message to fail, got %+v, %v", report, err)
+	}
+}
+
+func TestConsumerWorkerActionConcurrency(t *testing.T) {
+	t.Parallel()
+
+	// peakHandler records how many of its messages ran at once, waiting for up to want of them
+	peakHandler := func(want int32, peak *atomic.Int32) MessageHandler {
+		var running atomic.Int32
+		return func(ctx context.Context, payload json.RawMessage) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			for deadline := time.Now().Add(200 * time.Millisecond); running.Load() < want && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			for {
+				if p := peak.Load(); n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			return nil
+		}
+	}
+
+	var cheapPeak, otherPeak atomic.Int32
+	cfg := &config.Config{Consumer: config.ConsumerConfig{ActionConcurrency: map[string]int{"cheap": 3}}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"cheap": peakHandler(3, &cheapPeak),
+		"other": peakHandler(2, &otherPeak),
+	})
+
+	pools, err := actionPools(cfg.Consumer, 0)
+	if err != nil {
+		t.Fatalf("expected valid pools, got %v", err)
+	}
+	w.pools = pools
+	w.defaultPool = make(chan struct{}, defaultActionConcurrency)
+
+	ack := &fakeAcknowledger{}
+	msgChan := make(chan amqp091.Delivery, 5)
+	msgChan <- newTestDelivery(ack, 1, "cheap", "msg_1")
+	msgChan <- newTestDelivery(ack, 2, "cheap", "msg_2")
+	msgChan <- newTestDelivery(ack, 3, "cheap", "msg_3")
+	msgChan <- newTestDelivery(ack, 4, "other", "msg_4")
+	msgChan <- newTestDelivery(ack, 5, "other", "msg_5")
+	close(msgChan)
+
+	_ = w.consume(msgChan)
+
+	if len(ack.acks) != 5 {
+		t.Fatalf("expected every message to be acked once consume returns, got %v", ack.acks)
+	}
+	if cheapPeak.Load() != 3 {
+		t.Fatalf("expected 3 cheap messages at once, got %d", cheapPeak.Load())
+	}
+	if otherPeak.Load() != 1 {
+		t.Fatalf("expected unlisted actions to run one at a time, got %d", otherPeak.Load())
+	}
+}
+
+func TestConsumerWorkerConsumerConcurrency(t *testing.T) {
+	t.Parallel()
+
+	const concurrency = 3
+
+	var (
+		running  atomic.Int32
+		started  = make(chan struct{}, concurrency)
+		release  = make(chan struct{})
+		finished atomic.Int32
+	)
+
+	cfg := &config.Config{RabbitMQ: config.RabbitMQConfig{ConsumerConcurrency: concurrency}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"slow": func(ctx context.Context, payload json.RawMessage) error {
+			running.Add(1)
+			started <- struct{}{}
+			<-release
+			finished.Add(1)
+			return nil
+		},
+	})
+
+	ack := &fakeAcknowledger{}
+	msgChan := make(chan amqp091.Delivery, concurrency)
+	for i := range concurrency {
+		msgChan <- newTestDelivery(ack, uint64(i+1), "slow", fmt.Sprintf("msg_%d", i+1))
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- w.consume(msgChan) }()
+
+	// Every message is handled at once, by its own goroutine
+	for range concurrency {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d concurrent handlers, got %d", concurrency, running.Load())
+		}
+	}
+
+	// Shutdown waits for the handlers in flight
+	shutdown := make(chan struct{})
+	go func() {
+		_ = w.Shutdown(context.Background())
+		close(shutdown)
+	}()
+
+	select {
+	case <-shutdown:
+		t.Fatal("expected Shutdown to wait for the handlers in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-shutdown
+	if finished.Load() != concurrency {
+		t.Fatalf("expected every handler to finish before Shutdown returned, got %d", finished.Load())
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected consume to stop cleanly, got %v", err)
+	}
+	if len(ack.acks) != concurrency {
+		t.Fatalf("expected every message to be acked, got %v", ack.acks)
+	}
+}
+
+func TestConsumerWorkerShutdownDrainsInFlightMessage(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	cfg := &config.Config{Consumer: config.ConsumerConfig{RequeueOnShutdown: true}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		// The handler outlives the intake of deliveries, and ignores its context
+		"slow": func(ctx context.Context, payload json.RawMessage) error {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+	})
+
+	ack := &fakeAcknowledger{}
+	msgChan := make(chan amqp091.Delivery, 1)
+	msgChan <- newTestDelivery(ack, 1, "slow", "msg_1")
+
+	done := make(chan error, 1)
+	go func() { done <- w.consume(msgChan) }()
+	<-started
+
+	if err := w.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected a clean shutdown, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("expected consume to stop cleanly, got %v", err)
+	}
+	if len(ack.acks) != 1 || len(ack.nacks) != 0 {
+		t.Fatalf("expected the in-flight message to finish and be acked, got acks %v and nacks %v", ack.acks, ack.nacks)
+	}
+}
+
+func TestConsumerWorkerShutdownAbortsAfterGracePeriod(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{RequeueOnShutdown: true, ShutdownGracePeriod: time.Hour}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"stuck": func(ctx context.Context, payload json.RawMessage) error {
+			close(started)
+			<-release
+			return nil
+		},
+	})
+
+	ack := &fakeAcknowledger{}
+	msgChan := make(chan amqp091.Delivery, 1)
+	msgChan <- newTestDelivery(ack, 1, "stuck", "msg_1")
+
+	done := make(chan error, 1)
+	go func() { done <- w.consume(msgChan) }()
+	<-started
+
+	// The deadline of the context passed to Shutdown holds even with a longer grace period
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := w.Shutdown(ctx); err != nil {
+		t.Fatalf("expected Shutdown to abort the stuck message, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("expected consume to stop cleanly, got %v", err)
+	}
+	if len(ack.acks) != 0 || len(ack.nacks) != 1 || !ack.requeues[0] {
+		t.Fatalf("expected the aborted message to be requeued, got acks %v and nacks %v", ack.acks, ack.nacks)
+	}
+}
+
+func TestActionPoolsValidation(t *testing.T) {
+	t.Parallel()
+
+	invalid := map[string]config.ConsumerConfig{
+		"strict ordering":  {Ordering: config.OrderingStrict, ActionConcurrency: map[string]int{"cheap": 2}},
+		"zero concurrency": {ActionConcurrency: map[string]int{"cheap": 0}},
+	}
+
+	for name, cfg := range invalid {
+		if _, err := actionPools(cfg, 0); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+
+	if pools, err := actionPools(config.ConsumerConfig{}, 1); pools != nil || err != nil {
+		t.Fatalf("expected no pools by default, got %v, %v", pools, err)
+	}
+
+	// Two slots for "cheap" and one for the other actions
+	cfg := config.ConsumerConfig{ActionConcurrency: map[string]int{"cheap": 2}}
+	if _, err := actionPools(cfg, 2); err == nil || !strings.Contains(err.Error(), "rabbitmq.prefetch_count") {
+		t.Fatalf("expected a prefetch count lower than the slots to be rejected, got %v", err)
+	}
+	if _, err := actionPools(cfg, 3); err != nil {
+		t.Fatalf("expected a prefetch count covering the slots to be accepted, got %v", err)
+	}
+}
+
+func TestConsumerWorkerSkipsDuplicateEmail(t *testing.T) {
+	t.Parallel()
+
+	w := newTestConsumerWorker(t, &config.Config{}, nil)
+	w.handlers = map[string]MessageHandler{"create_user": w.handleCreateUser}
+	w.userRepo = &fakeUserRepository{err: fmt.Errorf("failed to create user: %w", repositories.ErrDuplicateEmail)}
+
+	body := []byte(`{"action":"create_user","id":"msg_1","payload":{"name":"Alice","email":"alice@example.com"}}`)
+	report, err := w.process(context.Background(), amqp091.Delivery{Body: body}, false)
+	if err != nil || report.Status != ProcessSkipped || report.Reason != "duplicate email" {
+		t.Fatalf("expected the message to be skipped, got %+v (%v)", report, err)
+	}
+
+	ack := &fakeAcknowledger{}
+	w.handleDelivery(amqp091.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: body})
+	if fmt.Sprint(ack.acks) != fmt.Sprint([]uint64{1}) || len(ack.nacks) != 0 {
+		t.Fatalf("expected the message to be acked rather than requeued, got acks %v and nacks %v", ack.acks, ack.nacks)
+	}
+}
+
+// fakeDatabase fails its health checks with err, recording whether they had a deadline.
+type fakeDatabase struct {
+	err         error
+	hadDeadline bool
+}
+
+func (d *fakeDatabase) HealthCheckWithContext(ctx context.Context) error {
+	_, d.hadDeadline = ctx.Deadline()
+	return d.err
+}
+
+func TestConsumerWorkerStartFailsWithoutDatabase(t *testing.T) {
+	t.Parallel()
+
+	w := newTestConsumerWorker(t, &config.Config{}, nil)
+	database := &fakeDatabase{err: errors.New("connection refused")}
+	w.database = database
+
+	// Start returns before consuming, which would need a broker
+	err := w.Start()
+	if !errors.Is(err, ErrDatabaseNotReady) || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("expected ErrDatabaseNotReady with its cause, got %v", err)
+	}
+	if !database.hadDeadline {
+		t.Fatal("expected the database check to be bounded by a timeout")
+	}
+
+	database.err = nil
+	if err := w.CheckDatabase(); err != nil {
+		t.Fatalf("expected a reachable database to be ready, got %v", err)
+	}
+}
+
+// fakeBroker records the messages requeued through it, standing in for RabbitMQ.
+type fakeBroker struct {
+	rabbitmq.MessageBroker
+	requeued []amqp091.Table
+}
+
+func (b *fakeBroker) RequeueMessage(msg amqp091.Delivery, headers amqp091.Table) error {
+	b.requeued = append(b.requeued, headers)
+	return nil
+}
+
+func TestConsumerWorkerRequeuesThroughBroker(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{MaxRequeues: 3}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"flaky": func(ctx context.Context, payload json.RawMessage) error { return errors.New("temporary failure") },
+	})
+	broker := &fakeBroker{}
+	w.rabbitMQ = broker
+
+	ack := &fakeAcknowledger{}
+	w.handleDelivery(newTestDelivery(ack, 1, "flaky", "msg_1"))
+
+	if len(broker.requeued) != 1 || broker.requeued[0][rabbitmq.HeaderRequeueCount] != int32(1) {
+		t.Fatalf("expected the message to be requeued once with its count, got %v", broker.requeued)
+	}
+	if fmt.Sprint(ack.acks) != fmt.Sprint([]uint64{1}) {
+		t.Fatalf("expected the original delivery to be acked once requeued, got %v", ack.acks)
+	}
+}
+
+// fakeFailedMessageRepository records the dead-lettered messages.
+type fakeFailedMessageRepository struct {
+	repositories.FailedMessageRepository
+	failed []*repositories.FailedMessage
+}
+
+func (r *fakeFailedMessageRepository) CreateFailedMessage(ctx context.Context, message *repositories.FailedMessage) (*repositories.FailedMessage, error) {
+	r.failed = append(r.failed, message)
+	return message, nil
+}
+
+func TestConsumerWorkerRecoversHandlerPanics(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Consumer: config.ConsumerConfig{MaxRequeues: 1}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{
+		"panicking": func(ctx context.Context, payload json.RawMessage) error {
+			var user *repositories.User
+			_ = user.Name
+			return nil
+		},
+	})
+	broker := rabbitmqtest.NewInMemoryBroker()
+	t.Cleanup(func() { _ = broker.Shutdown() })
+	w.rabbitMQ = broker
+	failedRepo := &fakeFailedMessageRepository{}
+	w.failedRepo = failedRepo
+
+	// The panic fails the message like any error: it is requeued, then dead-lettered
+	ack := &fakeAcknowledger{}
+	w.handleDelivery(newTestDelivery(ack, 1, "panicking", "msg_1"))
+	if depth, _ := broker.QueueDepth(); depth != 1 {
+		t.Fatalf("expected the message to be requeued, got a queue depth of %d", depth)
+	}
+
+	requeued := newTestDelivery(ack, 2, "panicking", "msg_1")
+	requeued.Headers = amqp091.Table{rabbitmq.HeaderRequeueCount: int32(1)}
+	w.handleDelivery(requeued)
+
+	if len(broker.DeadLetters()) != 1 || len(failedRepo.failed) != 1 || !strings.Contains(failedRepo.failed[0].Error, ErrHandlerPanic.Error()) {
+		t.Fatalf("expected the message to be dead-lettered with the panic, got %v", failedRepo.failed)
+	}
+	if fmt.Sprint(ack.acks) != fmt.Sprint([]uint64{1, 2}) {
+		t.Fatalf("expected both deliveries to be acked once handed back to the broker, got %v", ack.acks)
+	}
+}
+
+// consumingBroker hands out a delivery channel per consumer, closing it when the consumer is cancelled.
+type consumingBroker struct {
+	rabbitmq.MessageBroker
+	mu        sync.Mutex
+	consumers []rabbitmq.ConsumeOptions
+	chans     map[string]chan amqp091.Delivery
+}
+
+func (b *consumingBroker) ConsumeMessageWithOptions(opts rabbitmq.ConsumeOptions) (<-chan amqp091.Delivery, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consumers = append(b.consumers, opts)
+	if b.chans == nil {
+		b.chans = map[string]chan amqp091.Delivery{}
+	}
+	b.chans[opts.Tag] = make(chan amqp091.Delivery)
+	return b.chans[opts.Tag], nil
+}
+
+func (b *consumingBroker) CancelConsumer(tag string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if msgChan, ok := b.chans[tag]; ok {
+		close(msgChan)
+		delete(b.chans, tag)
+	}
+	return nil
+}
+
+func TestConsumerWorkerConsumesBindings(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{RabbitMQ: config.RabbitMQConfig{PrefetchCount: 5}}
+	w := newTestConsumerWorker(t, cfg, map[string]MessageHandler{})
+	w.id = "consumer"
+	w.bindings = []boundQueue{{queue: "invoices", tag: "consumer-invoices", action: "record"}}
+	broker := &consumingBroker{}
+	w.rabbitMQ = broker
+
+	done := make(chan error, 1)
+	go func() { done <- w.Run() }()
+
+	// Wait for both consumers, then lose the binding one: the main consumer must stop too
+	deadline := time.After(time.Second)
+	for {
+		broker.mu.Lock()
+		started := len(broker.chans) == 2
+		broker.mu.Unlock()
+		if started {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("expected both consumers to start")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	_ = broker.CancelConsumer("consumer-invoices")
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errMessageChannelClosed) {
+			t.Fatalf("expected the closed binding channel to be reported, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to return once a consumer stopped")
+	}
+
+	expected := []rabbitmq.ConsumeOptions{
+		{PrefetchCount: 5, Tag: "consumer"},
+		{PrefetchCount: 5, Tag: "consumer-invoices", Queue: "invoices"},
+	}
+	if fmt.Sprint(broker.consumers) != fmt.Sprint(expected) {
+		t.Fatalf("expected consumers %v, got %v", expected, broker.consumers)
+	}
+	if len(broker.chans) != 0 {
+		t.Fatalf("expected every consumer to be cancelled, got %v still running", broker.chans)
+	}
+}
+
+func TestConsumerWorkerDispatchesBindings(t *testing.T) {
+	t.Parallel()
+
+	var actions []string
+	w := newTestConsumerWorker(t, &config.Config{}, map[string]MessageHandler{
+		"record": func(ctx context.Context, payload json.RawMessage) error {
+			actions = append(actions, "record")
+			return nil
+		},
+		"other": func(ctx context.Context, payload json.RawMessage) error {
+			actions = append(actions, "other")
+			return nil
+		},
+	})
+	w.id = "consumer"
+	w.bindings = []boundQueue{{queue: "invoices", tag: "consumer-invoices", action: "record"}}
+
+	fromBinding := newTestDelivery(nil, 1, "other", "msg_1")
+	fromBinding.ConsumerTag = "consumer-invoices"
+	fromMain := newTestDelivery(nil, 2, "other", "msg_2")
+	fromMain.ConsumerTag = "consumer"
+
+	for _, msg := range []amqp091.Delivery{fromBinding, fromMain} {
+		if err := w.processWithTimeout(msg); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if fmt.Sprint(actions) != fmt.Sprint([]string{"record", "other"}) {
+		t.Fatalf("expected the binding message to go to its handler, got %v", actions)
+	}
+}
@@ -0,0 +1,100 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+	"github.com/samber/do-template-worker/pkg/repositories"
+	"github.com/samber/do/v2"
+)
+
+// OutboxRelay publishes the messages written to the outbox to RabbitMQ
+// This struct is the second half of the transactional outbox: the producer only writes messages
+// to the database, and the relay publishes them once their transaction has committed.
+type OutboxRelay struct {
+	outboxRepo repositories.OutboxRepository
+	rabbitMQ   rabbitmq.MessageBroker
+	logger     *zerolog.Logger
+	config     *config.Config
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// NewOutboxRelay creates a new outbox relay instance
+// This function demonstrates how to initialize a background worker with dependency injection.
+func NewOutboxRelay(injector do.Injector) (*OutboxRelay, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &OutboxRelay{
+		outboxRepo: do.MustInvoke[repositories.OutboxRepository](injector),
+		rabbitMQ:   do.MustInvoke[rabbitmq.MessageBroker](injector),
+		logger:     do.MustInvoke[*zerolog.Logger](injector),
+		config:     do.MustInvoke[*config.Config](injector),
+		ctx:        ctx,
+		cancel:     cancel,
+	}, nil
+}
+
+// Run polls the outbox every outbox.relay_interval until the relay is shut down, then returns nil
+// Like the producer's Run, it blocks and can be called again after a panic, so that serve can supervise it.
+func (r *OutboxRelay) Run() error {
+	interval := r.config.Outbox.RelayInterval
+
+	r.logger.Info().
+		Dur("interval", interval).
+		Int("batch_size", r.config.Outbox.BatchSize).
+		Msg("Starting outbox relay")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			r.logger.Info().Msg("Outbox relay stopped")
+			return nil
+		case <-ticker.C:
+			// Hold off while the broker asks publishers to pause
+			if err := r.rabbitMQ.WaitForFlow(r.ctx); err != nil {
+				continue
+			}
+
+			r.relay(r.rabbitMQ.PublishMirroredWithOptions)
+		}
+	}
+}
+
+// relay publishes batches of outbox messages until the outbox is drained or publishing fails
+// Failed messages stay in the outbox and are retried on the next poll. Messages are published with
+// the message ID and type stored in the outbox.
+func (r *OutboxRelay) relay(publish func([]byte, rabbitmq.PublishOptions) error) {
+	batchSize := r.config.Outbox.BatchSize
+
+	for r.ctx.Err() == nil {
+		published, err := r.outboxRepo.RelayOutboxMessages(r.ctx, batchSize, func(message *repositories.OutboxMessage) error {
+			return publish(message.Body, rabbitmq.PublishOptions{MessageID: message.MessageID, Type: message.Type})
+		})
+		if published > 0 {
+			r.logger.Info().Int("count", published).Msg("Relayed outbox messages")
+		}
+		if err != nil {
+			r.logger.Error().Err(err).Msg("Failed to relay outbox messages")
+			return
+		}
+
+		// A partial batch means the outbox is drained
+		if published < batchSize {
+			return
+		}
+	}
+}
+
+// Shutdown stops the outbox relay. Messages left in the outbox are published after the next start.
+func (r *OutboxRelay) Shutdown() error {
+	r.logger.Info().Msg("Stopping outbox relay")
+	r.cancel()
+	return nil
+}
@@ -0,0 +1,91 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+	"github.com/samber/do-template-worker/pkg/repositories"
+)
+
+// fakeOutboxRepository serves pending messages from memory.
+type fakeOutboxRepository struct {
+	repositories.OutboxRepository
+	pending []*repositories.OutboxMessage
+	batches int
+}
+
+func (r *fakeOutboxRepository) RelayOutboxMessages(ctx context.Context, limit int, publish func(*repositories.OutboxMessage) error) (int, error) {
+	r.batches++
+
+	published := 0
+	for published < limit && len(r.pending) > 0 {
+		if err := publish(r.pending[0]); err != nil {
+			return published, err
+		}
+		r.pending = r.pending[1:]
+		published++
+	}
+
+	return published, nil
+}
+
+func newTestOutboxRelay(repo repositories.OutboxRepository) *OutboxRelay {
+	logger := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &OutboxRelay{
+		outboxRepo: repo,
+		logger:     &logger,
+		config:     &config.Config{Outbox: config.OutboxConfig{BatchSize: 2}},
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+func TestOutboxRelayDrainsOutbox(t *testing.T) {
+	t.Parallel()
+
+	repo := &fakeOutboxRepository{}
+	for _, id := range []string{"msg_1", "msg_2", "msg_3"} {
+		repo.pending = append(repo.pending, &repositories.OutboxMessage{MessageID: id, Type: "create_user", Body: []byte(id)})
+	}
+	relay := newTestOutboxRelay(repo)
+
+	var published []string
+	relay.relay(func(body []byte, opts rabbitmq.PublishOptions) error {
+		if opts.MessageID != string(body) {
+			t.Errorf("expected message %s to be published with its message ID, got %q", body, opts.MessageID)
+		}
+		if opts.Type != "create_user" {
+			t.Errorf("expected message %s to be published with its type, got %q", body, opts.Type)
+		}
+		published = append(published, string(body))
+		return nil
+	})
+
+	if len(published) != 3 || len(repo.pending) != 0 {
+		t.Fatalf("expected every message to be published in one poll, got %v", published)
+	}
+	if repo.batches != 2 {
+		t.Fatalf("expected a full batch then a partial one, got %d batches", repo.batches)
+	}
+}
+
+func TestOutboxRelayStopsOnPublishFailure(t *testing.T) {
+	t.Parallel()
+
+	repo := &fakeOutboxRepository{pending: []*repositories.OutboxMessage{{MessageID: "msg_1"}, {MessageID: "msg_2"}, {MessageID: "msg_3"}}}
+	relay := newTestOutboxRelay(repo)
+
+	relay.relay(func(body []byte, opts rabbitmq.PublishOptions) error {
+		return errors.New("broker down")
+	})
+
+	if len(repo.pending) != 3 || repo.batches != 1 {
+		t.Fatalf("expected messages to stay in the outbox until the next poll, got %d pending after %d batches", len(repo.pending), repo.batches)
+	}
+}
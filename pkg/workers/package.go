@@ -10,6 +10,8 @@ import (
 var WorkerPackage = do.Package(
 	do.Lazy(rabbitmq.ProvideRabbitMQConfig),
 	do.Lazy(rabbitmq.NewRabbitMQService),
+	do.Bind[*rabbitmq.RabbitMQService, rabbitmq.MessageBroker](),
 	do.Lazy(NewProducerWorker),
 	do.Lazy(NewConsumerWorker),
+	do.Lazy(NewOutboxRelay),
 )
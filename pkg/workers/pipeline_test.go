@@ -0,0 +1,79 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/rabbitmq/rabbitmqtest"
+)
+
+func TestProducerConsumerPipelineInMemory(t *testing.T) {
+	t.Parallel()
+
+	broker := rabbitmqtest.NewInMemoryBroker()
+	t.Cleanup(func() { _ = broker.Shutdown() })
+
+	logger := zerolog.Nop()
+	producer := &ProducerWorker{
+		rabbitMQ: broker,
+		logger:   &logger,
+		config:   &config.Config{Producer: config.ProducerConfig{Action: "create_user"}},
+		ctx:      context.Background(),
+		generate: generateUserPayload,
+	}
+	for range 3 {
+		if err := producer.produceMessage(); err != nil {
+			t.Fatalf("failed to produce message: %v", err)
+		}
+	}
+
+	consumer := newTestConsumerWorker(t, &config.Config{RabbitMQ: config.RabbitMQConfig{PrefetchCount: 2}}, nil)
+	consumer.rabbitMQ = broker
+	users := &fakeUserRepository{}
+	consumer.userRepo = users
+
+	// The first attempt fails, so that a message is nacked and redelivered
+	var attempts atomic.Int32
+	consumer.handlers = map[string]MessageHandler{
+		"create_user": func(ctx context.Context, payload json.RawMessage) error {
+			if attempts.Add(1) == 1 {
+				return errors.New("temporary failure")
+			}
+			return consumer.handleCreateUser(ctx, payload)
+		},
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- consumer.Run() }()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		depth, _ := broker.QueueDepth()
+		if depth == 0 && broker.Unacked() == 0 && attempts.Load() == 4 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("expected every message to be consumed, %d ready and %d unacked after %d attempts", depth, broker.Unacked(), attempts.Load())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if err := consumer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shut down consumer: %v", err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("expected the consumer to stop cleanly, got %v", err)
+	}
+
+	if len(users.created) != 3 || len(broker.DeadLetters()) != 0 || len(broker.Rejected()) != 0 {
+		t.Fatalf("expected 3 users and no lost message, got %d users, %d dead letters and %d rejected",
+			len(users.created), len(broker.DeadLetters()), len(broker.Rejected()))
+	}
+}
@@ -1,68 +1,318 @@
 package workers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/logger"
 	"github.com/samber/do-template-worker/pkg/rabbitmq"
 	"github.com/samber/do-template-worker/pkg/repositories"
+	"github.com/samber/do-template-worker/pkg/tracing"
 	"github.com/samber/do/v2"
 )
 
+// ErrPublishTimeout is returned when a publish doesn't complete within producer.publish_timeout.
+var ErrPublishTimeout = errors.New("publish timed out")
+
+// ProducerRunOptions tunes a single producer run.
+type ProducerRunOptions struct {
+	// Duration stops the producer after the given wall-clock time. Zero runs until shutdown.
+	Duration time.Duration
+	// Interval is the delay between two messages. Zero uses producer.interval.
+	Interval time.Duration
+	// Count stops the producer once it has published that many messages. Zero runs until shutdown.
+	Count int64
+}
+
+// ProducerStats summarizes what a producer run has produced so far.
+type ProducerStats struct {
+	Produced int64
+	Elapsed  time.Duration
+}
+
+// Rate returns the average number of messages produced per second.
+func (s ProducerStats) Rate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Produced) / s.Elapsed.Seconds()
+}
+
 // ProducerWorker is a worker that produces messages to RabbitMQ
 // This struct demonstrates how to implement a producer worker with dependency injection.
 type ProducerWorker struct {
-	rabbitMQ *rabbitmq.RabbitMQService
+	rabbitMQ rabbitmq.MessageBroker
 	userRepo repositories.UserRepository
-	logger   *zerolog.Logger
-	config   *config.Config
-	ctx      context.Context
-	cancel   context.CancelFunc
+	// outboxRepo is only set with outbox.enabled, messages being then enqueued instead of published
+	outboxRepo repositories.OutboxRepository
+	logger     *zerolog.Logger
+	config     *config.Config
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	// generate builds the payload of the configured producer.action
+	generate PayloadGenerator
+
+	done      chan struct{}
+	produced  atomic.Int64
+	startedAt time.Time
+
+	// throttling is set while production is paused by backpressure
+	throttling bool
+	// publishing is set while a publish is in flight, including one abandoned after its timeout
+	publishing atomic.Bool
 }
 
 // NewProducerWorker creates a new producer worker instance
 // This function demonstrates how to initialize a producer with dependency injection.
 func NewProducerWorker(injector do.Injector) (*ProducerWorker, error) {
+	appConfig := do.MustInvoke[*config.Config](injector)
+
+	// Install the tracer provider before the first span is started
+	do.MustInvoke[*tracing.Tracing](injector)
+
+	// Register a payload generator per supported action, a payload template replacing them
+	var (
+		generate PayloadGenerator
+		err      error
+	)
+	if appConfig.Producer.PayloadTemplate != "" {
+		generate, err = templatePayloadGenerator(appConfig.Producer.PayloadTemplate)
+	} else {
+		generate, err = payloadGenerator(map[string]PayloadGenerator{
+			"create_user": generateUserPayload,
+		}, appConfig.Producer.Action)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var outboxRepo repositories.OutboxRepository
+	if appConfig.Outbox.Enabled {
+		outboxRepo = do.MustInvoke[repositories.OutboxRepository](injector)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &ProducerWorker{
-		rabbitMQ: do.MustInvoke[*rabbitmq.RabbitMQService](injector),
-		userRepo: do.MustInvoke[repositories.UserRepository](injector),
-		logger:   do.MustInvoke[*zerolog.Logger](injector),
-		config:   do.MustInvoke[*config.Config](injector),
-		ctx:      ctx,
-		cancel:   cancel,
+		rabbitMQ:   do.MustInvoke[rabbitmq.MessageBroker](injector),
+		userRepo:   do.MustInvoke[repositories.UserRepository](injector),
+		outboxRepo: outboxRepo,
+		logger:     do.MustInvoke[*zerolog.Logger](injector),
+		config:     appConfig,
+		ctx:        ctx,
+		cancel:     cancel,
+		generate:   generate,
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// payloadGenerator returns the generator registered for an action
+// An action without generator is a configuration error, reported with the supported actions.
+func payloadGenerator(generators map[string]PayloadGenerator, action string) (PayloadGenerator, error) {
+	if generate, ok := generators[action]; ok {
+		return generate, nil
+	}
+
+	actions := make([]string, 0, len(generators))
+	for name := range generators {
+		actions = append(actions, name)
+	}
+	sort.Strings(actions)
+
+	return nil, fmt.Errorf("no payload generator for producer.action %q, expected one of: %s", action, strings.Join(actions, ", "))
+}
+
+// payloadTemplateData is given to producer.payload_template for each produced message.
+type payloadTemplateData struct {
+	// Seq is the sequence number of the message since the producer started, from 1.
+	Seq      int64
+	Unix     int64
+	UnixNano int64
+}
+
+// templatePayloadGenerator returns a generator rendering producer.payload_template
+// The template is rendered once upfront, so that a template failing or rendering invalid JSON
+// is reported when the producer starts rather than on each message.
+func templatePayloadGenerator(text string) (PayloadGenerator, error) {
+	tmpl, err := template.New("payload").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid producer.payload_template: %w", err)
+	}
+
+	render := func(seq int64) (json.RawMessage, error) {
+		now := time.Now()
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, payloadTemplateData{Seq: seq, Unix: now.Unix(), UnixNano: now.UnixNano()}); err != nil {
+			return nil, err
+		}
+		if !json.Valid(buf.Bytes()) {
+			return nil, fmt.Errorf("rendered invalid JSON: %s", buf.String())
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	if _, err := render(0); err != nil {
+		return nil, fmt.Errorf("invalid producer.payload_template: %w", err)
+	}
+
+	var seq atomic.Int64
+	return func() interface{} {
+		// A payload that fails to render is rejected when the message is marshaled
+		payload, _ := render(seq.Add(1))
+		return payload
 	}, nil
 }
 
 // Start starts the producer worker
 // This method demonstrates how to start a producer worker with dependency injection.
 func (w *ProducerWorker) Start() error {
-	w.logger.Info().Msg("Starting producer worker")
+	return w.StartWithOptions(ProducerRunOptions{})
+}
+
+// StartWithOptions starts the producer worker with run options
+// A non-zero duration bounds the producer's context with a timeout, after which it stops on its own.
+func (w *ProducerWorker) StartWithOptions(opts ProducerRunOptions) error {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = w.config.Producer.Interval
+	}
+
+	if opts.Duration > 0 {
+		ctx, cancel := context.WithTimeout(w.ctx, opts.Duration)
+		parentCancel := w.cancel
+		w.ctx = ctx
+		w.cancel = func() {
+			cancel()
+			parentCancel()
+		}
+	}
+
+	w.logger.Info().
+		Dur("interval", interval).
+		Dur("duration", opts.Duration).
+		Int64("count", opts.Count).
+		Msg("Starting producer worker")
+
+	w.startedAt = time.Now()
 
 	// Start producing messages periodically
 	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
+		defer close(w.done)
+		w.produce(interval, opts.Count)
+	}()
+
+	return nil
+}
+
+// Run produces messages every producer.interval until the worker is shut down, then returns nil
+// Unlike Start, it blocks, and can be called again after a panic, which is how serve supervises the producer.
+func (w *ProducerWorker) Run() error {
+	w.logger.Info().Dur("interval", w.config.Producer.Interval).Msg("Starting producer worker")
+
+	if w.startedAt.IsZero() {
+		w.startedAt = time.Now()
+	}
+
+	w.produce(w.config.Producer.Interval, 0)
+	return nil
+}
 
-		for {
-			select {
-			case <-w.ctx.Done():
-				w.logger.Info().Msg("Producer worker stopped")
+// produce publishes a message every interval until the worker is stopped, or until count messages are
+// published when count is positive. Failed messages don't count.
+func (w *ProducerWorker) produce(interval time.Duration, count int64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			w.logger.Info().Msg("Producer worker stopped")
+			return
+		case <-ticker.C:
+			// Hold off while the broker asks publishers to pause
+			if err := w.rabbitMQ.WaitForFlow(w.ctx); err != nil {
+				continue
+			}
+
+			// Skip the tick while the consumer is falling behind
+			if w.throttled(w.rabbitMQ.QueueDepth) {
+				continue
+			}
+
+			// Skip the tick while a publish that timed out is still hanging, rather than piling up more
+			if w.publishing.Load() {
+				w.logger.Warn().Msg("Previous publish still in flight, skipping tick")
+				continue
+			}
+
+			if err := w.produceMessage(); errors.Is(err, ErrPublishTimeout) {
+				w.logger.Warn().Err(err).Msg("Publish timed out, moving on")
+				continue
+			} else if err != nil {
+				w.logger.Error().Err(err).Msg("Failed to produce message")
+				continue
+			}
+
+			if produced := w.produced.Add(1); count > 0 && produced >= count {
+				w.logger.Info().Int64("count", count).Msg("Producer published its message count")
 				return
-			case <-ticker.C:
-				if err := w.produceMessage(); err != nil {
-					w.logger.Error().Err(err).Msg("Failed to produce message")
-				}
 			}
 		}
-	}()
+	}
+}
 
-	return nil
+// throttled reports whether production should be skipped because the queue backlog
+// exceeds producer.max_backlog. Throttling starts and ends are logged once, not on every tick.
+// When the backlog can't be read, production goes on: backpressure is an optimization.
+func (w *ProducerWorker) throttled(queueDepth func() (int, error)) bool {
+	maxBacklog := w.config.Producer.MaxBacklog
+	if maxBacklog <= 0 {
+		return false
+	}
+
+	backlog, err := queueDepth()
+	if err != nil {
+		w.logger.Warn().Err(err).Msg("Failed to read queue backlog, producing anyway")
+		return false
+	}
+
+	throttling := backlog > maxBacklog
+	if throttling != w.throttling {
+		w.throttling = throttling
+		if throttling {
+			w.logger.Warn().Int("backlog", backlog).Int("max_backlog", maxBacklog).Msg("Producer throttled by backpressure")
+		} else {
+			w.logger.Info().Int("backlog", backlog).Int("max_backlog", maxBacklog).Msg("Producer resumed")
+		}
+	}
+
+	return throttling
+}
+
+// Done returns a channel closed once the producer has stopped producing.
+func (w *ProducerWorker) Done() <-chan struct{} {
+	return w.done
+}
+
+// Stats returns the number of messages produced since the producer started.
+func (w *ProducerWorker) Stats() ProducerStats {
+	return ProducerStats{
+		Produced: w.produced.Load(),
+		Elapsed:  time.Since(w.startedAt),
+	}
 }
 
 // Shutdown stops the producer worker
@@ -76,14 +326,17 @@ func (w *ProducerWorker) Shutdown() error {
 // produceMessage produces a message to RabbitMQ
 // This method demonstrates how to produce a message with dependency injection.
 func (w *ProducerWorker) produceMessage() error {
+	payload, err := json.Marshal(w.generate())
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
 	// Create a message
 	message := WorkerMessage{
-		Action: "create_user",
-		Payload: UserPayload{
-			Name:  fmt.Sprintf("User_%d", time.Now().Unix()),
-			Email: fmt.Sprintf("user_%d@example.com", time.Now().Unix()),
-		},
-		ID: fmt.Sprintf("msg_%d", time.Now().UnixNano()),
+		Action:  w.config.Producer.Action,
+		Payload: payload,
+		ID:      fmt.Sprintf("msg_%d", time.Now().UnixNano()),
+		Source:  w.config.App.Name,
 	}
 
 	// Serialize message
@@ -92,11 +345,94 @@ func (w *ProducerWorker) produceMessage() error {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
-	// Publish message
-	if err := w.rabbitMQ.PublishMessage(messageData); err != nil {
+	// With the outbox, the relay publishes the message once the transaction commits
+	if w.outboxRepo != nil {
+		if err := w.enqueue(w.ctx, message, messageData); err != nil {
+			return err
+		}
+
+		w.logger.Info().Str("message_id", message.ID).Str("action", message.Action).Msg("Enqueued message in outbox")
+		return nil
+	}
+
+	// Publish message, with its trace context so that the consumer continues the trace
+	ctx, end := logger.StartSpan(w.logger.WithContext(w.ctx), "message.publish")
+	opts := rabbitmq.PublishOptions{MessageID: message.ID, Type: message.Action}
+	if w.config.App.TracingEnabled {
+		opts.Headers = tracing.Inject(ctx)
+	}
+	err = w.publish(messageData, opts)
+	end(err)
+	if err != nil {
 		return fmt.Errorf("failed to publish message: %w", err)
 	}
 
-	w.logger.Info().Str("message_id", message.ID).Msg("Produced message")
+	w.logger.Info().Str("message_id", message.ID).Str("action", message.Action).Msg("Produced message")
 	return nil
 }
+
+// publish publishes a message, giving up after producer.publish_timeout
+// The broker client takes no context, so a publish that times out keeps running in the background
+// until the broker answers or the connection drops; publishing stays set meanwhile.
+func (w *ProducerWorker) publish(message []byte, opts rabbitmq.PublishOptions) error {
+	timeout := w.config.Producer.PublishTimeout
+	if timeout <= 0 {
+		return w.rabbitMQ.PublishMirroredWithOptions(message, opts)
+	}
+
+	w.publishing.Store(true)
+	result := make(chan error, 1)
+	go func() {
+		defer w.publishing.Store(false)
+		result <- w.rabbitMQ.PublishMirroredWithOptions(message, opts)
+	}()
+
+	ctx, cancel := context.WithTimeout(w.ctx, timeout)
+	defer cancel()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		if w.ctx.Err() != nil {
+			return w.ctx.Err()
+		}
+		return fmt.Errorf("%w after %s", ErrPublishTimeout, timeout)
+	}
+}
+
+// enqueue writes a message to the outbox in its own transaction
+// The generated messages announce no business write, so the transaction only holds the message. Code
+// announcing its writes must run them on the transaction of outboxRepo.Begin before enqueueing the
+// message with EnqueueOutboxMessage, so that both are committed or rolled back together.
+func (w *ProducerWorker) enqueue(ctx context.Context, message WorkerMessage, body []byte) error {
+	tx, err := w.outboxRepo.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction is a no-op
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	if err := w.outboxRepo.EnqueueOutboxMessage(ctx, tx, &repositories.OutboxMessage{MessageID: message.ID, Type: message.Action, Body: body}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// generatedUsers counts the users generated by the process.
+var generatedUsers atomic.Int64
+
+// generateUserPayload generates the payload of a create_user message
+// The counter keeps emails unique when the clock doesn't advance between two messages.
+func generateUserPayload() interface{} {
+	suffix := fmt.Sprintf("%d_%d", time.Now().UnixNano(), generatedUsers.Add(1))
+	return UserPayload{
+		Name:  "User_" + suffix,
+		Email: "user_" + suffix + "@example.com",
+	}
+}
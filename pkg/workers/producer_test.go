@@ -0,0 +1,224 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+	"github.com/samber/do-template-worker/pkg/config"
+	"github.com/samber/do-template-worker/pkg/rabbitmq"
+	"github.com/samber/do-template-worker/pkg/repositories"
+)
+
+func TestPayloadGenerator(t *testing.T) {
+	t.Parallel()
+
+	generators := map[string]PayloadGenerator{
+		"create_user": generateUserPayload,
+		"delete_user": func() interface{} { return map[string]interface{}{"id": 1} },
+	}
+
+	generate, err := payloadGenerator(generators, "create_user")
+	if err != nil {
+		t.Fatalf("expected a generator for create_user, got %v", err)
+	}
+	first, ok := generate().(UserPayload)
+	if !ok {
+		t.Fatalf("expected a UserPayload, got %T", generate())
+	}
+	if second := generate().(UserPayload); second.Email == first.Email {
+		t.Fatalf("expected consecutive payloads to have distinct emails, got %s twice", first.Email)
+	}
+
+	_, err = payloadGenerator(generators, "unknown")
+	if err == nil || !strings.Contains(err.Error(), "create_user, delete_user") {
+		t.Fatalf("expected an error listing the supported actions, got %v", err)
+	}
+}
+
+func TestTemplatePayloadGenerator(t *testing.T) {
+	t.Parallel()
+
+	generate, err := templatePayloadGenerator(`{"name":"User_{{.Seq}}","email":"user_{{.Seq}}@example.com"}`)
+	if err != nil {
+		t.Fatalf("expected a valid template, got %v", err)
+	}
+
+	for seq := 1; seq <= 2; seq++ {
+		data, err := json.Marshal(generate())
+		if err != nil {
+			t.Fatalf("failed to marshal payload: %v", err)
+		}
+
+		var payload UserPayload
+		if err := json.Unmarshal(data, &payload); err != nil || payload.Name != fmt.Sprintf("User_%d", seq) {
+			t.Fatalf("expected payload %d to be rendered with its sequence number, got %s (%v)", seq, data, err)
+		}
+	}
+
+	for text, want := range map[string]string{
+		`{"name":"{{.Name"}`:         "invalid producer.payload_template",
+		`{"name":"{{.Name}}"}`:       "can't evaluate field Name",
+		`{"name":User_{{.Seq}}}`:     "rendered invalid JSON",
+		`{"id":{{.UnixNano}}} extra`: "rendered invalid JSON",
+	} {
+		if _, err := templatePayloadGenerator(text); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected template %s to fail with %q, got %v", text, want, err)
+		}
+	}
+}
+
+func TestProducerWorkerThrottled(t *testing.T) {
+	t.Parallel()
+
+	logger := zerolog.Nop()
+	w := &ProducerWorker{logger: &logger, config: &config.Config{Producer: config.ProducerConfig{MaxBacklog: 10}}}
+
+	depth := func(backlog int, err error) func() (int, error) {
+		return func() (int, error) { return backlog, err }
+	}
+
+	if w.throttled(depth(10, nil)) {
+		t.Fatal("expected production at the max backlog")
+	}
+	if !w.throttled(depth(11, nil)) {
+		t.Fatal("expected production to be throttled above the max backlog")
+	}
+	if w.throttled(depth(0, errors.New("channel closed"))) {
+		t.Fatal("expected production to go on when the backlog can't be read")
+	}
+
+	w.config.Producer.MaxBacklog = 0
+	if w.throttled(depth(1000, nil)) {
+		t.Fatal("expected backpressure to be disabled by default")
+	}
+}
+
+// fakeTx records how a transaction ended.
+type fakeTx struct {
+	pgx.Tx
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	if !tx.committed {
+		tx.rolledBack = true
+	}
+	return nil
+}
+
+// fakeEnqueuingOutboxRepository records the messages enqueued in its transaction.
+type fakeEnqueuingOutboxRepository struct {
+	repositories.OutboxRepository
+	tx       *fakeTx
+	enqueued []*repositories.OutboxMessage
+	err      error
+}
+
+func (r *fakeEnqueuingOutboxRepository) Begin(ctx context.Context) (pgx.Tx, error) {
+	return r.tx, nil
+}
+
+func (r *fakeEnqueuingOutboxRepository) EnqueueOutboxMessage(ctx context.Context, tx pgx.Tx, message *repositories.OutboxMessage) error {
+	if tx != r.tx {
+		return errors.New("unexpected transaction")
+	}
+	if r.err != nil {
+		return r.err
+	}
+	r.enqueued = append(r.enqueued, message)
+	return nil
+}
+
+func TestProducerWorkerEnqueuesInOutbox(t *testing.T) {
+	t.Parallel()
+
+	logger := zerolog.Nop()
+	repo := &fakeEnqueuingOutboxRepository{tx: &fakeTx{}}
+	w := &ProducerWorker{
+		outboxRepo: repo,
+		logger:     &logger,
+		config:     &config.Config{Producer: config.ProducerConfig{Action: "create_user"}},
+		ctx:        context.Background(),
+		generate:   generateUserPayload,
+	}
+
+	// Publishing would dereference the nil RabbitMQ service
+	if err := w.produceMessage(); err != nil {
+		t.Fatalf("expected the message to be enqueued, got %v", err)
+	}
+	if len(repo.enqueued) != 1 || !repo.tx.committed {
+		t.Fatalf("expected one message enqueued in a committed transaction, got %d (committed: %t)", len(repo.enqueued), repo.tx.committed)
+	}
+
+	var message WorkerMessage
+	if err := json.Unmarshal(repo.enqueued[0].Body, &message); err != nil || message.ID != repo.enqueued[0].MessageID {
+		t.Fatalf("expected the enqueued body to be the message, got %s (%v)", repo.enqueued[0].Body, err)
+	}
+	if repo.enqueued[0].Type != "create_user" {
+		t.Fatalf("expected the action to be stored as the message type, got %q", repo.enqueued[0].Type)
+	}
+
+	repo = &fakeEnqueuingOutboxRepository{tx: &fakeTx{}, err: errors.New("insert failed")}
+	w.outboxRepo = repo
+	if err := w.produceMessage(); err == nil || !repo.tx.rolledBack {
+		t.Fatalf("expected a failed enqueue to roll the transaction back, got %v", err)
+	}
+}
+
+// hangingBroker blocks publishes until released, like a broker that stopped answering.
+type hangingBroker struct {
+	rabbitmq.MessageBroker
+	release chan struct{}
+}
+
+func (b *hangingBroker) PublishMirroredWithOptions(message []byte, opts rabbitmq.PublishOptions) error {
+	<-b.release
+	return nil
+}
+
+func TestProducerWorkerPublishTimeout(t *testing.T) {
+	t.Parallel()
+
+	logger := zerolog.Nop()
+	broker := &hangingBroker{release: make(chan struct{})}
+	w := &ProducerWorker{
+		rabbitMQ: broker,
+		logger:   &logger,
+		config:   &config.Config{Producer: config.ProducerConfig{Action: "create_user", PublishTimeout: 10 * time.Millisecond}},
+		ctx:      t.Context(),
+		generate: generateUserPayload,
+	}
+
+	if err := w.produceMessage(); !errors.Is(err, ErrPublishTimeout) {
+		t.Fatalf("expected the hanging publish to time out, got %v", err)
+	}
+	if !w.publishing.Load() {
+		t.Fatal("expected the abandoned publish to be reported in flight")
+	}
+
+	close(broker.release)
+	deadline := time.Now().Add(time.Second)
+	for w.publishing.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the publish to complete once the broker answers")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := w.produceMessage(); err != nil {
+		t.Fatalf("expected the publish to succeed once the broker answers, got %v", err)
+	}
+}
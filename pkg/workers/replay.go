@@ -0,0 +1,124 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/samber/do-template-worker/pkg/repositories"
+)
+
+// Statuses of a ProcessReport.
+const (
+	ProcessSucceeded = "succeeded"
+	ProcessFailed    = "failed"
+	// ProcessSkipped is the status of a message deliberately left unhandled, see ProcessReport.Reason.
+	ProcessSkipped = "skipped"
+)
+
+// ProcessReport is the outcome of a message run through the consumer pipeline.
+type ProcessReport struct {
+	MessageID string `json:"message_id,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Source    string `json:"source,omitempty"`
+	Status    string `json:"status"`
+	// Reason tells why a message was skipped: unaccepted source, unknown action or already processed.
+	Reason string      `json:"reason,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	DryRun bool        `json:"dry_run"`
+}
+
+// Process runs a message body through the consumer pipeline, as if it had been consumed, outside of the broker
+// The message is never acked, requeued nor dead-lettered: the outcome is returned instead, along with the
+// processing error. With dryRun, handlers run without side effects, see process.
+func (w *ConsumerWorker) Process(ctx context.Context, body []byte, dryRun bool) (ProcessReport, error) {
+	ctx = w.logger.WithContext(ctx)
+
+	report, err := w.process(ctx, amqp091.Delivery{Body: body}, dryRun)
+	report.DryRun = dryRun
+
+	return report, err
+}
+
+// dryRunUserRepository reads users from the underlying repository but discards writes
+// Writes are checked and answered as if they succeeded, so that handlers run their whole logic.
+type dryRunUserRepository struct {
+	repositories.UserRepository
+}
+
+// CreateUser returns the user as it would be created, without an ID.
+func (r dryRunUserRepository) CreateUser(ctx context.Context, user *repositories.User) (*repositories.User, error) {
+	if err := user.Validate(); err != nil {
+		return nil, err
+	}
+	if user.Status == "" {
+		user.Status = repositories.UserStatusActive
+	}
+	if !user.Status.Valid() {
+		return nil, fmt.Errorf("%w %q, expected one of: active, inactive, suspended", repositories.ErrInvalidUserStatus, user.Status)
+	}
+
+	created := *user
+	created.CreatedAt = time.Now()
+	created.UpdatedAt = created.CreatedAt
+
+	return &created, nil
+}
+
+// CreateUsers returns the users as they would be created, without IDs.
+func (r dryRunUserRepository) CreateUsers(ctx context.Context, users []*repositories.User) ([]*repositories.User, error) {
+	created := make([]*repositories.User, 0, len(users))
+	for _, user := range users {
+		user, err := r.CreateUser(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, user)
+	}
+
+	return created, nil
+}
+
+// UpdateUser returns the user as it would be updated.
+func (r dryRunUserRepository) UpdateUser(ctx context.Context, user *repositories.User) (*repositories.User, error) {
+	if err := user.Validate(); err != nil {
+		return nil, err
+	}
+
+	updated := *user
+	updated.UpdatedAt = time.Now()
+
+	return &updated, nil
+}
+
+// UpdateUserOptimistic returns the user as it would be updated, without checking for concurrent updates.
+func (r dryRunUserRepository) UpdateUserOptimistic(ctx context.Context, user *repositories.User, expectedUpdatedAt time.Time) (*repositories.User, error) {
+	return r.UpdateUser(ctx, user)
+}
+
+// DeleteUser does nothing.
+func (r dryRunUserRepository) DeleteUser(ctx context.Context, id int64) error {
+	return nil
+}
+
+// RestoreUser does nothing.
+func (r dryRunUserRepository) RestoreUser(ctx context.Context, id int64) error {
+	return nil
+}
+
+// HardDeleteUser does nothing.
+func (r dryRunUserRepository) HardDeleteUser(ctx context.Context, id int64) error {
+	return nil
+}
+
+// SetPassword does nothing.
+func (r dryRunUserRepository) SetPassword(ctx context.Context, id int64, password string) error {
+	return nil
+}
+
+// WithTx runs fn without a transaction, since writes are discarded anyway.
+func (r dryRunUserRepository) WithTx(ctx context.Context, fn func(repo repositories.UserRepository) error) error {
+	return fn(r)
+}
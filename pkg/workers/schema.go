@@ -0,0 +1,58 @@
+package workers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// ErrSchemaViolation is returned when a payload does not match the JSON Schema of its action.
+var ErrSchemaViolation = errors.New("payload violates schema")
+
+// compileSchemas compiles the JSON Schema of each action once, so that payloads are validated
+// against cached schemas. An invalid or missing schema file fails the worker at startup.
+func compileSchemas(paths map[string]string) (map[string]*jsonschema.Schema, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	compiler := jsonschema.NewCompiler()
+	schemas := make(map[string]*jsonschema.Schema, len(paths))
+
+	for action, path := range paths {
+		schema, err := compiler.Compile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile schema of action %s: %w", action, err)
+		}
+		schemas[action] = schema
+	}
+
+	return schemas, nil
+}
+
+// validatePayload checks a payload against the schema of its action
+// Actions without a schema are not validated.
+func (w *ConsumerWorker) validatePayload(action string, payload json.RawMessage) error {
+	schema, ok := w.schemas[action]
+	if !ok {
+		return nil
+	}
+
+	// A missing payload is validated as null
+	var value any
+	if len(payload) > 0 {
+		var err error
+		if value, err = jsonschema.UnmarshalJSON(bytes.NewReader(payload)); err != nil {
+			return fmt.Errorf("%w: %v", ErrSchemaViolation, err)
+		}
+	}
+
+	if err := schema.Validate(value); err != nil {
+		return fmt.Errorf("%w: %v", ErrSchemaViolation, err)
+	}
+
+	return nil
+}
@@ -1,14 +1,57 @@
 package workers
 
+import (
+	"context"
+	"encoding/json"
+)
+
+// MessageHandler handles the payload of a message for a given action
+// The payload is left encoded, so that each handler decodes it into the type of its action.
+type MessageHandler func(ctx context.Context, payload json.RawMessage) error
+
+// PayloadGenerator builds the payload of a produced message for a given action.
+type PayloadGenerator func() interface{}
+
 // WorkerMessage represents the message structure for the workers.
 type WorkerMessage struct {
-	Action  string      `json:"action"`
-	Payload interface{} `json:"payload"`
-	ID      string      `json:"id"`
+	Action  string          `json:"action"`
+	Payload json.RawMessage `json:"payload"`
+	ID      string          `json:"id"`
+	// Source is the name of the service that produced the message, empty when unknown.
+	Source string `json:"source,omitempty"`
+}
+
+// sourceContextKey is the context key of the source of the message being handled.
+type sourceContextKey struct{}
+
+// MessageSource returns the source of the message being handled, as set by the consumer in the
+// handler's context. It returns an empty string when the source is unknown.
+func MessageSource(ctx context.Context) string {
+	source, _ := ctx.Value(sourceContextKey{}).(string)
+	return source
 }
 
+// resultContextKey is the context key of the result of the message being handled.
+type resultContextKey struct{}
+
+// SetMessageResult records the result of the message being handled, such as the ID of a created
+// record. With consumer.store_results, it is stored in message_results once the handler succeeds.
+// It does nothing outside of a message handler.
+func SetMessageResult(ctx context.Context, result interface{}) {
+	if holder, ok := ctx.Value(resultContextKey{}).(*interface{}); ok {
+		*holder = result
+	}
+}
+
+// usersContextKey is the context key of the UserRepository scoped to the transaction of the message being handled.
+type usersContextKey struct{}
+
 // UserPayload represents the user data in the message.
 type UserPayload struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	// Status is one of active, inactive or suspended. Empty creates an active user.
+	Status string `json:"status,omitempty"`
 }